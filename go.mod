@@ -3,6 +3,15 @@ module github.com/twigman/fshare
 go 1.24.4
 
 require (
+	github.com/alecthomas/chroma/v2 v2.24.0
 	github.com/google/uuid v1.6.0
 	github.com/mattn/go-sqlite3 v1.14.28
+	github.com/yuin/goldmark v1.8.6
+	golang.org/x/crypto v0.48.0
+	golang.org/x/image v0.36.0
+)
+
+require (
+	github.com/dlclark/regexp2 v1.12.0 // indirect
+	golang.org/x/sys v0.41.0 // indirect
 )
@@ -3,7 +3,10 @@ package config
 import (
 	"encoding/json"
 	"errors"
+	"net"
+	"net/netip"
 	"os"
+	"time"
 )
 
 type Config struct {
@@ -11,10 +14,40 @@ type Config struct {
 	DataPath        string `json:"data_path"`
 	UploadPath      string `json:"upload_path"`
 	MaxFileSizeInMB int64  `json:"max_file_size_in_mb"` // 0 = no limit
-	//ContinuousFileValidation bool   `json:"continuous_file_validation"`
-	//SpacePerUserInMB         int    `json:"space_per_user_in_mb"`
-	AutoDeleteIntervalInSec int `json:"autodelete_interval_in_sec"`
-	//MaxFolderDepth           int    `json:"max_folder_depth"`
+	// re-hash stored files in the background and mark files with missing or changed content as broken
+	ContinuousFileValidation  bool          `json:"continuous_file_validation"`
+	ValidationIntervalInHours int           `json:"validation_interval_in_hours"`  // pause between two passes, 0 = 24h
+	ValidationRateInMBPerSec  int64         `json:"validation_rate_in_mb_per_sec"` // read rate while hashing, 0 = 10 MB/s
+	SpacePerUserInMB          int64         `json:"space_per_user_in_mb"`          // 0 = no limit
+	AutoDeleteIntervalInSec   int           `json:"autodelete_interval_in_sec"`
+	MaxFolderDepth            int           `json:"max_folder_depth"`         // 0 = no limit
+	UploadExpiryInHours       int           `json:"upload_expiry_in_hours"`   // resumable uploads, 0 = 24h
+	TrashRetentionInHours     int           `json:"trash_retention_in_hours"` // 0 = 7 days
+	MaxVersionsPerFile        int64         `json:"max_versions_per_file"`    // older versions kept per file, 0 = no limit
+	Storage                   StorageConfig `json:"storage"`
+	// reverse proxies (IPs or CIDRs) whose X-Forwarded-Host and X-Forwarded-Proto headers are used to build returned links
+	TrustedProxies []string `json:"trusted_proxies"`
+}
+
+const (
+	StorageLocal = "local"
+	StorageS3    = "s3"
+)
+
+// StorageConfig selects where the content of uploaded files is stored
+type StorageConfig struct {
+	Backend string   `json:"backend"` // "local" (default) or "s3"
+	S3      S3Config `json:"s3"`
+}
+
+// S3Config configures an S3-compatible object storage
+type S3Config struct {
+	Endpoint  string `json:"endpoint"` // e.g. https://s3.eu-central-1.amazonaws.com or http://localhost:9000
+	Region    string `json:"region"`   // default us-east-1
+	Bucket    string `json:"bucket"`
+	Prefix    string `json:"prefix"`     // optional key prefix inside the bucket
+	AccessKey string `json:"access_key"` // FSHARE_S3_ACCESS_KEY if empty
+	SecretKey string `json:"secret_key"` // FSHARE_S3_SECRET_KEY if empty
 }
 
 // LoadConfig loads the configuration from a given path.
@@ -47,9 +80,64 @@ func (c *Config) Validate() error {
 		return errors.New("upload_path is required")
 	}
 
+	// storage
+	switch c.Storage.Backend {
+	case "", StorageLocal:
+	case StorageS3:
+		if c.Storage.S3.Endpoint == "" || c.Storage.S3.Bucket == "" {
+			return errors.New("storage.s3.endpoint and storage.s3.bucket are required for the s3 backend")
+		}
+	default:
+		return errors.New("storage.backend is not valid")
+	}
+
+	// trusted_proxies
+	for _, p := range c.TrustedProxies {
+		if _, err := parseProxyPrefix(p); err != nil {
+			return errors.New("trusted_proxies contains an invalid IP or CIDR: " + p)
+		}
+	}
+
 	return nil
 }
 
+// IsTrustedProxy reports whether a request with the given remote address (host:port) comes from a trusted reverse proxy
+func (c *Config) IsTrustedProxy(remoteAddr string) bool {
+	if len(c.TrustedProxies) == 0 {
+		return false
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, p := range c.TrustedProxies {
+		prefix, err := parseProxyPrefix(p)
+		if err == nil && prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseProxyPrefix parses an entry of trusted_proxies, a single IP is a prefix of its full length
+func parseProxyPrefix(p string) (netip.Prefix, error) {
+	if addr, err := netip.ParseAddr(p); err == nil {
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	prefix, err := netip.ParsePrefix(p)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return prefix.Masked(), nil
+}
+
 func (c *Config) MaxFileSizeBytes() int64 {
 	return c.MaxFileSizeInMB << 20
 }
@@ -57,3 +145,39 @@ func (c *Config) MaxFileSizeBytes() int64 {
 func (c *Config) IsUploadLimited() bool {
 	return c.MaxFileSizeInMB > 0
 }
+
+func (c *Config) SpacePerUserBytes() int64 {
+	return c.SpacePerUserInMB << 20
+}
+
+// UploadExpiry returns how long an unfinished resumable upload is kept after its last chunk
+func (c *Config) UploadExpiry() time.Duration {
+	if c.UploadExpiryInHours <= 0 {
+		return 24 * time.Hour
+	}
+	return time.Duration(c.UploadExpiryInHours) * time.Hour
+}
+
+// ValidationInterval returns the pause between two passes of the file validation
+func (c *Config) ValidationInterval() time.Duration {
+	if c.ValidationIntervalInHours <= 0 {
+		return 24 * time.Hour
+	}
+	return time.Duration(c.ValidationIntervalInHours) * time.Hour
+}
+
+// ValidationRateBytes returns how many bytes per second the file validation reads at most
+func (c *Config) ValidationRateBytes() int64 {
+	if c.ValidationRateInMBPerSec <= 0 {
+		return 10 << 20
+	}
+	return c.ValidationRateInMBPerSec << 20
+}
+
+// TrashRetention returns how long deleted resources can be restored before they are purged
+func (c *Config) TrashRetention() time.Duration {
+	if c.TrashRetentionInHours <= 0 {
+		return 7 * 24 * time.Hour
+	}
+	return time.Duration(c.TrashRetentionInHours) * time.Hour
+}
@@ -53,6 +53,34 @@ var testConfigMap = map[string]string{
 		"upload_path": "",
 		"max_file_size_in_mb": 1
 	}`,
+	"s3Storage": `{
+		"port": 8080,
+		"upload_path": "/tmp",
+		"storage": {
+			"backend": "s3",
+			"s3": {"endpoint": "http://localhost:9000", "bucket": "fshare"}
+		}
+	}`,
+	"s3StorageNoBucket": `{
+		"port": 8080,
+		"upload_path": "/tmp",
+		"storage": {"backend": "s3", "s3": {"endpoint": "http://localhost:9000"}}
+	}`,
+	"trustedProxies": `{
+		"port": 8080,
+		"upload_path": "/tmp",
+		"trusted_proxies": ["127.0.0.1", "10.0.0.0/8", "::1"]
+	}`,
+	"invalidTrustedProxy": `{
+		"port": 8080,
+		"upload_path": "/tmp",
+		"trusted_proxies": ["proxy.local"]
+	}`,
+	"unknownStorage": `{
+		"port": 8080,
+		"upload_path": "/tmp",
+		"storage": {"backend": "ftp"}
+	}`,
 }
 
 func writeTestConfigToTempFile(t *testing.T, json string) string {
@@ -157,6 +185,11 @@ func TestValidate(t *testing.T) {
 		{"valid config 2", "valid_2", false, ""},
 		{"invalid port", "invalidPort", true, "port value is not valid"},
 		{"empty upload path", "emptyUploadPath", true, "upload_path is required"},
+		{"s3 storage", "s3Storage", false, ""},
+		{"s3 storage without bucket", "s3StorageNoBucket", true, "storage.s3.endpoint and storage.s3.bucket are required for the s3 backend"},
+		{"unknown storage", "unknownStorage", true, "storage.backend is not valid"},
+		{"trusted proxies", "trustedProxies", false, ""},
+		{"invalid trusted proxy", "invalidTrustedProxy", true, "trusted_proxies contains an invalid IP or CIDR: proxy.local"},
 	}
 
 	for _, tt := range tests {
@@ -191,3 +224,29 @@ func TestValidate(t *testing.T) {
 		})
 	}
 }
+
+func TestIsTrustedProxy(t *testing.T) {
+	cfg := &Config{TrustedProxies: []string{"127.0.0.1", "10.0.0.0/8", "::1"}}
+
+	tests := []struct {
+		remoteAddr string
+		want       bool
+	}{
+		{"127.0.0.1:1234", true},
+		{"10.1.2.3:80", true},
+		{"[::1]:8080", true},
+		{"[::ffff:127.0.0.1]:8080", true},
+		{"192.168.1.1:1234", false},
+		{"127.0.0.2:1234", false},
+		{"invalid", false},
+	}
+	for _, tt := range tests {
+		if got := cfg.IsTrustedProxy(tt.remoteAddr); got != tt.want {
+			t.Errorf("IsTrustedProxy(%q) = %v, want %v", tt.remoteAddr, got, tt.want)
+		}
+	}
+
+	if (&Config{}).IsTrustedProxy("127.0.0.1:1234") {
+		t.Error("Expected no trusted proxy without configuration")
+	}
+}
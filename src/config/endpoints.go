@@ -6,4 +6,18 @@ const (
 	EndpointDelete = "/fshare/delete/"
 	EndpointAPIKey = "/fshare/apikey"
 	EndpointView   = "/fshare/v/"
+	EndpointFolder = "/fshare/folder"
+	EndpointList   = "/fshare/list"
+	EndpointInfo   = "/fshare/info/"
+	EndpointTus    = "/fshare/tus/"
+	EndpointPut    = "/fshare/put/"
+	EndpointShare  = "/fshare/share/"
+	EndpointSign   = "/fshare/sign/"
+	EndpointThumb  = "/fshare/thumb/"
+
+	EndpointGallery = "/fshare/gallery/"
+
+	EndpointResource = "/fshare/resource/"
+
+	EndpointAPIKeyManage = "/fshare/apikey/"
 )
@@ -1,33 +1,64 @@
 package config
 
 import (
+	"bufio"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/twigman/fshare/src/internal/apperror"
 	"github.com/twigman/fshare/src/utils"
 )
 
+// LegacyHMACKeyID is the ID of a secret written by older versions, which stored a single secret without ID.
+// Signed URLs without kid parameter were created with it.
+const LegacyHMACKeyID = "0"
+
+// HMACKey is a secret used to sign URLs
+type HMACKey struct {
+	ID        string
+	Secret    string
+	ExpiresAt *time.Time // set once the key was replaced; signatures are accepted until then
+}
+
 type Env struct {
-	HMACSecret string
+	HMACSecret string // secret of the active key, used to sign new URLs
+	HMACKeyID  string // ID of the active key
+	HMACKeys   []HMACKey
+}
+
+// LookupHMACKey returns the key with the given ID if it is still valid at now
+func (e *Env) LookupHMACKey(id string, now time.Time) (HMACKey, bool) {
+	for _, k := range e.HMACKeys {
+		if k.ID == id {
+			if k.ExpiresAt != nil && !now.Before(*k.ExpiresAt) {
+				return HMACKey{}, false
+			}
+			return k, true
+		}
+	}
+	return HMACKey{}, false
+}
+
+func envPath(path string) (string, error) {
+	absPath, err := filepath.Abs(filepath.Join(path, ".env"))
+	if err != nil {
+		return "", apperror.ErrResourceResolvePath
+	}
+	return absPath, nil
 }
 
 func LoadOrCreateEnv(path string) (*Env, error) {
-	filePath := filepath.Join(path, ".env")
-	absPath, err := filepath.Abs(filePath)
+	absPath, err := envPath(path)
 	if err != nil {
-		return nil, apperror.ErrResourceResolvePath
+		return nil, err
 	}
 
 	if _, err := os.Stat(absPath); err == nil {
-		// read
-		data, err := os.ReadFile(absPath)
-		if err != nil {
-			return nil, fmt.Errorf("could not read secret file: %w", err)
-		}
-		return &Env{HMACSecret: strings.TrimSpace(string(data))}, nil
+		return readEnv(absPath)
 	}
 
 	secret, err := utils.GenerateSecret(32)
@@ -35,15 +66,130 @@ func LoadOrCreateEnv(path string) (*Env, error) {
 		return nil, err
 	}
 
-	env := &Env{HMACSecret: secret}
+	env := newEnv([]HMACKey{{ID: "1", Secret: secret}})
 
 	// save secret in file
-	if err := os.WriteFile(absPath, []byte(env.HMACSecret+"\n"), 0600); err != nil {
-		return env, fmt.Errorf("could not write secret file to: %w", err)
+	if err := writeEnv(absPath, env); err != nil {
+		return env, err
+	}
+	return env, nil
+}
+
+// RotateHMACSecret adds a new active secret. Older secrets stay valid for the grace period,
+// so outstanding signed URLs keep working until they expire. Secrets whose grace period ended are removed.
+func RotateHMACSecret(path string, grace time.Duration) (*Env, error) {
+	env, err := LoadOrCreateEnv(path)
+	if err != nil {
+		return nil, err
+	}
+	absPath, err := envPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	expiresAt := now.Add(grace).Truncate(time.Second)
+
+	var keys []HMACKey
+	maxID := 0
+	for _, k := range env.HMACKeys {
+		if id, err := strconv.Atoi(k.ID); err == nil && id > maxID {
+			maxID = id
+		}
+		if k.ExpiresAt != nil && !now.Before(*k.ExpiresAt) {
+			continue
+		}
+		if k.ExpiresAt == nil {
+			k.ExpiresAt = &expiresAt
+		}
+		keys = append(keys, k)
+	}
+
+	secret, err := utils.GenerateSecret(32)
+	if err != nil {
+		return nil, err
+	}
+	keys = append(keys, HMACKey{ID: strconv.Itoa(maxID + 1), Secret: secret})
+
+	env = newEnv(keys)
+	if err := writeEnv(absPath, env); err != nil {
+		return nil, err
 	}
 	return env, nil
 }
 
+// newEnv creates an env with the last key as active key
+func newEnv(keys []HMACKey) *Env {
+	active := keys[len(keys)-1]
+	return &Env{HMACSecret: active.Secret, HMACKeyID: active.ID, HMACKeys: keys}
+}
+
+// readEnv parses a .env file with one key per line: "<id> <secret> [<expiry in RFC 3339>]".
+// The last key is the active one. A file with a single secret and no ID was written by an older version.
+func readEnv(absPath string) (*Env, error) {
+	data, err := os.ReadFile(absPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read secret file: %w", err)
+	}
+
+	var keys []HMACKey
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		switch len(fields) {
+		case 1:
+			keys = append(keys, HMACKey{ID: LegacyHMACKeyID, Secret: fields[0]})
+		case 2:
+			keys = append(keys, HMACKey{ID: fields[0], Secret: fields[1]})
+		case 3:
+			t, err := time.Parse(time.RFC3339, fields[2])
+			if err != nil {
+				return nil, fmt.Errorf("invalid expiry of secret %s: %w", fields[0], err)
+			}
+			keys = append(keys, HMACKey{ID: fields[0], Secret: fields[1], ExpiresAt: &t})
+		default:
+			return nil, fmt.Errorf("invalid line in secret file")
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("secret file %s contains no secret", absPath)
+	}
+	if keys[len(keys)-1].ExpiresAt != nil {
+		return nil, fmt.Errorf("the last secret in %s must not expire", absPath)
+	}
+	return newEnv(keys), nil
+}
+
+// writeEnv replaces the .env file atomically, so a crash never leaves it without secrets
+func writeEnv(absPath string, env *Env) error {
+	var b strings.Builder
+	b.WriteString("# secrets to sign URLs: <id> <secret> [<expiry>]\n")
+	b.WriteString("# the last one signs new URLs, the others are accepted until their expiry\n")
+	for _, k := range env.HMACKeys {
+		if k.ExpiresAt != nil {
+			fmt.Fprintf(&b, "%s %s %s\n", k.ID, k.Secret, k.ExpiresAt.UTC().Format(time.RFC3339))
+		} else {
+			fmt.Fprintf(&b, "%s %s\n", k.ID, k.Secret)
+		}
+	}
+
+	tmpPath := absPath + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(b.String()), 0o600); err != nil {
+		return fmt.Errorf("could not write secret file to: %w", err)
+	}
+	if err := os.Rename(tmpPath, absPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("could not write secret file to: %w", err)
+	}
+	return nil
+}
+
 func CreateInitDataEnv(path string, data string) (string, error) {
 	filePath := filepath.Join(path, "init_data.env")
 	absPath, err := filepath.Abs(filePath)
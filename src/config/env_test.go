@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/twigman/fshare/src/config"
 )
@@ -28,9 +29,16 @@ func TestLoadOrCreateEnv_CreateNew(t *testing.T) {
 	if err != nil {
 		t.Fatalf("expected file to be created, got error %v", err)
 	}
-	content := strings.TrimSpace(string(data))
-	if content != env.HMACSecret {
-		t.Errorf("expected file content to match HMACSecret, got %s", content)
+	if !strings.Contains(string(data), env.HMACKeyID+" "+env.HMACSecret) {
+		t.Errorf("expected file content to contain the active key, got %s", data)
+	}
+
+	reloaded, err := config.LoadOrCreateEnv(dir)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if reloaded.HMACSecret != env.HMACSecret || reloaded.HMACKeyID != env.HMACKeyID {
+		t.Errorf("expected reloaded key %s, got %s", env.HMACKeyID, reloaded.HMACKeyID)
 	}
 }
 
@@ -50,6 +58,67 @@ func TestLoadOrCreateEnv_LoadExisting(t *testing.T) {
 	if env.HMACSecret != secret {
 		t.Errorf("expected %s, got %s", secret, env.HMACSecret)
 	}
+	if env.HMACKeyID != config.LegacyHMACKeyID {
+		t.Errorf("expected key ID %s, got %s", config.LegacyHMACKeyID, env.HMACKeyID)
+	}
+}
+
+func TestRotateHMACSecret(t *testing.T) {
+	dir := t.TempDir()
+	old, err := config.LoadOrCreateEnv(dir)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	env, err := config.RotateHMACSecret(dir, time.Hour)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if env.HMACKeyID == old.HMACKeyID || env.HMACSecret == old.HMACSecret {
+		t.Fatalf("expected a new active key, got %s", env.HMACKeyID)
+	}
+
+	now := time.Now()
+	key, ok := env.LookupHMACKey(old.HMACKeyID, now)
+	if !ok || key.Secret != old.HMACSecret {
+		t.Fatalf("expected old key to be valid during the grace period")
+	}
+	if _, ok := env.LookupHMACKey(old.HMACKeyID, now.Add(2*time.Hour)); ok {
+		t.Error("expected old key to be rejected after the grace period")
+	}
+	if _, ok := env.LookupHMACKey(env.HMACKeyID, now.Add(2*time.Hour)); !ok {
+		t.Error("expected active key to be valid")
+	}
+
+	reloaded, err := config.LoadOrCreateEnv(dir)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if reloaded.HMACKeyID != env.HMACKeyID || len(reloaded.HMACKeys) != 2 {
+		t.Errorf("expected active key %s and 2 keys, got %s and %d", env.HMACKeyID, reloaded.HMACKeyID, len(reloaded.HMACKeys))
+	}
+}
+
+func TestRotateHMACSecret_DropsExpiredKeys(t *testing.T) {
+	dir := t.TempDir()
+	content := "1 expired-secret 2000-01-01T00:00:00Z\n2 active-secret\n"
+	if err := os.WriteFile(filepath.Join(dir, ".env"), []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	env, err := config.RotateHMACSecret(dir, time.Hour)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if env.HMACKeyID != "3" {
+		t.Errorf("expected key ID 3, got %s", env.HMACKeyID)
+	}
+	if len(env.HMACKeys) != 2 {
+		t.Errorf("expected 2 keys, got %d", len(env.HMACKeys))
+	}
+	if _, ok := env.LookupHMACKey("1", time.Now()); ok {
+		t.Error("expected expired key to be removed")
+	}
 }
 
 func TestCreateInitDataEnv_CreatesFile(t *testing.T) {
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/twigman/fshare/src/config"
+	"github.com/twigman/fshare/src/storage"
+	"github.com/twigman/fshare/src/store"
+)
+
+// runFsck compares upload folder and db, prints the differences and optionally repairs them.
+// It exits with status 1 if findings are left that were not repaired.
+func runFsck(args []string) {
+	fs := flag.NewFlagSet("fsck", flag.ExitOnError)
+	flagConfigPath := fs.String("config", "", "config file path")
+	flagImportOrphans := fs.Bool("import-orphans", false, "save files in home dirs that are unknown to the db as private files of the API key")
+	flagMarkMissing := fs.Bool("mark-missing", false, "mark files whose content does not exist as broken")
+	flagDeleteLeftovers := fs.Bool("delete-leftovers", false, "delete stale temp files and unreferenced blobs")
+	flagRepair := fs.Bool("repair", false, "do all repairs")
+	fs.Parse(args)
+
+	if *flagConfigPath == "" {
+		log.Fatalf("Please provide a config file using the parameter --config.")
+	}
+
+	cfg, err := config.LoadConfig(*flagConfigPath)
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+	if err = cfg.Validate(); err != nil {
+		log.Fatalf("Config validation error: %v", err)
+	}
+
+	db, err := store.NewDB(cfg.DataPath)
+	if err != nil {
+		log.Fatalf("Error loading sqlite: %v", err)
+	}
+	backend, err := storage.New(cfg)
+	if err != nil {
+		log.Fatalf("Error initializing storage backend: %v", err)
+	}
+	if cfg.Storage.Backend == config.StorageS3 {
+		if err := storage.ClaimOwnership(backend, cfg.DataPath); err != nil {
+			log.Fatalf("Error claiming storage: %v", err)
+		}
+	}
+	rs := store.NewResourceServiceWithStorage(cfg, db, backend)
+
+	report, err := rs.Fsck(store.FsckOptions{
+		ImportOrphans:   *flagImportOrphans || *flagRepair,
+		MarkMissing:     *flagMarkMissing || *flagRepair,
+		DeleteLeftovers: *flagDeleteLeftovers || *flagRepair,
+	})
+	if err != nil {
+		log.Fatalf("fsck error: %v", err)
+	}
+
+	printFsckSection("Orphaned files", report.OrphanedFiles)
+	printFsckSection("Orphaned blobs", report.OrphanedBlobs)
+	printFsckSection("Files with missing content", report.MissingFiles)
+	printFsckSection("Stale temp files", report.StaleTempFiles)
+	printFsckSection("Imported files", report.Imported)
+	printFsckSection("Marked as broken", report.MarkedBroken)
+	printFsckSection("Deleted", report.Deleted)
+	printFsckSection("Errors", report.Errors)
+
+	if report.Unrepaired() {
+		os.Exit(1)
+	}
+	fmt.Println("No unrepaired findings")
+}
+
+func printFsckSection(title string, entries []string) {
+	if len(entries) == 0 {
+		return
+	}
+	fmt.Printf("%s (%d):\n", title, len(entries))
+	for _, e := range entries {
+		fmt.Printf("  %s\n", e)
+	}
+}
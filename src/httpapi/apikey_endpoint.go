@@ -4,8 +4,13 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/twigman/fshare/src/config"
 	"github.com/twigman/fshare/src/internal/apperror"
+	"github.com/twigman/fshare/src/store"
+	"github.com/twigman/fshare/src/utils"
 )
 
 func (s *RESTService) CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
@@ -36,8 +41,24 @@ func (s *RESTService) CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	key, err := s.apiKeyService.AddAPIKey(req.Key, req.Comment, req.HighlyTrusted, &keyUUID)
-	if err != nil {
+	if req.SpaceLimit != nil && *req.SpaceLimit < 0 {
+		writeJSONStatus(w, http.StatusBadRequest, apperror.ErrInvalidSpaceLimit.Msg)
+		return
+	}
+	if req.MaxVersions != nil && *req.MaxVersions < 0 {
+		writeJSONStatus(w, http.StatusBadRequest, apperror.ErrInvalidMaxVersions.Msg)
+		return
+	}
+
+	key := &store.APIKey{
+		Comment:         req.Comment,
+		IsHighlyTrusted: req.HighlyTrusted,
+		CreatedBy:       &keyUUID,
+		ExpiresAt:       req.ExpiresAt,
+		SpaceLimitInMB:  req.SpaceLimit,
+		MaxVersions:     req.MaxVersions,
+	}
+	if err := s.apiKeyService.CreateAPIKey(req.Key, key); err != nil {
 		if err == apperror.ErrCharsNotAllowed || err == apperror.ErrEmptyAPIKey {
 			writeJSONStatus(w, http.StatusBadRequest, "Could not create API key")
 			return
@@ -53,12 +74,226 @@ func (s *RESTService) CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	res := APIKeyResponse{
+	writeJSONResponse(w, http.StatusCreated, newAPIKeyResponse(key))
+}
+
+// APIKeyHandler dispatches requests to /fshare/apikey by method
+func (s *RESTService) APIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		s.ListAPIKeysHandler(w, r)
+		return
+	}
+	s.CreateAPIKeyHandler(w, r)
+}
+
+// ListAPIKeysHandler lists all API keys created by the requesting highly trusted key
+func (s *RESTService) ListAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONStatus(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	keyUUID, err := s.authorizeBearer(w, r)
+	if err != nil {
+		return
+	}
+
+	trusted, err := s.apiKeyService.IsAPIKeyHighlyTrusted(keyUUID)
+	if err != nil {
+		writeJSONStatus(w, http.StatusInternalServerError, "Auth error")
+		return
+	}
+	if !trusted {
+		writeJSONStatus(w, http.StatusForbidden, "Not authorized to list API keys")
+		return
+	}
+
+	keys, err := s.apiKeyService.ListAPIKeysCreatedBy(keyUUID)
+	if err != nil {
+		writeJSONStatus(w, http.StatusInternalServerError, "Could not list API keys")
+		return
+	}
+
+	res := make([]APIKeyResponse, 0, len(keys))
+	for _, k := range keys {
+		res = append(res, newAPIKeyResponse(k))
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+// ManageAPIKeyHandler handles DELETE /fshare/apikey/<uuid> (revoke) and POST /fshare/apikey/<uuid>/rotate
+func (s *RESTService) ManageAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	target := strings.TrimPrefix(r.URL.Path, config.EndpointAPIKeyManage)
+	targetUUID, action, _ := strings.Cut(target, "/")
+
+	switch {
+	case action == "" && r.Method == http.MethodDelete:
+		s.revokeAPIKey(w, r, targetUUID)
+	case action == "rotate" && r.Method == http.MethodPost:
+		s.rotateAPIKey(w, r, targetUUID)
+	case action == "" || action == "rotate":
+		writeJSONStatus(w, http.StatusMethodNotAllowed, "Method not allowed")
+	default:
+		writeJSONStatus(w, http.StatusNotFound, "Not found")
+	}
+}
+
+// authorizeKeyManagement authorizes the requester and loads the target key.
+// Only the highly trusted creator of a key may manage it; a key may rotate itself if allowSelf is set.
+func (s *RESTService) authorizeKeyManagement(w http.ResponseWriter, r *http.Request, targetUUID string, allowSelf bool) (string, *store.APIKey, error) {
+	keyUUID, err := s.authorizeBearer(w, r)
+	if err != nil {
+		return "", nil, err
+	}
+
+	target, err := s.apiKeyService.GetAPIKeyByUUID(targetUUID)
+	if err != nil {
+		if err == apperror.ErrAPIKeyNotFound {
+			writeJSONStatus(w, http.StatusNotFound, apperror.ErrAPIKeyNotFound.Msg)
+			return "", nil, err
+		}
+		writeJSONStatus(w, http.StatusInternalServerError, "Auth error")
+		return "", nil, err
+	}
+
+	if allowSelf && target.UUID == keyUUID {
+		return keyUUID, target, nil
+	}
+
+	trusted, err := s.apiKeyService.IsAPIKeyHighlyTrusted(keyUUID)
+	if err != nil {
+		writeJSONStatus(w, http.StatusInternalServerError, "Auth error")
+		return "", nil, err
+	}
+
+	if !trusted || target.CreatedBy == nil || *target.CreatedBy != keyUUID {
+		// do not reveal keys of others
+		writeJSONStatus(w, http.StatusNotFound, apperror.ErrAPIKeyNotFound.Msg)
+		return "", nil, apperror.ErrAuthorization
+	}
+	return keyUUID, target, nil
+}
+
+func (s *RESTService) revokeAPIKey(w http.ResponseWriter, r *http.Request, targetUUID string) {
+	keyUUID, target, err := s.authorizeKeyManagement(w, r, targetUUID, false)
+	if err != nil {
+		return
+	}
+
+	if target.RevokedAt != nil {
+		writeJSONStatus(w, apperror.ErrAPIKeyRevoked.Code, apperror.ErrAPIKeyRevoked.Msg)
+		return
+	}
+
+	policy := store.RevokePolicy(r.URL.Query().Get("policy"))
+	if policy == "" {
+		policy = store.RevokePolicyKeep
+	}
+
+	transferTo := ""
+	switch policy {
+	case store.RevokePolicyKeep, store.RevokePolicyDelete:
+	case store.RevokePolicyTransfer:
+		transferTo = r.URL.Query().Get("transfer_to")
+		if transferTo == "" {
+			transferTo = keyUUID
+		}
+		if transferTo == target.UUID {
+			writeJSONStatus(w, http.StatusBadRequest, apperror.ErrInvalidRevokePolicy.Msg)
+			return
+		}
+		if transferTo != keyUUID {
+			// only to active keys the requester is responsible for
+			k, err := s.apiKeyService.GetAPIKeyByUUID(transferTo)
+			if err != nil || k.CreatedBy == nil || *k.CreatedBy != keyUUID || !k.IsActive(time.Now().UTC()) {
+				writeJSONStatus(w, http.StatusBadRequest, apperror.ErrInvalidRevokePolicy.Msg)
+				return
+			}
+		}
+	default:
+		writeJSONStatus(w, http.StatusBadRequest, apperror.ErrInvalidRevokePolicy.Msg)
+		return
+	}
+
+	// revoke first, so the key can not be used while its resources are processed
+	if err := s.apiKeyService.RevokeAPIKey(target.UUID); err != nil {
+		if err == apperror.ErrAPIKeyRevoked {
+			writeJSONStatus(w, apperror.ErrAPIKeyRevoked.Code, apperror.ErrAPIKeyRevoked.Msg)
+			return
+		}
+		writeJSONStatus(w, http.StatusInternalServerError, "Could not revoke API key")
+		return
+	}
+
+	switch policy {
+	case store.RevokePolicyDelete:
+		err = s.resourceService.DeleteAllResources(target.UUID)
+	case store.RevokePolicyTransfer:
+		err = s.resourceService.TransferResources(target.UUID, transferTo)
+	}
+
+	if err != nil {
+		log.Printf("API key %s was revoked, but its resources could not be processed (policy %q): %v", target.UUID, policy, err)
+		writeJSONStatus(w, http.StatusInternalServerError, "API key revoked, but its resources could not be processed")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *RESTService) rotateAPIKey(w http.ResponseWriter, r *http.Request, targetUUID string) {
+	_, _, err := s.authorizeKeyManagement(w, r, targetUUID, true)
+	if err != nil {
+		return
+	}
+
+	var req APIKeyRotateRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONStatus(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	generated := req.Key == ""
+	if generated {
+		req.Key, err = utils.GenerateSecret(32)
+		if err != nil {
+			writeJSONStatus(w, http.StatusInternalServerError, "Could not rotate API key")
+			return
+		}
+	}
+
+	key, err := s.apiKeyService.RotateAPIKey(targetUUID, req.Key)
+	if err != nil {
+		if err == apperror.ErrCharsNotAllowed || err == apperror.ErrEmptyAPIKey {
+			writeJSONStatus(w, http.StatusBadRequest, "Could not rotate API key")
+			return
+		} else if err == apperror.ErrAPIKeyRevoked {
+			writeJSONStatus(w, apperror.ErrAPIKeyRevoked.Code, apperror.ErrAPIKeyRevoked.Msg)
+			return
+		}
+		writeJSONStatus(w, http.StatusInternalServerError, "Could not rotate API key")
+		return
+	}
+
+	res := newAPIKeyResponse(key)
+	if generated {
+		res.Key = req.Key
+	}
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func newAPIKeyResponse(key *store.APIKey) APIKeyResponse {
+	return APIKeyResponse{
 		UUID:          key.UUID,
 		Comment:       key.Comment,
 		HighlyTrusted: key.IsHighlyTrusted,
+		SpaceLimit:    key.SpaceLimitInMB,
+		MaxVersions:   key.MaxVersions,
 		CreatedAt:     key.CreatedAt,
+		ExpiresAt:     key.ExpiresAt,
+		RevokedAt:     key.RevokedAt,
 	}
-
-	writeJSONResponse(w, http.StatusCreated, res)
 }
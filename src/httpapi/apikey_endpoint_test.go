@@ -0,0 +1,349 @@
+package httpapi_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/twigman/fshare/src/config"
+	"github.com/twigman/fshare/src/httpapi"
+	"github.com/twigman/fshare/src/store"
+	"github.com/twigman/fshare/src/testutil/fake"
+)
+
+func setupAPIKeyTest(t *testing.T, highlyTrusted bool) (*httpapi.RESTService, *store.APIKeyService, *store.ResourceService, *store.APIKey) {
+	t.Helper()
+	dataDir := t.TempDir()
+	cfg := &config.Config{
+		DataPath:   dataDir,
+		UploadPath: filepath.Join(dataDir, "upload"),
+		Port:       8080,
+	}
+
+	as, rs, restService, err := httpapi.InitTestServices(cfg)
+	if err != nil {
+		t.Fatalf("Can not initialize test services: %v", err)
+	}
+
+	if err := store.CreateDirsFromConfig(cfg); err != nil {
+		t.Fatalf("Can not create app dirs: %v", err)
+	}
+
+	key, err := as.AddAPIKey("admin", "admin key", highlyTrusted, nil)
+	if err != nil {
+		t.Fatalf("Can not add API key: %v", err)
+	}
+
+	return restService, as, rs, key
+}
+
+func TestCreateAPIKeyHandler_SpaceLimit(t *testing.T) {
+	restService, _, rs, _ := setupAPIKeyTest(t, true)
+
+	body := `{"key": "ci-key", "comment": "ci", "space_limit_in_mb": 100}`
+	req := httptest.NewRequest(http.MethodPost, config.EndpointAPIKey, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer admin")
+	w := httptest.NewRecorder()
+
+	restService.CreateAPIKeyHandler(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	var res httpapi.APIKeyResponse
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	if res.SpaceLimit == nil || *res.SpaceLimit != 100 {
+		t.Fatalf("Expected space limit 100, got %v", res.SpaceLimit)
+	}
+
+	limit, err := rs.SpaceLimitBytes(res.UUID)
+	if err != nil {
+		t.Fatalf("Could not read space limit: %v", err)
+	}
+	if limit != 100<<20 {
+		t.Errorf("Expected %d bytes limit, got %d", 100<<20, limit)
+	}
+}
+
+func TestCreateAPIKeyHandler_NegativeSpaceLimit(t *testing.T) {
+	restService, _, _, _ := setupAPIKeyTest(t, true)
+
+	body := `{"key": "ci-key", "space_limit_in_mb": -1}`
+	req := httptest.NewRequest(http.MethodPost, config.EndpointAPIKey, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer admin")
+	w := httptest.NewRecorder()
+
+	restService.CreateAPIKeyHandler(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestCreateAPIKeyHandler_NotTrusted(t *testing.T) {
+	restService, _, _, _ := setupAPIKeyTest(t, false)
+
+	body := `{"key": "ci-key"}`
+	req := httptest.NewRequest(http.MethodPost, config.EndpointAPIKey, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer admin")
+	w := httptest.NewRecorder()
+
+	restService.CreateAPIKeyHandler(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, w.Code)
+	}
+}
+
+func addChildKey(t *testing.T, as *store.APIKeyService, rs *store.ResourceService, secret string, creator *store.APIKey) *store.APIKey {
+	t.Helper()
+	key, err := as.AddAPIKey(secret, secret, false, &creator.UUID)
+	if err != nil {
+		t.Fatalf("Can not add API key: %v", err)
+	}
+	if _, err := rs.GetOrCreateHomeDir(key.HashedKey); err != nil {
+		t.Fatalf("Can not create home dir: %v", err)
+	}
+	return key
+}
+
+func manageAPIKey(restService *httpapi.RESTService, method string, path string, apiKey string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	w := httptest.NewRecorder()
+	restService.ManageAPIKeyHandler(w, req)
+	return w
+}
+
+func TestListAPIKeysHandler(t *testing.T) {
+	restService, as, rs, admin := setupAPIKeyTest(t, true)
+	child := addChildKey(t, as, rs, "child", admin)
+	if _, err := as.AddAPIKey("other", "other", false, nil); err != nil {
+		t.Fatalf("Can not add API key: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, config.EndpointAPIKey, nil)
+	req.Header.Set("Authorization", "Bearer admin")
+	w := httptest.NewRecorder()
+
+	restService.APIKeyHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var res []httpapi.APIKeyResponse
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	if len(res) != 1 || res[0].UUID != child.UUID {
+		t.Fatalf("Expected only key %s, got %+v", child.UUID, res)
+	}
+	if res[0].Key != "" {
+		t.Errorf("Secret must not be listed")
+	}
+}
+
+func TestManageAPIKeyHandler_RevokeKeep(t *testing.T) {
+	restService, as, rs, admin := setupAPIKeyTest(t, true)
+	child := addChildKey(t, as, rs, "child", admin)
+
+	w := manageAPIKey(restService, http.MethodDelete, config.EndpointAPIKeyManage+child.UUID, "admin")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+
+	uuid, err := as.GetUUIDForAPIKey("child")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if uuid != "" {
+		t.Errorf("Revoked key is still valid")
+	}
+
+	// revoked key can not be used anymore
+	w = manageAPIKey(restService, http.MethodPost, config.EndpointAPIKeyManage+child.UUID+"/rotate", "child")
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	w = manageAPIKey(restService, http.MethodDelete, config.EndpointAPIKeyManage+child.UUID, "admin")
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status %d, got %d", http.StatusConflict, w.Code)
+	}
+}
+
+func TestManageAPIKeyHandler_RevokeDelete(t *testing.T) {
+	restService, as, rs, admin := setupAPIKeyTest(t, true)
+	child := addChildKey(t, as, rs, "child", admin)
+
+	fileUUID, err := rs.SaveUploadedFile(&fake.FakeMultipartFile{Reader: bytes.NewReader([]byte("data"))}, &store.Resource{Name: "a.txt", APIKeyUUID: child.UUID}, false)
+	if err != nil {
+		t.Fatalf("Can not save file: %v", err)
+	}
+
+	w := manageAPIKey(restService, http.MethodDelete, config.EndpointAPIKeyManage+child.UUID+"?policy=delete", "admin")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+
+	r, err := rs.GetResourceByUUID(fileUUID)
+	if err != nil {
+		t.Fatalf("Can not load resource: %v", err)
+	}
+	if r.DeletedAt == nil {
+		t.Errorf("Expected resource to be deleted")
+	}
+}
+
+func TestManageAPIKeyHandler_RevokeTransfer(t *testing.T) {
+	restService, as, rs, admin := setupAPIKeyTest(t, true)
+	if _, err := rs.GetOrCreateHomeDir(admin.HashedKey); err != nil {
+		t.Fatalf("Can not create home dir: %v", err)
+	}
+	child := addChildKey(t, as, rs, "child", admin)
+
+	fileUUID, err := rs.SaveUploadedFile(&fake.FakeMultipartFile{Reader: bytes.NewReader([]byte("data"))}, &store.Resource{Name: "a.txt", APIKeyUUID: child.UUID}, false)
+	if err != nil {
+		t.Fatalf("Can not save file: %v", err)
+	}
+
+	// target must be managed by the requester
+	other, err := as.AddAPIKey("other", "other", false, nil)
+	if err != nil {
+		t.Fatalf("Can not add API key: %v", err)
+	}
+	w := manageAPIKey(restService, http.MethodDelete, config.EndpointAPIKeyManage+child.UUID+"?policy=transfer&transfer_to="+other.UUID, "admin")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	w = manageAPIKey(restService, http.MethodDelete, config.EndpointAPIKeyManage+child.UUID+"?policy=transfer", "admin")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+
+	r, err := rs.GetResourceByUUID(fileUUID)
+	if err != nil {
+		t.Fatalf("Can not load resource: %v", err)
+	}
+	if r.APIKeyUUID != admin.UUID || r.DeletedAt != nil {
+		t.Errorf("Expected active resource owned by %s, got %+v", admin.UUID, r)
+	}
+}
+
+func TestManageAPIKeyHandler_RevokeNotCreator(t *testing.T) {
+	restService, as, _, _ := setupAPIKeyTest(t, true)
+	other, err := as.AddAPIKey("other", "other", false, nil)
+	if err != nil {
+		t.Fatalf("Can not add API key: %v", err)
+	}
+
+	w := manageAPIKey(restService, http.MethodDelete, config.EndpointAPIKeyManage+other.UUID, "admin")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestManageAPIKeyHandler_InvalidPolicy(t *testing.T) {
+	restService, as, rs, admin := setupAPIKeyTest(t, true)
+	child := addChildKey(t, as, rs, "child", admin)
+
+	w := manageAPIKey(restService, http.MethodDelete, config.EndpointAPIKeyManage+child.UUID+"?policy=shred", "admin")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	// key must still be valid
+	uuid, err := as.GetUUIDForAPIKey("child")
+	if err != nil || uuid != child.UUID {
+		t.Errorf("Expected key to stay valid, got %q, %v", uuid, err)
+	}
+}
+
+func TestManageAPIKeyHandler_Rotate(t *testing.T) {
+	restService, as, rs, admin := setupAPIKeyTest(t, true)
+	child := addChildKey(t, as, rs, "child", admin)
+
+	// self rotation with generated secret
+	w := manageAPIKey(restService, http.MethodPost, config.EndpointAPIKeyManage+child.UUID+"/rotate", "child")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var res httpapi.APIKeyResponse
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	if res.UUID != child.UUID || res.Key == "" {
+		t.Fatalf("Unexpected response: %+v", res)
+	}
+
+	uuid, err := as.GetUUIDForAPIKey(res.Key)
+	if err != nil || uuid != child.UUID {
+		t.Fatalf("New secret is not valid: %q, %v", uuid, err)
+	}
+	uuid, _ = as.GetUUIDForAPIKey("child")
+	if uuid != "" {
+		t.Errorf("Old secret is still valid")
+	}
+
+	// rotation by creator with chosen secret
+	req := httptest.NewRequest(http.MethodPost, config.EndpointAPIKeyManage+child.UUID+"/rotate", strings.NewReader(`{"key": "child-2"}`))
+	req.Header.Set("Authorization", "Bearer admin")
+	w = httptest.NewRecorder()
+	restService.ManageAPIKeyHandler(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	uuid, _ = as.GetUUIDForAPIKey("child-2")
+	if uuid != child.UUID {
+		t.Errorf("Chosen secret is not valid")
+	}
+}
+
+func TestCreateAPIKeyHandler_ExpiredKeyUnauthorized(t *testing.T) {
+	restService, as, _, _ := setupAPIKeyTest(t, true)
+
+	body := `{"key": "ci-key", "expires_at": "2000-01-01T00:00:00Z"}`
+	req := httptest.NewRequest(http.MethodPost, config.EndpointAPIKey, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer admin")
+	w := httptest.NewRecorder()
+
+	restService.CreateAPIKeyHandler(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	var res httpapi.APIKeyResponse
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	if res.ExpiresAt == nil {
+		t.Fatalf("Expected expires_at in response")
+	}
+
+	uuid, err := as.GetUUIDForAPIKey("ci-key")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if uuid != "" {
+		t.Errorf("Expired key is still valid")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, config.EndpointList, nil)
+	req.Header.Set("Authorization", "Bearer ci-key")
+	w = httptest.NewRecorder()
+	restService.ListResourcesHandler(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
@@ -0,0 +1,84 @@
+package httpapi
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// password attempts per client IP and per link within passwordAttemptWindow
+	passwordAttemptsPerIP   = 10
+	passwordAttemptsPerLink = 30
+	passwordAttemptWindow   = 10 * time.Minute
+)
+
+// attemptLimiter counts attempts per key in fixed time windows
+type attemptLimiter struct {
+	mu        sync.Mutex
+	limit     int
+	window    time.Duration
+	windows   map[string]*attemptWindow
+	lastSweep time.Time
+}
+
+type attemptWindow struct {
+	start time.Time
+	count int
+}
+
+func newAttemptLimiter(limit int, window time.Duration) *attemptLimiter {
+	return &attemptLimiter{
+		limit:   limit,
+		window:  window,
+		windows: make(map[string]*attemptWindow),
+	}
+}
+
+// allow records an attempt for the key and reports whether it is within the limit.
+// If not, it also returns the time until the next attempt is allowed.
+func (l *attemptLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// forget windows that ended, so the map only holds recently used keys
+	if now.Sub(l.lastSweep) > l.window {
+		for k, w := range l.windows {
+			if now.Sub(w.start) >= l.window {
+				delete(l.windows, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	w, ok := l.windows[key]
+	if !ok || now.Sub(w.start) >= l.window {
+		w = &attemptWindow{start: now}
+		l.windows[key] = w
+	}
+	if w.count >= l.limit {
+		return false, w.start.Add(l.window).Sub(now)
+	}
+	w.count++
+	return true, 0
+}
+
+// clientIP returns the IP of the client. Behind a trusted proxy it is the last address the proxy added to X-Forwarded-For.
+func (s *RESTService) clientIP(r *http.Request) string {
+	if s.config.IsTrustedProxy(r.RemoteAddr) {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			parts := strings.Split(fwd, ",")
+			if ip := strings.TrimSpace(parts[len(parts)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
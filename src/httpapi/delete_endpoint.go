@@ -20,7 +20,12 @@ func (s *RESTService) DeleteHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	rUUID := strings.TrimPrefix(r.URL.Path, config.EndpointDelete)
-	err = s.resourceService.DeleteResourceByUUID(rUUID, keyUUID)
+	if r.URL.Query().Get("permanent") == "true" {
+		// skip the trash, also used to empty it
+		err = s.resourceService.PurgeResourceByUUID(rUUID, keyUUID)
+	} else {
+		err = s.resourceService.DeleteResourceByUUID(rUUID, keyUUID)
+	}
 	if err != nil {
 		if err == apperror.ErrDeleteHomeDirNotAllowed {
 			writeJSONStatus(w, http.StatusForbidden, "No permission to delete this object")
@@ -39,7 +39,7 @@ func TestDeleteHandler_Success(t *testing.T) {
 	const filename = "test.txt"
 	const isPrivate = true
 	const keyHighlyTrusted = false
-	restService, rs, _, key, cfg, fileUUID, err := httpapi.SetupExistingTestUpload(dataDir, apiKey, filename, isPrivate, keyHighlyTrusted)
+	restService, rs, _, _, _, fileUUID, err := httpapi.SetupExistingTestUpload(dataDir, apiKey, filename, isPrivate, keyHighlyTrusted)
 	if err != nil {
 		t.Errorf("Test setup error: %v", err)
 	}
@@ -65,14 +65,64 @@ func TestDeleteHandler_Success(t *testing.T) {
 		t.Errorf("Wrong resource: %v", err)
 	}
 
-	if r.DeletedAt == nil {
-		t.Errorf("resource not marked as deleted: %v", err)
+	if r.DeletedAt == nil || !r.InTrash {
+		t.Errorf("resource not moved into the trash: %v", err)
 	}
-	// check file
-	_, err = os.Stat(filepath.Join(cfg.UploadPath, key.HashedKey, filename))
-	if os.IsExist(err) {
+	// the file is kept until the trash is purged
+	filePath, err := rs.BuildResourcePath(r)
+	if err != nil {
+		t.Fatalf("Path error: %v", err)
+	}
+	if _, err := os.Stat(filePath); err != nil {
+		t.Errorf("Testfile of trashed resource was removed: %v", err)
+	}
+}
+
+func TestDeleteHandler_Permanent(t *testing.T) {
+	dataDir := t.TempDir()
+	restService, rs, _, _, _, fileUUID, err := httpapi.SetupExistingTestUpload(dataDir, "123", "test.txt", true, false)
+	if err != nil {
+		t.Fatalf("Test setup error: %v", err)
+	}
+	r, err := rs.GetResourceByUUID(fileUUID)
+	if err != nil {
+		t.Fatalf("Resource does not exist: %v", err)
+	}
+	filePath, err := rs.BuildResourcePath(r)
+	if err != nil {
+		t.Fatalf("Path error: %v", err)
+	}
+
+	// first into the trash, then empty it
+	for _, target := range []string{fileUUID, fileUUID + "?permanent=true"} {
+		req := httptest.NewRequest(http.MethodDelete, config.EndpointDelete+target, nil)
+		req.Header.Set("Authorization", "Bearer 123")
+		rr := httptest.NewRecorder()
+		restService.DeleteHandler(rr, req)
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("expected %d, got %d", http.StatusNoContent, rr.Code)
+		}
+	}
+
+	r, err = rs.GetResourceByUUID(fileUUID)
+	if err != nil {
+		t.Fatalf("Resource does not exist: %v", err)
+	}
+	if r.DeletedAt == nil || r.InTrash {
+		t.Errorf("resource not purged: %+v", r)
+	}
+	if _, err := os.Stat(filePath); !os.IsNotExist(err) {
 		t.Errorf("Testfile still exists: %v", err)
 	}
+
+	// purged resources can not be deleted again
+	req := httptest.NewRequest(http.MethodDelete, config.EndpointDelete+fileUUID+"?permanent=true", nil)
+	req.Header.Set("Authorization", "Bearer 123")
+	rr := httptest.NewRecorder()
+	restService.DeleteHandler(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected %d, got %d", http.StatusNotFound, rr.Code)
+	}
 }
 
 func TestDeleteHandler_WrongKey(t *testing.T) {
@@ -209,7 +259,7 @@ func TestDeleteHandler_TwoTimes(t *testing.T) {
 	const filename = "test.txt"
 	const isPrivate = true
 	const keyHighlyTrusted = false
-	restService, rs, _, key, cfg, fileUUID, err := httpapi.SetupExistingTestUpload(dataDir, apiKey, filename, isPrivate, keyHighlyTrusted)
+	restService, rs, _, _, _, fileUUID, err := httpapi.SetupExistingTestUpload(dataDir, apiKey, filename, isPrivate, keyHighlyTrusted)
 	if err != nil {
 		t.Errorf("Test setup error: %v", err)
 	}
@@ -235,13 +285,8 @@ func TestDeleteHandler_TwoTimes(t *testing.T) {
 		t.Errorf("Wrong resource: %v", err)
 	}
 
-	if r.DeletedAt == nil {
-		t.Errorf("resource not marked as deleted: %v", err)
-	}
-	// check file
-	_, err = os.Stat(filepath.Join(cfg.UploadPath, key.HashedKey, filename))
-	if os.IsExist(err) {
-		t.Errorf("Testfile still exists: %v", err)
+	if r.DeletedAt == nil || !r.InTrash {
+		t.Errorf("resource not moved into the trash: %v", err)
 	}
 
 	// delete second time
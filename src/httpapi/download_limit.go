@@ -0,0 +1,96 @@
+package httpapi
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+
+	"github.com/twigman/fshare/src/internal/apperror"
+	"github.com/twigman/fshare/src/store"
+)
+
+// countDownload counts a view or download through a link with a download limit.
+// It returns false if the request must not proceed; a response was written in that case.
+// last is true if the file has to be removed with expireDownloadedResource after it was sent.
+// Used up shares just stop working, the file is kept.
+func (s *RESTService) countDownload(w http.ResponseWriter, link *shareLink) (ok bool, last bool) {
+	var err error
+	if link.share != nil {
+		err = s.resourceService.CountShareDownload(link.share)
+	} else {
+		last, err = s.resourceService.CountDownload(link.res)
+	}
+	if err == apperror.ErrDownloadLimitReached {
+		writeJSONStatus(w, http.StatusNotFound, "Not found")
+		return false, false
+	}
+	if err != nil {
+		writeJSONStatus(w, http.StatusInternalServerError, "Could not read file")
+		return false, false
+	}
+	return true, last
+}
+
+// serveWholeContent removes the headers that make http.ServeContent answer with a part of the content (Range) or
+// without content (conditional requests). Every request to a link with a download limit is counted, so it has to
+// get the whole file; otherwise a range request or a cache revalidation could use up the last download.
+func serveWholeContent(r *http.Request) {
+	for _, h := range []string{"Range", "If-Range", "If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since"} {
+		r.Header.Del(h)
+	}
+}
+
+// expireDownloadedResource removes a file after its last allowed view or download
+func (s *RESTService) expireDownloadedResource(res *store.Resource) {
+	if err := s.resourceService.ExpireResource(res); err != nil {
+		log.Printf("Could not remove file %s after its last download: %v", res.UUID, err)
+	}
+}
+
+// renderDownloadConfirmation asks before a view of a file with a download limit is used up.
+// Link previews and crawlers only send GET requests, the view is counted on the POST of the form.
+func renderDownloadConfirmation(w http.ResponseWriter, name string, remaining int64) {
+	nonce := generateNonce()
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", fmt.Sprintf(
+		"default-src 'none'; style-src 'nonce-%s'; form-action 'self'; base-uri 'none';", nonce,
+	))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Robots-Tag", "noindex, nofollow")
+
+	notice := fmt.Sprintf("%s can be opened %d more times.", html.EscapeString(name), remaining)
+	if remaining == 1 {
+		notice = fmt.Sprintf("%s can only be opened once more.", html.EscapeString(name))
+	}
+
+	fmt.Fprintf(w, `
+		<!DOCTYPE html>
+		<html lang="en">
+		<head>
+		<meta charset="utf-8">
+		<meta name="robots" content="noindex, nofollow">
+		<title>Open file</title>
+		<style nonce="%s">
+			body {
+			margin: 0;
+			background-color: #0d1117;
+			color: #c9d1d9;
+			font-family: sans-serif;
+			display: flex;
+			align-items: center;
+			justify-content: center;
+			height: 100vh;
+			}
+		</style>
+		</head>
+		<body>
+		<form method="post">
+		<p>%s</p>
+		<input type="hidden" name="confirm" value="true">
+		<button type="submit">Open</button>
+		</form>
+		</body>
+		</html>
+		`, nonce, notice)
+}
@@ -0,0 +1,171 @@
+package httpapi_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/twigman/fshare/src/config"
+	"github.com/twigman/fshare/src/httpapi"
+)
+
+func putLimitedFile(t *testing.T, restService *httpapi.RESTService, maxDownloads string) httpapi.PutUploadResponse {
+	t.Helper()
+	w := putUpload(restService, config.EndpointPut+"secret.txt?max_downloads="+maxDownloads, "top secret", map[string]string{
+		"Accept": "application/json",
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	var res httpapi.PutUploadResponse
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	return res
+}
+
+func confirmView(restService *httpapi.RESTService, fileUUID string) *httptest.ResponseRecorder {
+	form := url.Values{"confirm": {"true"}}
+	req := httptest.NewRequest(http.MethodPost, config.EndpointView+fileUUID, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	restService.ResourceHandler(w, req)
+	return w
+}
+
+func TestResourceHandler_BurnAfterReading(t *testing.T) {
+	restService, rs, _, _ := setupFolderTest(t)
+	fileUUID := putLimitedFile(t, restService, "1").UUID
+
+	blobPath, err := httpapi.StoredFilePath(rs, fileUUID)
+	if err != nil {
+		t.Fatalf("Path error: %v", err)
+	}
+
+	// link previews only load the interstitial
+	for range 2 {
+		req := httptest.NewRequest(http.MethodGet, config.EndpointView+fileUUID, nil)
+		w := httptest.NewRecorder()
+		restService.ResourceHandler(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected %d, got %d", http.StatusOK, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), `name="confirm"`) || strings.Contains(w.Body.String(), "top secret") {
+			t.Fatalf("Expected confirmation page, got %q", w.Body.String())
+		}
+	}
+
+	w := confirmView(restService, fileUUID)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "top secret") {
+		t.Fatalf("Expected content, got %d: %q", w.Code, w.Body.String())
+	}
+	// fetching the raw file would count another download
+	if strings.Contains(w.Body.String(), `id="copy-raw"`) {
+		t.Errorf("Expected no raw file buttons for a limited file")
+	}
+
+	r, err := rs.GetResourceByUUID(fileUUID)
+	if err != nil {
+		t.Fatalf("Resource does not exist: %v", err)
+	}
+	if r.DeletedAt == nil || r.DownloadCount != 1 {
+		t.Errorf("Expected file to be deleted after the view: %+v", r)
+	}
+	if _, err := os.Stat(blobPath); !os.IsNotExist(err) {
+		t.Errorf("Expected content to be removed, got %v", err)
+	}
+
+	if w := confirmView(restService, fileUUID); w.Code != http.StatusNotFound {
+		t.Errorf("Expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestRawResourceHandler_MaxDownloads(t *testing.T) {
+	restService, rs, _, _ := setupFolderTest(t)
+	res := putLimitedFile(t, restService, "2")
+	rawPath := strings.TrimPrefix(res.RawURL, "http://example.com")
+
+	for i, expected := range []int{http.StatusOK, http.StatusOK, http.StatusNotFound} {
+		req := httptest.NewRequest(http.MethodGet, rawPath, nil)
+		w := httptest.NewRecorder()
+		restService.RawResourceHandler(w, req)
+		if w.Code != expected {
+			t.Errorf("Download %d: expected %d, got %d", i+1, expected, w.Code)
+		}
+	}
+
+	r, err := rs.GetResourceByUUID(res.UUID)
+	if err != nil {
+		t.Fatalf("Resource does not exist: %v", err)
+	}
+	if r.DeletedAt == nil {
+		t.Errorf("Expected file to be deleted after the last download")
+	}
+}
+
+func TestRawResourceHandler_MaxDownloadsRange(t *testing.T) {
+	restService, rs, _, _ := setupFolderTest(t)
+	res := putLimitedFile(t, restService, "1")
+	rawPath := strings.TrimPrefix(res.RawURL, "http://example.com")
+
+	// the only download must deliver the whole file, even if the client asked for a part or a revalidation
+	req := httptest.NewRequest(http.MethodGet, rawPath, nil)
+	req.Header.Set("Range", "bytes=0-2")
+	req.Header.Set("If-None-Match", "*")
+	w := httptest.NewRecorder()
+	restService.RawResourceHandler(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "top secret" {
+		t.Fatalf("Expected %d with the whole file, got %d: %q", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	r, err := rs.GetResourceByUUID(res.UUID)
+	if err != nil {
+		t.Fatalf("Resource does not exist: %v", err)
+	}
+	if r.DeletedAt == nil {
+		t.Errorf("Expected file to be deleted after the download")
+	}
+}
+
+func TestResourceHandler_MaxDownloadsConcurrent(t *testing.T) {
+	restService, _, _, _ := setupFolderTest(t)
+	fileUUID := putLimitedFile(t, restService, "3").UUID
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	served := 0
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if w := confirmView(restService, fileUUID); w.Code == http.StatusOK {
+				mu.Lock()
+				served++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if served != 3 {
+		t.Errorf("Expected 3 views, got %d", served)
+	}
+}
+
+func TestPutUploadHandler_InvalidMaxDownloads(t *testing.T) {
+	restService, _, _, _ := setupFolderTest(t)
+
+	for _, v := range []string{"0", "-1", "abc"} {
+		w := putUpload(restService, config.EndpointPut+"secret.txt?max_downloads="+v, "top secret", nil)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("max_downloads=%s: expected %d, got %d", v, http.StatusBadRequest, w.Code)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/twigman/fshare/src/internal/apperror"
+	"github.com/twigman/fshare/src/store"
+)
+
+func (s *RESTService) CreateFolderHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONStatus(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	keyUUID, err := s.authorizeBearer(w, r)
+	if err != nil {
+		return
+	}
+
+	var req FolderRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONStatus(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Parent != nil && *req.Parent == "" {
+		req.Parent = nil
+	}
+
+	res := &store.Resource{
+		Name:       req.Name,
+		IsPrivate:  true,
+		ParentUUID: req.Parent,
+		APIKeyUUID: keyUUID,
+	}
+
+	folderUUID, err := s.resourceService.CreateFolder(res)
+	if err != nil {
+		if err == apperror.ErrFileInvalidFilename || err == apperror.ErrFileInvalidFilepath ||
+			err == apperror.ErrInvalidParent || err == apperror.ErrMaxFolderDepthReached {
+			writeJSONStatus(w, http.StatusBadRequest, err.Error())
+			return
+		} else if err == apperror.ErrFileAlreadyExists {
+			writeJSONStatus(w, http.StatusConflict, apperror.ErrFileAlreadyExists.Msg)
+			return
+		}
+		writeJSONStatus(w, http.StatusInternalServerError, "Could not create folder")
+		return
+	}
+
+	writeJSONResponse(w, http.StatusCreated, map[string]string{
+		"uuid": folderUUID,
+	})
+}
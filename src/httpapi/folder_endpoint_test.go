@@ -0,0 +1,195 @@
+package httpapi_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/twigman/fshare/src/config"
+	"github.com/twigman/fshare/src/httpapi"
+	"github.com/twigman/fshare/src/store"
+)
+
+func setupFolderTest(t *testing.T) (*httpapi.RESTService, *store.ResourceService, *store.APIKey, *config.Config) {
+	t.Helper()
+	dataDir := t.TempDir()
+	cfg := &config.Config{
+		DataPath:        dataDir,
+		UploadPath:      filepath.Join(dataDir, "upload"),
+		MaxFileSizeInMB: 5,
+		Port:            8080,
+	}
+
+	as, rs, restService, err := httpapi.InitTestServices(cfg)
+	if err != nil {
+		t.Fatalf("Can not initialize test services: %v", err)
+	}
+
+	key, err := as.AddAPIKey("123", "test key", false, nil)
+	if err != nil {
+		t.Fatalf("Can not add API key: %v", err)
+	}
+
+	if err := store.CreateDirsFromConfig(cfg); err != nil {
+		t.Fatalf("Can not create app dirs: %v", err)
+	}
+
+	if _, err = rs.GetOrCreateHomeDir(key.HashedKey); err != nil {
+		t.Fatalf("Can not create home dir: %v", err)
+	}
+
+	return restService, rs, key, cfg
+}
+
+func createFolder(t *testing.T, restService *httpapi.RESTService, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, config.EndpointFolder, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer 123")
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	restService.CreateFolderHandler(w, req)
+	return w
+}
+
+func TestCreateFolderHandler_Success(t *testing.T) {
+	restService, rs, key, _ := setupFolderTest(t)
+
+	w := createFolder(t, restService, `{"name": "project"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	var result map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+
+	r, err := rs.GetResourceByUUID(result["uuid"])
+	if err != nil {
+		t.Fatalf("Folder does not exist in db: %v", err)
+	}
+	if r.IsFile {
+		t.Errorf("Expected folder, got file")
+	}
+
+	if r.Name != "project" || r.ParentUUID != nil || r.APIKeyUUID != key.UUID {
+		t.Errorf("Unexpected folder: %+v", r)
+	}
+
+	// same name again
+	w = createFolder(t, restService, `{"name": "project"}`)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status %d, got %d", http.StatusConflict, w.Code)
+	}
+}
+
+func TestCreateFolderHandler_InvalidParent(t *testing.T) {
+	restService, _, _, _ := setupFolderTest(t)
+
+	w := createFolder(t, restService, `{"name": "project", "parent": "does-not-exist"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestCreateFolderHandler_InvalidName(t *testing.T) {
+	restService, _, _, _ := setupFolderTest(t)
+
+	w := createFolder(t, restService, `{"name": "../project"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestCreateFolderHandler_WrongMethod(t *testing.T) {
+	restService, _, _, _ := setupFolderTest(t)
+
+	req := httptest.NewRequest(http.MethodGet, config.EndpointFolder, nil)
+	w := httptest.NewRecorder()
+
+	restService.CreateFolderHandler(w, req)
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
+
+func TestUploadHandler_WithParentAndFolderDelete(t *testing.T) {
+	restService, rs, _, _ := setupFolderTest(t)
+
+	w := createFolder(t, restService, `{"name": "project"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+	var folder map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&folder); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("file", "build.log")
+	if err != nil {
+		t.Fatalf("CreateFormFile failed: %v", err)
+	}
+	if _, err := io.Copy(part, strings.NewReader("log")); err != nil {
+		t.Fatalf("Copy failed: %v", err)
+	}
+	writer.WriteField("parent", folder["uuid"])
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, config.EndpointUpload, body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer 123")
+	uw := httptest.NewRecorder()
+
+	restService.UploadHandler(uw, req)
+
+	if uw.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, uw.Code)
+	}
+	var file map[string]string
+	if err := json.NewDecoder(uw.Body).Decode(&file); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+
+	nestedPath, err := httpapi.StoredFilePath(rs, file["uuid"])
+	if err != nil {
+		t.Fatalf("Path error: %v", err)
+	}
+	if _, err := os.Stat(nestedPath); err != nil {
+		t.Fatalf("File not saved in folder: %v", err)
+	}
+
+	// delete folder
+	dreq := httptest.NewRequest(http.MethodDelete, config.EndpointDelete+folder["uuid"], nil)
+	dreq.Header.Set("Authorization", "Bearer 123")
+	dw := httptest.NewRecorder()
+
+	restService.DeleteHandler(dw, dreq)
+
+	if dw.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusNoContent, dw.Code)
+	}
+
+	// kept in the trash until it is purged
+	if _, err := os.Stat(nestedPath); err != nil {
+		t.Errorf("Expected nested file to be kept in the trash, got %v", err)
+	}
+
+	r, err := rs.GetResourceByUUID(file["uuid"])
+	if err != nil {
+		t.Fatalf("Resource does not exist: %v", err)
+	}
+	if r.DeletedAt == nil || !r.InTrash {
+		t.Errorf("Nested file was not moved into the trash")
+	}
+}
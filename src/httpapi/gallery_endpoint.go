@@ -0,0 +1,204 @@
+package httpapi
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/twigman/fshare/src/config"
+	"github.com/twigman/fshare/src/internal/apperror"
+	"github.com/twigman/fshare/src/store"
+)
+
+const (
+	// validity of a gallery link and of the thumbnail and image URLs on its pages
+	galleryURLExpiry = time.Hour
+	// resources listed per gallery page; only the images among them are shown
+	galleryPageSize = 100
+)
+
+// query parameters of the list endpoint a gallery link keeps
+var galleryListParams = []string{"prefix", "sort", "order"}
+
+// galleryAccessData is the signed content of a gallery link
+func galleryAccessData(keyUUID string, expires string) string {
+	return "gallery|" + keyUUID + "|" + expires
+}
+
+// GalleryHandler shows the images of an API key as thumbnails. Browsers can not send the Authorization header,
+// so a request with it is redirected to a signed gallery link, which can be opened in a browser until it expires.
+func (s *RESTService) GalleryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONStatus(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	keyUUID := strings.TrimPrefix(r.URL.Path, config.EndpointGallery)
+	if keyUUID == "" {
+		s.redirectToGallery(w, r)
+		return
+	}
+
+	expires, ok := s.validGalleryExpiry(r, keyUUID)
+	if !ok {
+		writeJSONStatus(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	key, err := s.apiKeyService.GetAPIKeyByUUID(keyUUID)
+	if err != nil || !key.IsActive(time.Now().UTC()) {
+		writeJSONStatus(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	q := r.URL.Query()
+	opts := store.ListOptions{
+		Cursor:     q.Get("cursor"),
+		SortBy:     q.Get("sort"),
+		NamePrefix: q.Get("prefix"),
+		Descending: q.Get("order") == "desc",
+		Limit:      galleryPageSize,
+	}
+	page, err := s.resourceService.ListResources(keyUUID, opts)
+	if err != nil {
+		if err == apperror.ErrInvalidListOptions {
+			writeJSONStatus(w, http.StatusBadRequest, apperror.ErrInvalidListOptions.Msg)
+			return
+		}
+		writeJSONStatus(w, http.StatusInternalServerError, "Could not list resources")
+		return
+	}
+
+	var tiles strings.Builder
+	for _, res := range page.Resources {
+		if thumbnailURL(res) == nil {
+			continue
+		}
+		thumbURL, err := s.generateSignedURL(config.EndpointThumb, res.UUID, expires)
+		if err != nil {
+			writeJSONStatus(w, http.StatusInternalServerError, "Failed to generate signed URL")
+			return
+		}
+		rawURL, err := s.generateSignedURL(config.EndpointRaw, res.UUID, expires)
+		if err != nil {
+			writeJSONStatus(w, http.StatusInternalServerError, "Failed to generate signed URL")
+			return
+		}
+		fmt.Fprintf(&tiles, `<a href="%s" title="%s"><img src="%s" alt="%s" loading="lazy"></a>`,
+			html.EscapeString(rawURL), html.EscapeString(res.Name), html.EscapeString(thumbURL+"&size=256"),
+			html.EscapeString(res.Name))
+	}
+	if tiles.Len() == 0 {
+		tiles.WriteString("<p>No images on this page.</p>")
+	}
+
+	var next string
+	if page.NextCursor != "" {
+		q.Set("cursor", page.NextCursor)
+		nextURL := config.EndpointGallery + keyUUID + "?" + q.Encode()
+		next = fmt.Sprintf(`<p><a href="%s">Next page</a></p>`, html.EscapeString(nextURL))
+	}
+
+	renderGallery(w, tiles.String(), next)
+}
+
+// redirectToGallery sends the owner to a signed gallery link of the API key
+func (s *RESTService) redirectToGallery(w http.ResponseWriter, r *http.Request) {
+	keyUUID, err := s.authorizeBearer(w, r)
+	if err != nil {
+		return
+	}
+
+	expires := fmt.Sprintf("%d", time.Now().Add(galleryURLExpiry).Unix())
+	kid, signature, err := s.hmacSign(galleryAccessData(keyUUID, expires))
+	if err != nil {
+		writeJSONStatus(w, http.StatusInternalServerError, "Failed to generate signed URL")
+		return
+	}
+
+	q := url.Values{}
+	for _, p := range galleryListParams {
+		if v := r.URL.Query().Get(p); v != "" {
+			q.Set(p, v)
+		}
+	}
+	q.Set("expires", expires)
+	q.Set("kid", kid)
+	q.Set("signature", signature)
+	http.Redirect(w, r, config.EndpointGallery+keyUUID+"?"+q.Encode(), http.StatusSeeOther)
+}
+
+// validGalleryExpiry checks the signature of a gallery link and returns its expiry
+func (s *RESTService) validGalleryExpiry(r *http.Request, keyUUID string) (time.Time, bool) {
+	q := r.URL.Query()
+	expires := q.Get("expires")
+	signature := q.Get("signature")
+	if expires == "" || signature == "" {
+		return time.Time{}, false
+	}
+	expiresInt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresInt {
+		return time.Time{}, false
+	}
+	if !s.hmacVerify(galleryAccessData(keyUUID, expires), q.Get("kid"), signature) {
+		return time.Time{}, false
+	}
+	return time.Unix(expiresInt, 0), true
+}
+
+func renderGallery(w http.ResponseWriter, tiles string, next string) {
+	nonce := generateNonce()
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", fmt.Sprintf(
+		"default-src 'none'; style-src 'nonce-%s'; img-src 'self'; object-src 'none'; base-uri 'none'; form-action 'none';",
+		nonce,
+	))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("X-Robots-Tag", "noindex, nofollow")
+
+	fmt.Fprintf(w, `
+		<!DOCTYPE html>
+		<html lang="en">
+		<head>
+		<meta charset="utf-8">
+		<meta name="robots" content="noindex, nofollow">
+		<title>Gallery</title>
+		<style nonce="%s">
+			body {
+			margin: 0;
+			padding: 1em;
+			background-color: #111;
+			color: #c9d1d9;
+			font-family: sans-serif;
+			}
+
+			.grid {
+			display: flex;
+			flex-wrap: wrap;
+			gap: 8px;
+			}
+
+			img {
+			display: block;
+			width: 256px;
+			height: 256px;
+			object-fit: cover;
+			background-color: #222;
+			}
+
+			a {
+			color: #58a6ff;
+			}
+		</style>
+		</head>
+		<body>
+		<div class="grid">%s</div>
+		%s
+		</body>
+		</html>
+		`, nonce, tiles, next)
+}
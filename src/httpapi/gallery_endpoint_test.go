@@ -0,0 +1,76 @@
+package httpapi_test
+
+import (
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/twigman/fshare/src/config"
+)
+
+func TestGalleryHandler(t *testing.T) {
+	restService, _, _, _ := setupFolderTest(t)
+	photoUUID := putTestImage(t, restService, "photo.png")
+	privateUUID := putTestImage(t, restService, "private.png?is_private=true")
+	if w := putUpload(restService, config.EndpointPut+"notes.txt", "no image", nil); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	gallery := func(target string, apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if apiKey != "" {
+			req.Header.Set("Authorization", "Bearer "+apiKey)
+		}
+		w := httptest.NewRecorder()
+		restService.GalleryHandler(w, req)
+		return w
+	}
+
+	// the owner is sent to a signed link browsers can open
+	w := gallery(config.EndpointGallery+"?sort=name", "123")
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected %d, got %d: %s", http.StatusSeeOther, w.Code, w.Body.String())
+	}
+	location := w.Header().Get("Location")
+	if !strings.HasPrefix(location, config.EndpointGallery) || !strings.Contains(location, "signature=") || !strings.Contains(location, "sort=name") {
+		t.Fatalf("Unexpected gallery link %q", location)
+	}
+
+	w = gallery(location, "")
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("Expected gallery page, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if strings.Count(body, "<img ") != 2 || strings.Contains(body, "notes.txt") {
+		t.Errorf("Expected the two images only, got %q", body)
+	}
+
+	// thumbnails of private images load without Authorization header
+	m := regexp.MustCompile(`src="(` + regexp.QuoteMeta(config.EndpointThumb+privateUUID) + `[^"]*)"`).FindStringSubmatch(body)
+	if m == nil {
+		t.Fatalf("Expected thumbnail of the private image, got %q", body)
+	}
+	thumbURL := html.UnescapeString(m[1])
+	tw := httptest.NewRecorder()
+	restService.ThumbnailHandler(tw, httptest.NewRequest(http.MethodGet, thumbURL, nil))
+	if tw.Code != http.StatusOK {
+		t.Errorf("Expected %d for signed thumbnail, got %d: %s", http.StatusOK, tw.Code, tw.Body.String())
+	}
+	if w := getThumbnail(restService, privateUUID, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected %d for unsigned thumbnail of a private image, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if !strings.Contains(body, `href="`+config.EndpointRaw+photoUUID+"?expires=") {
+		t.Errorf("Expected link to the original, got %q", body)
+	}
+
+	// tampered and missing signatures
+	if w := gallery(strings.Replace(location, "signature=", "signature=0", 1), ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected %d for a wrong signature, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if w := gallery(config.EndpointGallery, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected %d without Authorization header, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
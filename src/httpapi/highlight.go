@@ -0,0 +1,69 @@
+package httpapi
+
+import (
+	"bytes"
+	"html"
+	"sync"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// highlightStyle is the color scheme of highlighted code
+const highlightStyle = "github-dark"
+
+// maxHighlightSize is the largest text that is highlighted, larger texts are shown without colors
+// to keep the rendering time of the viewer low
+const maxHighlightSize = 1 << 20
+
+// highlightFormatter writes CSS classes instead of inline styles, the CSP of the viewer does not allow the latter
+var highlightFormatter = chromahtml.New(chromahtml.WithClasses(true))
+
+// lineFormatter additionally numbers the lines, line n gets the anchor #Ln
+var lineFormatter = chromahtml.New(
+	chromahtml.WithClasses(true),
+	chromahtml.WithLineNumbers(true),
+	chromahtml.WithLinkableLineNumbers(true, "L"),
+)
+
+var highlightCSS = sync.OnceValue(func() string {
+	var buf bytes.Buffer
+	if err := lineFormatter.WriteCSS(&buf, styles.Get(highlightStyle)); err != nil {
+		return ""
+	}
+	return buf.String()
+})
+
+// highlightCode returns the content as HTML with syntax highlighting for the given language.
+// Unknown languages and large texts are shown without colors.
+func highlightCode(lang string, content string) string {
+	return formatCode(highlightFormatter, lang, content)
+}
+
+// highlightLines is like highlightCode with line numbers and line anchors
+func highlightLines(lang string, content string) string {
+	return formatCode(lineFormatter, lang, content)
+}
+
+func formatCode(formatter *chromahtml.Formatter, lang string, content string) string {
+	plain := `<pre class="chroma"><code>` + html.EscapeString(content) + `</code></pre>`
+
+	lexer := lexers.Get(lang)
+	if lexer == nil || len(content) > maxHighlightSize {
+		// a single token, only split into lines
+		lexer = lexers.Get("plaintext")
+	}
+
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, content)
+	if err != nil {
+		return plain
+	}
+
+	var buf bytes.Buffer
+	if err := formatter.Format(&buf, styles.Get(highlightStyle), iterator); err != nil {
+		return plain
+	}
+	return buf.String()
+}
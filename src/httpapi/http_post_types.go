@@ -3,14 +3,146 @@ package httpapi
 import "time"
 
 type APIKeyRequest struct {
-	Key           string `json:"key"`
-	Comment       string `json:"comment"`
-	HighlyTrusted bool   `json:"highly_trusted"`
+	Key           string     `json:"key"`
+	Comment       string     `json:"comment"`
+	HighlyTrusted bool       `json:"highly_trusted"`
+	SpaceLimit    *int64     `json:"space_limit_in_mb"`
+	MaxVersions   *int64     `json:"max_versions"`
+	ExpiresAt     *time.Time `json:"expires_at"`
+}
+
+type APIKeyRotateRequest struct {
+	Key string `json:"key"` // empty = generate
 }
 
 type APIKeyResponse struct {
-	UUID          string    `json:"uuid"`
-	Comment       string    `json:"comment"`
-	HighlyTrusted bool      `json:"highly_trusted"`
-	CreatedAt     time.Time `json:"created_at"`
+	UUID          string     `json:"uuid"`
+	Key           string     `json:"key,omitempty"` // only set if the key was generated by fshare
+	Comment       string     `json:"comment"`
+	HighlyTrusted bool       `json:"highly_trusted"`
+	SpaceLimit    *int64     `json:"space_limit_in_mb,omitempty"`
+	MaxVersions   *int64     `json:"max_versions,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+}
+
+type FolderRequest struct {
+	Name   string  `json:"name"`
+	Parent *string `json:"parent"`
+}
+
+type ResourceResponse struct {
+	UUID                string     `json:"uuid"`
+	Name                string     `json:"name"`
+	IsFile              bool       `json:"is_file"`
+	Parent              *string    `json:"parent"`
+	Size                int64      `json:"size"`
+	IsPrivate           bool       `json:"is_private"`
+	IsPasswordProtected bool       `json:"is_password_protected"`
+	MaxDownloads        *int64     `json:"max_downloads"`
+	DownloadCount       int64      `json:"download_count"`
+	AutoDeleteAt        *time.Time `json:"autodelete_at"`
+	CreatedAt           time.Time  `json:"created_at"`
+	DeletedAt           *time.Time `json:"deleted_at,omitempty"`
+	InTrash             bool       `json:"in_trash"`
+	IsBroken            bool       `json:"is_broken"`
+	Version             int64      `json:"version,omitempty"`       // files only
+	UpdatedAt           *time.Time `json:"updated_at,omitempty"`    // when the current version was uploaded
+	ThumbnailURL        *string    `json:"thumbnail_url,omitempty"` // images only
+}
+
+// ResourceUpdateRequest changes the settings of an uploaded resource; omitted fields are kept
+type ResourceUpdateRequest struct {
+	Name      *string `json:"name"`
+	IsPrivate *bool   `json:"is_private"`
+	AutoDelIn *string `json:"auto_del_in"` // new TTL from now like "12h" or "7d", "" removes the TTL
+}
+
+type ResourceListResponse struct {
+	Resources  []ResourceResponse `json:"resources"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+}
+
+type ResourceInfoResponse struct {
+	UUID                string     `json:"uuid"`
+	Name                string     `json:"name"`
+	Size                int64      `json:"size"`
+	MimeType            string     `json:"mime_type"`
+	SHA256              string     `json:"sha256,omitempty"`
+	IsPrivate           bool       `json:"is_private"`
+	IsPasswordProtected bool       `json:"is_password_protected"`
+	IsAlive             bool       `json:"is_alive"`
+	MaxDownloads        *int64     `json:"max_downloads"`
+	DownloadCount       int64      `json:"download_count"`
+	AutoDeleteAt        *time.Time `json:"autodelete_at"`
+	TTLRemainingSec     *int64     `json:"ttl_remaining_sec"`
+	CreatedAt           time.Time  `json:"created_at"`
+	DeletedAt           *time.Time `json:"deleted_at"`
+	IsOwner             bool       `json:"is_owner"`
+	// only visible for the owner
+	Parent    *string    `json:"parent,omitempty"`
+	IsBroken  *bool      `json:"is_broken,omitempty"`
+	Version   int64      `json:"version,omitempty"`    // files only
+	UpdatedAt *time.Time `json:"updated_at,omitempty"` // when the current version was uploaded
+}
+
+type PutUploadResponse struct {
+	UUID            string    `json:"uuid"`
+	Name            string    `json:"name"`
+	Version         int64     `json:"version"`
+	ViewURL         string    `json:"view_url"`
+	RawURL          string    `json:"raw_url"`
+	RawURLExpiresAt time.Time `json:"raw_url_expires_at"`
+}
+
+type ShareRequest struct {
+	Label        string     `json:"label"`
+	Password     string     `json:"password"`
+	MaxDownloads *int64     `json:"max_downloads"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+}
+
+type ShareResponse struct {
+	Token               string     `json:"token"`
+	ResourceUUID        string     `json:"resource_uuid"`
+	Label               string     `json:"label"`
+	ViewURL             string     `json:"view_url"`
+	IsPasswordProtected bool       `json:"is_password_protected"`
+	MaxDownloads        *int64     `json:"max_downloads"`
+	DownloadCount       int64      `json:"download_count"`
+	ExpiresAt           *time.Time `json:"expires_at"`
+	CreatedAt           time.Time  `json:"created_at"`
+	RevokedAt           *time.Time `json:"revoked_at"`
+	IsActive            bool       `json:"is_active"`
+}
+
+type ShareListResponse struct {
+	Shares []ShareResponse `json:"shares"`
+}
+
+type VersionResponse struct {
+	Version   int64     `json:"version"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+	CreatedAt time.Time `json:"created_at"`
+	IsCurrent bool      `json:"is_current"`
+	RawURL    string    `json:"raw_url"` // needs the API key of the owner
+}
+
+type VersionListResponse struct {
+	UUID     string            `json:"uuid"`
+	Name     string            `json:"name"`
+	Versions []VersionResponse `json:"versions"`
+}
+
+type SignedURLRequest struct {
+	ExpiresIn string `json:"expires_in"`
+	Download  bool   `json:"download"`
+}
+
+type SignedURLResponse struct {
+	UUID      string    `json:"uuid"`
+	RawURL    string    `json:"raw_url"`
+	ExpiresAt time.Time `json:"expires_at"`
 }
@@ -0,0 +1,99 @@
+package httpapi
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/twigman/fshare/src/config"
+	"github.com/twigman/fshare/src/storage"
+)
+
+func (s *RESTService) ResourceInfoHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONStatus(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	rUUID := strings.TrimPrefix(r.URL.Path, config.EndpointInfo)
+
+	res, err := s.resourceService.GetResourceByUUID(rUUID)
+	if err != nil || res == nil || !res.IsFile {
+		writeJSONStatus(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	var isOwner bool
+	if res.IsPrivate {
+		keyUUID, err := s.authorizeBearer(w, r)
+		if err != nil {
+			return
+		}
+
+		if res.APIKeyUUID != keyUUID {
+			writeJSONStatus(w, http.StatusUnauthorized, "Authorization failed")
+			return
+		}
+		isOwner = true
+	} else {
+		isOwner = s.bearerKeyUUID(r) == res.APIKeyUUID
+
+		if res.PasswordHash != nil && !isOwner && !s.hasPasswordAccess(r, &shareLink{id: res.UUID, res: res}) {
+			writeJSONStatus(w, http.StatusUnauthorized, "Password required")
+			return
+		}
+	}
+
+	checksum := res.SHA256
+	if res.DeletedAt == nil && !res.IsBroken {
+		if _, err := s.resourceService.StatResource(res); err == storage.ErrNotExist {
+			_ = s.resourceService.MarkResourceAsBroken(res.UUID)
+			res.IsBroken = true
+		} else if err != nil {
+			writeJSONStatus(w, http.StatusInternalServerError, "Could not access file")
+			return
+		} else if checksum, err = s.resourceService.EnsureChecksum(res); err != nil {
+			log.Printf("Could not calculate checksum of resource %s: %v", res.UUID, err)
+		}
+	}
+
+	now := time.Now().UTC()
+	info := ResourceInfoResponse{
+		UUID:                res.UUID,
+		Name:                res.Name,
+		Size:                res.Size,
+		MimeType:            detectMimeType(res.Name),
+		SHA256:              checksum,
+		IsPrivate:           res.IsPrivate,
+		IsPasswordProtected: res.PasswordHash != nil,
+		IsAlive:             res.DeletedAt == nil && !res.IsBroken && !res.DownloadLimitReached(),
+		MaxDownloads:        res.MaxDownloads,
+		DownloadCount:       res.DownloadCount,
+		AutoDeleteAt:        res.AutoDeleteAt,
+		CreatedAt:           res.CreatedAt,
+		DeletedAt:           res.DeletedAt,
+		IsOwner:             isOwner,
+	}
+
+	if res.AutoDeleteAt != nil && res.DeletedAt == nil {
+		remaining := int64(res.AutoDeleteAt.Sub(now).Seconds())
+		if remaining <= 0 {
+			// expired, but not yet removed by the cleanup worker
+			remaining = 0
+			info.IsAlive = false
+		}
+		info.TTLRemainingSec = &remaining
+	}
+
+	if isOwner {
+		info.Parent = res.ParentUUID
+		info.IsBroken = &res.IsBroken
+		if res.IsFile {
+			info.Version = res.Version
+			info.UpdatedAt = res.UpdatedAt
+		}
+	}
+
+	writeJSONResponse(w, http.StatusOK, info)
+}
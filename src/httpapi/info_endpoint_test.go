@@ -0,0 +1,155 @@
+package httpapi_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/twigman/fshare/src/config"
+	"github.com/twigman/fshare/src/httpapi"
+)
+
+func getInfo(t *testing.T, restService *httpapi.RESTService, fileUUID string, apiKey string) (*httptest.ResponseRecorder, *httpapi.ResourceInfoResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, config.EndpointInfo+fileUUID, nil)
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	w := httptest.NewRecorder()
+
+	restService.ResourceInfoHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		return w, nil
+	}
+
+	var info httpapi.ResourceInfoResponse
+	if err := json.NewDecoder(w.Body).Decode(&info); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	return w, &info
+}
+
+func TestResourceInfoHandler_Public(t *testing.T) {
+	dataDir := t.TempDir()
+	restService, _, _, _, _, fileUUID, err := httpapi.SetupExistingTestUpload(dataDir, "123", "test.txt", false, false)
+	if err != nil {
+		t.Fatalf("Setup error: %v", err)
+	}
+
+	w, info := getInfo(t, restService, fileUUID, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected %d, got %d", http.StatusOK, w.Code)
+	}
+
+	sum := sha256.Sum256([]byte("Hello World"))
+	if info.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("Unexpected checksum %q", info.SHA256)
+	}
+	if info.Name != "test.txt" || info.Size != int64(len("Hello World")) {
+		t.Errorf("Unexpected info: %+v", info)
+	}
+	if info.MimeType != "text/plain; charset=utf-8" {
+		t.Errorf("Unexpected mime type %q", info.MimeType)
+	}
+	if !info.IsAlive || info.IsOwner || info.IsBroken != nil || info.TTLRemainingSec != nil {
+		t.Errorf("Unexpected info: %+v", info)
+	}
+
+	// owner sees additional fields
+	_, info = getInfo(t, restService, fileUUID, "123")
+	if !info.IsOwner || info.IsBroken == nil {
+		t.Errorf("Expected owner fields, got %+v", info)
+	}
+}
+
+func TestResourceInfoHandler_PrivateUnauthorized(t *testing.T) {
+	dataDir := t.TempDir()
+	restService, _, as, _, _, fileUUID, err := httpapi.SetupExistingTestUpload(dataDir, "123", "secret.txt", true, false)
+	if err != nil {
+		t.Fatalf("Setup error: %v", err)
+	}
+
+	if w, _ := getInfo(t, restService, fileUUID, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	if _, err := as.AddAPIKey("321", "second", false, nil); err != nil {
+		t.Fatalf("could not add second API key: %v", err)
+	}
+	if w, _ := getInfo(t, restService, fileUUID, "321"); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	if w, _ := getInfo(t, restService, fileUUID, "123"); w.Code != http.StatusOK {
+		t.Errorf("Expected %d, got %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestResourceInfoHandler_Deleted(t *testing.T) {
+	dataDir := t.TempDir()
+	restService, rs, _, key, _, fileUUID, err := httpapi.SetupExistingTestUpload(dataDir, "123", "test.txt", false, false)
+	if err != nil {
+		t.Fatalf("Setup error: %v", err)
+	}
+
+	if err := rs.DeleteResourceByUUID(fileUUID, key.UUID); err != nil {
+		t.Fatalf("Could not delete resource: %v", err)
+	}
+
+	w, info := getInfo(t, restService, fileUUID, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected %d, got %d", http.StatusOK, w.Code)
+	}
+	if info.IsAlive || info.DeletedAt == nil {
+		t.Errorf("Expected deleted resource, got %+v", info)
+	}
+}
+
+func TestResourceInfoHandler_FileMissing(t *testing.T) {
+	dataDir := t.TempDir()
+	restService, rs, _, _, _, fileUUID, err := httpapi.SetupExistingTestUpload(dataDir, "123", "ghost.txt", false, false)
+	if err != nil {
+		t.Fatalf("Setup error: %v", err)
+	}
+
+	filePath, err := httpapi.StoredFilePath(rs, fileUUID)
+	if err != nil {
+		t.Fatalf("Path error: %v", err)
+	}
+	if err := os.Remove(filePath); err != nil {
+		t.Fatalf("Failed to remove file: %v", err)
+	}
+
+	w, info := getInfo(t, restService, fileUUID, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected %d, got %d", http.StatusOK, w.Code)
+	}
+	if info.IsAlive {
+		t.Errorf("Expected missing file not to be alive")
+	}
+
+	r, err := rs.GetResourceByUUID(fileUUID)
+	if err != nil {
+		t.Fatalf("Could not load resource: %v", err)
+	}
+	if !r.IsBroken {
+		t.Errorf("Missing file was not marked as broken")
+	}
+}
+
+func TestResourceInfoHandler_NotFound(t *testing.T) {
+	dataDir := t.TempDir()
+	restService, _, _, _, _, _, err := httpapi.SetupExistingTestUpload(dataDir, "123", "test.txt", false, false)
+	if err != nil {
+		t.Fatalf("Setup error: %v", err)
+	}
+
+	if w, _ := getInfo(t, restService, "invalid", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
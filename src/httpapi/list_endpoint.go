@@ -0,0 +1,90 @@
+package httpapi
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/twigman/fshare/src/internal/apperror"
+	"github.com/twigman/fshare/src/store"
+)
+
+func (s *RESTService) ListResourcesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONStatus(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	keyUUID, err := s.authorizeBearer(w, r)
+	if err != nil {
+		return
+	}
+
+	q := r.URL.Query()
+
+	opts := store.ListOptions{
+		Cursor:         q.Get("cursor"),
+		SortBy:         q.Get("sort"),
+		NamePrefix:     q.Get("prefix"),
+		IncludeDeleted: q.Get("include_deleted") == "true",
+		InTrash:        q.Get("in_trash") == "true",
+	}
+
+	if limitRaw := q.Get("limit"); limitRaw != "" {
+		opts.Limit, err = strconv.Atoi(limitRaw)
+		if err != nil || opts.Limit < 1 {
+			writeJSONStatus(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+	}
+
+	switch q.Get("order") {
+	case "", "asc":
+	case "desc":
+		opts.Descending = true
+	default:
+		writeJSONStatus(w, http.StatusBadRequest, apperror.ErrInvalidListOptions.Msg)
+		return
+	}
+
+	page, err := s.resourceService.ListResources(keyUUID, opts)
+	if err != nil {
+		if err == apperror.ErrInvalidListOptions {
+			writeJSONStatus(w, http.StatusBadRequest, apperror.ErrInvalidListOptions.Msg)
+			return
+		}
+		writeJSONStatus(w, http.StatusInternalServerError, "Could not list resources")
+		return
+	}
+
+	res := ResourceListResponse{
+		Resources:  make([]ResourceResponse, 0, len(page.Resources)),
+		NextCursor: page.NextCursor,
+	}
+	for _, r := range page.Resources {
+		res.Resources = append(res.Resources, newResourceResponse(r))
+	}
+
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func newResourceResponse(r *store.Resource) ResourceResponse {
+	return ResourceResponse{
+		UUID:                r.UUID,
+		Name:                r.Name,
+		IsFile:              r.IsFile,
+		Parent:              r.ParentUUID,
+		Size:                r.Size,
+		IsPrivate:           r.IsPrivate,
+		IsPasswordProtected: r.PasswordHash != nil,
+		MaxDownloads:        r.MaxDownloads,
+		DownloadCount:       r.DownloadCount,
+		AutoDeleteAt:        r.AutoDeleteAt,
+		CreatedAt:           r.CreatedAt,
+		DeletedAt:           r.DeletedAt,
+		IsBroken:            r.IsBroken,
+		InTrash:             r.InTrash,
+		Version:             r.Version,
+		UpdatedAt:           r.UpdatedAt,
+		ThumbnailURL:        thumbnailURL(r),
+	}
+}
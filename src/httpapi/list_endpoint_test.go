@@ -0,0 +1,108 @@
+package httpapi_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/twigman/fshare/src/config"
+	"github.com/twigman/fshare/src/httpapi"
+)
+
+func TestListResourcesHandler_Success(t *testing.T) {
+	dataDir := t.TempDir()
+	const apiKey = "123"
+	restService, _, _, _, _, fileUUID, err := httpapi.SetupExistingTestUpload(dataDir, apiKey, "test.txt", true, false)
+	if err != nil {
+		t.Fatalf("Setup error: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, config.EndpointList+"?sort=name&order=desc&prefix=test", nil)
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	w := httptest.NewRecorder()
+
+	restService.ListResourcesHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var res httpapi.ResourceListResponse
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+
+	if len(res.Resources) != 1 {
+		t.Fatalf("Expected 1 resource, got %d", len(res.Resources))
+	}
+	if res.Resources[0].UUID != fileUUID || res.Resources[0].Size != int64(len("Hello World")) || !res.Resources[0].IsPrivate {
+		t.Errorf("Unexpected resource: %+v", res.Resources[0])
+	}
+	if res.NextCursor != "" {
+		t.Errorf("Expected no next cursor, got %q", res.NextCursor)
+	}
+}
+
+func TestListResourcesHandler_OtherKey(t *testing.T) {
+	dataDir := t.TempDir()
+	restService, _, as, _, _, _, err := httpapi.SetupExistingTestUpload(dataDir, "123", "test.txt", false, false)
+	if err != nil {
+		t.Fatalf("Setup error: %v", err)
+	}
+
+	if _, err := as.AddAPIKey("321", "second", false, nil); err != nil {
+		t.Fatalf("could not add second API key: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, config.EndpointList, nil)
+	req.Header.Set("Authorization", "Bearer 321")
+	w := httptest.NewRecorder()
+
+	restService.ListResourcesHandler(w, req)
+
+	var res httpapi.ResourceListResponse
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	if len(res.Resources) != 0 {
+		t.Errorf("Expected no resources of other keys, got %d", len(res.Resources))
+	}
+}
+
+func TestListResourcesHandler_InvalidOptions(t *testing.T) {
+	dataDir := t.TempDir()
+	restService, _, _, _, _, _, err := httpapi.SetupExistingTestUpload(dataDir, "123", "test.txt", false, false)
+	if err != nil {
+		t.Fatalf("Setup error: %v", err)
+	}
+
+	for _, query := range []string{"?sort=uuid", "?order=up", "?limit=abc", "?cursor=invalid"} {
+		req := httptest.NewRequest(http.MethodGet, config.EndpointList+query, nil)
+		req.Header.Set("Authorization", "Bearer 123")
+		w := httptest.NewRecorder()
+
+		restService.ListResourcesHandler(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected %d, got %d", query, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+func TestListResourcesHandler_Unauthorized(t *testing.T) {
+	dataDir := t.TempDir()
+	restService, _, _, _, _, _, err := httpapi.SetupExistingTestUpload(dataDir, "123", "test.txt", false, false)
+	if err != nil {
+		t.Fatalf("Setup error: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, config.EndpointList, nil)
+	w := httptest.NewRecorder()
+
+	restService.ListResourcesHandler(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
@@ -0,0 +1,245 @@
+package httpapi
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/twigman/fshare/src/config"
+	"github.com/twigman/fshare/src/store"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// markdownImageExpiry is the validity of the signed URLs of images embedded in rendered Markdown
+const markdownImageExpiry = 10 * time.Minute
+
+// markdown renders CommonMark with GFM tables, task lists, strikethrough and autolinks.
+// Raw HTML is omitted and links with dangerous schemes like javascript: are dropped, as goldmark does without html.WithUnsafe.
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithRendererOptions(
+		renderer.WithNodeRenderers(util.Prioritized(&codeBlockRenderer{}, 100)),
+	),
+)
+
+// codeBlockRenderer highlights fenced code blocks like the text viewer
+type codeBlockRenderer struct{}
+
+func (r *codeBlockRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindFencedCodeBlock, r.renderFencedCodeBlock)
+}
+
+func (r *codeBlockRenderer) renderFencedCodeBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*ast.FencedCodeBlock)
+
+	var code strings.Builder
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		code.Write(line.Value(source))
+	}
+
+	lang := ""
+	if n.Info != nil {
+		lang = string(n.Language(source))
+	}
+	if _, err := w.WriteString(highlightCode(lang, code.String())); err != nil {
+		return ast.WalkStop, err
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+// renderMarkdown converts Markdown to HTML. Image sources are passed through resolveImage.
+func renderMarkdown(source []byte, resolveImage func(dest string) string) (string, error) {
+	doc := markdown.Parser().Parse(text.NewReader(source))
+
+	err := ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if img, ok := n.(*ast.Image); ok && entering {
+			img.Destination = []byte(resolveImage(string(img.Destination)))
+		}
+		return ast.WalkContinue, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := markdown.Renderer().Render(&buf, source, doc); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// markdownImageResolver returns a function replacing relative image paths with signed URLs of the images of the same API key,
+// resolved from the folder of the Markdown file. Private images are only included if the owner views the file, images with
+// password or download limit never. Other sources are kept, the CSP of the viewer blocks external images anyway.
+func (s *RESTService) markdownImageResolver(res *store.Resource, ownerView bool, trusted bool) func(string) string {
+	return func(dest string) string {
+		u, err := url.Parse(dest)
+		if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" || strings.HasPrefix(u.Path, "/") {
+			return dest
+		}
+
+		img, err := s.resourceService.ResolveRelativePath(res.APIKeyUUID, res.ParentUUID, u.Path)
+		if err != nil {
+			return dest
+		}
+		if !img.IsFile || img.IsBroken || img.DownloadLimitReached() || img.PasswordHash != nil || img.MaxDownloads != nil ||
+			(img.IsPrivate && !ownerView) || !isRenderableImageFile(img.Name, trusted) {
+			return dest
+		}
+
+		signed, err := s.generateSignedURL(config.EndpointRaw, img.UUID, time.Now().Add(markdownImageExpiry))
+		if err != nil {
+			return dest
+		}
+		return signed
+	}
+}
+
+// renderMarkdownView shows rendered Markdown with a toggle to its highlighted source. The toggle is a checkbox styled with CSS,
+// so it works without scripts and without reloading the page, which would count another download of a limited file.
+func renderMarkdownView(w http.ResponseWriter, content string, resolveImage func(string) string) {
+	rendered, err := renderMarkdown([]byte(content), resolveImage)
+	if err != nil {
+		renderText(w, "markdown", content, "")
+		return
+	}
+
+	nonce := generateNonce()
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", fmt.Sprintf(
+		"default-src 'none'; style-src 'nonce-%s'; img-src 'self'; object-src 'none'; base-uri 'none'; form-action 'none';",
+		nonce,
+	))
+
+	fmt.Fprintf(w, `
+		<!DOCTYPE html>
+		<html lang="en">
+		<head>
+		<meta charset="utf-8">
+		<title>Viewer</title>
+		<style nonce="%s">
+			body {
+			margin: 0;
+			background-color: #0d1117;
+			color: #c9d1d9;
+			font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif;
+			line-height: 1.5;
+			}
+
+			#show-source {
+			display: none;
+			}
+
+			.toggle {
+			position: fixed;
+			top: 0.5em;
+			right: 1em;
+			padding: 0.2em 0.8em;
+			border: 1px solid #30363d;
+			border-radius: 6px;
+			background: #161b22;
+			cursor: pointer;
+			font-size: 0.9em;
+			}
+
+			.toggle::after {
+			content: "Source";
+			}
+
+			#show-source:checked ~ .toggle::after {
+			content: "Rendered";
+			}
+
+			#show-source:checked ~ .markdown, .source {
+			display: none;
+			}
+
+			#show-source:checked ~ .source {
+			display: block;
+			}
+
+			.markdown {
+			max-width: 980px;
+			margin: 0 auto;
+			padding: 2em 1em;
+			}
+
+			.markdown a {
+			color: #58a6ff;
+			}
+
+			.markdown img {
+			max-width: 100%%;
+			}
+
+			.markdown table {
+			border-collapse: collapse;
+			}
+
+			.markdown th, .markdown td {
+			border: 1px solid #30363d;
+			padding: 0.3em 0.8em;
+			}
+
+			.markdown code {
+			background: #161b22;
+			padding: 0.1em 0.3em;
+			border-radius: 4px;
+			}
+
+			.markdown li:has(> input[type=checkbox]) {
+			list-style: none;
+			}
+
+			pre {
+			margin: 0;
+			padding: 1em;
+			overflow-x: auto;
+			font-family: monospace;
+			}
+
+			.markdown pre {
+			border-radius: 6px;
+			}
+
+			.markdown pre code {
+			padding: 0;
+			}
+
+			%s
+
+			.chroma {
+			background-color: #0d1117;
+			}
+
+			.markdown .chroma {
+			background-color: #161b22;
+			}
+		</style>
+		</head>
+		<body>
+		<input type="checkbox" id="show-source">
+		<label for="show-source" class="toggle"></label>
+		<article class="markdown">
+		%s
+		</article>
+		<div class="source">
+		%s
+		</div>
+		</body>
+		</html>
+		`, nonce, highlightCSS(), rendered, highlightCode("markdown", content))
+}
@@ -0,0 +1,85 @@
+package httpapi_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/twigman/fshare/src/config"
+	"github.com/twigman/fshare/src/httpapi"
+	"github.com/twigman/fshare/src/store"
+)
+
+const testMarkdown = "# Release notes\n\n" +
+	"| a | b |\n|---|---|\n| 1 | 2 |\n\n" +
+	"- [x] done\n- [ ] open\n\n" +
+	"```go\nfunc main() {}\n```\n\n" +
+	"<script>alert(1)</script>\n\n" +
+	"[click](javascript:alert(1))\n\n" +
+	"![public](img/public.png) ![private](img/private.png) ![external](https://example.com/x.png)\n"
+
+func TestResourceHandler_Markdown(t *testing.T) {
+	dataDir := t.TempDir()
+	restService, rs, _, key, _, _, err := httpapi.SetupExistingTestUpload(dataDir, "123", "other.txt", false, false)
+	if err != nil {
+		t.Fatalf("Setup error: %v", err)
+	}
+
+	folderUUID, err := rs.CreateFolder(&store.Resource{Name: "img", APIKeyUUID: key.UUID})
+	if err != nil {
+		t.Fatalf("Error creating folder: %v", err)
+	}
+	save := func(name string, parentUUID *string, isPrivate bool, content string) string {
+		t.Helper()
+		u, err := rs.SaveUploadedFile(strings.NewReader(content), &store.Resource{
+			Name: name, IsPrivate: isPrivate, ParentUUID: parentUUID, APIKeyUUID: key.UUID,
+		}, false)
+		if err != nil {
+			t.Fatalf("Error saving %s: %v", name, err)
+		}
+		return u
+	}
+	publicImg := save("public.png", &folderUUID, false, "png")
+	privateImg := save("private.png", &folderUUID, true, "png2")
+	publicDoc := save("README.md", nil, false, testMarkdown)
+	privateDoc := save("NOTES.md", nil, true, testMarkdown)
+
+	w := viewLink(restService, publicDoc)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	body := w.Body.String()
+
+	for _, want := range []string{
+		"<h1>Release notes</h1>",
+		"<table>",
+		`<input checked="" disabled="" type="checkbox"`,
+		`<span class="kd">func</span>`,
+		`id="show-source"`,
+		config.EndpointRaw + publicImg + "?expires=",
+		`src="img/private.png"`,
+		`src="https://example.com/x.png"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %q in the rendered Markdown", want)
+		}
+	}
+	for _, unwanted := range []string{"<script>", `href="javascript:`, privateImg} {
+		if strings.Contains(body, unwanted) {
+			t.Errorf("Unexpected %q in the rendered Markdown", unwanted)
+		}
+	}
+	if csp := w.Header().Get("Content-Security-Policy"); strings.Contains(csp, "script-src") || !strings.Contains(csp, "img-src 'self'") {
+		t.Errorf("Unexpected Content-Security-Policy %q", csp)
+	}
+
+	// the owner also sees private images
+	req := httptest.NewRequest(http.MethodGet, config.EndpointView+privateDoc, nil)
+	req.Header.Set("Authorization", "Bearer 123")
+	w = httptest.NewRecorder()
+	restService.ResourceHandler(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), config.EndpointRaw+privateImg+"?expires=") {
+		t.Errorf("Expected a signed URL of the private image, got %d", w.Code)
+	}
+}
@@ -0,0 +1,145 @@
+package httpapi
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/twigman/fshare/src/config"
+	"github.com/twigman/fshare/src/utils"
+)
+
+const (
+	// how long a correct password grants access to a resource
+	passwordAccessDuration = time.Hour
+	passwordCookiePrefix   = "fshare_access_"
+	// the cookie is sent to every endpoint showing the link (view, info, thumbnails); its name contains the link ID
+	passwordCookiePath = "/fshare/"
+)
+
+// passwordAccessData is the signed content of an access cookie
+func passwordAccessData(id string, expires string) string {
+	return "access|" + id + "|" + expires
+}
+
+// hasPasswordAccess reports whether the request may access a password protected link,
+// either as owner of the file or with a cookie issued after entering the password
+func (s *RESTService) hasPasswordAccess(r *http.Request, link *shareLink) bool {
+	if s.bearerKeyUUID(r) == link.res.APIKeyUUID {
+		return true
+	}
+
+	cookie, err := r.Cookie(passwordCookiePrefix + link.id)
+	if err != nil {
+		return false
+	}
+
+	// <expires>.<key ID>.<signature>
+	parts := strings.SplitN(cookie.Value, ".", 3)
+	if len(parts) != 3 {
+		return false
+	}
+	expires, kid, signature := parts[0], parts[1], parts[2]
+	expiresInt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresInt {
+		return false
+	}
+
+	return s.hmacVerify(passwordAccessData(link.id, expires), kid, signature)
+}
+
+// handlePasswordSubmit checks the password submitted with the parsed form and on success sets the access cookie
+// and redirects back to the view. Attempts are limited per client IP and per link against guessing and to bound
+// the CPU time spent on hashing.
+func (s *RESTService) handlePasswordSubmit(w http.ResponseWriter, r *http.Request, link *shareLink) {
+	now := time.Now()
+	ok, wait := s.passwordIPLimiter.allow(s.clientIP(r), now)
+	if ok {
+		// attempts rejected for the IP do not count for the link
+		ok, wait = s.passwordLinkLimiter.allow(link.id, now)
+	}
+	if !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		renderPasswordPrompt(w, http.StatusTooManyRequests, link.res.Name, "Too many attempts, please try again later")
+		return
+	}
+
+	s.passwordSlots <- struct{}{}
+	ok = utils.VerifyPassword(*link.passwordHash(), r.PostForm.Get("password"))
+	<-s.passwordSlots
+	if !ok {
+		renderPasswordPrompt(w, http.StatusUnauthorized, link.res.Name, "Wrong password")
+		return
+	}
+
+	expiry := time.Now().Add(passwordAccessDuration)
+	expires := fmt.Sprintf("%d", expiry.Unix())
+	kid, signature, err := s.hmacSign(passwordAccessData(link.id, expires))
+	if err != nil {
+		writeJSONStatus(w, http.StatusInternalServerError, "Failed to grant access")
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     passwordCookiePrefix + link.id,
+		Value:    expires + "." + kid + "." + signature,
+		Path:     passwordCookiePath,
+		Expires:  expiry,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(s.requestBaseURL(r), "https://"),
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.Redirect(w, r, config.EndpointView+link.id, http.StatusSeeOther)
+}
+
+func renderPasswordPrompt(w http.ResponseWriter, status int, name string, errMsg string) {
+	nonce := generateNonce()
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", fmt.Sprintf(
+		"default-src 'none'; style-src 'nonce-%s'; form-action 'self'; base-uri 'none';", nonce,
+	))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	var errLine string
+	if errMsg != "" {
+		errLine = fmt.Sprintf(`<p class="error">%s</p>`, html.EscapeString(errMsg))
+	}
+
+	fmt.Fprintf(w, `
+		<!DOCTYPE html>
+		<html lang="en">
+		<head>
+		<meta charset="utf-8">
+		<title>Password required</title>
+		<style nonce="%s">
+			body {
+			margin: 0;
+			background-color: #0d1117;
+			color: #c9d1d9;
+			font-family: sans-serif;
+			display: flex;
+			align-items: center;
+			justify-content: center;
+			height: 100vh;
+			}
+
+			.error {
+			color: #f85149;
+			}
+		</style>
+		</head>
+		<body>
+		<form method="post">
+		<p>%s is password protected.</p>
+		%s
+		<input type="password" name="password" autofocus required>
+		<button type="submit">Open</button>
+		</form>
+		</body>
+		</html>
+		`, nonce, html.EscapeString(name), errLine)
+}
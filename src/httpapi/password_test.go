@@ -0,0 +1,201 @@
+package httpapi_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/twigman/fshare/src/config"
+	"github.com/twigman/fshare/src/httpapi"
+)
+
+func putProtectedFile(t *testing.T, restService *httpapi.RESTService, query string) string {
+	t.Helper()
+	w := putUpload(restService, config.EndpointPut+"notes.txt"+query, "secret notes", map[string]string{
+		"Accept":          "application/json",
+		"Fshare-Password": "hunter2",
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	var res httpapi.PutUploadResponse
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	return res.UUID
+}
+
+func submitPassword(restService *httpapi.RESTService, fileUUID string, password string) *httptest.ResponseRecorder {
+	form := url.Values{"password": {password}}
+	req := httptest.NewRequest(http.MethodPost, config.EndpointView+fileUUID, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	restService.ResourceHandler(w, req)
+	return w
+}
+
+func TestResourceHandler_PasswordProtected(t *testing.T) {
+	restService, rs, _, _ := setupFolderTest(t)
+	fileUUID := putProtectedFile(t, restService, "")
+
+	r, err := rs.GetResourceByUUID(fileUUID)
+	if err != nil {
+		t.Fatalf("Resource does not exist: %v", err)
+	}
+	if r.PasswordHash == nil || strings.Contains(*r.PasswordHash, "hunter2") {
+		t.Fatalf("Expected hashed password, got %v", r.PasswordHash)
+	}
+
+	// prompt
+	req := httptest.NewRequest(http.MethodGet, config.EndpointView+fileUUID, nil)
+	w := httptest.NewRecorder()
+	restService.ResourceHandler(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `name="password"`) || strings.Contains(w.Body.String(), "secret notes") {
+		t.Errorf("Expected password prompt, got %q", w.Body.String())
+	}
+
+	// wrong password
+	w = submitPassword(restService, fileUUID, "wrong")
+	if w.Code != http.StatusUnauthorized || len(w.Result().Cookies()) != 0 {
+		t.Fatalf("Expected %d without cookie, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	// correct password
+	w = submitPassword(restService, fileUUID, "hunter2")
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected %d, got %d", http.StatusSeeOther, w.Code)
+	}
+	if loc := w.Header().Get("Location"); loc != config.EndpointView+fileUUID {
+		t.Errorf("Unexpected redirect to %q", loc)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || !cookies[0].HttpOnly {
+		t.Fatalf("Expected one HttpOnly cookie, got %+v", cookies)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, config.EndpointView+fileUUID, nil)
+	req.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	restService.ResourceHandler(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "secret notes") {
+		t.Errorf("Expected content with cookie, got %d", w.Code)
+	}
+
+	// manipulated cookie
+	req = httptest.NewRequest(http.MethodGet, config.EndpointView+fileUUID, nil)
+	req.AddCookie(&http.Cookie{Name: cookies[0].Name, Value: "9999999999.abcdef"})
+	w = httptest.NewRecorder()
+	restService.ResourceHandler(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected %d for forged cookie, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	// the owner does not need the password
+	req = httptest.NewRequest(http.MethodGet, config.EndpointView+fileUUID, nil)
+	req.Header.Set("Authorization", "Bearer 123")
+	w = httptest.NewRecorder()
+	restService.ResourceHandler(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected %d for owner, got %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestResourceInfoHandler_PasswordProtected(t *testing.T) {
+	restService, _, _, _ := setupFolderTest(t)
+	fileUUID := putProtectedFile(t, restService, "")
+
+	w, _ := getInfo(t, restService, fileUUID, "")
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	// the cookie must be sent by browsers to the info endpoint as well
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatalf("Cookie jar error: %v", err)
+	}
+	viewURL, _ := url.Parse("http://example.com" + config.EndpointView + fileUUID)
+	jar.SetCookies(viewURL, submitPassword(restService, fileUUID, "hunter2").Result().Cookies())
+	infoURL, _ := url.Parse("http://example.com" + config.EndpointInfo + fileUUID)
+	cookies := jar.Cookies(infoURL)
+	if len(cookies) != 1 {
+		t.Fatalf("Expected access cookie for the info endpoint, got %+v", cookies)
+	}
+	req := httptest.NewRequest(http.MethodGet, config.EndpointInfo+fileUUID, nil)
+	req.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	restService.ResourceInfoHandler(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected %d with cookie, got %d", http.StatusOK, w.Code)
+	}
+
+	_, info := getInfo(t, restService, fileUUID, "123")
+	if info == nil || !info.IsPasswordProtected || !info.IsOwner {
+		t.Errorf("Unexpected info for owner: %+v", info)
+	}
+}
+
+func TestPutUploadHandler_PasswordIgnoredForPrivate(t *testing.T) {
+	restService, rs, _, _ := setupFolderTest(t)
+	fileUUID := putProtectedFile(t, restService, "?is_private=true")
+
+	r, err := rs.GetResourceByUUID(fileUUID)
+	if err != nil {
+		t.Fatalf("Resource does not exist: %v", err)
+	}
+	if r.PasswordHash != nil {
+		t.Errorf("Expected no password for private file")
+	}
+}
+
+func TestResourceHandler_PasswordAttemptsLimited(t *testing.T) {
+	restService, _, _, _ := setupFolderTest(t)
+	fileUUID := putProtectedFile(t, restService, "")
+	otherUUID := putProtectedFile(t, restService, "")
+
+	for i := range 10 {
+		if w := submitPassword(restService, fileUUID, "wrong"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("Attempt %d: expected %d, got %d", i+1, http.StatusUnauthorized, w.Code)
+		}
+	}
+
+	// further attempts of the same client are rejected without checking the password, on every link
+	for _, id := range []string{fileUUID, otherUUID} {
+		w := submitPassword(restService, id, "hunter2")
+		if w.Code != http.StatusTooManyRequests || len(w.Result().Cookies()) != 0 {
+			t.Errorf("Expected %d without cookie, got %d", http.StatusTooManyRequests, w.Code)
+		}
+		if w.Header().Get("Retry-After") == "" {
+			t.Errorf("Expected Retry-After header")
+		}
+	}
+
+	// guessing from many IPs is limited per link
+	submitFrom := func(ip string) int {
+		form := url.Values{"password": {"wrong"}}
+		req := httptest.NewRequest(http.MethodPost, config.EndpointView+otherUUID, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		restService.ResourceHandler(w, req)
+		return w.Code
+	}
+	for i := range 30 {
+		if code := submitFrom(fmt.Sprintf("198.51.100.%d", i)); code != http.StatusUnauthorized {
+			t.Fatalf("Attempt %d: expected %d, got %d", i+1, http.StatusUnauthorized, code)
+		}
+	}
+	if code := submitFrom("203.0.113.1"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected %d after too many attempts on the link, got %d", http.StatusTooManyRequests, code)
+	}
+}
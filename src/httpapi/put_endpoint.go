@@ -0,0 +1,156 @@
+package httpapi
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/twigman/fshare/src/config"
+	"github.com/twigman/fshare/src/internal/apperror"
+	"github.com/twigman/fshare/src/store"
+	"github.com/twigman/fshare/src/utils"
+)
+
+// validity of the signed raw URL returned by PutUploadHandler
+const putRawURLExpiry = 24 * time.Hour
+
+// PutUploadHandler stores the plain request body as file, e.g. for curl -T or --data-binary.
+// Options are read from query parameters or Fshare-* headers.
+func (s *RESTService) PutUploadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodPost {
+		writeJSONStatus(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	keyUUID, err := s.authorizeBearer(w, r)
+	if err != nil {
+		return
+	}
+
+	filename := strings.TrimPrefix(r.URL.Path, config.EndpointPut)
+	if filename == "" || strings.Contains(filename, "/") {
+		writeJSONStatus(w, http.StatusBadRequest, apperror.ErrFileInvalidFilename.Msg)
+		return
+	}
+
+	// upload limit
+	if s.config.IsUploadLimited() {
+		if r.ContentLength > s.config.MaxFileSizeBytes() {
+			writeJSONStatus(w, http.StatusRequestEntityTooLarge, "File too large")
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, s.config.MaxFileSizeBytes())
+	}
+
+	// read options
+	isPrivate := putOption(r, "is_private", "Fshare-Is-Private") == "true"
+
+	var parentUUID *string
+	if parent := putOption(r, "parent", "Fshare-Parent"); parent != "" {
+		parentUUID = &parent
+	}
+
+	var autoDeleteAt *time.Time // default no auto delete
+	if autoDelIn := parseAutoDeleteIn(putOption(r, "auto_del_in", "Fshare-Auto-Del-In")); autoDelIn != nil {
+		autoDeleteTime := time.Now().Add(*autoDelIn).UTC()
+		autoDeleteAt = &autoDeleteTime
+	}
+
+	maxDownloads, err := parseMaxDownloads(putOption(r, "max_downloads", "Fshare-Max-Downloads"))
+	if err != nil {
+		writeJSONStatus(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// the password is only accepted as header, query parameters end up in logs
+	var passwordHash *string
+	if password := r.Header.Get("Fshare-Password"); password != "" && !isPrivate {
+		hash, err := utils.HashPassword(password)
+		if err != nil {
+			writeJSONStatus(w, http.StatusInternalServerError, "Could not hash password")
+			return
+		}
+		passwordHash = &hash
+	}
+
+	staged, err := s.resourceService.StageUpload(keyUUID, r.Body, s.config.MaxFileSizeBytes())
+	if err == apperror.ErrFileInvalidFilepath {
+		writeJSONStatus(w, http.StatusInternalServerError, "Could not save file")
+		return
+	}
+	if err != nil {
+		writeUploadStreamError(w, err)
+		return
+	}
+
+	res := &store.Resource{
+		Name:         filename,
+		IsPrivate:    isPrivate,
+		ParentUUID:   parentUUID,
+		APIKeyUUID:   keyUUID,
+		AutoDeleteAt: autoDeleteAt,
+		PasswordHash: passwordHash,
+		MaxDownloads: maxDownloads,
+	}
+
+	versioning := putOption(r, "versioning", "Fshare-Versioning") == "true"
+	fileUUID, err := s.saveStagedUpload(staged, res, versioning)
+	if err != nil {
+		writeSaveFileError(w, err)
+		return
+	}
+
+	base := s.requestBaseURL(r)
+	// the raw endpoint only shows viewer types inline, an uploaded HTML file is downloaded through this URL
+	expiry := time.Now().Add(putRawURLExpiry).UTC()
+	rawURL, err := s.generateSignedURL(config.EndpointRaw, fileUUID, expiry)
+	if err != nil {
+		writeJSONStatus(w, http.StatusInternalServerError, "Failed to generate signed URL")
+		return
+	}
+
+	resp := PutUploadResponse{
+		UUID:            fileUUID,
+		Name:            res.Name,
+		Version:         res.Version,
+		ViewURL:         base + config.EndpointView + fileUUID,
+		RawURL:          base + rawURL,
+		RawURLExpiresAt: expiry.Truncate(time.Second),
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		writeJSONResponse(w, http.StatusCreated, resp)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprintf(w, "uuid: %s\nview: %s\nraw:  %s\n", resp.UUID, resp.ViewURL, resp.RawURL)
+}
+
+// putOption returns an upload option from the query or, if not set there, from a header
+func putOption(r *http.Request, queryParam string, header string) string {
+	if v := r.URL.Query().Get(queryParam); v != "" {
+		return v
+	}
+	return r.Header.Get(header)
+}
+
+// requestBaseURL returns scheme and host the client used to reach the service.
+// X-Forwarded-Proto and X-Forwarded-Host are only used if the request comes from a trusted proxy, otherwise
+// any client could make the service return links to another host.
+func (s *RESTService) requestBaseURL(r *http.Request) string {
+	fromProxy := s.config.IsTrustedProxy(r.RemoteAddr)
+
+	scheme := "http"
+	if r.TLS != nil || (fromProxy && r.Header.Get("X-Forwarded-Proto") == "https") {
+		scheme = "https"
+	}
+
+	host := r.Host
+	if fwdHost := r.Header.Get("X-Forwarded-Host"); fromProxy && fwdHost != "" {
+		host = fwdHost
+	}
+	return scheme + "://" + host
+}
@@ -0,0 +1,206 @@
+package httpapi_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/twigman/fshare/src/config"
+	"github.com/twigman/fshare/src/httpapi"
+)
+
+func putUpload(restService *httpapi.RESTService, path string, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer 123")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+
+	restService.PutUploadHandler(w, req)
+	return w
+}
+
+func TestPutUploadHandler_JSON(t *testing.T) {
+	restService, rs, _, _ := setupFolderTest(t)
+
+	w := putUpload(restService, config.EndpointPut+"build.log?is_private=true", "log line", map[string]string{
+		"Accept":             "application/json",
+		"Fshare-Auto-Del-In": "2d",
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	var res httpapi.PutUploadResponse
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	if res.Name != "build.log" {
+		t.Errorf("Unexpected name %q", res.Name)
+	}
+	if res.ViewURL != "http://example.com"+config.EndpointView+res.UUID {
+		t.Errorf("Unexpected view URL %q", res.ViewURL)
+	}
+	if !strings.HasPrefix(res.RawURL, "http://example.com"+config.EndpointRaw+res.UUID+"?expires=") {
+		t.Errorf("Unexpected raw URL %q", res.RawURL)
+	}
+
+	r, err := rs.GetResourceByUUID(res.UUID)
+	if err != nil {
+		t.Fatalf("Resource does not exist: %v", err)
+	}
+	if !r.IsPrivate || r.AutoDeleteAt == nil || r.Size != 8 {
+		t.Errorf("Unexpected resource: %+v", r)
+	}
+
+	savedPath, err := httpapi.StoredFilePath(rs, res.UUID)
+	if err != nil {
+		t.Fatalf("Path error: %v", err)
+	}
+	data, err := os.ReadFile(savedPath)
+	if err != nil {
+		t.Fatalf("File not saved: %v", err)
+	}
+	if string(data) != "log line" {
+		t.Errorf("Wrong file content %q", data)
+	}
+
+	// the raw URL is ready to use
+	rawPath := strings.TrimPrefix(res.RawURL, "http://example.com")
+	req := httptest.NewRequest(http.MethodGet, rawPath, nil)
+	rw := httptest.NewRecorder()
+	restService.RawResourceHandler(rw, req)
+	if rw.Code != http.StatusOK || rw.Body.String() != "log line" {
+		t.Errorf("Raw URL not usable: %d %q", rw.Code, rw.Body.String())
+	}
+}
+
+func TestPutUploadHandler_HTMLRawURLDownloads(t *testing.T) {
+	restService, _, _, _ := setupFolderTest(t)
+
+	w := putUpload(restService, config.EndpointPut+"evil.html", "<script>alert(1)</script>", map[string]string{"Accept": "application/json"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var res httpapi.PutUploadResponse
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+
+	// the returned raw URL must not render the upload on the fshare origin
+	req := httptest.NewRequest(http.MethodGet, strings.TrimPrefix(res.RawURL, "http://example.com"), nil)
+	rw := httptest.NewRecorder()
+	restService.RawResourceHandler(rw, req)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("Expected %d, got %d", http.StatusOK, rw.Code)
+	}
+	if ct := rw.Header().Get("Content-Type"); ct != "application/octet-stream" {
+		t.Errorf("Expected application/octet-stream, got %q", ct)
+	}
+	if cd := rw.Header().Get("Content-Disposition"); !strings.HasPrefix(cd, "attachment") {
+		t.Errorf("Expected attachment, got Content-Disposition %q", cd)
+	}
+}
+
+func TestPutUploadHandler_PlainText(t *testing.T) {
+	restService, _, _, _ := setupFolderTest(t)
+
+	w := putUpload(restService, config.EndpointPut+"a.txt", "a", nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("Unexpected Content-Type %q", w.Header().Get("Content-Type"))
+	}
+
+	body := w.Body.String()
+	if !strings.Contains(body, "view: http://example.com"+config.EndpointView) || !strings.Contains(body, "raw:  http://example.com"+config.EndpointRaw) {
+		t.Errorf("Unexpected body %q", body)
+	}
+
+	// same name again is renamed
+	w = putUpload(restService, config.EndpointPut+"a.txt", "b", map[string]string{"Accept": "application/json"})
+	var res httpapi.PutUploadResponse
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	if res.Name != "0a.txt" {
+		t.Errorf("Expected renamed file, got %q", res.Name)
+	}
+}
+
+func TestPutUploadHandler_ForwardedHeaders(t *testing.T) {
+	restService, _, _, cfg := setupFolderTest(t)
+	forwarded := map[string]string{
+		"Accept":            "application/json",
+		"X-Forwarded-Host":  "evil.example",
+		"X-Forwarded-Proto": "https",
+	}
+
+	viewURL := func() string {
+		t.Helper()
+		w := putUpload(restService, config.EndpointPut+"a.txt", "a", forwarded)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+		}
+		var res httpapi.PutUploadResponse
+		if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+			t.Fatalf("Failed to decode JSON: %v", err)
+		}
+		return strings.TrimSuffix(res.ViewURL, res.UUID)
+	}
+
+	// headers of arbitrary clients are ignored
+	if u := viewURL(); u != "http://example.com"+config.EndpointView {
+		t.Errorf("Expected forwarded headers to be ignored, got %q", u)
+	}
+
+	// httptest requests come from 192.0.2.1
+	cfg.TrustedProxies = []string{"192.0.2.0/24"}
+	if u := viewURL(); u != "https://evil.example"+config.EndpointView {
+		t.Errorf("Expected forwarded headers of a trusted proxy to be used, got %q", u)
+	}
+}
+
+func TestPutUploadHandler_InvalidRequests(t *testing.T) {
+	restService, _, _, _ := setupFolderTest(t)
+
+	tests := []struct {
+		name   string
+		path   string
+		body   string
+		status int
+	}{
+		{"no filename", config.EndpointPut, "x", http.StatusBadRequest},
+		{"hidden file", config.EndpointPut + ".env", "x", http.StatusBadRequest},
+		{"nested path", config.EndpointPut + "a%2Fb.txt", "x", http.StatusBadRequest},
+		{"invalid parent", config.EndpointPut + "a.txt?parent=nope", "x", http.StatusBadRequest},
+		{"too large", config.EndpointPut + "big.bin", strings.Repeat("A", 6<<20), http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := putUpload(restService, tt.path, tt.body, nil)
+			if w.Code != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, w.Code)
+			}
+		})
+	}
+}
+
+func TestPutUploadHandler_WrongMethod(t *testing.T) {
+	restService, _, _, _ := setupFolderTest(t)
+
+	req := httptest.NewRequest(http.MethodGet, config.EndpointPut+"a.txt", nil)
+	req.Header.Set("Authorization", "Bearer 123")
+	w := httptest.NewRecorder()
+	restService.PutUploadHandler(w, req)
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
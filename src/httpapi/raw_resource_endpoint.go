@@ -1,14 +1,14 @@
 package httpapi
 
 import (
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
-	"mime"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strings"
 
 	"github.com/twigman/fshare/src/config"
+	"github.com/twigman/fshare/src/storage"
 )
 
 func (s *RESTService) RawResourceHandler(w http.ResponseWriter, r *http.Request) {
@@ -17,44 +17,81 @@ func (s *RESTService) RawResourceHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// query paramters are not in the path
-	file_uuid := strings.TrimPrefix(r.URL.Path, config.EndpointRaw)
+	// query paramters are not in the path; UUID of the file or token of a share
+	id := strings.TrimPrefix(r.URL.Path, config.EndpointRaw)
 
-	if !s.isValidSignedRequest(r, file_uuid) {
+	// files need a signed URL, shares without password can be downloaded directly
+	isSigned := s.isValidSignedRequest(r, id)
+	link := s.resolveShareLink(id)
+	if !isSigned && (link == nil || link.share == nil || link.passwordHash() != nil) {
 		writeJSONStatus(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
-
-	res, err := s.resourceService.GetResourceByUUID(file_uuid)
-	if err != nil || res == nil || !res.IsFile || res.DeletedAt != nil || res.IsBroken {
+	if link == nil {
 		writeJSONStatus(w, http.StatusNotFound, "Not found")
 		return
 	}
+	res := link.res
 
-	resPath, err := s.resourceService.BuildResourcePath(res)
+	content, err := s.resourceService.OpenResource(res)
+	if err == storage.ErrNotExist {
+		_ = s.resourceService.MarkResourceAsBroken(res.UUID)
+		writeJSONStatus(w, http.StatusNotFound, "File not found")
+		return
+	}
 	if err != nil {
-		writeJSONStatus(w, http.StatusInternalServerError, "Could not resolve filepath")
+		writeJSONStatus(w, http.StatusInternalServerError, "Could not read file")
 		return
 	}
 
-	if _, err := os.Stat(resPath); err != nil {
-		_ = s.resourceService.MarkResourceAsBroken(res.UUID)
-		writeJSONStatus(w, http.StatusNotFound, "File not found")
+	ok, lastDownload := true, false
+	if link.isLimited() {
+		ok, lastDownload = s.countDownload(w, link)
+		serveWholeContent(r)
+	}
+	defer func() {
+		content.Close()
+		if lastDownload {
+			s.expireDownloadedResource(res)
+		}
+	}()
+	if !ok {
 		return
 	}
 
-	fileExt := filepath.Ext(res.Name)
-	mimeType := mime.TypeByExtension(fileExt)
-	if mimeType == "" {
-		mimeType = "application/octet-stream"
+	keyIsHighlyTrusted, err := s.apiKeyService.IsAPIKeyHighlyTrusted(res.APIKeyUUID)
+	if err != nil {
+		// proceed
+		keyIsHighlyTrusted = false
 	}
-	w.Header().Set("Content-Type", mimeType)
 
-	if r.URL.Query().Get("download") == "true" {
+	// raw URLs are handed out for any file, so a document must not be able to run scripts on this origin
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox; default-src 'none'")
+
+	inlineType := rawInlineType(res.Name, keyIsHighlyTrusted)
+	if inlineType == "" {
+		w.Header().Set("Content-Type", "application/octet-stream")
 		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", res.Name))
 	} else {
-		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Type", inlineType)
+		if r.URL.Query().Get("download") == "true" {
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", res.Name))
+		}
 	}
 
-	http.ServeFile(w, r, resPath)
+	setDigestHeaders(w, res.SHA256)
+	http.ServeContent(w, r, res.Name, content.ModTime, content)
+}
+
+// setDigestHeaders sets ETag and Digest (RFC 3230) from the hex encoded SHA-256 of the full content, so clients can
+// verify downloads and revalidate cached copies. Nothing is set if the checksum is unknown.
+// http.ServeContent answers If-None-Match and If-Range with the ETag.
+func setDigestHeaders(w http.ResponseWriter, sum string) {
+	raw, err := hex.DecodeString(sum)
+	if err != nil || len(raw) != 32 {
+		return
+	}
+	w.Header().Set("ETag", `"`+sum+`"`)
+	w.Header().Set("Digest", "sha-256="+base64.StdEncoding.EncodeToString(raw))
 }
@@ -10,6 +10,9 @@ import (
 	"time"
 
 	"github.com/twigman/fshare/src/config"
+	"github.com/twigman/fshare/src/storage"
+	"github.com/twigman/fshare/src/store"
+	"github.com/twigman/fshare/src/testutil/fake"
 )
 
 func TestRawResourceHandler_MethodNotAllowed(t *testing.T) {
@@ -54,13 +57,16 @@ func TestRawResourceHandler_Unauthorized(t *testing.T) {
 func TestRawResourceHandler_FileMissing(t *testing.T) {
 	dataDir := t.TempDir()
 	filename := "missing.txt"
-	restService, rs, _, key, cfg, fileUUID, err := SetupExistingTestUpload(dataDir, "apikey", filename, false, false)
+	restService, rs, _, _, _, fileUUID, err := SetupExistingTestUpload(dataDir, "apikey", filename, false, false)
 	if err != nil {
 		t.Fatalf("Setup error: %v", err)
 	}
 
 	// delete file
-	filePath := filepath.Join(cfg.UploadPath, key.UUID, filename)
+	filePath, err := StoredFilePath(rs, fileUUID)
+	if err != nil {
+		t.Fatalf("Path error: %v", err)
+	}
 	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
 		t.Fatalf("Remove error: %v", err)
 	}
@@ -181,3 +187,146 @@ func TestRawResourceHandler_DownloadHeader(t *testing.T) {
 		t.Errorf("Expected attachment in Content-Disposition, got %s", disp)
 	}
 }
+
+func TestRawResourceHandler_InlineTypes(t *testing.T) {
+	tests := []struct {
+		filename    string
+		trusted     bool
+		contentType string
+		attachment  bool
+	}{
+		{"photo.png", false, "image/png", false},
+		{"clip.mp4", false, "video/mp4", false},
+		{"main.go", false, "text/plain; charset=utf-8", false},
+		{"page.html", false, "application/octet-stream", true},
+		{"drawing.svg", false, "application/octet-stream", true},
+		{"drawing.svg", true, "image/svg+xml", false},
+		{"page.htm", true, "application/octet-stream", true},
+		{"archive.zip", false, "application/octet-stream", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			restService, _, _, _, _, fileUUID, err := SetupExistingTestUpload(t.TempDir(), "apikey", tt.filename, false, tt.trusted)
+			if err != nil {
+				t.Fatalf("Setup error: %v", err)
+			}
+			signURL, err := restService.generateSignedURL(config.EndpointRaw, fileUUID, time.Now().Add(5*time.Second))
+			if err != nil {
+				t.Fatalf("Signing error: %v", err)
+			}
+
+			w := httptest.NewRecorder()
+			restService.RawResourceHandler(w, httptest.NewRequest(http.MethodGet, signURL, nil))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected %d, got %d", http.StatusOK, w.Code)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != tt.contentType {
+				t.Errorf("Expected Content-Type %q, got %q", tt.contentType, ct)
+			}
+			if disp := w.Header().Get("Content-Disposition"); strings.HasPrefix(disp, "attachment") != tt.attachment {
+				t.Errorf("Expected attachment %v, got Content-Disposition %q", tt.attachment, disp)
+			}
+			if w.Header().Get("X-Content-Type-Options") != "nosniff" {
+				t.Errorf("Expected nosniff")
+			}
+			if csp := w.Header().Get("Content-Security-Policy"); csp != "sandbox; default-src 'none'" {
+				t.Errorf("Expected sandbox CSP, got %q", csp)
+			}
+		})
+	}
+}
+
+func TestRawResourceHandler_S3BackendRange(t *testing.T) {
+	dataDir := t.TempDir()
+	cfg := &config.Config{
+		DataPath:   dataDir,
+		UploadPath: filepath.Join(dataDir, "upload"),
+	}
+
+	ts := httptest.NewServer(fake.NewS3Server("access"))
+	defer ts.Close()
+	backend, err := storage.NewS3(config.S3Config{Endpoint: ts.URL, Bucket: "fshare", AccessKey: "access", SecretKey: "secret"}, ts.Client())
+	if err != nil {
+		t.Fatalf("Backend error: %v", err)
+	}
+
+	db, err := store.NewDB(cfg.DataPath)
+	if err != nil {
+		t.Fatalf("DB error: %v", err)
+	}
+	as := store.NewAPIKeyService(db)
+	rs := store.NewResourceServiceWithStorage(cfg, db, backend)
+	restService := NewRESTService(cfg, as, rs)
+
+	key, err := as.AddAPIKey("123", "test key", false, nil)
+	if err != nil {
+		t.Fatalf("API key error: %v", err)
+	}
+	if err := store.CreateDirsFromConfig(cfg); err != nil {
+		t.Fatalf("Dir error: %v", err)
+	}
+	if _, err := rs.GetOrCreateHomeDir(key.HashedKey); err != nil {
+		t.Fatalf("Home dir error: %v", err)
+	}
+	fileUUID, err := rs.SaveUploadedFile(strings.NewReader("Hello World"), &store.Resource{Name: "a.txt", APIKeyUUID: key.UUID}, false)
+	if err != nil {
+		t.Fatalf("Upload error: %v", err)
+	}
+
+	signURL, err := restService.generateSignedURL(config.EndpointRaw, fileUUID, time.Now().Add(30*time.Second))
+	if err != nil {
+		t.Fatalf("Signing error: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, signURL, nil)
+	req.Header.Set("Range", "bytes=6-")
+	w := httptest.NewRecorder()
+	restService.RawResourceHandler(w, req)
+
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("Expected %d, got %d", http.StatusPartialContent, w.Code)
+	}
+	if w.Body.String() != "World" {
+		t.Errorf("Expected %q, got %q", "World", w.Body.String())
+	}
+}
+
+func TestRawResourceHandler_DigestHeaders(t *testing.T) {
+	dataDir := t.TempDir()
+	restService, _, _, _, _, fileUUID, err := SetupExistingTestUpload(dataDir, "apikey", "test.txt", false, false)
+	if err != nil {
+		t.Fatalf("Setup error: %v", err)
+	}
+
+	signURL, err := restService.generateSignedURL(config.EndpointRaw, fileUUID, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Signing error: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, signURL, nil)
+	w := httptest.NewRecorder()
+	restService.RawResourceHandler(w, req)
+
+	// SHA-256 of "Hello World"
+	const etag = `"a591a6d40bf420404a011733cfb7b190d62c65bf0bcda32b57b277d9ad9f146e"`
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected %d, got %d", http.StatusOK, w.Code)
+	}
+	if got := w.Header().Get("ETag"); got != etag {
+		t.Errorf("Unexpected ETag %q", got)
+	}
+	if got := w.Header().Get("Digest"); got != "sha-256=pZGm1Av0IEBKARczz7exkNYsZb8LzaMrV7J32a2fFG4=" {
+		t.Errorf("Unexpected Digest %q", got)
+	}
+
+	// cached copies are revalidated with the ETag
+	req = httptest.NewRequest(http.MethodGet, signURL, nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	restService.RawResourceHandler(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("Expected %d, got %d", http.StatusNotModified, w.Code)
+	}
+}
@@ -5,31 +5,52 @@ import (
 	"encoding/base64"
 	"fmt"
 	"html"
-	"mime"
+	"io"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/twigman/fshare/src/config"
+	"github.com/twigman/fshare/src/storage"
 )
 
+// mediaPlaybackExpiry is the validity of the signed raw URL of audio and video files in the media viewer
+const mediaPlaybackExpiry = 6 * time.Hour
+
+// viewerRawURLExpiry is the validity of the signed raw URL used by the copy and download buttons of the text viewer
+const viewerRawURLExpiry = time.Hour
+
+// maxViewFormSize limits the forms posted to the view, i.e. password and confirmation
+const maxViewFormSize = 4096
+
 func (s *RESTService) ResourceHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+	// POST is used to submit the password of a protected resource and to confirm
+	// the view of a file with a download limit
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
 		writeJSONStatus(w, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
-	file_uuid := strings.TrimPrefix(r.URL.Path, config.EndpointView)
+	// UUID of the file or token of a share
+	id := strings.TrimPrefix(r.URL.Path, config.EndpointView)
 
-	res, err := s.resourceService.GetResourceByUUID(file_uuid)
-	if err != nil || res == nil || !res.IsFile || res.DeletedAt != nil || res.IsBroken {
+	link := s.resolveShareLink(id)
+	if link == nil {
 		writeJSONStatus(w, http.StatusNotFound, "Not found")
 		return
 	}
+	res := link.res
+
+	if r.Method == http.MethodPost {
+		r.Body = http.MaxBytesReader(w, r.Body, maxViewFormSize)
+		if err := r.ParseForm(); err != nil {
+			writeJSONStatus(w, http.StatusBadRequest, "Invalid form")
+			return
+		}
+	}
 
-	if res.IsPrivate {
+	if link.isPrivate() {
 		keyUUID, err := s.authorizeBearer(w, r)
 		if err != nil {
 			return
@@ -39,30 +60,57 @@ func (s *RESTService) ResourceHandler(w http.ResponseWriter, r *http.Request) {
 			writeJSONStatus(w, http.StatusUnauthorized, "Authorization failed")
 			return
 		}
+	} else if link.passwordHash() != nil {
+		if r.PostForm.Has("password") {
+			s.handlePasswordSubmit(w, r, link)
+			return
+		}
+		if !s.hasPasswordAccess(r, link) {
+			renderPasswordPrompt(w, http.StatusUnauthorized, res.Name, "")
+			return
+		}
 	}
 
-	resPath, err := s.resourceService.BuildResourcePath(res)
-	if err != nil {
-		writeJSONStatus(w, http.StatusInternalServerError, "Could not resolve filepath")
+	isLimited := link.isLimited()
+	if isLimited && r.PostForm.Get("confirm") != "true" {
+		renderDownloadConfirmation(w, res.Name, link.remainingDownloads())
 		return
 	}
+	if r.Method != http.MethodGet && !isLimited {
+		writeJSONStatus(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
 	fileExt := filepath.Ext(res.Name)
 
 	// detect mime type
-	mimeType := mime.TypeByExtension(fileExt)
-	if mimeType == "" {
-		mimeType = "application/octet-stream"
-	}
+	mimeType := detectMimeType(res.Name)
 
-	// present source code in HTML with highlighting
-	content, err := os.ReadFile(resPath)
+	content, err := s.resourceService.OpenResource(res)
 	if err != nil {
-		_ = s.resourceService.MarkResourceAsBroken(res.UUID)
+		if err == storage.ErrNotExist {
+			_ = s.resourceService.MarkResourceAsBroken(res.UUID)
+		}
 
 		writeJSONStatus(w, http.StatusInternalServerError, "Could not read file")
 		return
 	}
 
+	ok, lastDownload := true, false
+	if isLimited {
+		ok, lastDownload = s.countDownload(w, link)
+		serveWholeContent(r)
+	}
+	defer func() {
+		content.Close()
+		if lastDownload {
+			s.expireDownloadedResource(res)
+		}
+	}()
+	if !ok {
+		return
+	}
+
 	keyIsHighlyTrusted, err := s.apiKeyService.IsAPIKeyHighlyTrusted(res.APIKeyUUID)
 	if err != nil {
 		// proceed
@@ -70,23 +118,51 @@ func (s *RESTService) ResourceHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if isRenderableTextFile(fileExt, keyIsHighlyTrusted) {
-		renderText(w, getLangClass(fileExt, keyIsHighlyTrusted), string(content))
+		// present source code in HTML with highlighting, Markdown rendered
+		text, err := io.ReadAll(content)
+		if err != nil {
+			writeJSONStatus(w, http.StatusInternalServerError, "Could not read file")
+			return
+		}
+		lang := getHighlightLang(fileExt, keyIsHighlyTrusted)
+		if lang == "markdown" {
+			// private files are only shown to their owner
+			renderMarkdownView(w, string(text), s.markdownImageResolver(res, link.isPrivate(), keyIsHighlyTrusted))
+			return
+		}
+		// a limited file would count another download when the raw file is fetched
+		var rawURL string
+		if !isLimited {
+			rawURL, err = s.generateSignedURL(config.EndpointRaw, link.id, time.Now().Add(viewerRawURLExpiry))
+			if err != nil {
+				rawURL = ""
+			}
+		}
+		renderText(w, lang, string(text), rawURL)
 	} else if isRenderableImageFile(fileExt, keyIsHighlyTrusted) {
+		// large photos are shown scaled down first
+		if wantsImagePreview(r, link) {
+			s.renderImagePreview(w, link)
+			return
+		}
 		// present images in browser
 		if strings.HasPrefix(mimeType, "image/") {
 			w.Header().Set("Content-Type", mimeType)
 			w.Header().Set("X-Content-Type-Options", "nosniff")
-			http.ServeFile(w, r, resPath)
+			setDigestHeaders(w, res.SHA256)
+			http.ServeContent(w, r, res.Name, content.ModTime, content)
 			return
 		}
-	} else if keyIsHighlyTrusted && isBrowserRenderableFile(fileExt) {
-		s.renderMediaViewer(w, res.UUID, mimeType)
+	} else if isBrowserRenderableFile(fileExt, keyIsHighlyTrusted) && !isLimited {
+		// the viewer loads the file through a second request, which a limited file may not allow
+		s.renderMediaViewer(w, link.id, mimeType)
 		return
 	} else {
 		// force download
 		w.Header().Set("Content-Type", "application/octet-stream")
 		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", res.Name))
-		http.ServeFile(w, r, resPath)
+		setDigestHeaders(w, res.SHA256)
+		http.ServeContent(w, r, res.Name, content.ModTime, content)
 		return
 	}
 }
@@ -104,7 +180,11 @@ func (s *RESTService) renderMediaViewer(w http.ResponseWriter, rUUID string, mim
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.Header().Set("X-Content-Type-Options", "nosniff")
 
+	// audio and video are loaded by range requests while playing, which need a valid URL until the end
 	expiry := time.Now().Add(30 * time.Second)
+	if strings.HasPrefix(mimeType, "video/") || strings.HasPrefix(mimeType, "audio/") {
+		expiry = time.Now().Add(mediaPlaybackExpiry)
+	}
 	signedURL, err := s.generateSignedURL(config.EndpointRaw, rUUID, expiry)
 	if err != nil {
 		writeJSONStatus(w, http.StatusInternalServerError, "Failed to generate signed URL")
@@ -119,6 +199,10 @@ func (s *RESTService) renderMediaViewer(w http.ResponseWriter, rUUID string, mim
 		embed = fmt.Sprintf(`<iframe src="%s" width="100%%" height="100%%" style="border:none;"></iframe>`, escapedPath)
 	case strings.HasPrefix(mimeType, "image/svg"):
 		embed = fmt.Sprintf(`<img src="%s" style="max-width:100%%; max-height:100%%;">`, escapedPath)
+	case strings.HasPrefix(mimeType, "video/"):
+		embed = fmt.Sprintf(`<video src="%s" controls preload="metadata" style="max-width:100%%; max-height:100%%;"></video>`, escapedPath)
+	case strings.HasPrefix(mimeType, "audio/"):
+		embed = fmt.Sprintf(`<audio src="%s" controls preload="metadata" style="width:min(600px, 90%%);"></audio>`, escapedPath)
 	default:
 		http.Error(w, "Unsupported viewer", http.StatusUnsupportedMediaType)
 		return
@@ -131,21 +215,31 @@ func (s *RESTService) renderMediaViewer(w http.ResponseWriter, rUUID string, mim
 	</body></html>`, embed)
 }
 
-func renderText(w http.ResponseWriter, langClass string, content string) {
+// renderText shows highlighted code with line numbers. #L120 or #L120-L140 highlights and scrolls to lines,
+// shift-click on a line number selects a range. rawURL is the signed URL used to copy and download the file,
+// the buttons are left out if it is empty.
+func renderText(w http.ResponseWriter, lang string, content string, rawURL string) {
 	nonce := generateNonce()
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.Header().Set("Content-Security-Policy", fmt.Sprintf(
-		"default-src 'none'; script-src https://cdnjs.cloudflare.com 'nonce-%s'; style-src https://cdnjs.cloudflare.com 'nonce-%s'; img-src 'self'; object-src 'none'; base-uri 'none';",
+		"default-src 'none'; script-src 'nonce-%s'; style-src 'nonce-%s'; connect-src 'self'; img-src 'self'; object-src 'none'; base-uri 'none'; form-action 'none';",
 		nonce, nonce,
 	))
 
+	var buttons string
+	if rawURL != "" {
+		escapedURL := html.EscapeString(rawURL)
+		buttons = fmt.Sprintf(`<button type="button" id="copy-raw" data-url="%s">Copy raw</button>
+			<a href="%s&amp;download=true">Download</a>`, escapedURL, escapedURL)
+	}
+
+	// highlighting is done here, so the viewer needs no third-party assets
 	fmt.Fprintf(w, `
 		<!DOCTYPE html>
 		<html lang="en">
 		<head>
 		<meta charset="utf-8">
 		<title>Viewer</title>
-		<link rel="stylesheet" href="https://cdnjs.cloudflare.com/ajax/libs/highlight.js/11.9.0/styles/github-dark.min.css">
 		<style nonce="%s">
 			body {
 			margin: 0;
@@ -157,29 +251,128 @@ func renderText(w http.ResponseWriter, langClass string, content string) {
 			pre {
 			margin: 0;
 			padding: 1em;
-			background: #0d1117;
 			box-shadow: none;
 			border: none;
 			overflow-x: auto;
 			}
 
-			code {
-			background: none;
-			color: inherit;
+			%s
+
+			.chroma {
+			background-color: #0d1117;
+			}
+
+			.chroma .hl {
+			background-color: #2d2a1c;
+			}
+
+			#wrap {
+			display: none;
+			}
+
+			#wrap:checked ~ pre .cl {
+			white-space: pre-wrap;
+			overflow-wrap: anywhere;
+			}
+
+			.toolbar {
+			position: fixed;
+			top: 0.5em;
+			right: 1em;
+			display: flex;
+			gap: 0.4em;
+			}
+
+			.toolbar label, .toolbar button, .toolbar a {
+			padding: 0.2em 0.8em;
+			border: 1px solid #30363d;
+			border-radius: 6px;
+			background: #161b22;
+			color: #c9d1d9;
+			font: inherit;
+			font-size: 0.85em;
+			text-decoration: none;
+			cursor: pointer;
+			}
+
+			#wrap:checked ~ .toolbar label {
+			border-color: #58a6ff;
 			}
 		</style>
-		<script src="https://cdnjs.cloudflare.com/ajax/libs/highlight.js/11.9.0/highlight.min.js" defer></script>
+		</head>
+		<body>
+		<input type="checkbox" id="wrap">
+		<div class="toolbar">
+			<label for="wrap">Wrap</label>
+			%s
+		</div>
+		%s
 		<script nonce="%s">
-			window.addEventListener('DOMContentLoaded', function () {
-			document.querySelectorAll('pre code').forEach(function (el) {
-				hljs.highlightElement(el);
-			});
+			(function () {
+			var marked = [];
+			var anchor = null;
+
+			function highlightRange() {
+				marked.forEach(function (line) { line.classList.remove('hl'); });
+				marked = [];
+
+				var m = /^#L(\d+)(?:-L(\d+))?$/.exec(location.hash);
+				if (!m) {
+				return;
+				}
+				var from = parseInt(m[1], 10);
+				var to = m[2] ? parseInt(m[2], 10) : from;
+				if (to < from) {
+				var tmp = from; from = to; to = tmp;
+				}
+				for (var i = from; i <= to; i++) {
+				var ln = document.getElementById('L' + i);
+				if (!ln) {
+					break;
+				}
+				ln.parentNode.classList.add('hl');
+				marked.push(ln.parentNode);
+				}
+				if (marked.length > 0) {
+				marked[0].scrollIntoView({ block: 'center' });
+				}
+			}
+
+			document.querySelector('pre').addEventListener('click', function (e) {
+				var link = e.target.closest('a.lnlinks');
+				if (!link) {
+				return;
+				}
+				var n = link.parentNode.id.slice(1);
+				if (e.shiftKey && anchor !== null) {
+				e.preventDefault();
+				history.replaceState(null, '', '#L' + anchor + '-L' + n);
+				highlightRange();
+				return;
+				}
+				anchor = n;
 			});
+
+			var copy = document.getElementById('copy-raw');
+			if (copy) {
+				copy.addEventListener('click', function () {
+				fetch(copy.dataset.url)
+					.then(function (resp) {
+					if (!resp.ok) {
+						throw new Error(resp.status);
+					}
+					return resp.text();
+					})
+					.then(function (text) { return navigator.clipboard.writeText(text); })
+					.then(function () { copy.textContent = 'Copied'; }, function () { copy.textContent = 'Copy failed'; });
+				});
+			}
+
+			window.addEventListener('hashchange', highlightRange);
+			highlightRange();
+			})();
 		</script>
-		</head>
-		<body>
-		<pre><code class="language-%s">%s</code></pre>
 		</body>
 		</html>
-		`, nonce, nonce, langClass, html.EscapeString(content))
+		`, nonce, highlightCSS(), buttons, highlightLines(lang, content), nonce)
 }
@@ -1,10 +1,13 @@
 package httpapi_test
 
 import (
+	"fmt"
+	"html"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"testing"
 
@@ -14,7 +17,7 @@ import (
 
 func TestResourceHandler_MethodNotAllowed(t *testing.T) {
 	s := &httpapi.RESTService{}
-	req := httptest.NewRequest(http.MethodPost, config.EndpointView+"someuuid", nil)
+	req := httptest.NewRequest(http.MethodPut, config.EndpointView+"someuuid", nil)
 	w := httptest.NewRecorder()
 
 	s.ResourceHandler(w, req)
@@ -141,6 +144,29 @@ func TestResourceHandler_PublicTextFileNotTrusted(t *testing.T) {
 	if !strings.Contains(w.Body.String(), "<html") {
 		t.Errorf("Expected HTML response for text file")
 	}
+
+	// highlighting is done by the server, no third-party assets are loaded
+	if !strings.Contains(w.Body.String(), `<span class="nx">Hello</span>`) {
+		t.Errorf("Expected highlighted code, got %s", w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "https://") || strings.Contains(w.Body.String(), "<script src") {
+		t.Errorf("Expected no external assets in the viewer")
+	}
+	if csp := w.Header().Get("Content-Security-Policy"); strings.Contains(csp, "https:") || !strings.Contains(csp, "script-src 'nonce-") {
+		t.Errorf("Unexpected Content-Security-Policy %q", csp)
+	}
+
+	// numbered lines with anchors, buttons with a signed raw URL
+	for _, want := range []string{
+		`<span class="ln" id="L1"><a class="lnlinks" href="#L1">1</a></span>`,
+		`id="wrap"`,
+		`id="copy-raw" data-url="` + config.EndpointRaw + fileUUID + "?expires=",
+		"&amp;download=true",
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("Expected %q in the viewer", want)
+		}
+	}
 }
 
 func TestResourceHandler_PublicPNGNotTruested(t *testing.T) {
@@ -197,13 +223,16 @@ func TestResourceHandler_PublicFileMissing(t *testing.T) {
 	const filename = "ghost.txt"
 	const isPrivate = false
 	const keyHighlyTrusted = false
-	restService, rs, _, key, cfg, fileUUID, err := httpapi.SetupExistingTestUpload(dataDir, apiKey, filename, isPrivate, keyHighlyTrusted)
+	restService, rs, _, _, _, fileUUID, err := httpapi.SetupExistingTestUpload(dataDir, apiKey, filename, isPrivate, keyHighlyTrusted)
 	if err != nil {
 		t.Fatalf("Setup error: %v", err)
 	}
 
 	// delete file
-	filePath := filepath.Join(cfg.UploadPath, key.UUID, filename)
+	filePath, err := httpapi.StoredFilePath(rs, fileUUID)
+	if err != nil {
+		t.Fatalf("Path error: %v", err)
+	}
 	if err := os.Remove(filePath); err != nil {
 		t.Fatalf("Failed to remove file: %v", err)
 	}
@@ -333,3 +362,60 @@ func TestResourceHandler_PublicSVGNotTrusted(t *testing.T) {
 		t.Errorf("Expected attachment disposition, got %s", disp)
 	}
 }
+
+func TestResourceHandler_MediaViewer(t *testing.T) {
+	tests := []struct {
+		filename string
+		trusted  bool
+		element  string // empty if the file is downloaded
+	}{
+		{"clip.mp4", false, "<video"},
+		{"song.mp3", false, "<audio"},
+		{"song.flac", false, ""},
+		{"song.flac", true, "<audio"},
+		{"movie.mov", true, "<video"},
+	}
+	for _, tc := range tests {
+		t.Run(fmt.Sprintf("%s trusted %v", tc.filename, tc.trusted), func(t *testing.T) {
+			dataDir := t.TempDir()
+			restService, _, _, _, _, fileUUID, err := httpapi.SetupExistingTestUpload(dataDir, "key", tc.filename, false, tc.trusted)
+			if err != nil {
+				t.Fatalf("Setup error: %v", err)
+			}
+
+			w := viewLink(restService, fileUUID)
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected %d, got %d", http.StatusOK, w.Code)
+			}
+			if tc.element == "" {
+				if disp := w.Header().Get("Content-Disposition"); !strings.Contains(disp, "attachment") {
+					t.Errorf("Expected attachment disposition, got %s", disp)
+				}
+				return
+			}
+			if !strings.Contains(w.Body.String(), tc.element) {
+				t.Fatalf("Expected %s player, got %s", tc.element, w.Body.String())
+			}
+
+			// the player seeks with range requests to the signed raw URL
+			m := regexp.MustCompile(`src="([^"]+)"`).FindStringSubmatch(w.Body.String())
+			if m == nil {
+				t.Fatalf("No source in %s", w.Body.String())
+			}
+			req := httptest.NewRequest(http.MethodGet, html.UnescapeString(m[1]), nil)
+			req.Header.Set("Range", "bytes=6-10")
+			w = httptest.NewRecorder()
+			restService.RawResourceHandler(w, req)
+
+			if w.Code != http.StatusPartialContent || w.Body.String() != "World" {
+				t.Fatalf("Expected partial content, got %d %q", w.Code, w.Body.String())
+			}
+			if cr := w.Header().Get("Content-Range"); cr != "bytes 6-10/11" {
+				t.Errorf("Unexpected Content-Range %q", cr)
+			}
+			if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, strings.TrimPrefix(tc.element, "<")) {
+				t.Errorf("Unexpected Content-Type %q", ct)
+			}
+		})
+	}
+}
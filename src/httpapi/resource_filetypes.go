@@ -1,6 +1,7 @@
 package httpapi
 
 import (
+	"mime"
 	"path/filepath"
 	"strings"
 )
@@ -29,6 +30,34 @@ var imageTypeWhitelistTrusted = func() map[string]bool {
 	return trusted
 }()
 
+// mediaTypeWhitelistDefault maps audio and video files played in the media viewer to their MIME type.
+// The types are listed here, since the MIME table of the system may not know them or differ between systems.
+var mediaTypeWhitelistDefault = map[string]string{
+	".mp4":  "video/mp4",
+	".webm": "video/webm",
+	".mp3":  "audio/mpeg",
+	".ogg":  "audio/ogg",
+	".wav":  "audio/wav",
+}
+
+var mediaTypeWhitelistTrusted = func() map[string]string {
+	trusted := make(map[string]string)
+	for k, v := range mediaTypeWhitelistDefault {
+		trusted[k] = v
+	}
+	// add types
+	trusted[".m4v"] = "video/mp4"
+	trusted[".ogv"] = "video/ogg"
+	trusted[".mov"] = "video/quicktime"
+	trusted[".m4a"] = "audio/mp4"
+	trusted[".oga"] = "audio/ogg"
+	trusted[".opus"] = "audio/ogg"
+	trusted[".flac"] = "audio/flac"
+	trusted[".aac"] = "audio/aac"
+	return trusted
+}()
+
+// highlightExtWhitelistDefault maps the extensions of files shown in the text viewer to the lexer used for highlighting
 var highlightExtWhitelistDefault = map[string]string{
 	"go":         "go",
 	"js":         "javascript",
@@ -70,12 +99,12 @@ var highlightExtWhitelistTrusted = func() map[string]string {
 	trusted["rs"] = "rust"
 	trusted["swift"] = "swift"
 	trusted["conf"] = "ini"
-	trusted["bat"] = "dos"
+	trusted["bat"] = "batchfile"
 	trusted["ps1"] = "powershell"
 	trusted["tsx"] = "typescript"
 	trusted["jsx"] = "javascript"
-	trusted["vue"] = "xml"
-	trusted["asm"] = "x86asm"
+	trusted["vue"] = "vue"
+	trusted["asm"] = "nasm"
 	trusted["log"] = "plaintext"
 	return trusted
 }()
@@ -98,7 +127,7 @@ func isRenderableImageFile(ext string, trusted bool) bool {
 	return imageTypeWhitelistDefault[ext]
 }
 
-func getLangClass(ext string, trusted bool) string {
+func getHighlightLang(ext string, trusted bool) string {
 	ext = strings.TrimPrefix(strings.ToLower(ext), ".")
 	if trusted {
 		if lang, ok := highlightExtWhitelistTrusted[ext]; ok {
@@ -112,13 +141,58 @@ func getLangClass(ext string, trusted bool) string {
 	return "plaintext"
 }
 
-func isBrowserRenderableFile(ext string) bool {
+func isRenderableMediaFile(ext string, trusted bool) bool {
+	ext = strings.ToLower(filepath.Ext(ext))
+	if trusted {
+		_, ok := mediaTypeWhitelistTrusted[ext]
+		return ok
+	}
+	_, ok := mediaTypeWhitelistDefault[ext]
+	return ok
+}
+
+// isBrowserRenderableFile detects files shown in the media viewer. PDF and SVG may contain active content
+// and are only shown for highly trusted keys.
+func isBrowserRenderableFile(ext string, trusted bool) bool {
+	if isRenderableMediaFile(ext, trusted) {
+		return true
+	}
+	if !trusted {
+		return false
+	}
+
 	ext = strings.ToLower(filepath.Ext(ext))
 	switch ext {
-	//case ".pdf", ".svg", ".mp4", ".webm", ".mp3", ".ogg", ".wav":
 	case ".pdf", ".svg":
 		return true
 	default:
 		return false
 	}
 }
+
+// rawInlineType returns the content type a file is shown with by the raw endpoint, or "" if it has to be downloaded.
+// Only types the viewer shows for the key are served inline. Text files are sent as plain text, except for markup,
+// which is downloaded like any other document.
+func rawInlineType(filename string, trusted bool) string {
+	mimeType := detectMimeType(filename)
+	if isRenderableImageFile(filename, trusted) || isBrowserRenderableFile(filename, trusted) {
+		return mimeType
+	}
+	if isRenderableTextFile(filepath.Ext(filename), trusted) && !strings.HasPrefix(mimeType, "text/html") && !strings.Contains(mimeType, "xml") {
+		return "text/plain; charset=utf-8"
+	}
+	return ""
+}
+
+func detectMimeType(filename string) string {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if mimeType, ok := mediaTypeWhitelistTrusted[ext]; ok {
+		return mimeType
+	}
+
+	mimeType := mime.TypeByExtension(ext)
+	if mimeType == "" {
+		return "application/octet-stream"
+	}
+	return mimeType
+}
@@ -0,0 +1,109 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/twigman/fshare/src/config"
+	"github.com/twigman/fshare/src/internal/apperror"
+	"github.com/twigman/fshare/src/store"
+)
+
+// maxResourceUpdateSize limits the JSON body of a settings change
+const maxResourceUpdateSize = 4096
+
+// ManageResourceHandler handles PATCH /fshare/resource/<uuid>, which changes name, privacy and TTL of a resource,
+// POST /fshare/resource/<uuid>/restore, which moves it out of the trash, and GET /fshare/resource/<uuid>/versions[/<n>],
+// which lists the versions of a file or downloads one of them
+func (s *RESTService) ManageResourceHandler(w http.ResponseWriter, r *http.Request) {
+	target := strings.TrimPrefix(r.URL.Path, config.EndpointResource)
+	rUUID, action, _ := strings.Cut(target, "/")
+	action, version, _ := strings.Cut(action, "/")
+
+	switch {
+	case rUUID == "" || (version != "" && action != "versions"):
+		writeJSONStatus(w, http.StatusNotFound, "Not found")
+	case action == "" && r.Method == http.MethodPatch:
+		s.updateResource(w, r, rUUID)
+	case action == "restore" && r.Method == http.MethodPost:
+		s.restoreResource(w, r, rUUID)
+	case action == "versions" && version == "" && r.Method == http.MethodGet:
+		s.listVersions(w, r, rUUID)
+	case action == "versions" && r.Method == http.MethodGet:
+		s.downloadVersion(w, r, rUUID, version)
+	case action == "" || action == "restore" || action == "versions":
+		writeJSONStatus(w, http.StatusMethodNotAllowed, "Method not allowed")
+	default:
+		writeJSONStatus(w, http.StatusNotFound, "Not found")
+	}
+}
+
+func (s *RESTService) updateResource(w http.ResponseWriter, r *http.Request, rUUID string) {
+	keyUUID, err := s.authorizeBearer(w, r)
+	if err != nil {
+		return
+	}
+
+	var req ResourceUpdateRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxResourceUpdateSize)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONStatus(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	upd := store.ResourceUpdate{Name: req.Name, IsPrivate: req.IsPrivate}
+	if req.AutoDelIn != nil {
+		// "" removes the TTL
+		var d time.Duration
+		if *req.AutoDelIn != "" {
+			d, err = parseDuration(*req.AutoDelIn)
+			if err != nil || d <= 0 {
+				writeJSONStatus(w, http.StatusBadRequest, "auto_del_in must be a positive duration like 12h or 7d")
+				return
+			}
+		}
+		upd.AutoDeleteIn = &d
+	}
+
+	res, err := s.resourceService.UpdateResource(rUUID, keyUUID, upd)
+	if err != nil {
+		writeResourceUpdateError(w, err)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, newResourceResponse(res))
+}
+
+func (s *RESTService) restoreResource(w http.ResponseWriter, r *http.Request, rUUID string) {
+	keyUUID, err := s.authorizeBearer(w, r)
+	if err != nil {
+		return
+	}
+
+	res, err := s.resourceService.RestoreResource(rUUID, keyUUID)
+	if err != nil {
+		writeResourceUpdateError(w, err)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, newResourceResponse(res))
+}
+
+func writeResourceUpdateError(w http.ResponseWriter, err error) {
+	switch err {
+	case apperror.ErrResourceNotFound, apperror.ErrAuthorization:
+		// do not reveal resources of other API keys
+		writeJSONStatus(w, http.StatusNotFound, apperror.ErrResourceNotFound.Msg)
+	case apperror.ErrFileAlreadyExists:
+		writeJSONStatus(w, http.StatusConflict, apperror.ErrFileAlreadyExists.Msg)
+	case apperror.ErrFileInvalidFilename,
+		apperror.ErrUpdateHomeDirNotAllowed,
+		apperror.ErrAutoDeleteNotAFile,
+		apperror.ErrResourceNotInTrash,
+		apperror.ErrInsufficientStorage:
+		e := err.(*apperror.FShareError)
+		writeJSONStatus(w, e.Code, e.Msg)
+	default:
+		writeJSONStatus(w, http.StatusInternalServerError, "Update failed")
+	}
+}
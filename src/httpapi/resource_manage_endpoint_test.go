@@ -0,0 +1,182 @@
+package httpapi_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/twigman/fshare/src/config"
+	"github.com/twigman/fshare/src/httpapi"
+	"github.com/twigman/fshare/src/store"
+)
+
+func patchResource(restService *httpapi.RESTService, rUUID string, body string, apiKey string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPatch, config.EndpointResource+rUUID, strings.NewReader(body))
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	w := httptest.NewRecorder()
+
+	restService.ManageResourceHandler(w, req)
+	return w
+}
+
+func TestManageResourceHandler_Update(t *testing.T) {
+	dataDir := t.TempDir()
+	restService, rs, as, key, _, fileUUID, err := httpapi.SetupExistingTestUpload(dataDir, "123", "test.txt", false, false)
+	if err != nil {
+		t.Fatalf("Setup error: %v", err)
+	}
+	if _, err := as.AddAPIKey("456", "other key", false, nil); err != nil {
+		t.Fatalf("Can not add API key: %v", err)
+	}
+
+	w := patchResource(restService, fileUUID, `{"name": "renamed.txt", "is_private": true, "auto_del_in": "2d"}`, "123")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var res httpapi.ResourceResponse
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	if res.Name != "renamed.txt" || !res.IsPrivate || res.AutoDeleteAt == nil ||
+		res.AutoDeleteAt.Before(time.Now().Add(47*time.Hour)) {
+		t.Errorf("Unexpected response: %+v", res)
+	}
+
+	// the file is private now
+	if w := viewLink(restService, fileUUID); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected %d for the private file, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	// make it public again and remove the TTL
+	w = patchResource(restService, fileUUID, `{"is_private": false, "auto_del_in": ""}`, "123")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	stored, err := rs.GetResourceByUUID(fileUUID)
+	if err != nil {
+		t.Fatalf("Could not load resource: %v", err)
+	}
+	if stored.IsPrivate || stored.AutoDeleteAt != nil || stored.Name != "renamed.txt" || stored.APIKeyUUID != key.UUID {
+		t.Errorf("Unexpected resource: %+v", stored)
+	}
+	if w := viewLink(restService, fileUUID); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Hello World") {
+		t.Errorf("Expected content of the public file, got %d", w.Code)
+	}
+}
+
+func TestManageResourceHandler_UpdateErrors(t *testing.T) {
+	dataDir := t.TempDir()
+	restService, rs, as, key, _, fileUUID, err := httpapi.SetupExistingTestUpload(dataDir, "123", "test.txt", false, false)
+	if err != nil {
+		t.Fatalf("Setup error: %v", err)
+	}
+	if _, err := as.AddAPIKey("456", "other key", false, nil); err != nil {
+		t.Fatalf("Can not add API key: %v", err)
+	}
+	if _, err := rs.SaveUploadedFile(strings.NewReader("taken"), &store.Resource{Name: "taken.txt", APIKeyUUID: key.UUID}, false); err != nil {
+		t.Fatalf("Could not save file: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		uuid   string
+		body   string
+		apiKey string
+		status int
+	}{
+		{"no auth", fileUUID, `{"is_private": true}`, "", http.StatusUnauthorized},
+		{"other key", fileUUID, `{"is_private": true}`, "456", http.StatusNotFound},
+		{"missing", "missing", `{"is_private": true}`, "123", http.StatusNotFound},
+		{"invalid body", fileUUID, `{`, "123", http.StatusBadRequest},
+		{"invalid ttl", fileUUID, `{"auto_del_in": "soon"}`, "123", http.StatusBadRequest},
+		{"zero ttl", fileUUID, `{"auto_del_in": "0s"}`, "123", http.StatusBadRequest},
+		{"invalid name", fileUUID, `{"name": "../evil.txt"}`, "123", http.StatusBadRequest},
+		{"name taken", fileUUID, `{"name": "taken.txt"}`, "123", http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := patchResource(restService, tt.uuid, tt.body, tt.apiKey); w.Code != tt.status {
+				t.Errorf("Expected status %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, config.EndpointResource+fileUUID, nil)
+	w := httptest.NewRecorder()
+	restService.ManageResourceHandler(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+
+	stored, err := rs.GetResourceByUUID(fileUUID)
+	if err != nil {
+		t.Fatalf("Could not load resource: %v", err)
+	}
+	if stored.Name != "test.txt" || stored.IsPrivate {
+		t.Errorf("Expected failed updates to keep the resource, got %+v", stored)
+	}
+}
+
+func TestManageResourceHandler_Restore(t *testing.T) {
+	dataDir := t.TempDir()
+	restService, _, _, _, _, fileUUID, err := httpapi.SetupExistingTestUpload(dataDir, "123", "test.txt", false, false)
+	if err != nil {
+		t.Fatalf("Setup error: %v", err)
+	}
+
+	restore := func(apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, config.EndpointResource+fileUUID+"/restore", nil)
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		w := httptest.NewRecorder()
+		restService.ManageResourceHandler(w, req)
+		return w
+	}
+
+	if w := restore("123"); w.Code != http.StatusConflict {
+		t.Errorf("Expected status %d for a file that is not in the trash, got %d", http.StatusConflict, w.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, config.EndpointDelete+fileUUID, nil)
+	req.Header.Set("Authorization", "Bearer 123")
+	w := httptest.NewRecorder()
+	restService.DeleteHandler(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+	if w := viewLink(restService, fileUUID); w.Code != http.StatusNotFound {
+		t.Errorf("Expected %d for a trashed file, got %d", http.StatusNotFound, w.Code)
+	}
+
+	// listed in the trash
+	req = httptest.NewRequest(http.MethodGet, config.EndpointList+"?in_trash=true", nil)
+	req.Header.Set("Authorization", "Bearer 123")
+	w = httptest.NewRecorder()
+	restService.ListResourcesHandler(w, req)
+	var list httpapi.ResourceListResponse
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	if len(list.Resources) != 1 || list.Resources[0].UUID != fileUUID || !list.Resources[0].InTrash {
+		t.Fatalf("Expected the file in the trash, got %+v", list.Resources)
+	}
+
+	w = restore("123")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var res httpapi.ResourceResponse
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	if res.InTrash || res.DeletedAt != nil || res.Name != "test.txt" {
+		t.Errorf("Unexpected restored resource: %+v", res)
+	}
+	if w := viewLink(restService, fileUUID); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Hello World") {
+		t.Errorf("Expected content of the restored file, got %d", w.Code)
+	}
+}
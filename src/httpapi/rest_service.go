@@ -8,9 +8,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"path"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/twigman/fshare/src/config"
@@ -21,14 +24,26 @@ type RESTService struct {
 	config          *config.Config
 	apiKeyService   *store.APIKeyService
 	resourceService *store.ResourceService
-	env             *config.Env
+
+	// secrets to sign URLs, read by loadEnv on first use
+	envMu sync.Mutex
+	env   *config.Env
+
+	// throttle password attempts of share links
+	passwordIPLimiter   *attemptLimiter
+	passwordLinkLimiter *attemptLimiter
+	// bounds the number of password hashes computed at the same time
+	passwordSlots chan struct{}
 }
 
 func NewRESTService(config *config.Config, as *store.APIKeyService, rs *store.ResourceService) *RESTService {
 	return &RESTService{
-		config:          config,
-		apiKeyService:   as,
-		resourceService: rs,
+		config:              config,
+		apiKeyService:       as,
+		resourceService:     rs,
+		passwordIPLimiter:   newAttemptLimiter(passwordAttemptsPerIP, passwordAttemptWindow),
+		passwordLinkLimiter: newAttemptLimiter(passwordAttemptsPerLink, passwordAttemptWindow),
+		passwordSlots:       make(chan struct{}, runtime.NumCPU()),
 	}
 }
 
@@ -53,35 +68,85 @@ func (s *RESTService) authorizeBearer(w http.ResponseWriter, r *http.Request) (s
 	return keyUUID, nil
 }
 
-func (s *RESTService) generateSignedURL(endpoint string, uuid string, exp time.Time) (string, error) {
+// bearerKeyUUID returns the UUID of the API key sent in the Authorization header or an empty string.
+// In contrast to authorizeBearer no response is written.
+func (s *RESTService) bearerKeyUUID(r *http.Request) string {
+	apiKey, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+
+	keyUUID, err := s.apiKeyService.GetUUIDForAPIKey(apiKey)
+	if err != nil {
+		return ""
+	}
+	return keyUUID
+}
+
+// loadEnv reads the secrets from the .env file on first use. Requests sign and verify URLs concurrently.
+func (s *RESTService) loadEnv() (*config.Env, error) {
+	s.envMu.Lock()
+	defer s.envMu.Unlock()
+
 	if s.env == nil {
 		env, err := config.LoadOrCreateEnv(s.config.DataPath)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 		s.env = env
 	}
+	return s.env, nil
+}
 
-	// expiry time as unix timestamp
-	expires := fmt.Sprintf("%d", exp.Unix())
-	data := uuid + "|" + expires
-
+func hmacSHA256Hex(secret string, data string) string {
 	// hmac needs a hash function and a secret to create a signature
-	mac := hmac.New(sha256.New, []byte(s.env.HMACSecret))
+	mac := hmac.New(sha256.New, []byte(secret))
 	// apply hmac
 	mac.Write([]byte(data))
-	signature := hex.EncodeToString(mac.Sum(nil))
-
-	fullPath := path.Join("/", endpoint, uuid)
+	return hex.EncodeToString(mac.Sum(nil))
+}
 
-	return fmt.Sprintf("%s?expires=%s&signature=%s", fullPath, expires, signature), nil
+// hmacSign signs data with the active secret and returns its key ID and the hex encoded HMAC-SHA256
+func (s *RESTService) hmacSign(data string) (kid string, signature string, err error) {
+	env, err := s.loadEnv()
+	if err != nil {
+		return "", "", err
+	}
+	return env.HMACKeyID, hmacSHA256Hex(env.HMACSecret, data), nil
 }
 
-func (s *RESTService) isValidSignedRequest(r *http.Request, uuid string) bool {
-	if s.env == nil {
+// hmacVerify checks a signature created by hmacSign with the secret kid, which is rejected after its grace period
+func (s *RESTService) hmacVerify(data string, kid string, signature string) bool {
+	env, err := s.loadEnv()
+	if err != nil {
 		return false
 	}
 
+	key, ok := env.LookupHMACKey(kid, time.Now())
+	if !ok {
+		return false
+	}
+	expectedSig := hmacSHA256Hex(key.Secret, data)
+
+	// constant-time compare; checks all bytes for constant result
+	return subtle.ConstantTimeCompare([]byte(signature), []byte(expectedSig)) == 1
+}
+
+func (s *RESTService) generateSignedURL(endpoint string, uuid string, exp time.Time) (string, error) {
+	// expiry time as unix timestamp
+	expires := fmt.Sprintf("%d", exp.Unix())
+
+	kid, signature, err := s.hmacSign(uuid + "|" + expires)
+	if err != nil {
+		return "", err
+	}
+
+	fullPath := path.Join("/", endpoint, uuid)
+
+	return fmt.Sprintf("%s?expires=%s&kid=%s&signature=%s", fullPath, expires, url.QueryEscape(kid), signature), nil
+}
+
+func (s *RESTService) isValidSignedRequest(r *http.Request, uuid string) bool {
 	expiresStr := r.URL.Query().Get("expires")
 	signature := r.URL.Query().Get("signature")
 	if expiresStr == "" || signature == "" {
@@ -94,17 +159,13 @@ func (s *RESTService) isValidSignedRequest(r *http.Request, uuid string) bool {
 		return false
 	}
 
-	data := uuid + "|" + expiresStr
-	mac := hmac.New(sha256.New, []byte(s.env.HMACSecret))
-	mac.Write([]byte(data))
-	expectedSig := hex.EncodeToString(mac.Sum(nil))
-
-	// constant-time compare; checks all bytes for constant result
-	if subtle.ConstantTimeCompare([]byte(signature), []byte(expectedSig)) != 1 {
-		return false
+	// URLs signed by older versions have no key ID
+	kid := r.URL.Query().Get("kid")
+	if kid == "" {
+		kid = config.LegacyHMACKeyID
 	}
 
-	return true
+	return s.hmacVerify(uuid+"|"+expiresStr, kid, signature)
 }
 
 func writeJSONStatus(w http.ResponseWriter, statusCode int, statusMsg string) {
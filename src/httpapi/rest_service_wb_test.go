@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
@@ -73,6 +75,15 @@ func SetupExistingTestUpload(dataDir string, apiKey string, filename string, isP
 	return restService, rs, as, key, cfg, fileUUID, nil
 }
 
+// StoredFilePath returns the path of the stored content of a file resource
+func StoredFilePath(rs *store.ResourceService, fileUUID string) (string, error) {
+	r, err := rs.GetResourceByUUID(fileUUID)
+	if err != nil {
+		return "", err
+	}
+	return rs.BuildResourcePath(r)
+}
+
 // Tests valid url
 // manipulated uuid
 // manipulated expires
@@ -124,3 +135,127 @@ func TestValidateSignedRequest(t *testing.T) {
 		t.Errorf("expected invalid signature due to manipulated expires, but got valid")
 	}
 }
+
+// the secrets are loaded by the first of several concurrent requests, go test -race checks the access
+func TestValidateSignedRequest_Concurrent(t *testing.T) {
+	dataDir := t.TempDir()
+	cfg := &config.Config{DataPath: dataDir, UploadPath: filepath.Join(dataDir, "upload")}
+	_, _, s, err := InitTestServices(cfg)
+	if err != nil {
+		t.Fatalf("could not init test services %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			signedURL, err := s.generateSignedURL("/test", "test-uuid", time.Now().Add(time.Minute))
+			if err != nil {
+				t.Errorf("could not create url: %v", err)
+				return
+			}
+			if !s.isValidSignedRequest(httptest.NewRequest(http.MethodGet, signedURL, nil), "test-uuid") {
+				t.Errorf("expected valid signature, got invalid")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// URLs signed before a rotation stay valid during the grace period, also after a restart
+func TestValidateSignedRequest_KeyRotation(t *testing.T) {
+	dataDir := t.TempDir()
+	cfg := &config.Config{
+		DataPath:        dataDir,
+		UploadPath:      filepath.Join(dataDir, "upload"),
+		MaxFileSizeInMB: 5,
+		Port:            8080,
+	}
+	_, _, s, err := InitTestServices(cfg)
+	if err != nil {
+		t.Fatalf("could not init test services %v", err)
+	}
+
+	uuid := "test-uuid"
+	expiry := time.Now().Add(5 * time.Minute)
+	oldURL, err := s.generateSignedURL("/test", uuid, expiry)
+	if err != nil {
+		t.Fatalf("could not create url: %v", err)
+	}
+
+	if _, err := config.RotateHMACSecret(dataDir, time.Hour); err != nil {
+		t.Fatalf("could not rotate secret: %v", err)
+	}
+	// restart
+	s.env = nil
+
+	if !s.isValidSignedRequest(httptest.NewRequest(http.MethodGet, oldURL, nil), uuid) {
+		t.Errorf("expected URL signed with the previous key to be valid")
+	}
+
+	newURL, err := s.generateSignedURL("/test", uuid, expiry)
+	if err != nil {
+		t.Fatalf("could not create url: %v", err)
+	}
+	newReq := httptest.NewRequest(http.MethodGet, newURL, nil)
+	if newReq.URL.Query().Get("kid") != s.env.HMACKeyID || s.env.HMACKeyID == "1" {
+		t.Errorf("expected URL to be signed with the new key, got kid %s", newReq.URL.Query().Get("kid"))
+	}
+	if !s.isValidSignedRequest(newReq, uuid) {
+		t.Errorf("expected valid signature, got invalid")
+	}
+
+	// unknown key ID
+	badReq := httptest.NewRequest(http.MethodGet, newURL, nil)
+	q := badReq.URL.Query()
+	q.Set("kid", "99")
+	badReq.URL.RawQuery = q.Encode()
+	if s.isValidSignedRequest(badReq, uuid) {
+		t.Errorf("expected invalid signature for unknown key ID, but got valid")
+	}
+
+	// the grace period of the first key ended
+	if _, err := config.RotateHMACSecret(dataDir, -time.Hour); err != nil {
+		t.Fatalf("could not rotate secret: %v", err)
+	}
+	s.env = nil
+	if !s.isValidSignedRequest(httptest.NewRequest(http.MethodGet, oldURL, nil), uuid) {
+		t.Errorf("expected key with unchanged grace period to stay valid")
+	}
+	if s.isValidSignedRequest(httptest.NewRequest(http.MethodGet, newURL, nil), uuid) {
+		t.Errorf("expected URL signed with an expired key to be invalid")
+	}
+}
+
+// URLs signed by older versions carry no kid and use the single secret of the old .env format
+func TestValidateSignedRequest_LegacySecret(t *testing.T) {
+	dataDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dataDir, ".env"), []byte("legacy-secret\n"), 0o600); err != nil {
+		t.Fatalf("failed to write secret file: %v", err)
+	}
+	cfg := &config.Config{
+		DataPath:        dataDir,
+		UploadPath:      filepath.Join(dataDir, "upload"),
+		MaxFileSizeInMB: 5,
+		Port:            8080,
+	}
+	_, _, s, err := InitTestServices(cfg)
+	if err != nil {
+		t.Fatalf("could not init test services %v", err)
+	}
+
+	uuid := "test-uuid"
+	signedURL, err := s.generateSignedURL("/test", uuid, time.Now().Add(5*time.Minute))
+	if err != nil {
+		t.Fatalf("could not create url: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodGet, signedURL, nil)
+	q := req.URL.Query()
+	q.Del("kid")
+	req.URL.RawQuery = q.Encode()
+
+	if !s.isValidSignedRequest(req, uuid) {
+		t.Errorf("expected URL without kid to be valid with the legacy secret")
+	}
+}
@@ -0,0 +1,137 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/twigman/fshare/src/config"
+	"github.com/twigman/fshare/src/internal/apperror"
+	"github.com/twigman/fshare/src/store"
+	"github.com/twigman/fshare/src/utils"
+)
+
+// maxShareRequestSize limits the JSON body of a new share
+const maxShareRequestSize = 4096
+
+// ShareHandler manages the share links of a file: POST /fshare/share/<uuid> creates a share,
+// GET /fshare/share/<uuid> lists them and DELETE /fshare/share/<uuid>/<token> revokes one.
+func (s *RESTService) ShareHandler(w http.ResponseWriter, r *http.Request) {
+	target := strings.TrimPrefix(r.URL.Path, config.EndpointShare)
+	rUUID, token, hasToken := strings.Cut(target, "/")
+
+	switch {
+	case rUUID == "" || (hasToken && (token == "" || strings.Contains(token, "/"))):
+		writeJSONStatus(w, http.StatusNotFound, "Not found")
+	case !hasToken && r.Method == http.MethodPost:
+		s.createShare(w, r, rUUID)
+	case !hasToken && r.Method == http.MethodGet:
+		s.listShares(w, r, rUUID)
+	case hasToken && r.Method == http.MethodDelete:
+		s.revokeShare(w, r, rUUID, token)
+	default:
+		writeJSONStatus(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func (s *RESTService) createShare(w http.ResponseWriter, r *http.Request, rUUID string) {
+	keyUUID, err := s.authorizeBearer(w, r)
+	if err != nil {
+		return
+	}
+
+	var req ShareRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxShareRequestSize)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONStatus(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	share := &store.Share{
+		ResourceUUID: rUUID,
+		Label:        strings.TrimSpace(req.Label),
+		MaxDownloads: req.MaxDownloads,
+		ExpiresAt:    req.ExpiresAt,
+	}
+	if req.Password != "" {
+		hash, err := utils.HashPassword(req.Password)
+		if err != nil {
+			writeJSONStatus(w, http.StatusInternalServerError, "Could not hash password")
+			return
+		}
+		share.PasswordHash = &hash
+	}
+
+	if err := s.resourceService.CreateShare(share, keyUUID); err != nil {
+		writeShareError(w, err)
+		return
+	}
+
+	writeJSONResponse(w, http.StatusCreated, newShareResponse(s.requestBaseURL(r), share))
+}
+
+func (s *RESTService) listShares(w http.ResponseWriter, r *http.Request, rUUID string) {
+	keyUUID, err := s.authorizeBearer(w, r)
+	if err != nil {
+		return
+	}
+
+	shares, err := s.resourceService.ListShares(rUUID, keyUUID)
+	if err != nil {
+		writeShareError(w, err)
+		return
+	}
+
+	res := ShareListResponse{Shares: make([]ShareResponse, 0, len(shares))}
+	for _, sh := range shares {
+		res.Shares = append(res.Shares, newShareResponse(s.requestBaseURL(r), sh))
+	}
+	writeJSONResponse(w, http.StatusOK, res)
+}
+
+func (s *RESTService) revokeShare(w http.ResponseWriter, r *http.Request, rUUID string, token string) {
+	keyUUID, err := s.authorizeBearer(w, r)
+	if err != nil {
+		return
+	}
+
+	if err := s.resourceService.RevokeShare(rUUID, token, keyUUID); err != nil {
+		writeShareError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeShareError(w http.ResponseWriter, err error) {
+	switch err {
+	case apperror.ErrResourceNotFound, apperror.ErrAuthorization:
+		// do not reveal files of other API keys
+		writeJSONStatus(w, http.StatusNotFound, apperror.ErrResourceNotFound.Msg)
+	case apperror.ErrShareNotFound,
+		apperror.ErrShareNotAFile,
+		apperror.ErrShareLimitedFile,
+		apperror.ErrInvalidMaxDownloads,
+		apperror.ErrInvalidShareExpiry:
+		e := err.(*apperror.FShareError)
+		writeJSONStatus(w, e.Code, e.Msg)
+	default:
+		writeJSONStatus(w, http.StatusInternalServerError, "Share error")
+	}
+}
+
+func newShareResponse(baseURL string, sh *store.Share) ShareResponse {
+	return ShareResponse{
+		Token:               sh.Token,
+		ResourceUUID:        sh.ResourceUUID,
+		Label:               sh.Label,
+		ViewURL:             baseURL + config.EndpointView + sh.Token,
+		IsPasswordProtected: sh.PasswordHash != nil,
+		MaxDownloads:        sh.MaxDownloads,
+		DownloadCount:       sh.DownloadCount,
+		ExpiresAt:           sh.ExpiresAt,
+		CreatedAt:           sh.CreatedAt,
+		RevokedAt:           sh.RevokedAt,
+		IsActive:            sh.IsActive(time.Now()),
+	}
+}
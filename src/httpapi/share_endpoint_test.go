@@ -0,0 +1,192 @@
+package httpapi_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/twigman/fshare/src/config"
+	"github.com/twigman/fshare/src/httpapi"
+)
+
+func shareRequest(restService *httpapi.RESTService, method string, path string, body string, apiKey string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, config.EndpointShare+path, strings.NewReader(body))
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	w := httptest.NewRecorder()
+
+	restService.ShareHandler(w, req)
+	return w
+}
+
+func createShare(t *testing.T, restService *httpapi.RESTService, fileUUID string, body string) httpapi.ShareResponse {
+	t.Helper()
+	w := shareRequest(restService, http.MethodPost, fileUUID, body, "123")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	var res httpapi.ShareResponse
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	return res
+}
+
+func viewLink(restService *httpapi.RESTService, id string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, config.EndpointView+id, nil)
+	w := httptest.NewRecorder()
+
+	restService.ResourceHandler(w, req)
+	return w
+}
+
+func TestShareHandler(t *testing.T) {
+	dataDir := t.TempDir()
+	restService, _, as, _, _, fileUUID, err := httpapi.SetupExistingTestUpload(dataDir, "123", "secret.txt", true, false)
+	if err != nil {
+		t.Fatalf("Setup error: %v", err)
+	}
+	if _, err := as.AddAPIKey("456", "other key", false, nil); err != nil {
+		t.Fatalf("Can not add API key: %v", err)
+	}
+
+	alice := createShare(t, restService, fileUUID, `{"label": "alice"}`)
+	bob := createShare(t, restService, fileUUID, `{"label": "bob"}`)
+	if alice.Label != "alice" || !alice.IsActive || alice.ViewURL != "http://example.com"+config.EndpointView+alice.Token {
+		t.Errorf("Unexpected share: %+v", alice)
+	}
+
+	// the file itself stays private, the shares grant access
+	if w := viewLink(restService, fileUUID); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected %d for the private file, got %d", http.StatusUnauthorized, w.Code)
+	}
+	for _, token := range []string{alice.Token, bob.Token} {
+		if w := viewLink(restService, token); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Hello World") {
+			t.Errorf("Expected content for share, got %d", w.Code)
+		}
+	}
+
+	// raw download of a share without password needs no signature
+	req := httptest.NewRequest(http.MethodGet, config.EndpointRaw+alice.Token, nil)
+	w := httptest.NewRecorder()
+	restService.RawResourceHandler(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "Hello World" {
+		t.Errorf("Expected raw content for share, got %d", w.Code)
+	}
+
+	// other keys can not manage the shares
+	if w := shareRequest(restService, http.MethodGet, fileUUID, "", "456"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected %d for other key, got %d", http.StatusNotFound, w.Code)
+	}
+	if w := shareRequest(restService, http.MethodDelete, fileUUID+"/"+alice.Token, "", "456"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected %d for other key, got %d", http.StatusNotFound, w.Code)
+	}
+
+	// revoking one share keeps the other
+	if w := shareRequest(restService, http.MethodDelete, fileUUID+"/"+alice.Token, "", "123"); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected %d, got %d", http.StatusNoContent, w.Code)
+	}
+	if w := viewLink(restService, alice.Token); w.Code != http.StatusNotFound {
+		t.Errorf("Expected %d for revoked share, got %d", http.StatusNotFound, w.Code)
+	}
+	if w := viewLink(restService, bob.Token); w.Code != http.StatusOK {
+		t.Errorf("Expected %d for remaining share, got %d", http.StatusOK, w.Code)
+	}
+
+	w = shareRequest(restService, http.MethodGet, fileUUID, "", "123")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected %d, got %d", http.StatusOK, w.Code)
+	}
+	var list httpapi.ShareListResponse
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	if len(list.Shares) != 2 || list.Shares[0].IsActive || list.Shares[0].RevokedAt == nil || !list.Shares[1].IsActive {
+		t.Errorf("Unexpected shares: %+v", list.Shares)
+	}
+}
+
+func TestShareHandler_PasswordAndLimit(t *testing.T) {
+	dataDir := t.TempDir()
+	restService, rs, _, _, _, fileUUID, err := httpapi.SetupExistingTestUpload(dataDir, "123", "secret.txt", false, false)
+	if err != nil {
+		t.Fatalf("Setup error: %v", err)
+	}
+
+	protected := createShare(t, restService, fileUUID, `{"password": "hunter2"}`)
+	if !protected.IsPasswordProtected {
+		t.Errorf("Expected password protected share: %+v", protected)
+	}
+	if w := viewLink(restService, protected.Token); w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), `name="password"`) {
+		t.Errorf("Expected password prompt, got %d", w.Code)
+	}
+	req := httptest.NewRequest(http.MethodGet, config.EndpointRaw+protected.Token, nil)
+	w := httptest.NewRecorder()
+	restService.RawResourceHandler(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected %d for unsigned raw download, got %d", http.StatusUnauthorized, w.Code)
+	}
+	cookies := submitPassword(restService, protected.Token, "hunter2").Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("Expected access cookie, got %+v", cookies)
+	}
+	req = httptest.NewRequest(http.MethodGet, config.EndpointView+protected.Token, nil)
+	req.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	restService.ResourceHandler(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected %d with cookie, got %d", http.StatusOK, w.Code)
+	}
+
+	// the password of a share does not protect the file or other shares
+	if w := viewLink(restService, fileUUID); w.Code != http.StatusOK {
+		t.Errorf("Expected %d for the file, got %d", http.StatusOK, w.Code)
+	}
+
+	once := createShare(t, restService, fileUUID, `{"max_downloads": 1}`)
+	if w := viewLink(restService, once.Token); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `name="confirm"`) {
+		t.Fatalf("Expected confirmation page, got %d", w.Code)
+	}
+	if w := confirmView(restService, once.Token); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Hello World") {
+		t.Fatalf("Expected content, got %d", w.Code)
+	}
+	if w := confirmView(restService, once.Token); w.Code != http.StatusNotFound {
+		t.Errorf("Expected %d for used up share, got %d", http.StatusNotFound, w.Code)
+	}
+
+	// a used up share keeps the file
+	r, err := rs.GetResourceByUUID(fileUUID)
+	if err != nil || r.DeletedAt != nil {
+		t.Errorf("Expected file to be kept: %+v, %v", r, err)
+	}
+
+	for _, body := range []string{`{"max_downloads": 0}`, `{"expires_at": "2000-01-01T00:00:00Z"}`, `invalid`} {
+		if w := shareRequest(restService, http.MethodPost, fileUUID, body, "123"); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected %d, got %d", body, http.StatusBadRequest, w.Code)
+		}
+	}
+	if w := shareRequest(restService, http.MethodPut, fileUUID, "", "123"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
+
+func TestShareHandler_LimitedFile(t *testing.T) {
+	restService, rs, _, _ := setupFolderTest(t)
+	res := putLimitedFile(t, restService, "1")
+
+	// a share would not count the downloads of a burn after read file
+	if w := shareRequest(restService, http.MethodPost, res.UUID, `{}`, "123"); w.Code != http.StatusConflict {
+		t.Fatalf("Expected %d, got %d: %s", http.StatusConflict, w.Code, w.Body.String())
+	}
+
+	if w := confirmView(restService, res.UUID); w.Code != http.StatusOK {
+		t.Fatalf("Expected %d, got %d", http.StatusOK, w.Code)
+	}
+	if r, err := rs.GetResourceByUUID(res.UUID); err != nil || r.DeletedAt == nil {
+		t.Errorf("Expected file to be deleted after its only view: %+v, %v", r, err)
+	}
+}
@@ -0,0 +1,57 @@
+package httpapi
+
+import (
+	"github.com/twigman/fshare/src/store"
+)
+
+// shareLink is the target of a view or raw URL: a file addressed by its UUID or by the token of one of its shares.
+// Privacy, password and download limit of the file only apply to its UUID, a share has its own.
+type shareLink struct {
+	id    string // UUID of the file or token of the share, used in URLs and cookies
+	res   *store.Resource
+	share *store.Share // nil if the file is addressed by its UUID
+}
+
+// resolveShareLink looks up the file or share behind the id of a view or raw URL.
+// nil is returned if there is nothing to access.
+func (s *RESTService) resolveShareLink(id string) *shareLink {
+	res, err := s.resourceService.GetResourceByUUID(id)
+	if err == nil && res != nil {
+		if !res.IsFile || res.DeletedAt != nil || res.IsBroken || res.DownloadLimitReached() {
+			return nil
+		}
+		return &shareLink{id: id, res: res}
+	}
+
+	share, res, err := s.resourceService.GetActiveShare(id)
+	if err != nil {
+		return nil
+	}
+	return &shareLink{id: id, res: res, share: share}
+}
+
+func (l *shareLink) isPrivate() bool {
+	return l.share == nil && l.res.IsPrivate
+}
+
+func (l *shareLink) passwordHash() *string {
+	if l.share != nil {
+		return l.share.PasswordHash
+	}
+	return l.res.PasswordHash
+}
+
+func (l *shareLink) isLimited() bool {
+	if l.share != nil {
+		return l.share.MaxDownloads != nil
+	}
+	return l.res.MaxDownloads != nil
+}
+
+// remainingDownloads returns the number of views and downloads left of a limited link
+func (l *shareLink) remainingDownloads() int64 {
+	if l.share != nil {
+		return *l.share.MaxDownloads - l.share.DownloadCount
+	}
+	return *l.res.MaxDownloads - l.res.DownloadCount
+}
@@ -0,0 +1,77 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/twigman/fshare/src/config"
+)
+
+const (
+	// validity of a signed URL if the request does not set expires_in
+	defaultSignedURLExpiry = time.Hour
+	maxSignedURLExpiry     = 7 * 24 * time.Hour
+	maxSignRequestSize     = 4096
+)
+
+// SignURLHandler lets the owner of a file mint a signed raw URL, e.g. for tools that can not send an Authorization header
+func (s *RESTService) SignURLHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONStatus(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	keyUUID, err := s.authorizeBearer(w, r)
+	if err != nil {
+		return
+	}
+
+	// an empty body uses the defaults
+	var req SignedURLRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxSignRequestSize)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeJSONStatus(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	expiresIn := defaultSignedURLExpiry
+	if req.ExpiresIn != "" {
+		expiresIn, err = parseDuration(req.ExpiresIn)
+		if err != nil || expiresIn <= 0 || expiresIn > maxSignedURLExpiry {
+			writeJSONStatus(w, http.StatusBadRequest, "expires_in must be between 1s and 7d")
+			return
+		}
+	}
+
+	rUUID := strings.TrimPrefix(r.URL.Path, config.EndpointSign)
+	res, err := s.resourceService.GetResourceByUUID(rUUID)
+	if err != nil || res == nil || res.APIKeyUUID != keyUUID || res.DeletedAt != nil {
+		// do not reveal files of other API keys
+		writeJSONStatus(w, http.StatusNotFound, "Resource not found")
+		return
+	}
+	if !res.IsFile {
+		writeJSONStatus(w, http.StatusBadRequest, "Only files can be downloaded")
+		return
+	}
+
+	expiry := time.Now().Add(expiresIn).UTC()
+	rawURL, err := s.generateSignedURL(config.EndpointRaw, res.UUID, expiry)
+	if err != nil {
+		writeJSONStatus(w, http.StatusInternalServerError, "Failed to generate signed URL")
+		return
+	}
+	if req.Download {
+		rawURL += "&download=true"
+	}
+
+	writeJSONResponse(w, http.StatusOK, SignedURLResponse{
+		UUID:      res.UUID,
+		RawURL:    s.requestBaseURL(r) + rawURL,
+		ExpiresAt: expiry.Truncate(time.Second),
+	})
+}
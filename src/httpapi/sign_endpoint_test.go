@@ -0,0 +1,104 @@
+package httpapi_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/twigman/fshare/src/config"
+	"github.com/twigman/fshare/src/httpapi"
+)
+
+func signURL(restService *httpapi.RESTService, fileUUID string, body string, apiKey string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, config.EndpointSign+fileUUID, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	w := httptest.NewRecorder()
+
+	restService.SignURLHandler(w, req)
+	return w
+}
+
+func TestSignURLHandler(t *testing.T) {
+	dataDir := t.TempDir()
+	restService, _, as, _, _, fileUUID, err := httpapi.SetupExistingTestUpload(dataDir, "123", "secret.txt", true, false)
+	if err != nil {
+		t.Fatalf("Setup error: %v", err)
+	}
+	if _, err := as.AddAPIKey("456", "other key", false, nil); err != nil {
+		t.Fatalf("Can not add API key: %v", err)
+	}
+
+	w := signURL(restService, fileUUID, `{"expires_in": "2h", "download": true}`, "123")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var res httpapi.SignedURLResponse
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	if d := time.Until(res.ExpiresAt); d < 119*time.Minute || d > 2*time.Hour {
+		t.Errorf("Unexpected expiry %v", res.ExpiresAt)
+	}
+
+	// the private file can be downloaded without Authorization header
+	rawPath := strings.TrimPrefix(res.RawURL, "http://example.com")
+	req := httptest.NewRequest(http.MethodGet, rawPath, nil)
+	rw := httptest.NewRecorder()
+	restService.RawResourceHandler(rw, req)
+	if rw.Code != http.StatusOK || rw.Body.String() != "Hello World" {
+		t.Errorf("Signed URL not usable: %d %q", rw.Code, rw.Body.String())
+	}
+	if cd := rw.Header().Get("Content-Disposition"); !strings.HasPrefix(cd, "attachment") {
+		t.Errorf("Expected download, got Content-Disposition %q", cd)
+	}
+
+	// default expiry with empty body
+	if w := signURL(restService, fileUUID, "", "123"); w.Code != http.StatusOK {
+		t.Errorf("Expected %d, got %d", http.StatusOK, w.Code)
+	}
+
+	// only the owner can sign
+	if w := signURL(restService, fileUUID, "", "456"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected %d for other key, got %d", http.StatusNotFound, w.Code)
+	}
+
+	for _, body := range []string{`{"expires_in": "8d"}`, `{"expires_in": "0s"}`, `{"expires_in": "soon"}`, `invalid`} {
+		if w := signURL(restService, fileUUID, body, "123"); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected %d, got %d", body, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+func TestSignURLHandler_HTMLIsAttachment(t *testing.T) {
+	dataDir := t.TempDir()
+	restService, _, _, _, _, fileUUID, err := httpapi.SetupExistingTestUpload(dataDir, "123", "page.html", false, true)
+	if err != nil {
+		t.Fatalf("Setup error: %v", err)
+	}
+
+	w := signURL(restService, fileUUID, "", "123")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var res httpapi.SignedURLResponse
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+
+	// a signed link must not render a document on the fshare origin
+	req := httptest.NewRequest(http.MethodGet, strings.TrimPrefix(res.RawURL, "http://example.com"), nil)
+	rw := httptest.NewRecorder()
+	restService.RawResourceHandler(rw, req)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("Expected %d, got %d", http.StatusOK, rw.Code)
+	}
+	if ct := rw.Header().Get("Content-Type"); ct != "application/octet-stream" {
+		t.Errorf("Expected application/octet-stream, got %q", ct)
+	}
+	if cd := rw.Header().Get("Content-Disposition"); !strings.HasPrefix(cd, "attachment") {
+		t.Errorf("Expected attachment, got Content-Disposition %q", cd)
+	}
+}
@@ -0,0 +1,191 @@
+package httpapi
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/twigman/fshare/src/config"
+	"github.com/twigman/fshare/src/internal/apperror"
+	"github.com/twigman/fshare/src/storage"
+	"github.com/twigman/fshare/src/store"
+)
+
+// ThumbnailHandler serves a scaled down version of an image. Access is checked like for the view of the file,
+// or granted by a signed URL.
+func (s *RESTService) ThumbnailHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONStatus(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// UUID of the file or token of a share
+	id := strings.TrimPrefix(r.URL.Path, config.EndpointThumb)
+
+	size := store.DefaultThumbnailSize
+	if sizeRaw := r.URL.Query().Get("size"); sizeRaw != "" {
+		var err error
+		size, err = strconv.Atoi(sizeRaw)
+		if err != nil {
+			writeJSONStatus(w, http.StatusBadRequest, apperror.ErrInvalidThumbnailSize.Msg)
+			return
+		}
+	}
+
+	link := s.resolveShareLink(id)
+	if link == nil {
+		writeJSONStatus(w, http.StatusNotFound, "Not found")
+		return
+	}
+	res := link.res
+
+	// signed thumbnail URLs of the gallery are issued by the owner
+	isSigned := s.isValidSignedRequest(r, id)
+	if !isSigned && link.isPrivate() {
+		keyUUID, err := s.authorizeBearer(w, r)
+		if err != nil {
+			return
+		}
+		if res.APIKeyUUID != keyUUID {
+			writeJSONStatus(w, http.StatusUnauthorized, "Authorization failed")
+			return
+		}
+	} else if !isSigned && link.passwordHash() != nil && !s.hasPasswordAccess(r, link) {
+		writeJSONStatus(w, http.StatusUnauthorized, "Password required")
+		return
+	}
+
+	// a thumbnail would show the content without counting a download
+	if link.isLimited() {
+		writeJSONStatus(w, http.StatusForbidden, "No thumbnails for files with a download limit")
+		return
+	}
+
+	keyIsHighlyTrusted, err := s.apiKeyService.IsAPIKeyHighlyTrusted(res.APIKeyUUID)
+	if err != nil {
+		keyIsHighlyTrusted = false
+	}
+	if !isRenderableImageFile(res.Name, keyIsHighlyTrusted) {
+		writeJSONStatus(w, apperror.ErrThumbnailNotSupported.Code, apperror.ErrThumbnailNotSupported.Msg)
+		return
+	}
+
+	thumb, mimeType, err := s.resourceService.OpenThumbnail(res, size)
+	if err != nil {
+		switch err {
+		case apperror.ErrInvalidThumbnailSize:
+			writeJSONStatus(w, http.StatusBadRequest, fmt.Sprintf("%s, supported sizes: %s", err.Error(), thumbnailSizesText()))
+		case apperror.ErrThumbnailNotSupported:
+			writeJSONStatus(w, apperror.ErrThumbnailNotSupported.Code, apperror.ErrThumbnailNotSupported.Msg)
+		case storage.ErrNotExist:
+			_ = s.resourceService.MarkResourceAsBroken(res.UUID)
+			writeJSONStatus(w, http.StatusNotFound, "File not found")
+		default:
+			writeJSONStatus(w, http.StatusInternalServerError, "Could not create thumbnail")
+		}
+		return
+	}
+	defer thumb.Close()
+
+	info, err := thumb.Stat()
+	if err != nil {
+		writeJSONStatus(w, http.StatusInternalServerError, "Could not read thumbnail")
+		return
+	}
+
+	w.Header().Set("Content-Type", mimeType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// the name of the cached file contains the checksum of the content
+	w.Header().Set("ETag", `"`+info.Name()+`"`)
+	http.ServeContent(w, r, info.Name(), info.ModTime(), thumb)
+}
+
+func thumbnailSizesText() string {
+	sizes := make([]string, len(store.ThumbnailSizes))
+	for i, size := range store.ThumbnailSizes {
+		sizes[i] = strconv.Itoa(size)
+	}
+	return strings.Join(sizes, ", ")
+}
+
+// thumbnailURL returns the thumbnail URL of images, nil for other resources and for files with a download limit
+func thumbnailURL(r *store.Resource) *string {
+	if !r.IsFile || r.DeletedAt != nil || r.IsBroken || r.MaxDownloads != nil || !store.IsThumbnailSupported(r.Name) {
+		return nil
+	}
+	u := config.EndpointThumb + r.UUID
+	return &u
+}
+
+// imagePreviewSize is the thumbnail size shown on the preview page of large images
+const imagePreviewSize = 1024
+
+// imagePreviewMinSize is the file size from which browsers get a preview page instead of the original image
+const imagePreviewMinSize = 512 << 10
+
+// wantsImagePreview reports whether a view of an image should show the preview page: a browser opened a large image
+// of a link the thumbnail endpoint can serve without an Authorization header. Embedded images and other clients
+// do not ask for HTML and get the original.
+func wantsImagePreview(r *http.Request, link *shareLink) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html") &&
+		link.res.Size >= imagePreviewMinSize &&
+		store.IsThumbnailSupported(link.res.Name) &&
+		!link.isPrivate() && !link.isLimited()
+}
+
+// renderImagePreview shows a scaled down version of a large image, which links to the original
+func (s *RESTService) renderImagePreview(w http.ResponseWriter, link *shareLink) {
+	rawURL, err := s.generateSignedURL(config.EndpointRaw, link.id, time.Now().Add(viewerRawURLExpiry))
+	if err != nil {
+		writeJSONStatus(w, http.StatusInternalServerError, "Failed to generate signed URL")
+		return
+	}
+	thumbURL := fmt.Sprintf("%s%s?size=%d", config.EndpointThumb, link.id, imagePreviewSize)
+
+	nonce := generateNonce()
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", fmt.Sprintf(
+		"default-src 'none'; style-src 'nonce-%s'; img-src 'self'; object-src 'none'; base-uri 'none'; form-action 'none';",
+		nonce,
+	))
+
+	fmt.Fprintf(w, `
+		<!DOCTYPE html>
+		<html lang="en">
+		<head>
+		<meta charset="utf-8">
+		<title>%s</title>
+		<style nonce="%s">
+			body {
+			margin: 0;
+			background-color: #111;
+			color: #c9d1d9;
+			font-family: sans-serif;
+			display: flex;
+			flex-direction: column;
+			align-items: center;
+			justify-content: center;
+			min-height: 100vh;
+			}
+
+			img {
+			max-width: 100vw;
+			max-height: calc(100vh - 3em);
+			}
+
+			a {
+			color: #58a6ff;
+			}
+		</style>
+		</head>
+		<body>
+		<a href="%s"><img src="%s" alt="%s"></a>
+		<p><a href="%s">Original (%.1f MB)</a></p>
+		</body>
+		</html>
+		`, html.EscapeString(link.res.Name), nonce, html.EscapeString(rawURL), html.EscapeString(thumbURL),
+		html.EscapeString(link.res.Name), html.EscapeString(rawURL), float64(link.res.Size)/(1<<20))
+}
@@ -0,0 +1,226 @@
+package httpapi_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math/rand/v2"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/twigman/fshare/src/config"
+	"github.com/twigman/fshare/src/httpapi"
+)
+
+func putTestImage(t *testing.T, restService *httpapi.RESTService, path string) string {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 800, 400))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	for x := 0; x < 800; x++ {
+		img.Set(x, x%400, color.RGBA{R: 255, A: 255})
+	}
+	return putImage(t, restService, path, img, nil)
+}
+
+func putImage(t *testing.T, restService *httpapi.RESTService, path string, img image.Image, headers map[string]string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Error encoding image: %v", err)
+	}
+
+	h := map[string]string{"Accept": "application/json"}
+	for k, v := range headers {
+		h[k] = v
+	}
+	w := putUpload(restService, config.EndpointPut+path, buf.String(), h)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var res httpapi.PutUploadResponse
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	return res.UUID
+}
+
+func getThumbnail(restService *httpapi.RESTService, path string, apiKey string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, config.EndpointThumb+path, nil)
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	w := httptest.NewRecorder()
+	restService.ThumbnailHandler(w, req)
+	return w
+}
+
+func TestThumbnailHandler(t *testing.T) {
+	restService, _, _, _ := setupFolderTest(t)
+
+	publicUUID := putTestImage(t, restService, "public.png")
+	privateUUID := putTestImage(t, restService, "private.png?is_private=true")
+	limitedUUID := putTestImage(t, restService, "limited.png?max_downloads=1")
+	textUUID := putLimitedFile(t, restService, "5").UUID
+	w := putUpload(restService, config.EndpointPut+"notes.txt", "plain text", map[string]string{"Accept": "application/json"})
+	var text httpapi.PutUploadResponse
+	if err := json.NewDecoder(w.Body).Decode(&text); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+
+	w = getThumbnail(restService, publicUUID+"?size=128", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "image/jpeg" {
+		t.Errorf("Expected image/jpeg, got %q", ct)
+	}
+	thumb, _, err := image.DecodeConfig(w.Body)
+	if err != nil {
+		t.Fatalf("Error decoding thumbnail: %v", err)
+	}
+	if thumb.Width != 128 || thumb.Height != 64 {
+		t.Errorf("Expected 128x64 thumbnail, got %dx%d", thumb.Width, thumb.Height)
+	}
+
+	// conditional requests use the ETag of the cached thumbnail
+	etag := w.Header().Get("ETag")
+	req := httptest.NewRequest(http.MethodGet, config.EndpointThumb+publicUUID+"?size=128", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	restService.ThumbnailHandler(w, req)
+	if etag == "" || w.Code != http.StatusNotModified {
+		t.Errorf("Expected %d for ETag %q, got %d", http.StatusNotModified, etag, w.Code)
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		apiKey string
+		want   int
+	}{
+		{"private without key", privateUUID, "", http.StatusUnauthorized},
+		{"private with key", privateUUID, "123", http.StatusOK},
+		{"download limit", limitedUUID, "123", http.StatusForbidden},
+		{"invalid size", publicUUID + "?size=100", "", http.StatusBadRequest},
+		{"size not a number", publicUUID + "?size=big", "", http.StatusBadRequest},
+		{"not an image", text.UUID, "", http.StatusUnsupportedMediaType},
+		{"limited text", textUUID, "", http.StatusForbidden},
+		{"unknown", "does-not-exist", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := getThumbnail(restService, tt.path, tt.apiKey)
+			if w.Code != tt.want {
+				t.Errorf("Expected %d, got %d: %s", tt.want, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	// listed images link their thumbnail
+	req = httptest.NewRequest(http.MethodGet, config.EndpointList, nil)
+	req.Header.Set("Authorization", "Bearer 123")
+	w = httptest.NewRecorder()
+	restService.ListResourcesHandler(w, req)
+
+	var list httpapi.ResourceListResponse
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	urls := make(map[string]*string)
+	for _, r := range list.Resources {
+		urls[r.UUID] = r.ThumbnailURL
+	}
+	if u := urls[publicUUID]; u == nil || *u != config.EndpointThumb+publicUUID {
+		t.Errorf("Expected thumbnail URL for %s, got %v", publicUUID, u)
+	}
+	if urls[text.UUID] != nil || urls[limitedUUID] != nil {
+		t.Errorf("Expected no thumbnail URL for text and limited files")
+	}
+}
+
+func TestThumbnailHandler_PasswordProtected(t *testing.T) {
+	restService, _, _, _ := setupFolderTest(t)
+	img := image.NewRGBA(image.Rect(0, 0, 300, 200))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	fileUUID := putImage(t, restService, "protected.png", img, map[string]string{"Fshare-Password": "hunter2"})
+
+	if w := getThumbnail(restService, fileUUID, ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected %d without password, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	// browsers send the cookie of the unlocked view to the thumbnail endpoint
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatalf("Cookie jar error: %v", err)
+	}
+	viewURL, _ := url.Parse("http://example.com" + config.EndpointView + fileUUID)
+	jar.SetCookies(viewURL, submitPassword(restService, fileUUID, "hunter2").Result().Cookies())
+	thumbURL, _ := url.Parse("http://example.com" + config.EndpointThumb + fileUUID)
+	cookies := jar.Cookies(thumbURL)
+	if len(cookies) != 1 {
+		t.Fatalf("Expected access cookie for the thumbnail endpoint, got %+v", cookies)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, config.EndpointThumb+fileUUID, nil)
+	req.AddCookie(cookies[0])
+	w := httptest.NewRecorder()
+	restService.ThumbnailHandler(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected %d with cookie, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+}
+
+func TestResourceHandler_ImagePreview(t *testing.T) {
+	restService, _, _, _ := setupFolderTest(t)
+
+	// noise does not compress, so the photo is large
+	photo := image.NewRGBA(image.Rect(0, 0, 600, 400))
+	rnd := rand.New(rand.NewPCG(1, 2))
+	for i := range photo.Pix {
+		photo.Pix[i] = uint8(rnd.IntN(256))
+		if i%4 == 3 {
+			photo.Pix[i] = 255
+		}
+	}
+	photoUUID := putImage(t, restService, "photo.png", photo, nil)
+	smallUUID := putTestImage(t, restService, "small.png")
+
+	view := func(id string, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, config.EndpointView+id, nil)
+		req.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		restService.ResourceHandler(w, req)
+		return w
+	}
+
+	const browserAccept = "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+	w := view(photoUUID, browserAccept)
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("Expected preview page, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(body, `src="`+config.EndpointThumb+photoUUID+`?size=1024"`) {
+		t.Errorf("Expected thumbnail in preview page, got %q", body)
+	}
+	if !strings.Contains(body, `href="`+config.EndpointRaw+photoUUID+"?expires=") {
+		t.Errorf("Expected link to the original, got %q", body)
+	}
+
+	// embedded images, other clients and small images get the original
+	for _, tt := range []struct{ id, accept string }{
+		{photoUUID, "image/avif,image/webp,*/*"},
+		{photoUUID, "*/*"},
+		{smallUUID, browserAccept},
+	} {
+		if w := view(tt.id, tt.accept); w.Header().Get("Content-Type") != "image/png" {
+			t.Errorf("Expected original image for %s with %q, got %q", tt.id, tt.accept, w.Header().Get("Content-Type"))
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package httpapi
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/twigman/fshare/src/config"
+	"github.com/twigman/fshare/src/internal/apperror"
+	"github.com/twigman/fshare/src/store"
+)
+
+// resumable uploads according to the tus protocol (https://tus.io/protocols/resumable-upload)
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,expiration,termination"
+	// response header with the UUID of the resource created by a completed upload
+	headerResourceUUID = "Fshare-Resource-UUID"
+)
+
+// TusHandler handles resumable uploads:
+// POST /fshare/tus/ creates an upload, HEAD /fshare/tus/<id> returns its offset,
+// PATCH /fshare/tus/<id> appends data and DELETE /fshare/tus/<id> terminates it.
+func (s *RESTService) TusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+
+	method := r.Method
+	if override := r.Header.Get("X-HTTP-Method-Override"); override != "" && method == http.MethodPost {
+		method = override
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, config.EndpointTus)
+
+	if method == http.MethodOptions {
+		w.Header().Set("Tus-Version", tusVersion)
+		w.Header().Set("Tus-Extension", tusExtensions)
+		if s.config.IsUploadLimited() {
+			w.Header().Set("Tus-Max-Size", strconv.FormatInt(s.config.MaxFileSizeBytes(), 10))
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		writeJSONStatus(w, http.StatusPreconditionFailed, "Unsupported tus version")
+		return
+	}
+
+	switch {
+	case id == "" && method == http.MethodPost:
+		s.createUpload(w, r)
+	case id != "" && method == http.MethodHead:
+		s.headUpload(w, r, id)
+	case id != "" && method == http.MethodPatch:
+		s.patchUpload(w, r, id)
+	case id != "" && method == http.MethodDelete:
+		s.terminateUpload(w, r, id)
+	default:
+		writeJSONStatus(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func (s *RESTService) createUpload(w http.ResponseWriter, r *http.Request) {
+	keyUUID, err := s.authorizeBearer(w, r)
+	if err != nil {
+		return
+	}
+
+	if r.Header.Get("Upload-Defer-Length") != "" {
+		writeJSONStatus(w, http.StatusBadRequest, "Upload-Defer-Length is not supported")
+		return
+	}
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		writeJSONStatus(w, http.StatusBadRequest, "Invalid Upload-Length")
+		return
+	}
+
+	rawMetadata := r.Header.Get("Upload-Metadata")
+	metadata, err := parseUploadMetadata(rawMetadata)
+	if err != nil {
+		writeJSONStatus(w, http.StatusBadRequest, "Invalid Upload-Metadata")
+		return
+	}
+
+	name := metadata["filename"]
+	if name == "" {
+		name = metadata["name"]
+	}
+	if name == "" {
+		writeJSONStatus(w, http.StatusBadRequest, "Missing filename in Upload-Metadata")
+		return
+	}
+
+	u := &store.UploadSession{
+		APIKeyUUID: keyUUID,
+		Name:       name,
+		IsPrivate:  metadata["is_private"] == "true",
+		Versioning: metadata["versioning"] == "true",
+		Length:     length,
+		Metadata:   rawMetadata,
+	}
+	if parent := metadata["parent"]; parent != "" {
+		u.ParentUUID = &parent
+	}
+	if autoDelIn := parseAutoDeleteIn(metadata["auto_del_in"]); autoDelIn != nil {
+		sec := int64(autoDelIn.Seconds())
+		u.AutoDeleteInSec = &sec
+	}
+	if u.MaxDownloads, err = parseMaxDownloads(metadata["max_downloads"]); err != nil {
+		writeJSONStatus(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := s.resourceService.CreateUploadSession(u); err != nil {
+		writeUploadError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", path.Join(config.EndpointTus, u.ID))
+	w.Header().Set("Upload-Expires", u.ExpiresAt.Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *RESTService) headUpload(w http.ResponseWriter, r *http.Request, id string) {
+	keyUUID, err := s.authorizeBearer(w, r)
+	if err != nil {
+		return
+	}
+
+	u, err := s.resourceService.GetUploadSession(id, keyUUID)
+	if err != nil {
+		writeUploadError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(u.Length, 10))
+	w.Header().Set("Upload-Expires", u.ExpiresAt.Format(http.TimeFormat))
+	if u.Metadata != "" {
+		w.Header().Set("Upload-Metadata", u.Metadata)
+	}
+	if u.IsCompleted() {
+		w.Header().Set(headerResourceUUID, *u.ResourceUUID)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *RESTService) patchUpload(w http.ResponseWriter, r *http.Request, id string) {
+	keyUUID, err := s.authorizeBearer(w, r)
+	if err != nil {
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		writeJSONStatus(w, http.StatusUnsupportedMediaType, "Content-Type must be application/offset+octet-stream")
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		writeJSONStatus(w, http.StatusBadRequest, "Invalid Upload-Offset")
+		return
+	}
+
+	u, err := s.resourceService.AppendToUpload(id, keyUUID, offset, r.Body)
+	if u != nil {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+		w.Header().Set("Upload-Expires", u.ExpiresAt.Format(http.TimeFormat))
+	}
+	if err != nil {
+		writeUploadError(w, err)
+		return
+	}
+
+	if u.IsCompleted() {
+		w.Header().Set(headerResourceUUID, *u.ResourceUUID)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *RESTService) terminateUpload(w http.ResponseWriter, r *http.Request, id string) {
+	keyUUID, err := s.authorizeBearer(w, r)
+	if err != nil {
+		return
+	}
+
+	if err := s.resourceService.TerminateUpload(id, keyUUID); err != nil {
+		writeUploadError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeUploadError maps errors of resumable uploads to HTTP responses
+func writeUploadError(w http.ResponseWriter, err error) {
+	switch err {
+	case apperror.ErrUploadNotFound,
+		apperror.ErrUploadExpired,
+		apperror.ErrUploadOffsetMismatch,
+		apperror.ErrUploadLocked,
+		apperror.ErrUploadCompleted,
+		apperror.ErrFileTooLarge,
+		apperror.ErrInsufficientStorage,
+		apperror.ErrFileInvalidFilename,
+		apperror.ErrInvalidParent,
+		apperror.ErrInvalidMaxDownloads,
+		apperror.ErrVersioningNotAFile:
+		e := err.(*apperror.FShareError)
+		writeJSONStatus(w, e.Code, e.Msg)
+	default:
+		writeJSONStatus(w, http.StatusInternalServerError, "Upload error")
+	}
+}
+
+// parseUploadMetadata decodes the Upload-Metadata header: comma separated pairs of key and base64 encoded value
+func parseUploadMetadata(raw string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(raw) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(raw, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, fmt.Errorf("empty metadata key")
+		}
+		if _, exists := metadata[key]; exists {
+			return nil, fmt.Errorf("duplicate metadata key %q", key)
+		}
+
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, err
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
@@ -0,0 +1,223 @@
+package httpapi_test
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/twigman/fshare/src/config"
+	"github.com/twigman/fshare/src/httpapi"
+)
+
+func tusRequest(restService *httpapi.RESTService, method string, path string, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer 123")
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+
+	restService.TusHandler(w, req)
+	return w
+}
+
+func createTusUpload(t *testing.T, restService *httpapi.RESTService, length int, metadata string) string {
+	t.Helper()
+	w := tusRequest(restService, http.MethodPost, config.EndpointTus, "", map[string]string{
+		"Upload-Length":   strconv.Itoa(length),
+		"Upload-Metadata": metadata,
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	location := w.Header().Get("Location")
+	if !strings.HasPrefix(location, config.EndpointTus) {
+		t.Fatalf("Unexpected Location header %q", location)
+	}
+	if w.Header().Get("Upload-Expires") == "" {
+		t.Errorf("Missing Upload-Expires header")
+	}
+	return location
+}
+
+func patchTusUpload(restService *httpapi.RESTService, location string, offset int, data string) *httptest.ResponseRecorder {
+	return tusRequest(restService, http.MethodPatch, location, data, map[string]string{
+		"Content-Type":  "application/offset+octet-stream",
+		"Upload-Offset": strconv.Itoa(offset),
+	})
+}
+
+func tusMetadata(pairs ...string) string {
+	var parts []string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, pairs[i]+" "+base64.StdEncoding.EncodeToString([]byte(pairs[i+1])))
+	}
+	return strings.Join(parts, ",")
+}
+
+func TestTusHandler_ResumableUpload(t *testing.T) {
+	restService, rs, _, _ := setupFolderTest(t)
+
+	content := "Hello resumable World"
+	location := createTusUpload(t, restService, len(content), tusMetadata("filename", "build.log", "is_private", "true", "auto_del_in", "1h"))
+
+	// first chunk
+	w := patchTusUpload(restService, location, 0, content[:5])
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+	if w.Header().Get("Upload-Offset") != "5" {
+		t.Fatalf("Expected offset 5, got %q", w.Header().Get("Upload-Offset"))
+	}
+
+	// resume
+	w = tusRequest(restService, http.MethodHead, location, "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if w.Header().Get("Upload-Offset") != "5" || w.Header().Get("Upload-Length") != strconv.Itoa(len(content)) {
+		t.Fatalf("Unexpected offset/length: %q/%q", w.Header().Get("Upload-Offset"), w.Header().Get("Upload-Length"))
+	}
+	if w.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("Expected Cache-Control no-store")
+	}
+
+	// wrong offset
+	w = patchTusUpload(restService, location, 0, content[5:])
+	if w.Code != http.StatusConflict {
+		t.Fatalf("Expected status %d, got %d", http.StatusConflict, w.Code)
+	}
+
+	w = patchTusUpload(restService, location, 5, content[5:])
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+
+	resourceUUID := w.Header().Get("Fshare-Resource-UUID")
+	if resourceUUID == "" {
+		t.Fatalf("Missing resource UUID after completed upload")
+	}
+
+	res, err := rs.GetResourceByUUID(resourceUUID)
+	if err != nil {
+		t.Fatalf("Resource not found: %v", err)
+	}
+	if res.Name != "build.log" || !res.IsPrivate || res.AutoDeleteAt == nil || res.Size != int64(len(content)) || res.SHA256 == "" {
+		t.Errorf("Unexpected resource: %+v", res)
+	}
+
+	savedPath, err := httpapi.StoredFilePath(rs, resourceUUID)
+	if err != nil {
+		t.Fatalf("Path error: %v", err)
+	}
+	data, err := os.ReadFile(savedPath)
+	if err != nil {
+		t.Fatalf("File was not saved: %v", err)
+	}
+	if string(data) != content {
+		t.Errorf("Wrong file content.\nGot:  %q\nWant: %q", data, content)
+	}
+
+	// completed uploads report their resource
+	w = tusRequest(restService, http.MethodHead, location, "", nil)
+	if w.Header().Get("Fshare-Resource-UUID") != resourceUUID {
+		t.Errorf("Expected resource UUID in HEAD response")
+	}
+
+	w = patchTusUpload(restService, location, len(content), "x")
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, w.Code)
+	}
+}
+
+func TestTusHandler_Terminate(t *testing.T) {
+	restService, _, key, cfg := setupFolderTest(t)
+
+	location := createTusUpload(t, restService, 10, tusMetadata("filename", "a.bin"))
+	id := strings.TrimPrefix(location, config.EndpointTus)
+
+	w := patchTusUpload(restService, location, 0, "12345")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+
+	w = tusRequest(restService, http.MethodDelete, location, "", nil)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+
+	if _, err := os.Stat(filepath.Join(cfg.UploadPath, key.UUID, ".uploads", id)); !os.IsNotExist(err) {
+		t.Errorf("Expected staged data to be removed, got %v", err)
+	}
+
+	w = tusRequest(restService, http.MethodHead, location, "", nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestTusHandler_Options(t *testing.T) {
+	restService, _, _, _ := setupFolderTest(t)
+
+	req := httptest.NewRequest(http.MethodOptions, config.EndpointTus, nil)
+	w := httptest.NewRecorder()
+	restService.TusHandler(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+	if w.Header().Get("Tus-Version") != "1.0.0" {
+		t.Errorf("Unexpected Tus-Version %q", w.Header().Get("Tus-Version"))
+	}
+	if !strings.Contains(w.Header().Get("Tus-Extension"), "termination") {
+		t.Errorf("Unexpected Tus-Extension %q", w.Header().Get("Tus-Extension"))
+	}
+	if w.Header().Get("Tus-Max-Size") != strconv.Itoa(5<<20) {
+		t.Errorf("Unexpected Tus-Max-Size %q", w.Header().Get("Tus-Max-Size"))
+	}
+}
+
+func TestTusHandler_InvalidRequests(t *testing.T) {
+	restService, _, _, _ := setupFolderTest(t)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		status  int
+	}{
+		{"missing length", map[string]string{"Upload-Metadata": tusMetadata("filename", "a.txt")}, http.StatusBadRequest},
+		{"missing filename", map[string]string{"Upload-Length": "1"}, http.StatusBadRequest},
+		{"invalid filename", map[string]string{"Upload-Length": "1", "Upload-Metadata": tusMetadata("filename", ".hidden")}, http.StatusBadRequest},
+		{"too large", map[string]string{"Upload-Length": strconv.Itoa(6 << 20), "Upload-Metadata": tusMetadata("filename", "a.txt")}, http.StatusRequestEntityTooLarge},
+		{"wrong version", map[string]string{"Tus-Resumable": "0.2.2", "Upload-Length": "1", "Upload-Metadata": tusMetadata("filename", "a.txt")}, http.StatusPreconditionFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := tusRequest(restService, http.MethodPost, config.EndpointTus, "", tt.headers)
+			if w.Code != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, w.Code)
+			}
+		})
+	}
+}
+
+func TestTusHandler_Unauthorized(t *testing.T) {
+	restService, _, _, _ := setupFolderTest(t)
+	location := createTusUpload(t, restService, 10, tusMetadata("filename", "a.bin"))
+
+	req := httptest.NewRequest(http.MethodHead, location, nil)
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	w := httptest.NewRecorder()
+	restService.TusHandler(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
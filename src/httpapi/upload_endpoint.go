@@ -2,6 +2,8 @@ package httpapi
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
 	"strings"
@@ -9,6 +11,14 @@ import (
 
 	"github.com/twigman/fshare/src/internal/apperror"
 	"github.com/twigman/fshare/src/store"
+	"github.com/twigman/fshare/src/utils"
+)
+
+const (
+	// maxFormFieldSize limits the size of the non-file fields of an upload form
+	maxFormFieldSize = 4096
+	// maxFormOverhead is the space for form fields and multipart boundaries on top of the max file size
+	maxFormOverhead = 64 << 10
 )
 
 func (s *RESTService) UploadHandler(w http.ResponseWriter, r *http.Request) {
@@ -22,72 +32,121 @@ func (s *RESTService) UploadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// upload limit
+	// upload limit; the file itself is checked while it is received
 	if s.config.IsUploadLimited() {
-		r.Body = http.MaxBytesReader(w, r.Body, s.config.MaxFileSizeBytes())
-		// space in RAM
-		if err := r.ParseMultipartForm(s.config.MaxFileSizeBytes()); err != nil {
+		maxBodySize := s.config.MaxFileSizeBytes() + maxFormOverhead
+		if r.ContentLength > maxBodySize {
 			writeJSONStatus(w, http.StatusRequestEntityTooLarge, "File too large")
 			return
 		}
-	} else {
-		// 32 MiB for RAM, rest will be created in /tmp
-		if err := r.ParseMultipartForm(32 << 20); err != nil {
-			writeJSONStatus(w, http.StatusBadRequest, "Upload error")
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+	}
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		writeJSONStatus(w, http.StatusBadRequest, "Upload error")
+		return
+	}
+
+	// the file is streamed into a temp file; form fields may be sent before or after it
+	var staged *store.StagedFile
+	var filename string
+	fields := make(map[string]string)
+	defer func() {
+		if staged != nil {
+			staged.Remove()
+		}
+	}()
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writeUploadStreamError(w, err)
+			return
+		}
+
+		if part.FormName() == "file" {
+			if staged != nil {
+				writeJSONStatus(w, http.StatusBadRequest, "Only one file per upload")
+				return
+			}
+			filename = part.FileName()
+			staged, err = s.resourceService.StageUpload(keyUUID, part, s.config.MaxFileSizeBytes())
+			if err == apperror.ErrFileInvalidFilepath {
+				writeJSONStatus(w, http.StatusInternalServerError, "Could not save file")
+				return
+			}
+			if err != nil {
+				writeUploadStreamError(w, err)
+				return
+			}
+			continue
+		}
+
+		value, err := io.ReadAll(io.LimitReader(part, maxFormFieldSize+1))
+		if err != nil {
+			writeUploadStreamError(w, err)
+			return
+		}
+		if len(value) > maxFormFieldSize {
+			writeJSONStatus(w, http.StatusBadRequest, "Form field too large")
 			return
 		}
+		fields[part.FormName()] = string(value)
 	}
-	defer r.MultipartForm.RemoveAll()
 
-	file, header, err := r.FormFile("file")
-	if err != nil {
+	if staged == nil || filename == "" {
 		writeJSONStatus(w, http.StatusBadRequest, "Invalid file")
 		return
 	}
-	defer file.Close()
+
 	// read fields
-	isPrivate := r.FormValue("is_private") == "true"
+	isPrivate := fields["is_private"] == "true"
+
+	var parentUUID *string
+	if parent := fields["parent"]; parent != "" {
+		parentUUID = &parent
+	}
 
 	// handle TTL
-	autoDelInRaw := r.FormValue("auto_del_in")
-	var autoDeleteTime time.Time
-	var autoDeleteAt *time.Time
-
-	if autoDelInRaw == "" {
-		autoDeleteAt = nil // default no auto delete
-	} else if strings.HasSuffix(autoDelInRaw, "d") {
-		daysStr := strings.TrimSuffix(autoDelInRaw, "d")
-		days, err := strconv.Atoi(daysStr)
-		if err != nil || days < 0 {
-			autoDeleteTime = time.Now().Add(24 * time.Hour).UTC() // fallback
-			autoDeleteAt = &autoDeleteTime
-		} else {
-			autoDeleteTime = time.Now().Add(time.Duration(days) * 24 * time.Hour).UTC()
-			autoDeleteAt = &autoDeleteTime
-		}
-	} else {
-		autoDeleteDur, err := time.ParseDuration(autoDelInRaw)
-		if err != nil || autoDeleteDur < 0 {
-			autoDeleteDur = 24 * time.Hour // fallback
-		}
-		autoDeleteTime = time.Now().Add(autoDeleteDur).UTC()
+	var autoDeleteAt *time.Time // default no auto delete
+	if autoDelIn := parseAutoDeleteIn(fields["auto_del_in"]); autoDelIn != nil {
+		autoDeleteTime := time.Now().Add(*autoDelIn).UTC()
 		autoDeleteAt = &autoDeleteTime
 	}
 
+	maxDownloads, err := parseMaxDownloads(fields["max_downloads"])
+	if err != nil {
+		writeJSONStatus(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	res := &store.Resource{
-		Name:         header.Filename,
+		Name:         filename,
 		IsPrivate:    isPrivate,
+		ParentUUID:   parentUUID,
 		APIKeyUUID:   keyUUID,
 		AutoDeleteAt: autoDeleteAt,
+		MaxDownloads: maxDownloads,
 	}
 
-	file_uuid, err := s.resourceService.SaveUploadedFile(file, res, true)
-	if err == apperror.ErrFileInvalidFilename {
-		writeJSONStatus(w, http.StatusBadRequest, apperror.ErrFileInvalidFilename.Msg)
-		return
+	// private files are only accessible by the owner, a password is not needed
+	if password := fields["password"]; password != "" && !isPrivate {
+		hash, err := utils.HashPassword(password)
+		if err != nil {
+			writeJSONStatus(w, http.StatusInternalServerError, "Could not hash password")
+			return
+		}
+		res.PasswordHash = &hash
 	}
+
+	file_uuid, err := s.saveStagedUpload(staged, res, fields["versioning"] == "true")
+	staged = nil // moved or removed
 	if err != nil {
-		writeJSONStatus(w, http.StatusInternalServerError, "Could not save file")
+		writeSaveFileError(w, err)
 		return
 	}
 
@@ -97,3 +156,85 @@ func (s *RESTService) UploadHandler(w http.ResponseWriter, r *http.Request) {
 		"uuid": file_uuid,
 	})
 }
+
+// saveStagedUpload saves an upload as new file, renaming it on name conflicts. With versioning, an existing file
+// with the same name gets the upload as new version instead.
+func (s *RESTService) saveStagedUpload(staged *store.StagedFile, res *store.Resource, versioning bool) (string, error) {
+	if versioning {
+		return s.resourceService.SaveStagedFileAsVersion(staged, res)
+	}
+	return s.resourceService.SaveStagedFile(staged, res, true)
+}
+
+// writeSaveFileError responds to errors of SaveStagedFile and SaveStagedFileAsVersion
+func writeSaveFileError(w http.ResponseWriter, err error) {
+	switch err {
+	case apperror.ErrFileInvalidFilename, apperror.ErrInvalidParent, apperror.ErrInvalidMaxDownloads:
+		writeJSONStatus(w, http.StatusBadRequest, err.Error())
+	case apperror.ErrVersioningNotAFile:
+		writeJSONStatus(w, apperror.ErrVersioningNotAFile.Code, apperror.ErrVersioningNotAFile.Msg)
+	case apperror.ErrFileAlreadyExists, apperror.ErrResourceNotFound:
+		// a legacy file that can not be versioned, or the file was deleted while the upload was saved
+		writeJSONStatus(w, http.StatusConflict, "Could not save file as new version")
+	case apperror.ErrInsufficientStorage:
+		writeJSONStatus(w, apperror.ErrInsufficientStorage.Code, apperror.ErrInsufficientStorage.Msg)
+	default:
+		writeJSONStatus(w, http.StatusInternalServerError, "Could not save file")
+	}
+}
+
+// writeUploadStreamError responds to errors that occur while an upload is received
+func writeUploadStreamError(w http.ResponseWriter, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if err == apperror.ErrFileTooLarge || errors.As(err, &maxBytesErr) {
+		writeJSONStatus(w, http.StatusRequestEntityTooLarge, "File too large")
+		return
+	}
+	writeJSONStatus(w, http.StatusBadRequest, "Upload error")
+}
+
+// parseAutoDeleteIn parses a TTL like "12h" or "7d". Empty input means no TTL, invalid input falls back to 24h.
+func parseAutoDeleteIn(raw string) *time.Duration {
+	if raw == "" {
+		return nil
+	}
+
+	d, err := parseDuration(raw)
+	if err != nil {
+		d = 24 * time.Hour // fallback
+	}
+	return &d
+}
+
+// parseDuration parses a non-negative duration like "30m", "12h" or "7d"
+func parseDuration(raw string) (time.Duration, error) {
+	if daysStr, ok := strings.CutSuffix(raw, "d"); ok {
+		days, err := strconv.Atoi(daysStr)
+		if err != nil || days < 0 {
+			return 0, errors.New("invalid number of days")
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, errors.New("negative duration")
+	}
+	return d, nil
+}
+
+// parseMaxDownloads parses the number of allowed views and downloads of a file. Empty input means no limit.
+func parseMaxDownloads(raw string) (*int64, error) {
+	if raw == "" {
+		return nil, nil
+	}
+
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || n <= 0 {
+		return nil, apperror.ErrInvalidMaxDownloads
+	}
+	return &n, nil
+}
@@ -88,16 +88,6 @@ func TestUploadHandler_Success(t *testing.T) {
 		t.Errorf("Expected status %d, got %d", http.StatusCreated, resp.StatusCode)
 	}
 
-	savedPath := filepath.Join(cfg.UploadPath, key.UUID, testFilename)
-	content, err := os.ReadFile(savedPath)
-	if err != nil {
-		t.Fatalf("File not saved: %v", err)
-	}
-
-	if string(content) != testContent {
-		t.Errorf("File content mismatch.\nGot:  %q\nWant: %q", content, testContent)
-	}
-
 	// parse response JSON in map
 	var result map[string]interface{}
 	err = json.NewDecoder(resp.Body).Decode(&result)
@@ -111,6 +101,19 @@ func TestUploadHandler_Success(t *testing.T) {
 		t.Fatalf("UUID not found or not a string")
 	}
 
+	savedPath, err := httpapi.StoredFilePath(rs, uuid)
+	if err != nil {
+		t.Fatalf("Path error: %v", err)
+	}
+	content, err := os.ReadFile(savedPath)
+	if err != nil {
+		t.Fatalf("File not saved: %v", err)
+	}
+
+	if string(content) != testContent {
+		t.Errorf("File content mismatch.\nGot:  %q\nWant: %q", content, testContent)
+	}
+
 	// database check
 	r, err := rs.GetResourceByUUID(uuid)
 	if err != nil {
@@ -464,3 +467,175 @@ func TestUploadHandler_InvalidFilename_1(t *testing.T) {
 		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, resp.StatusCode)
 	}
 }
+
+func TestUploadHandler_SpaceLimitExceeded(t *testing.T) {
+	dataDir := t.TempDir()
+	cfg := &config.Config{
+		DataPath:         dataDir,
+		UploadPath:       filepath.Join(dataDir, "upload"),
+		MaxFileSizeInMB:  5,
+		SpacePerUserInMB: 1,
+		Port:             8080,
+	}
+
+	as, rs, restService, err := httpapi.InitTestServices(cfg)
+	if err != nil {
+		t.Fatalf("Can not initialize test services: %v", err)
+	}
+
+	const apiKey = "123"
+	key, err := as.AddAPIKey(apiKey, "test key", false, nil)
+	if err != nil {
+		t.Fatalf("Can not add API key: %v", err)
+	}
+
+	if err := store.CreateDirsFromConfig(cfg); err != nil {
+		t.Fatalf("Can not create app dirs: %v", err)
+	}
+
+	if _, err = rs.GetOrCreateHomeDir(key.HashedKey); err != nil {
+		t.Fatalf("Can not create home dir: %v", err)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(restService.UploadHandler))
+	defer ts.Close()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("file", "big.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := part.Write(bytes.Repeat([]byte("A"), 2<<20)); err != nil {
+		t.Fatal(err)
+	}
+	writer.Close()
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusInsufficientStorage {
+		t.Errorf("Expected status %d, got %d", http.StatusInsufficientStorage, resp.StatusCode)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(cfg.UploadPath, key.UUID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("File should not be saved, found %d entries in home dir", len(entries))
+	}
+}
+
+func TestUploadHandler_StreamedTooLarge(t *testing.T) {
+	restService, _, key, cfg := setupFolderTest(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(restService.UploadHandler))
+	defer ts.Close()
+
+	// unknown content length, so the size can only be checked while streaming
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	go func() {
+		part, err := writer.CreateFormFile("file", "big.bin")
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		if _, err := part.Write(bytes.Repeat([]byte("A"), 6<<20)); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		writer.Close()
+		pw.Close()
+	}()
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL, pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer 123")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status %d, got %d", http.StatusRequestEntityTooLarge, resp.StatusCode)
+	}
+
+	// no leftover temp files
+	entries, err := os.ReadDir(filepath.Join(cfg.UploadPath, key.UUID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected empty home dir, found %d entries", len(entries))
+	}
+}
+
+func TestUploadHandler_FieldsBeforeFile(t *testing.T) {
+	restService, rs, _, _ := setupFolderTest(t)
+
+	w := createFolder(t, restService, `{"name": "project"}`)
+	var folder map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&folder); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	writer.WriteField("parent", folder["uuid"])
+	writer.WriteField("is_private", "true")
+	writer.WriteField("auto_del_in", "1h")
+	part, err := writer.CreateFormFile("file", "a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte("content"))
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, config.EndpointUpload, body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer 123")
+	w = httptest.NewRecorder()
+	restService.UploadHandler(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	var result map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+
+	r, err := rs.GetResourceByUUID(result["uuid"])
+	if err != nil {
+		t.Fatalf("Resource does not exist: %v", err)
+	}
+	if !r.IsPrivate || r.AutoDeleteAt == nil || r.ParentUUID == nil || *r.ParentUUID != folder["uuid"] || r.Size != 7 || r.SHA256 == "" {
+		t.Errorf("Unexpected resource: %+v", r)
+	}
+
+	savedPath, err := httpapi.StoredFilePath(rs, r.UUID)
+	if err != nil {
+		t.Fatalf("Path error: %v", err)
+	}
+	if _, err := os.Stat(savedPath); err != nil {
+		t.Errorf("File not saved: %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package httpapi
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/twigman/fshare/src/config"
+	"github.com/twigman/fshare/src/internal/apperror"
+	"github.com/twigman/fshare/src/storage"
+	"github.com/twigman/fshare/src/store"
+)
+
+// listVersions returns the current and all older versions of a file of the API key, newest first
+func (s *RESTService) listVersions(w http.ResponseWriter, r *http.Request, rUUID string) {
+	keyUUID, err := s.authorizeBearer(w, r)
+	if err != nil {
+		return
+	}
+
+	res, versions, err := s.resourceService.ListVersions(rUUID, keyUUID)
+	if err != nil {
+		writeVersionError(w, err)
+		return
+	}
+
+	resp := VersionListResponse{
+		UUID:     res.UUID,
+		Name:     res.Name,
+		Versions: []VersionResponse{newVersionResponse(res, store.CurrentVersion(res))},
+	}
+	for _, v := range versions {
+		resp.Versions = append(resp.Versions, newVersionResponse(res, v))
+	}
+	writeJSONResponse(w, http.StatusOK, resp)
+}
+
+// downloadVersion sends the content of a version of a file of the API key as attachment
+func (s *RESTService) downloadVersion(w http.ResponseWriter, r *http.Request, rUUID string, rawVersion string) {
+	keyUUID, err := s.authorizeBearer(w, r)
+	if err != nil {
+		return
+	}
+
+	version, err := strconv.ParseInt(rawVersion, 10, 64)
+	if err != nil || version <= 0 {
+		writeJSONStatus(w, http.StatusNotFound, apperror.ErrVersionNotFound.Msg)
+		return
+	}
+
+	res, v, err := s.resourceService.GetVersion(rUUID, keyUUID, version)
+	if err != nil {
+		writeVersionError(w, err)
+		return
+	}
+
+	content, err := s.resourceService.OpenResourceVersion(res, v)
+	if err == storage.ErrNotExist {
+		writeJSONStatus(w, http.StatusNotFound, "File not found")
+		return
+	}
+	if err != nil {
+		writeJSONStatus(w, http.StatusInternalServerError, "Could not read file")
+		return
+	}
+	defer content.Close()
+
+	w.Header().Set("Content-Type", detectMimeType(res.Name))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", res.Name))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	setDigestHeaders(w, v.SHA256)
+	http.ServeContent(w, r, res.Name, v.CreatedAt, content)
+}
+
+func newVersionResponse(res *store.Resource, v *store.ResourceVersion) VersionResponse {
+	return VersionResponse{
+		Version:   v.Version,
+		Size:      v.Size,
+		SHA256:    v.SHA256,
+		CreatedAt: v.CreatedAt,
+		IsCurrent: v.Version == res.Version,
+		RawURL:    config.EndpointResource + res.UUID + "/versions/" + strconv.FormatInt(v.Version, 10),
+	}
+}
+
+func writeVersionError(w http.ResponseWriter, err error) {
+	switch err {
+	case apperror.ErrResourceNotFound, apperror.ErrAuthorization:
+		// do not reveal resources of other API keys
+		writeJSONStatus(w, http.StatusNotFound, apperror.ErrResourceNotFound.Msg)
+	case apperror.ErrVersionNotFound:
+		writeJSONStatus(w, http.StatusNotFound, apperror.ErrVersionNotFound.Msg)
+	default:
+		writeJSONStatus(w, http.StatusInternalServerError, "Could not read versions")
+	}
+}
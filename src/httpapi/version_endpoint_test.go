@@ -0,0 +1,103 @@
+package httpapi_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/twigman/fshare/src/config"
+	"github.com/twigman/fshare/src/httpapi"
+)
+
+func getVersions(restService *httpapi.RESTService, path string, apiKey string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, config.EndpointResource+path, nil)
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	w := httptest.NewRecorder()
+
+	restService.ManageResourceHandler(w, req)
+	return w
+}
+
+func TestManageResourceHandler_Versions(t *testing.T) {
+	dataDir := t.TempDir()
+	restService, _, as, _, _, fileUUID, err := httpapi.SetupExistingTestUpload(dataDir, "123", "test.txt", false, false)
+	if err != nil {
+		t.Fatalf("Setup error: %v", err)
+	}
+	if _, err := as.AddAPIKey("456", "other key", false, nil); err != nil {
+		t.Fatalf("Can not add API key: %v", err)
+	}
+
+	// re-upload with versioning keeps UUID and link
+	w := putUpload(restService, config.EndpointPut+"test.txt?versioning=true", "Hello again", map[string]string{
+		"Accept": "application/json",
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var put httpapi.PutUploadResponse
+	if err := json.NewDecoder(w.Body).Decode(&put); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	if put.UUID != fileUUID || put.Name != "test.txt" || put.Version != 2 {
+		t.Errorf("Unexpected response: %+v", put)
+	}
+	if w := viewLink(restService, fileUUID); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Hello again") {
+		t.Errorf("Expected the link to serve the latest version, got %d", w.Code)
+	}
+
+	w = getVersions(restService, fileUUID+"/versions", "123")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var list httpapi.VersionListResponse
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	if len(list.Versions) != 2 || list.Versions[0].Version != 2 || !list.Versions[0].IsCurrent ||
+		list.Versions[1].Version != 1 || list.Versions[1].IsCurrent || list.Versions[1].Size != 11 {
+		t.Fatalf("Unexpected versions: %+v", list.Versions)
+	}
+
+	w = getVersions(restService, strings.TrimPrefix(list.Versions[1].RawURL, config.EndpointResource), "123")
+	if w.Code != http.StatusOK || w.Body.String() != "Hello World" {
+		t.Errorf("Expected content of version 1, got %d %q", w.Code, w.Body.String())
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.Contains(cd, "test.txt") {
+		t.Errorf("Unexpected Content-Disposition %q", cd)
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		apiKey string
+		status int
+	}{
+		{"unknown version", fileUUID + "/versions/9", "123", http.StatusNotFound},
+		{"invalid version", fileUUID + "/versions/abc", "123", http.StatusNotFound},
+		{"other key", fileUUID + "/versions", "456", http.StatusNotFound},
+		{"other key download", fileUUID + "/versions/1", "456", http.StatusNotFound},
+		{"invalid key", fileUUID + "/versions", "999", http.StatusUnauthorized},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if w := getVersions(restService, tc.path, tc.apiKey); w.Code != tc.status {
+				t.Errorf("Expected status %d, got %d: %s", tc.status, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	// without versioning, the upload is still renamed
+	w = putUpload(restService, config.EndpointPut+"test.txt", "Hello", map[string]string{"Accept": "application/json"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	if err := json.NewDecoder(w.Body).Decode(&put); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	if put.UUID == fileUUID || put.Name != "0test.txt" || put.Version != 1 {
+		t.Errorf("Unexpected response: %+v", put)
+	}
+}
@@ -39,4 +39,32 @@ var (
 	ErrEmptyAPIKey             = &FShareError{Code: http.StatusBadRequest, Key: "invalid_apikey", Msg: "Empty API key"}
 	ErrDeleteHomeDirNotAllowed = &FShareError{Code: http.StatusForbidden, Key: "unauthorized_delete_home_dir", Msg: "Deleting the home directory is not allowed"}
 	ErrAuthorization           = &FShareError{Code: http.StatusUnauthorized, Key: "unauthorized", Msg: "Not authorized"}
+	ErrInvalidParent           = &FShareError{Code: http.StatusBadRequest, Key: "invalid_parent", Msg: "Parent is not a valid folder"}
+	ErrMaxFolderDepthReached   = &FShareError{Code: http.StatusBadRequest, Key: "max_folder_depth_reached", Msg: "Maximum folder depth reached"}
+	ErrInvalidSpaceLimit       = &FShareError{Code: http.StatusBadRequest, Key: "invalid_space_limit", Msg: "Space limit must not be negative"}
+	ErrInvalidListOptions      = &FShareError{Code: http.StatusBadRequest, Key: "invalid_list_options", Msg: "Invalid sort, order or cursor"}
+	ErrAPIKeyNotFound          = &FShareError{Code: http.StatusNotFound, Key: "apikey_not_found", Msg: "API key not found"}
+	ErrAPIKeyRevoked           = &FShareError{Code: http.StatusConflict, Key: "apikey_revoked", Msg: "API key is revoked"}
+	ErrInvalidRevokePolicy     = &FShareError{Code: http.StatusBadRequest, Key: "invalid_revoke_policy", Msg: "Invalid revoke policy"}
+	ErrInsufficientStorage     = &FShareError{Code: http.StatusInsufficientStorage, Key: "insufficient_storage", Msg: "Storage quota exceeded"}
+	ErrFileTooLarge            = &FShareError{Code: http.StatusRequestEntityTooLarge, Key: "file_too_large", Msg: "File too large"}
+	ErrUploadNotFound          = &FShareError{Code: http.StatusNotFound, Key: "upload_not_found", Msg: "Upload not found"}
+	ErrUploadExpired           = &FShareError{Code: http.StatusGone, Key: "upload_expired", Msg: "Upload expired"}
+	ErrUploadOffsetMismatch    = &FShareError{Code: http.StatusConflict, Key: "upload_offset_mismatch", Msg: "Upload offset does not match"}
+	ErrUploadLocked            = &FShareError{Code: http.StatusLocked, Key: "upload_locked", Msg: "Upload is in use by another request"}
+	ErrUploadCompleted         = &FShareError{Code: http.StatusForbidden, Key: "upload_completed", Msg: "Upload is already completed"}
+	ErrDownloadLimitReached    = &FShareError{Code: http.StatusGone, Key: "download_limit_reached", Msg: "Download limit reached"}
+	ErrInvalidMaxDownloads     = &FShareError{Code: http.StatusBadRequest, Key: "invalid_max_downloads", Msg: "max_downloads must be a positive number"}
+	ErrShareNotFound           = &FShareError{Code: http.StatusNotFound, Key: "share_not_found", Msg: "Share not found"}
+	ErrShareNotAFile           = &FShareError{Code: http.StatusBadRequest, Key: "share_not_a_file", Msg: "Only files can be shared"}
+	ErrShareLimitedFile        = &FShareError{Code: http.StatusConflict, Key: "share_limited_file", Msg: "Files with a download limit can not be shared"}
+	ErrInvalidShareExpiry      = &FShareError{Code: http.StatusBadRequest, Key: "invalid_share_expiry", Msg: "expires_at must be in the future"}
+	ErrUpdateHomeDirNotAllowed = &FShareError{Code: http.StatusForbidden, Key: "unauthorized_update_home_dir", Msg: "Changing the home directory is not allowed"}
+	ErrAutoDeleteNotAFile      = &FShareError{Code: http.StatusBadRequest, Key: "autodelete_not_a_file", Msg: "Only files can be deleted automatically"}
+	ErrResourceNotInTrash      = &FShareError{Code: http.StatusConflict, Key: "resource_not_in_trash", Msg: "Resource is not in the trash"}
+	ErrInvalidMaxVersions      = &FShareError{Code: http.StatusBadRequest, Key: "invalid_max_versions", Msg: "max_versions must not be negative"}
+	ErrVersionNotFound         = &FShareError{Code: http.StatusNotFound, Key: "version_not_found", Msg: "Version not found"}
+	ErrVersioningNotAFile      = &FShareError{Code: http.StatusConflict, Key: "versioning_not_a_file", Msg: "A folder with this name already exists"}
+	ErrInvalidThumbnailSize    = &FShareError{Code: http.StatusBadRequest, Key: "invalid_thumbnail_size", Msg: "Invalid thumbnail size"}
+	ErrThumbnailNotSupported   = &FShareError{Code: http.StatusUnsupportedMediaType, Key: "thumbnail_not_supported", Msg: "No thumbnail available for this file"}
 )
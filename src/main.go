@@ -12,15 +12,23 @@ import (
 
 	"github.com/twigman/fshare/src/config"
 	"github.com/twigman/fshare/src/httpapi"
+	"github.com/twigman/fshare/src/storage"
 	"github.com/twigman/fshare/src/store"
 	"github.com/twigman/fshare/src/utils"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "fsck" {
+		runFsck(os.Args[2:])
+		return
+	}
+
 	flagAPIKey := flag.String("api-key", "", "initial API key to start the service")
 	flagComment := flag.String("comment", "", "comment for initial API key")
 	flagHighlyTrusted := flag.Bool("highly-trusted", false, "more privileges for the key user")
 	flagConfigPath := flag.String("config", "", "config file path")
+	flagRotateHMACSecret := flag.Bool("rotate-hmac-secret", false, "create a new secret to sign URLs and exit")
+	flagHMACGracePeriod := flag.Duration("hmac-grace-period", 7*24*time.Hour, "how long URLs signed with the previous secret stay valid after rotation")
 
 	flag.Parse()
 
@@ -42,6 +50,15 @@ func main() {
 
 	log.Printf("Config loaded\n")
 
+	if *flagRotateHMACSecret {
+		env, err := config.RotateHMACSecret(cfg.DataPath, *flagHMACGracePeriod)
+		if err != nil {
+			log.Fatalf("Error rotating HMAC secret: %v", err)
+		}
+		log.Printf("New HMAC secret %s is active, previous secrets are valid for %s. Restart the service to apply it.", env.HMACKeyID, *flagHMACGracePeriod)
+		return
+	}
+
 	// create directories
 	err = store.CreateDirsFromConfig(cfg)
 	if err != nil {
@@ -60,7 +77,21 @@ func main() {
 	 * api key + home dir
 	 ******************************/
 	as := store.NewAPIKeyService(db)
-	rs := store.NewResourceService(cfg, db)
+	backend, err := storage.New(cfg)
+	if err != nil {
+		log.Fatalf("Error initializing storage backend: %v", err)
+	}
+	if cfg.Storage.Backend == config.StorageS3 {
+		if err := storage.ClaimOwnership(backend, cfg.DataPath); err != nil {
+			log.Fatalf("Error claiming storage: %v", err)
+		}
+	}
+	rs := store.NewResourceServiceWithStorage(cfg, db, backend)
+
+	// files uploaded by older versions are stored under their name
+	if err := rs.MigrateLegacyFiles(); err != nil {
+		log.Fatalf("Error migrating files into the blob store: %v", err)
+	}
 
 	var key *store.APIKey
 
@@ -123,18 +154,33 @@ func startServer(cfg *config.Config, as *store.APIKeyService, rs *store.Resource
 	mux.HandleFunc(config.EndpointView, restService.ResourceHandler)
 	mux.HandleFunc(config.EndpointDelete, restService.DeleteHandler)
 	mux.HandleFunc(config.EndpointRaw, restService.RawResourceHandler)
-	mux.HandleFunc(config.EndpointAPIKey, restService.CreateAPIKeyHandler)
+	mux.HandleFunc(config.EndpointAPIKey, restService.APIKeyHandler)
+	mux.HandleFunc(config.EndpointAPIKeyManage, restService.ManageAPIKeyHandler)
+	mux.HandleFunc(config.EndpointFolder, restService.CreateFolderHandler)
+	mux.HandleFunc(config.EndpointList, restService.ListResourcesHandler)
+	mux.HandleFunc(config.EndpointInfo, restService.ResourceInfoHandler)
+	mux.HandleFunc(config.EndpointTus, restService.TusHandler)
+	mux.HandleFunc(config.EndpointPut, restService.PutUploadHandler)
+	mux.HandleFunc(config.EndpointShare, restService.ShareHandler)
+	mux.HandleFunc(config.EndpointSign, restService.SignURLHandler)
+	mux.HandleFunc(config.EndpointThumb, restService.ThumbnailHandler)
+	mux.HandleFunc(config.EndpointGallery, restService.GalleryHandler)
+	mux.HandleFunc(config.EndpointResource, restService.ManageResourceHandler)
 
 	// start cleanup worker for autodelete
 	stopCh := make(chan struct{})
 	go rs.StartCleanupWorker(time.Duration(cfg.AutoDeleteIntervalInSec)*time.Second, stopCh)
 
+	if cfg.ContinuousFileValidation {
+		go rs.StartValidationWorker(cfg.ValidationInterval(), cfg.ValidationRateBytes(), stopCh)
+	}
+
 	// handle graceful shutdown
 	signalCh := make(chan os.Signal, 1)
 	signal.Notify(signalCh, os.Interrupt, os.Kill)
 	go func() {
 		<-signalCh
-		log.Println("Shutdown signal received, stopping cleanup worker...")
+		log.Println("Shutdown signal received, stopping background workers...")
 		close(stopCh)
 		os.Exit(0)
 	}()
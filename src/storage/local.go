@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Local stores objects as files below a root dir on the local disk
+type Local struct {
+	root string
+}
+
+func NewLocal(root string) *Local {
+	return &Local{root: root}
+}
+
+// Path returns the path of the file holding an object
+func (l *Local) Path(key string) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(l.root, filepath.FromSlash(key)), nil
+}
+
+func (l *Local) Put(key string, src io.Reader, size int64) error {
+	path, err := l.Path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	// write next to the destination, so the object appears atomically
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), ".put-*")
+	if err != nil {
+		return fmt.Errorf("temp file creation error: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	n, err := io.Copy(tmpFile, src)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if size >= 0 && n != size {
+		return fmt.Errorf("expected %d bytes, got %d", size, n)
+	}
+
+	return os.Rename(tmpFile.Name(), path)
+}
+
+// PutFile links a local file into the store, so its content is not copied if both are on the same filesystem
+func (l *Local) PutFile(key string, srcPath string) error {
+	path, err := l.Path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	if err := os.Link(srcPath, path); err == nil {
+		return nil
+	}
+
+	// e.g. different filesystems
+	f, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return l.Put(key, f, -1)
+}
+
+func (l *Local) Get(key string) (io.ReadCloser, error) {
+	return l.Open(key)
+}
+
+func (l *Local) GetRange(key string, offset int64, length int64) (io.ReadCloser, error) {
+	obj, err := l.Open(key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := obj.Seek(offset, io.SeekStart); err != nil {
+		obj.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(obj, length), obj}, nil
+}
+
+func (l *Local) Open(key string) (*Object, error) {
+	path, err := l.Path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotExist
+		}
+		return nil, err
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Object{ReadSeekCloser: f, ObjectInfo: ObjectInfo{Size: stat.Size(), ModTime: stat.ModTime()}}, nil
+}
+
+func (l *Local) Stat(key string) (*ObjectInfo, error) {
+	path, err := l.Path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotExist
+		}
+		return nil, err
+	}
+	return &ObjectInfo{Size: stat.Size(), ModTime: stat.ModTime()}, nil
+}
+
+func (l *Local) Delete(key string) error {
+	path, err := l.Path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// ownerKey is the object recording which instance stores its objects next to it.
+// Blob keys always contain a slash, so it never collides with a blob.
+const ownerKey = ".fshare-owner"
+
+// instanceIDFile in the data path identifies an instance
+const instanceIDFile = "instance_id"
+
+// ClaimOwnership marks the objects of the backend as owned by the instance with the given data path and fails if
+// another instance already owns them. fshare keeps the references of blobs, sessions and secrets in the local
+// database of one instance, so two instances sharing objects would delete content the other one still references.
+// The marker is written with a conditional put, so of two instances starting at the same time only one wins.
+func ClaimOwnership(b Backend, dataPath string) error {
+	cp, ok := b.(conditionalPutter)
+	if !ok {
+		return errors.New("the storage backend does not support conditional writes")
+	}
+
+	id, err := loadOrCreateInstanceID(dataPath)
+	if err != nil {
+		return err
+	}
+
+	err = cp.PutIfAbsent(ownerKey, strings.NewReader(id), int64(len(id)))
+	if err == nil {
+		return nil
+	}
+	if err != ErrExist {
+		return err
+	}
+
+	owner, err := readOwner(b)
+	if err != nil {
+		return err
+	}
+	if owner != id {
+		return fmt.Errorf("the storage is used by the instance %s, every instance needs its own bucket or storage.s3.prefix", owner)
+	}
+	return nil
+}
+
+func readOwner(b Backend) (string, error) {
+	rc, err := b.Get(ownerKey)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, 64))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// loadOrCreateInstanceID returns the ID of the instance with the given data path
+func loadOrCreateInstanceID(dataPath string) (string, error) {
+	path := filepath.Join(dataPath, instanceIDFile)
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if id := strings.TrimSpace(string(data)); id != "" {
+			return id, nil
+		}
+		return "", errors.New(path + " is empty")
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	id := uuid.NewString()
+	if err := os.WriteFile(path, []byte(id+"\n"), 0o600); err != nil {
+		return "", err
+	}
+	return id, nil
+}
@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/twigman/fshare/src/config"
+)
+
+// ErrNotExist is returned for keys without a stored object
+var ErrNotExist = errors.New("object does not exist")
+
+// ErrExist is returned by a conditional write if there already is an object for the key
+var ErrExist = errors.New("object already exists")
+
+// Backend stores the content of files as objects addressed by a key like "ab/abcdef..."
+type Backend interface {
+	// Put stores size bytes from src under key, replacing an existing object
+	Put(key string, src io.Reader, size int64) error
+	// Get returns the whole content of an object
+	Get(key string) (io.ReadCloser, error)
+	// GetRange returns length bytes of an object starting at offset
+	GetRange(key string, offset int64, length int64) (io.ReadCloser, error)
+	// Stat returns ErrNotExist if there is no object for key
+	Stat(key string) (*ObjectInfo, error)
+	// Delete removes an object. Deleting a missing object is not an error.
+	Delete(key string) error
+}
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Size    int64
+	ModTime time.Time
+}
+
+// Object is the opened content of a stored object. It can be passed to http.ServeContent.
+type Object struct {
+	io.ReadSeekCloser
+	ObjectInfo
+}
+
+// fileImporter is implemented by backends that can take over a local file without copying it
+type fileImporter interface {
+	PutFile(key string, path string) error
+}
+
+// conditionalPutter is implemented by backends that can store an object only if the key is free, in one request
+type conditionalPutter interface {
+	PutIfAbsent(key string, src io.Reader, size int64) error
+}
+
+// opener is implemented by backends that can open objects more efficiently than by range requests
+type opener interface {
+	Open(key string) (*Object, error)
+}
+
+// New creates the backend selected in the config
+func New(cfg *config.Config) (Backend, error) {
+	switch cfg.Storage.Backend {
+	case "", config.StorageLocal:
+		return NewLocal(filepath.Join(cfg.UploadPath, "blobs")), nil
+	case config.StorageS3:
+		s3cfg := cfg.Storage.S3
+		// credentials should not have to be stored in the config file
+		if s3cfg.AccessKey == "" {
+			s3cfg.AccessKey = os.Getenv("FSHARE_S3_ACCESS_KEY")
+		}
+		if s3cfg.SecretKey == "" {
+			s3cfg.SecretKey = os.Getenv("FSHARE_S3_SECRET_KEY")
+		}
+		return NewS3(s3cfg, nil)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Storage.Backend)
+	}
+}
+
+// PutFile stores the content of a local file under key. The local file is left untouched.
+func PutFile(b Backend, key string, path string) error {
+	if i, ok := b.(fileImporter); ok {
+		return i.PutFile(key, path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return b.Put(key, f, stat.Size())
+}
+
+// Open opens an object for reading and seeking
+func Open(b Backend, key string) (*Object, error) {
+	if o, ok := b.(opener); ok {
+		return o.Open(key)
+	}
+
+	info, err := b.Stat(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Object{
+		ReadSeekCloser: &rangeReadSeeker{b: b, key: key, size: info.Size},
+		ObjectInfo:     *info,
+	}, nil
+}
+
+// validateKey rejects keys that could escape the storage root
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return fmt.Errorf("invalid storage key %q", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("invalid storage key %q", key)
+		}
+	}
+	return nil
+}
+
+// rangeReadSeeker reads an object lazily by range requests starting at the current offset
+type rangeReadSeeker struct {
+	b      Backend
+	key    string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+func (r *rangeReadSeeker) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		body, err := r.b.GetRange(r.key, r.offset, r.size-r.offset)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	if err == io.EOF && r.offset < r.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (r *rangeReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = r.offset + offset
+	case io.SeekEnd:
+		abs = r.size + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	if abs != r.offset && r.body != nil {
+		// the next read starts a new range request
+		r.body.Close()
+		r.body = nil
+	}
+	r.offset = abs
+	return abs, nil
+}
+
+func (r *rangeReadSeeker) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
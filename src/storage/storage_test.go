@@ -0,0 +1,230 @@
+package storage_test
+
+import (
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/twigman/fshare/src/config"
+	"github.com/twigman/fshare/src/storage"
+	"github.com/twigman/fshare/src/testutil/fake"
+)
+
+// testBackend runs the same checks against every backend
+func testBackend(t *testing.T, b storage.Backend) {
+	t.Helper()
+	content := []byte("Hello World")
+
+	if _, err := b.Stat("ab/missing"); err != storage.ErrNotExist {
+		t.Fatalf("expected ErrNotExist, got %v", err)
+	}
+	if _, err := b.Get("ab/missing"); err != storage.ErrNotExist {
+		t.Fatalf("expected ErrNotExist, got %v", err)
+	}
+
+	if err := b.Put("ab/object", bytes.NewReader(content), int64(len(content))); err != nil {
+		t.Fatalf("Put error: %v", err)
+	}
+
+	info, err := b.Stat("ab/object")
+	if err != nil {
+		t.Fatalf("Stat error: %v", err)
+	}
+	if info.Size != int64(len(content)) {
+		t.Errorf("expected size %d, got %d", len(content), info.Size)
+	}
+
+	rc, err := b.Get("ab/object")
+	if err != nil {
+		t.Fatalf("Get error: %v", err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if !bytes.Equal(data, content) {
+		t.Errorf("Get: got %q, want %q", data, content)
+	}
+
+	rc, err = b.GetRange("ab/object", 6, 5)
+	if err != nil {
+		t.Fatalf("GetRange error: %v", err)
+	}
+	data, _ = io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "World" {
+		t.Errorf("GetRange: got %q, want %q", data, "World")
+	}
+
+	// seekable reads, e.g. by http.ServeContent
+	obj, err := storage.Open(b, "ab/object")
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	if end, err := obj.Seek(0, io.SeekEnd); err != nil || end != int64(len(content)) {
+		t.Errorf("Seek end: got %d, %v", end, err)
+	}
+	if _, err := obj.Seek(6, io.SeekStart); err != nil {
+		t.Fatalf("Seek error: %v", err)
+	}
+	data, _ = io.ReadAll(obj)
+	if string(data) != "World" {
+		t.Errorf("Seek+Read: got %q, want %q", data, "World")
+	}
+	obj.Close()
+
+	// local files
+	src := filepath.Join(t.TempDir(), "src")
+	if err := os.WriteFile(src, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.PutFile(b, "cd/file", src); err != nil {
+		t.Fatalf("PutFile error: %v", err)
+	}
+	if _, err := os.Stat(src); err != nil {
+		t.Errorf("expected source file to be left untouched: %v", err)
+	}
+	if info, err := b.Stat("cd/file"); err != nil || info.Size != int64(len(content)) {
+		t.Errorf("file not stored: %+v, %v", info, err)
+	}
+
+	if err := b.Delete("ab/object"); err != nil {
+		t.Fatalf("Delete error: %v", err)
+	}
+	if _, err := b.Stat("ab/object"); err != storage.ErrNotExist {
+		t.Errorf("expected ErrNotExist after delete, got %v", err)
+	}
+	if err := b.Delete("ab/object"); err != nil {
+		t.Errorf("deleting a missing object should not fail: %v", err)
+	}
+
+	for _, key := range []string{"", "/abs", "../escape", "ab/../../escape", "ab//c"} {
+		if err := b.Put(key, bytes.NewReader(content), int64(len(content))); err == nil {
+			t.Errorf("expected invalid key %q to be rejected", key)
+		}
+	}
+}
+
+func TestLocal(t *testing.T) {
+	root := t.TempDir()
+	b := storage.NewLocal(root)
+	testBackend(t, b)
+
+	if _, err := os.Stat(filepath.Join(root, "cd", "file")); err != nil {
+		t.Errorf("expected object to be stored below root: %v", err)
+	}
+}
+
+func TestS3(t *testing.T) {
+	srv := fake.NewS3Server("access")
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	b, err := storage.NewS3(config.S3Config{
+		Endpoint:  ts.URL,
+		Bucket:    "fshare",
+		Prefix:    "blobs",
+		AccessKey: "access",
+		SecretKey: "secret",
+	}, ts.Client())
+	if err != nil {
+		t.Fatalf("NewS3 error: %v", err)
+	}
+	testBackend(t, b)
+
+	if data, ok := srv.Object("/fshare/blobs/cd/file"); !ok || string(data) != "Hello World" {
+		t.Errorf("expected object in bucket with prefix, got %q (%v)", data, ok)
+	}
+}
+
+func TestS3_WrongCredentials(t *testing.T) {
+	ts := httptest.NewServer(fake.NewS3Server("access"))
+	defer ts.Close()
+
+	b, err := storage.NewS3(config.S3Config{Endpoint: ts.URL, Bucket: "fshare", AccessKey: "other", SecretKey: "secret"}, ts.Client())
+	if err != nil {
+		t.Fatalf("NewS3 error: %v", err)
+	}
+	if _, err := b.Stat("ab/object"); err == nil || err == storage.ErrNotExist {
+		t.Errorf("expected access error, got %v", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	cfg := &config.Config{UploadPath: t.TempDir()}
+	b, err := storage.New(cfg)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	if _, ok := b.(*storage.Local); !ok {
+		t.Errorf("expected local backend by default, got %T", b)
+	}
+
+	cfg.Storage = config.StorageConfig{Backend: config.StorageS3, S3: config.S3Config{Endpoint: "http://localhost:9000", Bucket: "fshare"}}
+	t.Setenv("FSHARE_S3_ACCESS_KEY", "access")
+	t.Setenv("FSHARE_S3_SECRET_KEY", "secret")
+	b, err = storage.New(cfg)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	if _, ok := b.(*storage.S3); !ok {
+		t.Errorf("expected s3 backend, got %T", b)
+	}
+}
+
+func TestClaimOwnership(t *testing.T) {
+	srv := fake.NewS3Server("access")
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	newBackend := func(prefix string) storage.Backend {
+		t.Helper()
+		b, err := storage.NewS3(config.S3Config{
+			Endpoint:  ts.URL,
+			Bucket:    "fshare",
+			Prefix:    prefix,
+			AccessKey: "access",
+			SecretKey: "secret",
+		}, ts.Client())
+		if err != nil {
+			t.Fatalf("NewS3 error: %v", err)
+		}
+		return b
+	}
+
+	first, second := t.TempDir(), t.TempDir()
+	if err := storage.ClaimOwnership(newBackend("a"), first); err != nil {
+		t.Fatalf("Claim error: %v", err)
+	}
+	// restarts of the same instance
+	if err := storage.ClaimOwnership(newBackend("a"), first); err != nil {
+		t.Errorf("Expected the owner to claim again, got %v", err)
+	}
+	if err := storage.ClaimOwnership(newBackend("a"), second); err == nil {
+		t.Errorf("Expected a second instance to be rejected")
+	}
+	if err := storage.ClaimOwnership(newBackend("b"), second); err != nil {
+		t.Errorf("Expected a second instance with its own prefix to be accepted, got %v", err)
+	}
+
+	// instances starting at the same time
+	var wg sync.WaitGroup
+	var claimed atomic.Int32
+	for i := 0; i < 8; i++ {
+		b, dataPath := newBackend("c"), t.TempDir()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := storage.ClaimOwnership(b, dataPath); err == nil {
+				claimed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := claimed.Load(); n != 1 {
+		t.Errorf("Expected exactly one instance to claim the prefix, got %d", n)
+	}
+}
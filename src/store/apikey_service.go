@@ -22,29 +22,122 @@ func NewAPIKeyService(db *SQLite) *APIKeyService {
 }
 
 func (a *APIKeyService) AddAPIKey(apiKey string, comment string, isHighlyTrusted bool, createdBy *string) (*APIKey, error) {
+	key := &APIKey{
+		Comment:         comment,
+		IsHighlyTrusted: isHighlyTrusted,
+		CreatedBy:       createdBy,
+	}
+	if err := a.CreateAPIKey(apiKey, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// CreateAPIKey stores a new API key with the settings of key, including expiry and limits, in a single insert,
+// so a failed request never leaves a usable key without them. UUID, hash and creation time are filled in.
+func (a *APIKeyService) CreateAPIKey(apiKey string, key *APIKey) error {
+	if key.SpaceLimitInMB != nil && *key.SpaceLimitInMB < 0 {
+		return apperror.ErrInvalidSpaceLimit
+	}
+	if key.MaxVersions != nil && *key.MaxVersions < 0 {
+		return apperror.ErrInvalidMaxVersions
+	}
+
 	key_uuid, err := uuid.NewV7()
 	if err != nil {
-		return nil, fmt.Errorf("UUID generation error: %v", err)
+		return fmt.Errorf("UUID generation error: %v", err)
 	}
 
 	hashedKey, err := hashAPIKey(apiKey)
+	if err != nil {
+		return err
+	}
+
+	key.UUID = key_uuid.String()
+	key.HashedKey = hashedKey
+	key.CreatedAt = time.Now().UTC()
+	key.RevokedAt = nil
+	if key.ExpiresAt != nil {
+		t := key.ExpiresAt.UTC()
+		key.ExpiresAt = &t
+	}
+
+	return a.db.insertAPIKey(key)
+}
+
+// SetSpaceLimit overrides the storage quota of an API key (nil = config default, 0 = no limit)
+func (a *APIKeyService) SetSpaceLimit(keyUUID string, spaceLimitInMB *int64) error {
+	if spaceLimitInMB != nil && *spaceLimitInMB < 0 {
+		return apperror.ErrInvalidSpaceLimit
+	}
+	return a.db.updateAPIKeySpaceLimit(keyUUID, spaceLimitInMB)
+}
+
+// SetMaxVersions overrides how many older versions are kept per file of an API key (nil = config default, 0 = no limit)
+func (a *APIKeyService) SetMaxVersions(keyUUID string, maxVersions *int64) error {
+	if maxVersions != nil && *maxVersions < 0 {
+		return apperror.ErrInvalidMaxVersions
+	}
+	return a.db.updateAPIKeyMaxVersions(keyUUID, maxVersions)
+}
+
+// SetExpiresAt sets the expiry of an API key (nil = never expires)
+func (a *APIKeyService) SetExpiresAt(keyUUID string, expiresAt *time.Time) error {
+	if expiresAt != nil {
+		t := expiresAt.UTC()
+		expiresAt = &t
+	}
+	return a.db.updateAPIKeyExpiresAt(keyUUID, expiresAt)
+}
+
+func (a *APIKeyService) GetAPIKeyByUUID(keyUUID string) (*APIKey, error) {
+	key, err := a.db.findAPIKeyByUUID(keyUUID)
 	if err != nil {
 		return nil, err
 	}
+	if key == nil {
+		return nil, apperror.ErrAPIKeyNotFound
+	}
+	return key, nil
+}
 
-	key := &APIKey{
-		UUID:            key_uuid.String(),
-		HashedKey:       hashedKey,
-		Comment:         comment,
-		IsHighlyTrusted: isHighlyTrusted,
-		CreatedAt:       time.Now().UTC(),
-		CreatedBy:       createdBy,
+// ListAPIKeysCreatedBy returns all keys created by the given key, including revoked and expired ones
+func (a *APIKeyService) ListAPIKeysCreatedBy(creatorUUID string) ([]*APIKey, error) {
+	return a.db.findAPIKeysCreatedBy(creatorUUID)
+}
+
+// RevokeAPIKey permanently disables an API key. Its resources are not touched.
+func (a *APIKeyService) RevokeAPIKey(keyUUID string) error {
+	key, err := a.GetAPIKeyByUUID(keyUUID)
+	if err != nil {
+		return err
+	}
+	if key.RevokedAt != nil {
+		return apperror.ErrAPIKeyRevoked
 	}
+	return a.db.updateAPIKeyRevokedAt(keyUUID, time.Now().UTC())
+}
 
-	err = a.db.insertAPIKey(key)
+// RotateAPIKey replaces the secret of an API key. UUID and home dir stay the same.
+func (a *APIKeyService) RotateAPIKey(keyUUID string, newAPIKey string) (*APIKey, error) {
+	key, err := a.GetAPIKeyByUUID(keyUUID)
 	if err != nil {
 		return nil, err
 	}
+	if key.RevokedAt != nil {
+		return nil, apperror.ErrAPIKeyRevoked
+	}
+
+	hashedKey, err := hashAPIKey(newAPIKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.db.updateAPIKeyHash(keyUUID, hashedKey); err != nil {
+		return nil, err
+	}
+
+	key.HashedKey = hashedKey
 	return key, nil
 }
 
@@ -84,7 +177,7 @@ func (a *APIKeyService) GetUUIDForAPIKey(apiKey string) (string, error) {
 		return "", err
 	}
 
-	if key == nil {
+	if key == nil || !key.IsActive(time.Now().UTC()) {
 		return "", nil
 	}
 	return key.UUID, nil
@@ -3,6 +3,9 @@ package store
 import (
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/twigman/fshare/src/internal/apperror"
 )
 
 func TestAPIKeyService_AddAPIKey(t *testing.T) {
@@ -215,3 +218,214 @@ func TestHashAPIKey(t *testing.T) {
 		t.Fatalf("expected error for invalid key, got %v", err)
 	}
 }
+
+func TestAPIKeyService_SetSpaceLimit(t *testing.T) {
+	db, err := NewDB(t.TempDir())
+	if err != nil {
+		t.Fatalf("could not init test db %v", err)
+	}
+
+	as := NewAPIKeyService(db)
+	k, err := as.AddAPIKey("key", "test", false, nil)
+	if err != nil {
+		t.Fatalf("could not add API key: %v", err)
+	}
+	if k.SpaceLimitInMB != nil {
+		t.Fatalf("expected no space limit override")
+	}
+
+	limit := int64(100)
+	if err := as.SetSpaceLimit(k.UUID, &limit); err != nil {
+		t.Fatalf("could not set space limit: %v", err)
+	}
+
+	dbKey, err := db.findAPIKeyByUUID(k.UUID)
+	if err != nil {
+		t.Fatalf("API key not found in db")
+	}
+	if dbKey.SpaceLimitInMB == nil || *dbKey.SpaceLimitInMB != limit {
+		t.Fatalf("stored space limit is incorrect: %v", dbKey.SpaceLimitInMB)
+	}
+
+	negative := int64(-1)
+	if err := as.SetSpaceLimit(k.UUID, &negative); err == nil {
+		t.Fatalf("expected error for negative space limit")
+	}
+}
+
+func TestAPIKeyService_CreateAPIKey(t *testing.T) {
+	db, err := NewDB(t.TempDir())
+	if err != nil {
+		t.Fatalf("could not init test db %v", err)
+	}
+	as := NewAPIKeyService(db)
+
+	limit := int64(100)
+	versions := int64(3)
+	expires := time.Now().Add(time.Hour).Truncate(time.Second)
+	k := &APIKey{Comment: "limited", SpaceLimitInMB: &limit, MaxVersions: &versions, ExpiresAt: &expires}
+	if err := as.CreateAPIKey("key", k); err != nil {
+		t.Fatalf("could not create API key: %v", err)
+	}
+
+	// all settings are written with the key
+	dbKey, err := db.findAPIKeyByUUID(k.UUID)
+	if err != nil || dbKey == nil {
+		t.Fatalf("API key not found in db: %v", err)
+	}
+	if dbKey.SpaceLimitInMB == nil || *dbKey.SpaceLimitInMB != limit || dbKey.MaxVersions == nil || *dbKey.MaxVersions != versions ||
+		dbKey.ExpiresAt == nil || !dbKey.ExpiresAt.Equal(expires) {
+		t.Errorf("stored settings are incorrect: %+v", dbKey)
+	}
+
+	// invalid settings do not leave a key behind
+	negative := int64(-1)
+	if err := as.CreateAPIKey("other", &APIKey{MaxVersions: &negative}); err != apperror.ErrInvalidMaxVersions {
+		t.Errorf("expected %v, got %v", apperror.ErrInvalidMaxVersions, err)
+	}
+	if uuid, err := as.GetUUIDForAPIKey("other"); err == nil && uuid != "" {
+		t.Errorf("expected no key to be stored, got %s", uuid)
+	}
+}
+
+func TestAPIKeyService_RevokeAPIKey(t *testing.T) {
+	db, err := NewDB(t.TempDir())
+	if err != nil {
+		t.Fatalf("could not init test db %v", err)
+	}
+
+	as := NewAPIKeyService(db)
+	k, err := as.AddAPIKey("key", "test", false, nil)
+	if err != nil {
+		t.Fatalf("could not add API key: %v", err)
+	}
+
+	if err := as.RevokeAPIKey(k.UUID); err != nil {
+		t.Fatalf("could not revoke API key: %v", err)
+	}
+
+	uuid, err := as.GetUUIDForAPIKey("key")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if uuid != "" {
+		t.Fatalf("expected no UUID for revoked key, got %v", uuid)
+	}
+
+	if err := as.RevokeAPIKey(k.UUID); err != apperror.ErrAPIKeyRevoked {
+		t.Fatalf("expected ErrAPIKeyRevoked, got %v", err)
+	}
+
+	if err := as.RevokeAPIKey("nonexistent"); err != apperror.ErrAPIKeyNotFound {
+		t.Fatalf("expected ErrAPIKeyNotFound, got %v", err)
+	}
+}
+
+func TestAPIKeyService_RotateAPIKey(t *testing.T) {
+	db, err := NewDB(t.TempDir())
+	if err != nil {
+		t.Fatalf("could not init test db %v", err)
+	}
+
+	as := NewAPIKeyService(db)
+	k, err := as.AddAPIKey("old-key", "test", false, nil)
+	if err != nil {
+		t.Fatalf("could not add API key: %v", err)
+	}
+
+	rotated, err := as.RotateAPIKey(k.UUID, "new-key")
+	if err != nil {
+		t.Fatalf("could not rotate API key: %v", err)
+	}
+	if rotated.UUID != k.UUID {
+		t.Fatalf("expected UUID %v to be kept, got %v", k.UUID, rotated.UUID)
+	}
+
+	uuid, err := as.GetUUIDForAPIKey("old-key")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if uuid != "" {
+		t.Fatalf("old secret still valid")
+	}
+
+	uuid, err = as.GetUUIDForAPIKey("new-key")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if uuid != k.UUID {
+		t.Fatalf("expected UUID %v for new secret, got %v", k.UUID, uuid)
+	}
+
+	if _, err := as.RotateAPIKey(k.UUID, "invalid==="); err == nil {
+		t.Fatalf("expected error for invalid key")
+	}
+}
+
+func TestAPIKeyService_ExpiredKey(t *testing.T) {
+	db, err := NewDB(t.TempDir())
+	if err != nil {
+		t.Fatalf("could not init test db %v", err)
+	}
+
+	as := NewAPIKeyService(db)
+	k, err := as.AddAPIKey("key", "test", false, nil)
+	if err != nil {
+		t.Fatalf("could not add API key: %v", err)
+	}
+
+	future := time.Now().Add(time.Hour)
+	if err := as.SetExpiresAt(k.UUID, &future); err != nil {
+		t.Fatalf("could not set expiry: %v", err)
+	}
+	uuid, err := as.GetUUIDForAPIKey("key")
+	if err != nil || uuid != k.UUID {
+		t.Fatalf("expected key to be valid before expiry, got %q, %v", uuid, err)
+	}
+
+	past := time.Now().Add(-time.Minute)
+	if err := as.SetExpiresAt(k.UUID, &past); err != nil {
+		t.Fatalf("could not set expiry: %v", err)
+	}
+	uuid, err = as.GetUUIDForAPIKey("key")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if uuid != "" {
+		t.Fatalf("expected no UUID for expired key, got %v", uuid)
+	}
+}
+
+func TestAPIKeyService_ListAPIKeysCreatedBy(t *testing.T) {
+	db, err := NewDB(t.TempDir())
+	if err != nil {
+		t.Fatalf("could not init test db %v", err)
+	}
+
+	as := NewAPIKeyService(db)
+	admin, err := as.AddAPIKey("admin", "admin", true, nil)
+	if err != nil {
+		t.Fatalf("could not add API key: %v", err)
+	}
+	for _, key := range []string{"a", "b"} {
+		if _, err := as.AddAPIKey(key, key, false, &admin.UUID); err != nil {
+			t.Fatalf("could not add API key: %v", err)
+		}
+	}
+	if _, err := as.AddAPIKey("other", "other", false, nil); err != nil {
+		t.Fatalf("could not add API key: %v", err)
+	}
+
+	keys, err := as.ListAPIKeysCreatedBy(admin.UUID)
+	if err != nil {
+		t.Fatalf("could not list API keys: %v", err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("expected 2 keys, got %d", len(keys))
+	}
+	for _, k := range keys {
+		if k.CreatedBy == nil || *k.CreatedBy != admin.UUID {
+			t.Fatalf("listed key %s was not created by admin", k.UUID)
+		}
+	}
+}
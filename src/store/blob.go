@@ -0,0 +1,121 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/twigman/fshare/src/internal/apperror"
+	"github.com/twigman/fshare/src/storage"
+)
+
+// blobDir is the dir inside the upload folder holding the content of all files if they are stored on the local disk.
+// API key home dirs are named after UUIDs, so it never collides with a home dir.
+const blobDir = "blobs"
+
+// blobKey returns the storage key of the blob with the given hex encoded SHA-256
+func blobKey(sum string) (string, error) {
+	if len(sum) != sha256.Size*2 {
+		return "", apperror.ErrFileInvalidFilepath
+	}
+	if _, err := hex.DecodeString(sum); err != nil {
+		return "", apperror.ErrFileInvalidFilepath
+	}
+	return sum[:2] + "/" + sum, nil
+}
+
+// storeBlob copies a local file into the blob store and calls register to save the reference in the db.
+// If the blob already exists, nothing is copied. The local file is removed once the reference is saved.
+func (s *ResourceService) storeBlob(srcPath string, sum string, register func() error) error {
+	key, err := blobKey(sum)
+	if err != nil {
+		return err
+	}
+
+	s.blobMu.Lock()
+	defer s.blobMu.Unlock()
+
+	_, err = s.storage.Stat(key)
+	exists := err == nil
+	if err != nil && err != storage.ErrNotExist {
+		return err
+	}
+
+	if !exists {
+		if err := storage.PutFile(s.storage, key, srcPath); err != nil {
+			return fmt.Errorf("blob store error: %v", err)
+		}
+	}
+
+	if err := register(); err != nil {
+		if !exists {
+			if err2 := s.storage.Delete(key); err2 != nil {
+				log.Printf("Could not remove unreferenced blob %s: %v", sum, err2)
+			}
+		}
+		return err
+	}
+
+	if err := os.Remove(srcPath); err != nil && !os.IsNotExist(err) {
+		log.Printf("Could not remove stored file %s: %v", srcPath, err)
+	}
+	return nil
+}
+
+// removeBlob deletes a blob that is not referenced anymore. Callers need to hold blobMu.
+func (s *ResourceService) removeBlob(sum string) error {
+	key, err := blobKey(sum)
+	if err != nil {
+		return err
+	}
+	return s.storage.Delete(key)
+}
+
+// removeBlobs deletes blobs that are not referenced anymore. Callers need to hold blobMu.
+func (s *ResourceService) removeBlobs(sums []string) error {
+	for _, sum := range sums {
+		if err := s.removeBlob(sum); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MigrateLegacyFiles moves files stored by older versions under their name into the blob store.
+// Files that do not exist anymore are marked as broken.
+func (s *ResourceService) MigrateLegacyFiles() error {
+	files, err := s.db.findLegacyFiles()
+	if err != nil {
+		return err
+	}
+
+	for _, r := range files {
+		path, err := s.legacyResourcePath(r)
+		if err != nil {
+			log.Printf("Skipping file %s: %v", r.UUID, err)
+			continue
+		}
+
+		sum, size, err := hashFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				if err := s.MarkResourceAsBroken(r.UUID); err != nil {
+					log.Printf("Failed to mark file %s as broken: %v", r.UUID, err)
+				}
+				continue
+			}
+			log.Printf("Failed to read file %s: %v", path, err)
+			continue
+		}
+
+		err = s.storeBlob(path, sum, func() error {
+			return s.db.setResourceBlob(r.UUID, sum, size)
+		})
+		if err != nil {
+			log.Printf("Failed to move file %s into the blob store: %v", path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+package store
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/twigman/fshare/src/config"
+	"github.com/twigman/fshare/src/storage"
+	"github.com/twigman/fshare/src/testutil/fake"
+)
+
+func TestBlobStore_Deduplication(t *testing.T) {
+	dataDir := t.TempDir()
+	cfg := &config.Config{
+		DataPath:   dataDir,
+		UploadPath: filepath.Join(dataDir, "upload"),
+	}
+
+	rs, key, err := initServices(cfg)
+	if err != nil {
+		t.Fatalf("Error initializing test services: %v", err)
+	}
+	if err := CreateDirsFromConfig(cfg); err != nil {
+		t.Fatalf("Error creating app dirs: %v", err)
+	}
+	if _, err := rs.GetOrCreateHomeDir(key.HashedKey); err != nil {
+		t.Fatalf("Error creating home dir: %v", err)
+	}
+
+	content := []byte("Hello World")
+	const sum = "a591a6d40bf420404a011733cfb7b190d62c65bf0bcda32b57b277d9ad9f146e"
+
+	var uuids []string
+	for _, name := range []string{"a.txt", "b.txt", "a.txt"} {
+		u, err := rs.SaveUploadedFile(&fake.FakeMultipartFile{Reader: bytes.NewReader(content)}, &Resource{Name: name, APIKeyUUID: key.UUID}, true)
+		if err != nil {
+			t.Fatalf("Error saving file: %v", err)
+		}
+		uuids = append(uuids, u)
+	}
+
+	blob := filepath.Join(cfg.UploadPath, blobDir, sum[:2], sum)
+	for _, u := range uuids {
+		r, err := rs.GetResourceByUUID(u)
+		if err != nil {
+			t.Fatalf("Error loading resource: %v", err)
+		}
+		if path, _ := rs.BuildResourcePath(r); path != blob {
+			t.Errorf("expected resource %s to be stored in blob %s, got %s", r.Name, blob, path)
+		}
+	}
+
+	count, err := rs.db.findBlobRefCount(sum)
+	if err != nil {
+		t.Fatalf("Error loading blob: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("expected 3 references, got %d", count)
+	}
+
+	// no copies or temp files left
+	entries, err := os.ReadDir(filepath.Join(cfg.UploadPath, key.UUID))
+	if err != nil {
+		t.Fatalf("Error reading home dir: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected empty home dir, found %d entries", len(entries))
+	}
+
+	// delete and expire: blob stays as long as it is referenced
+	if err := rs.PurgeResourceByUUID(uuids[0], key.UUID); err != nil {
+		t.Fatalf("Error deleting file: %v", err)
+	}
+
+	past := time.Now().UTC().Add(-time.Minute)
+	expired, err := rs.GetResourceByUUID(uuids[1])
+	if err != nil {
+		t.Fatalf("Error loading resource: %v", err)
+	}
+	expired.AutoDeleteAt = &past
+	if err := rs.db.updateResource(expired); err != nil {
+		t.Fatalf("Error updating resource: %v", err)
+	}
+	if err := rs.cleanupExpiredFiles(); err != nil {
+		t.Fatalf("Error cleaning up files: %v", err)
+	}
+
+	if _, err := os.Stat(blob); err != nil {
+		t.Fatalf("expected blob to exist while referenced: %v", err)
+	}
+	if count, _ := rs.db.findBlobRefCount(sum); count != 1 {
+		t.Errorf("expected 1 reference, got %d", count)
+	}
+
+	// deleting twice must not release the reference again
+	if err := rs.deleteResource(expired, time.Now().UTC()); err != nil {
+		t.Fatalf("Error deleting resource again: %v", err)
+	}
+	if count, _ := rs.db.findBlobRefCount(sum); count != 1 {
+		t.Errorf("expected 1 reference, got %d", count)
+	}
+
+	// last reference
+	if err := rs.PurgeResourceByUUID(uuids[2], key.UUID); err != nil {
+		t.Fatalf("Error deleting file: %v", err)
+	}
+	if _, err := os.Stat(blob); !os.IsNotExist(err) {
+		t.Errorf("expected blob to be removed, got %v", err)
+	}
+	if count, _ := rs.db.findBlobRefCount(sum); count != 0 {
+		t.Errorf("expected no references, got %d", count)
+	}
+}
+
+func TestBlobStore_MigrateLegacyFiles(t *testing.T) {
+	dataDir := t.TempDir()
+	cfg := &config.Config{
+		DataPath:   dataDir,
+		UploadPath: filepath.Join(dataDir, "upload"),
+	}
+
+	rs, key, err := initServices(cfg)
+	if err != nil {
+		t.Fatalf("Error initializing test services: %v", err)
+	}
+
+	// files uploaded by an older version
+	homeDir := filepath.Join(cfg.UploadPath, key.UUID)
+	if err := os.MkdirAll(homeDir, 0o700); err != nil {
+		t.Fatalf("Error creating home dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(homeDir, "old.txt"), []byte("Hello World"), 0o600); err != nil {
+		t.Fatalf("Error writing file: %v", err)
+	}
+
+	old := &Resource{UUID: "old", Name: "old.txt", IsFile: true, APIKeyUUID: key.UUID, CreatedAt: time.Now().UTC()}
+	missing := &Resource{UUID: "missing", Name: "missing.txt", IsFile: true, APIKeyUUID: key.UUID, CreatedAt: time.Now().UTC()}
+	for _, r := range []*Resource{old, missing} {
+		if err := rs.db.insertResource(r); err != nil {
+			t.Fatalf("Error inserting resource: %v", err)
+		}
+	}
+
+	if err := rs.MigrateLegacyFiles(); err != nil {
+		t.Fatalf("Error migrating files: %v", err)
+	}
+
+	migrated, err := rs.GetResourceByUUID("old")
+	if err != nil {
+		t.Fatalf("Error loading resource: %v", err)
+	}
+	if migrated.BlobSHA256 == nil || migrated.SHA256 != *migrated.BlobSHA256 || migrated.Size != int64(len("Hello World")) {
+		t.Fatalf("file not migrated: %+v", migrated)
+	}
+
+	path, err := rs.BuildResourcePath(migrated)
+	if err != nil {
+		t.Fatalf("Error building path: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "Hello World" {
+		t.Errorf("migrated file not readable: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(homeDir, "old.txt")); !os.IsNotExist(err) {
+		t.Errorf("expected legacy file to be moved, got %v", err)
+	}
+
+	broken, err := rs.GetResourceByUUID("missing")
+	if err != nil {
+		t.Fatalf("Error loading resource: %v", err)
+	}
+	if !broken.IsBroken || broken.BlobSHA256 != nil {
+		t.Errorf("expected missing file to be marked as broken: %+v", broken)
+	}
+}
+
+func TestBlobStore_S3Backend(t *testing.T) {
+	dataDir := t.TempDir()
+	cfg := &config.Config{
+		DataPath:   dataDir,
+		UploadPath: filepath.Join(dataDir, "upload"),
+	}
+
+	srv := fake.NewS3Server("access")
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	backend, err := storage.NewS3(config.S3Config{Endpoint: ts.URL, Bucket: "fshare", AccessKey: "access", SecretKey: "secret"}, ts.Client())
+	if err != nil {
+		t.Fatalf("Error creating backend: %v", err)
+	}
+
+	db, err := NewDB(cfg.DataPath)
+	if err != nil {
+		t.Fatalf("DB init error: %v", err)
+	}
+	rs := NewResourceServiceWithStorage(cfg, db, backend)
+	key, err := NewAPIKeyService(db).AddAPIKey("123", "123", false, nil)
+	if err != nil {
+		t.Fatalf("Error adding API key: %v", err)
+	}
+	if err := CreateDirsFromConfig(cfg); err != nil {
+		t.Fatalf("Error creating app dirs: %v", err)
+	}
+	if _, err := rs.GetOrCreateHomeDir(key.HashedKey); err != nil {
+		t.Fatalf("Error creating home dir: %v", err)
+	}
+
+	content := []byte("Hello World")
+	first, err := rs.SaveUploadedFile(&fake.FakeMultipartFile{Reader: bytes.NewReader(content)}, &Resource{Name: "a.txt", APIKeyUUID: key.UUID}, false)
+	if err != nil {
+		t.Fatalf("Error saving file: %v", err)
+	}
+	second, err := rs.SaveUploadedFile(&fake.FakeMultipartFile{Reader: bytes.NewReader(content)}, &Resource{Name: "b.txt", APIKeyUUID: key.UUID}, false)
+	if err != nil {
+		t.Fatalf("Error saving file: %v", err)
+	}
+
+	if srv.ObjectCount() != 1 || srv.RequestCount(http.MethodPut) != 1 {
+		t.Errorf("expected one uploaded object, got %d objects after %d uploads", srv.ObjectCount(), srv.RequestCount(http.MethodPut))
+	}
+	entries, err := os.ReadDir(filepath.Join(cfg.UploadPath, key.UUID))
+	if err != nil || len(entries) != 0 {
+		t.Errorf("expected no local copies, found %d entries (%v)", len(entries), err)
+	}
+
+	r, err := rs.GetResourceByUUID(first)
+	if err != nil {
+		t.Fatalf("Error loading resource: %v", err)
+	}
+	if _, err := rs.BuildResourcePath(r); err == nil {
+		t.Errorf("expected no local path for remote files")
+	}
+
+	obj, err := rs.OpenResource(r)
+	if err != nil {
+		t.Fatalf("Error opening resource: %v", err)
+	}
+	data, err := io.ReadAll(obj)
+	obj.Close()
+	if err != nil || !bytes.Equal(data, content) {
+		t.Errorf("Wrong file content %q (%v)", data, err)
+	}
+
+	for _, u := range []string{first, second} {
+		if err := rs.PurgeResourceByUUID(u, key.UUID); err != nil {
+			t.Fatalf("Error deleting file: %v", err)
+		}
+	}
+	if srv.ObjectCount() != 0 {
+		t.Errorf("expected object to be deleted with the last reference")
+	}
+}
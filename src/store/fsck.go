@@ -0,0 +1,344 @@
+package store
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/twigman/fshare/src/storage"
+)
+
+// fsckStaleAge is the age after which temp files of uploads and the blob store are considered left over.
+// Younger ones may belong to a request that is still running.
+const fsckStaleAge = time.Hour
+
+// FsckOptions selects the repairs done by Fsck. Without any, Fsck only reports.
+type FsckOptions struct {
+	ImportOrphans   bool // save files in home dirs that are unknown to the db as resources of the API key
+	MarkMissing     bool // mark files whose content does not exist as broken
+	DeleteLeftovers bool // remove stale temp files and blobs that are not referenced in the db
+}
+
+// FsckReport lists the differences between upload folder, storage backend and db found by Fsck
+type FsckReport struct {
+	OrphanedFiles  []string // files in home dirs that no resource refers to
+	OrphanedBlobs  []string // files in the blob store that are not referenced in the db
+	MissingFiles   []string // UUIDs of undeleted files whose content does not exist and that are not marked as broken yet
+	StaleTempFiles []string // temp files of uploads and the blob store, and staged data of abandoned resumable uploads
+
+	Imported     []string // UUIDs of resources created for orphaned files
+	MarkedBroken []string // UUIDs of files marked as broken
+	Deleted      []string // removed orphaned blobs and temp files
+	Errors       []string // problems that could not be repaired
+}
+
+// Unrepaired reports whether findings are left that were not repaired
+func (r *FsckReport) Unrepaired() bool {
+	return len(r.OrphanedFiles) > len(r.Imported) ||
+		len(r.MissingFiles) > len(r.MarkedBroken) ||
+		len(r.OrphanedBlobs)+len(r.StaleTempFiles) > len(r.Deleted) ||
+		len(r.Errors) > 0
+}
+
+// Fsck compares the upload folder and the storage backend with the db and optionally repairs the differences.
+// It should run while the service is stopped, since uploads in progress can not be told apart from leftovers otherwise.
+func (s *ResourceService) Fsck(opts FsckOptions) (*FsckReport, error) {
+	report := &FsckReport{}
+	now := time.Now()
+
+	if err := s.fsckMissingContent(report, opts); err != nil {
+		return nil, err
+	}
+	if err := s.fsckBlobDir(report, opts, now); err != nil {
+		return nil, err
+	}
+	if err := s.fsckHomeDirs(report, opts, now); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// fsckMissingContent finds undeleted files whose blob or legacy file does not exist
+func (s *ResourceService) fsckMissingContent(report *FsckReport, opts FsckOptions) error {
+	blobs, err := s.db.findBlobs()
+	if err != nil {
+		return err
+	}
+	for _, b := range blobs {
+		key, err := blobKey(b.SHA256)
+		if err != nil {
+			return err
+		}
+		_, err = s.storage.Stat(key)
+		if err == nil {
+			continue
+		}
+		if err != storage.ErrNotExist {
+			report.Errors = append(report.Errors, fmt.Sprintf("could not check blob %s: %v", b.SHA256, err))
+			continue
+		}
+
+		files, err := s.db.findActiveFilesByBlob(b.SHA256)
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			if err := s.fsckMissingFile(report, opts, f); err != nil {
+				return err
+			}
+		}
+	}
+
+	legacy, err := s.db.findLegacyFiles()
+	if err != nil {
+		return err
+	}
+	for _, f := range legacy {
+		path, err := s.legacyResourcePath(f)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("could not resolve path of file %s: %v", f.UUID, err))
+			continue
+		}
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			if err := s.fsckMissingFile(report, opts, f); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// fsckMissingFile reports a file without content. Files already marked as broken are known and skipped.
+func (s *ResourceService) fsckMissingFile(report *FsckReport, opts FsckOptions, f *Resource) error {
+	if f.IsBroken {
+		return nil
+	}
+	report.MissingFiles = append(report.MissingFiles, f.UUID)
+	if !opts.MarkMissing {
+		return nil
+	}
+	if err := s.MarkResourceAsBroken(f.UUID); err != nil {
+		return err
+	}
+	report.MarkedBroken = append(report.MarkedBroken, f.UUID)
+	return nil
+}
+
+// fsckBlobDir finds blobs without db entry and temp files in the blob store. Only the local storage backend is walked.
+func (s *ResourceService) fsckBlobDir(report *FsckReport, opts FsckOptions, now time.Time) error {
+	if _, ok := s.storage.(*storage.Local); !ok {
+		return nil
+	}
+	root := filepath.Join(s.cfg.UploadPath, blobDir)
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		name := d.Name()
+		if strings.HasPrefix(name, ".put-") {
+			if isStale(d, now) {
+				report.StaleTempFiles = append(report.StaleTempFiles, path)
+				s.fsckDelete(report, opts, path)
+			}
+			return nil
+		}
+
+		if key, err := blobKey(name); err == nil && filepath.Join(root, filepath.FromSlash(key)) == path {
+			count, err := s.db.findBlobRefCount(name)
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				return nil
+			}
+		}
+		report.OrphanedBlobs = append(report.OrphanedBlobs, path)
+		s.fsckDelete(report, opts, path)
+		return nil
+	})
+	return err
+}
+
+// fsckHomeDirs finds files in the home dirs that are neither legacy files nor uploads in progress
+func (s *ResourceService) fsckHomeDirs(report *FsckReport, opts FsckOptions, now time.Time) error {
+	legacyPaths := make(map[string]bool)
+	legacy, err := s.db.findLegacyFiles()
+	if err != nil {
+		return err
+	}
+	for _, f := range legacy {
+		if path, err := s.legacyResourcePath(f); err == nil {
+			legacyPaths[path] = true
+		}
+	}
+
+	entries, err := os.ReadDir(s.cfg.UploadPath)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !e.IsDir() || e.Name() == blobDir {
+			continue
+		}
+		keyUUID := e.Name()
+		home, err := filepath.Abs(filepath.Join(s.cfg.UploadPath, keyUUID))
+		if err != nil {
+			return err
+		}
+
+		err = filepath.WalkDir(home, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(home, path)
+			if err != nil {
+				return err
+			}
+
+			if d.IsDir() {
+				if rel == uploadStagingDir {
+					return s.fsckStagedUploads(report, opts, path)
+				}
+				return nil
+			}
+
+			// temp files of StageUpload
+			if filepath.Dir(rel) == "." && strings.HasPrefix(d.Name(), "upload-") {
+				if isStale(d, now) {
+					report.StaleTempFiles = append(report.StaleTempFiles, path)
+					s.fsckDelete(report, opts, path)
+				}
+				return nil
+			}
+
+			if legacyPaths[path] {
+				return nil
+			}
+			report.OrphanedFiles = append(report.OrphanedFiles, path)
+			if opts.ImportOrphans {
+				s.fsckImport(report, keyUUID, rel, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fsckStagedUploads finds staged data of resumable uploads that are expired or unknown to the db
+func (s *ResourceService) fsckStagedUploads(report *FsckReport, opts FsckOptions, dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		u, err := s.db.findUploadSession(e.Name())
+		if err != nil {
+			return err
+		}
+		if u != nil && time.Now().UTC().Before(u.ExpiresAt) {
+			continue
+		}
+		report.StaleTempFiles = append(report.StaleTempFiles, path)
+		if opts.DeleteLeftovers {
+			if u != nil {
+				if err := s.db.deleteUploadSession(u.ID); err != nil {
+					return err
+				}
+			}
+			s.fsckDelete(report, opts, path)
+		}
+	}
+	return filepath.SkipDir
+}
+
+// fsckImport saves an orphaned file as resource of the API key. Its folders are created if needed,
+// name conflicts are resolved by prefixing a number like for uploads.
+func (s *ResourceService) fsckImport(report *FsckReport, keyUUID string, rel string, path string) {
+	fail := func(err error) {
+		report.Errors = append(report.Errors, fmt.Sprintf("could not import %s: %v", path, err))
+	}
+
+	key, err := s.db.findAPIKeyByUUID(keyUUID)
+	if err != nil {
+		fail(err)
+		return
+	}
+	if key == nil {
+		fail(fmt.Errorf("API key %s does not exist", keyUUID))
+		return
+	}
+
+	var parentUUID *string
+	dir := filepath.Dir(rel)
+	if dir != "." {
+		for _, name := range strings.Split(dir, string(filepath.Separator)) {
+			folder, err := s.db.findActiveChild(name, keyUUID, parentUUID)
+			if err != nil {
+				fail(err)
+				return
+			}
+			if folder != nil && folder.IsFile {
+				fail(fmt.Errorf("%s is a file", name))
+				return
+			}
+			if folder == nil {
+				folder = &Resource{Name: name, IsPrivate: true, ParentUUID: parentUUID, APIKeyUUID: keyUUID}
+				if _, err := s.CreateFolder(folder); err != nil {
+					fail(err)
+					return
+				}
+			}
+			parentUUID = &folder.UUID
+		}
+	}
+
+	sum, size, err := hashFile(path)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	// imported files are private, the owner decides whether to share them
+	r := &Resource{Name: filepath.Base(rel), IsPrivate: true, ParentUUID: parentUUID, APIKeyUUID: keyUUID}
+	if err := s.prepareFile(r); err != nil {
+		fail(err)
+		return
+	}
+	fileUUID, err := s.commitFile(path, r, size, sum, true)
+	if err != nil {
+		fail(err)
+		return
+	}
+	report.Imported = append(report.Imported, fileUUID)
+}
+
+func (s *ResourceService) fsckDelete(report *FsckReport, opts FsckOptions, path string) {
+	if !opts.DeleteLeftovers {
+		return
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		report.Errors = append(report.Errors, fmt.Sprintf("could not delete %s: %v", path, err))
+		return
+	}
+	report.Deleted = append(report.Deleted, path)
+}
+
+func isStale(d fs.DirEntry, now time.Time) bool {
+	info, err := d.Info()
+	return err == nil && now.Sub(info.ModTime()) > fsckStaleAge
+}
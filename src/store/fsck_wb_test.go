@@ -0,0 +1,121 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/twigman/fshare/src/config"
+)
+
+func TestFsck(t *testing.T) {
+	dataDir := t.TempDir()
+	cfg := &config.Config{DataPath: dataDir, UploadPath: filepath.Join(dataDir, "upload")}
+	rs, key := initTrashTest(t, cfg)
+
+	okUUID := saveTestFile(t, rs, &Resource{Name: "ok.txt", APIKeyUUID: key.UUID}, "intact")
+	missingUUID := saveTestFile(t, rs, &Resource{Name: "missing.txt", APIKeyUUID: key.UUID}, "will vanish")
+
+	missing, err := rs.GetResourceByUUID(missingUUID)
+	if err != nil {
+		t.Fatalf("Error loading resource: %v", err)
+	}
+	missingPath, err := rs.BuildResourcePath(missing)
+	if err != nil {
+		t.Fatalf("Error building path: %v", err)
+	}
+	if err := os.Remove(missingPath); err != nil {
+		t.Fatalf("Error removing blob: %v", err)
+	}
+
+	writeFile := func(path string, content string, stale bool) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatalf("Error creating dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("Error writing file: %v", err)
+		}
+		if stale {
+			old := time.Now().Add(-2 * fsckStaleAge)
+			if err := os.Chtimes(path, old, old); err != nil {
+				t.Fatalf("Error changing mtime: %v", err)
+			}
+		}
+	}
+
+	home := filepath.Join(cfg.UploadPath, key.UUID)
+	orphanBlob := filepath.Join(cfg.UploadPath, blobDir, sha256Hex("lost")[:2], sha256Hex("lost"))
+	writeFile(orphanBlob, "lost", false)
+	writeFile(filepath.Join(cfg.UploadPath, blobDir, "ab", ".put-123"), "tmp", true)
+	writeFile(filepath.Join(home, "upload-123"), "tmp", true)
+	writeFile(filepath.Join(home, uploadStagingDir, "unknown-session"), "partial", false)
+	writeFile(filepath.Join(home, "notes.txt"), "orphan", false)
+	writeFile(filepath.Join(home, "docs", "sub", "report.txt"), "nested orphan", false)
+	// uploads in progress are left alone
+	writeFile(filepath.Join(home, "upload-456"), "tmp", false)
+
+	// report only
+	report, err := rs.Fsck(FsckOptions{})
+	if err != nil {
+		t.Fatalf("Error running fsck: %v", err)
+	}
+	if len(report.OrphanedFiles) != 2 || len(report.OrphanedBlobs) != 1 || len(report.MissingFiles) != 1 ||
+		len(report.StaleTempFiles) != 3 || !report.Unrepaired() {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if report.MissingFiles[0] != missingUUID || report.OrphanedBlobs[0] != orphanBlob {
+		t.Errorf("unexpected findings: %+v", report)
+	}
+	if _, err := os.Stat(orphanBlob); err != nil {
+		t.Errorf("expected the orphaned blob to be kept without repair: %v", err)
+	}
+
+	// repair
+	report, err = rs.Fsck(FsckOptions{ImportOrphans: true, MarkMissing: true, DeleteLeftovers: true})
+	if err != nil {
+		t.Fatalf("Error running fsck: %v", err)
+	}
+	if len(report.Imported) != 2 || len(report.MarkedBroken) != 1 || len(report.Deleted) != 4 || report.Unrepaired() {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	for rUUID, broken := range map[string]bool{okUUID: false, missingUUID: true} {
+		r, err := rs.GetResourceByUUID(rUUID)
+		if err != nil {
+			t.Fatalf("Error loading resource: %v", err)
+		}
+		if r.IsBroken != broken {
+			t.Errorf("expected is_broken %v for %s, got %v", broken, r.Name, r.IsBroken)
+		}
+	}
+
+	docs, err := rs.db.findActiveChild("docs", key.UUID, nil)
+	if err != nil || docs == nil || docs.IsFile {
+		t.Fatalf("expected folder docs to be created, got %+v, %v", docs, err)
+	}
+	sub, err := rs.db.findActiveChild("sub", key.UUID, &docs.UUID)
+	if err != nil || sub == nil {
+		t.Fatalf("expected folder sub to be created, got %+v, %v", sub, err)
+	}
+	imported, err := rs.db.findActiveChild("report.txt", key.UUID, &sub.UUID)
+	if err != nil || imported == nil {
+		t.Fatalf("expected report.txt to be imported, got %+v, %v", imported, err)
+	}
+	if !imported.IsPrivate || imported.SHA256 != sha256Hex("nested orphan") {
+		t.Errorf("unexpected imported file: %+v", imported)
+	}
+	if _, err := os.Stat(filepath.Join(home, "notes.txt")); !os.IsNotExist(err) {
+		t.Errorf("expected the orphan to be moved into the blob store, got %v", err)
+	}
+
+	// nothing left
+	report, err = rs.Fsck(FsckOptions{})
+	if err != nil {
+		t.Fatalf("Error running fsck: %v", err)
+	}
+	if report.Unrepaired() || len(report.MissingFiles) != 0 || len(report.OrphanedFiles) != 0 {
+		t.Errorf("expected no findings, got %+v", report)
+	}
+}
@@ -1,35 +1,116 @@
 package store
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
-	"mime/multipart"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/twigman/fshare/src/config"
 	"github.com/twigman/fshare/src/internal/apperror"
+	"github.com/twigman/fshare/src/storage"
 )
 
 type ResourceService struct {
-	db  *SQLite
-	cfg *config.Config
+	db      *SQLite
+	cfg     *config.Config
+	storage storage.Backend
+	// serializes quota checks, name resolution and inserts of new resources
+	quotaMu sync.Mutex
+	// serializes writing and unlinking of blobs, so a blob is never removed while a new reference is added
+	blobMu sync.Mutex
+	// upload session ID -> *sync.Mutex of uploads currently written, prevents concurrent writes to the same resumable upload
+	uploadLocks sync.Map
+	// bounds the number of thumbnails generated at the same time
+	thumbnailSlots chan struct{}
 }
 
+// NewResourceService creates a resource service storing file content on the local disk below the upload path
 func NewResourceService(cfg *config.Config, db *SQLite) *ResourceService {
-	return &ResourceService{cfg: cfg, db: db}
+	return NewResourceServiceWithStorage(cfg, db, storage.NewLocal(filepath.Join(cfg.UploadPath, blobDir)))
 }
 
+func NewResourceServiceWithStorage(cfg *config.Config, db *SQLite, backend storage.Backend) *ResourceService {
+	return &ResourceService{cfg: cfg, db: db, storage: backend, thumbnailSlots: make(chan struct{}, maxConcurrentThumbnails)}
+}
+
+// BuildResourcePath returns the local path of the content of a resource.
+// Files are stored in the blob store; only files uploaded by older versions still live under their name in the home dir.
+// Fails for files in a remote storage backend.
 func (s *ResourceService) BuildResourcePath(r *Resource) (string, error) {
+	if r.IsFile && r.BlobSHA256 != nil {
+		key, err := blobKey(*r.BlobSHA256)
+		if err != nil {
+			return "", err
+		}
+		local, ok := s.storage.(*storage.Local)
+		if !ok {
+			return "", apperror.ErrResourceResolvePath
+		}
+		return local.Path(key)
+	}
+	return s.legacyResourcePath(r)
+}
 
-	// make sure target path is in upload folder
-	dstPath := filepath.Join(s.cfg.UploadPath, r.APIKeyUUID, r.Name)
+// OpenResource opens the content of a file for reading
+func (s *ResourceService) OpenResource(r *Resource) (*storage.Object, error) {
+	if !r.IsFile {
+		return nil, apperror.ErrResourceNotFound
+	}
+
+	if r.BlobSHA256 == nil {
+		// stored by an older version under its name
+		path, err := s.legacyResourcePath(r)
+		if err != nil {
+			return nil, err
+		}
+		return storage.NewLocal(filepath.Dir(path)).Open(filepath.Base(path))
+	}
+
+	key, err := blobKey(*r.BlobSHA256)
+	if err != nil {
+		return nil, err
+	}
+	return storage.Open(s.storage, key)
+}
+
+// StatResource returns size and modification time of the content of a file
+func (s *ResourceService) StatResource(r *Resource) (*storage.ObjectInfo, error) {
+	obj, err := s.OpenResource(r)
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+	return &obj.ObjectInfo, nil
+}
+
+// legacyResourcePath returns the named path of a resource below the home dir of its API key
+func (s *ResourceService) legacyResourcePath(r *Resource) (string, error) {
+	dstPath := filepath.Join(s.cfg.UploadPath, r.APIKeyUUID)
+
+	if !isHomeDir(r) {
+		folders, err := s.resolveFolderChain(r.ParentUUID, r.APIKeyUUID)
+		if err != nil {
+			return "", err
+		}
+
+		for _, f := range folders {
+			dstPath = filepath.Join(dstPath, f.Name)
+		}
+		dstPath = filepath.Join(dstPath, r.Name)
+	}
 
+	// make sure target path is in upload folder
 	absBase, err := filepath.Abs(s.cfg.UploadPath)
 	if err != nil {
 		return "", apperror.ErrResourceResolvePath
@@ -42,81 +123,320 @@ func (s *ResourceService) BuildResourcePath(r *Resource) (string, error) {
 	return absDst, nil
 }
 
-func (s *ResourceService) SaveUploadedFile(file multipart.File, r *Resource, allowRename bool) (string, error) {
-	if strings.Contains(r.Name, "..") ||
-		strings.Contains(r.Name, "/") ||
-		strings.Contains(r.Name, "\\") ||
-		strings.HasPrefix(r.Name, ".") {
-		return "", apperror.ErrFileInvalidFilename
+// resolveFolderChain returns all folders from the home dir (excluded) down to the given parent
+func (s *ResourceService) resolveFolderChain(parentUUID *string, keyUUID string) ([]*Resource, error) {
+	var folders []*Resource
+
+	for parentUUID != nil {
+		p, err := s.db.findResourceByUUID(*parentUUID)
+		if err != nil {
+			return nil, err
+		}
+		if p == nil || p.IsFile || p.APIKeyUUID != keyUUID {
+			return nil, apperror.ErrInvalidParent
+		}
+		if isHomeDir(p) {
+			break
+		}
+
+		folders = append([]*Resource{p}, folders...)
+		parentUUID = p.ParentUUID
+	}
+	return folders, nil
+}
+
+// prepareParent validates the parent of a new resource and returns the folder depth of the parent (0 = home dir).
+// A parent pointing to the home dir is normalized to nil.
+func (s *ResourceService) prepareParent(r *Resource) (int, error) {
+	if r.ParentUUID == nil {
+		return 0, checkReservedName(r)
+	}
+
+	p, err := s.db.findResourceByUUID(*r.ParentUUID)
+	if err != nil {
+		return 0, err
+	}
+	if p == nil || p.IsFile || p.APIKeyUUID != r.APIKeyUUID || p.DeletedAt != nil || p.IsBroken {
+		return 0, apperror.ErrInvalidParent
+	}
+
+	if isHomeDir(p) {
+		r.ParentUUID = nil
+		return 0, checkReservedName(r)
+	}
+
+	folders, err := s.resolveFolderChain(r.ParentUUID, r.APIKeyUUID)
+	if err != nil {
+		return 0, err
+	}
+	return len(folders), nil
+}
+
+// validateResourceName checks a file or folder name for forbidden patterns
+func validateResourceName(name string) error {
+	if strings.Contains(name, "..") ||
+		strings.Contains(name, "/") ||
+		strings.Contains(name, "\\") ||
+		strings.HasPrefix(name, ".") {
+		return apperror.ErrFileInvalidFilename
+	}
+	return nil
+}
+
+// checkReservedName prevents resources in the home dir from being named like the home dir itself
+func checkReservedName(r *Resource) error {
+	if r.Name == r.APIKeyUUID {
+		return apperror.ErrFileInvalidFilename
+	}
+	return nil
+}
+
+// isHomeDir detects the home dir of an API key
+func isHomeDir(r *Resource) bool {
+	return !r.IsFile && r.ParentUUID == nil && r.Name == r.APIKeyUUID
+}
+
+func (s *ResourceService) SaveUploadedFile(file io.Reader, r *Resource, allowRename bool) (string, error) {
+	staged, err := s.StageUpload(r.APIKeyUUID, file, 0)
+	if err != nil {
+		return "", err
+	}
+	return s.SaveStagedFile(staged, r, allowRename)
+}
+
+// StagedFile is an upload that was written to a temp file but is not saved as resource yet
+type StagedFile struct {
+	Path   string
+	Size   int64
+	SHA256 string // hex encoded
+}
+
+// Remove deletes the temp file of a staged upload
+func (f *StagedFile) Remove() error {
+	if err := os.Remove(f.Path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// StageUpload streams data into a temp file in the home dir of the API key and computes size and checksum on the fly.
+// Exceeding maxSize (0 = no limit) aborts with ErrFileTooLarge.
+func (s *ResourceService) StageUpload(keyUUID string, src io.Reader, maxSize int64) (*StagedFile, error) {
+	if keyUUID == "" || strings.ContainsAny(keyUUID, "./\\") {
+		return nil, apperror.ErrFileInvalidFilepath
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Join(s.cfg.UploadPath, keyUUID), "upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("temp file creation error: %v", err)
+	}
+	staged := &StagedFile{Path: tmpFile.Name()}
+
+	if maxSize > 0 {
+		// one more byte to detect files that are too large
+		src = io.LimitReader(src, maxSize+1)
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmpFile, hash), src)
+	if err == nil && maxSize > 0 && size > maxSize {
+		err = apperror.ErrFileTooLarge
+	}
+	if closeErr := tmpFile.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("file close error: %v", closeErr)
+	}
+	if err != nil {
+		staged.Remove()
+		return nil, err
+	}
+
+	staged.Size = size
+	staged.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return staged, nil
+}
+
+// SaveStagedFile moves a staged upload into the blob store and saves the resource.
+// The temp file is removed if that fails.
+func (s *ResourceService) SaveStagedFile(f *StagedFile, r *Resource, allowRename bool) (string, error) {
+	if err := s.prepareFile(r); err != nil {
+		f.Remove()
+		return "", err
+	}
+
+	fileUUID, err := s.commitFile(f.Path, r, f.Size, f.SHA256, allowRename)
+	if err != nil {
+		f.Remove()
+		return "", err
+	}
+	return fileUUID, nil
+}
+
+// prepareFile validates name and parent of a new file
+func (s *ResourceService) prepareFile(r *Resource) error {
+	if err := validateResourceName(r.Name); err != nil {
+		return err
+	}
+	if r.MaxDownloads != nil && *r.MaxDownloads <= 0 {
+		return apperror.ErrInvalidMaxDownloads
 	}
 
 	r.Name = strings.TrimSpace(r.Name)
 	r.Name = filepath.Base(r.Name)
 
+	_, err := s.prepareParent(r)
+	return err
+}
+
+// resolveResourceName checks whether the name of a new resource is already taken in its parent.
+// If allowRename is set, name collisions are resolved by prefixing a number to the name.
+func (s *ResourceService) resolveResourceName(r *Resource, allowRename bool) error {
 	originalName := r.Name
 	var fileVersion string
-	var absDst string
-	var err error
 
-	// does file exist?
 	for {
 		r.Name = fileVersion + originalName
-		absDst, err = s.BuildResourcePath(r)
+		existing, err := s.db.findActiveChild(r.Name, r.APIKeyUUID, r.ParentUUID)
 		if err != nil {
-			return "", err
+			return err
 		}
-		_, err = os.Stat(absDst)
-		if err == nil {
-			if allowRename {
-				// rename
-				if fileVersion == "" {
-					fileVersion = "0"
-				} else {
-					i, err := strconv.Atoi(fileVersion)
-					if err != nil {
-						return "", fmt.Errorf("error parsing fileVersion: %v", err)
-					}
-					fileVersion = fmt.Sprint(i + 1)
-				}
-			} else {
-				return "", apperror.ErrFileAlreadyExists
-			}
-		} else if os.IsNotExist(err) {
-			// file does not exist
-			break
+		if existing == nil {
+			return nil
+		}
+		if !allowRename {
+			return apperror.ErrFileAlreadyExists
+		}
+
+		// rename
+		if fileVersion == "" {
+			fileVersion = "0"
 		} else {
-			return "", fmt.Errorf("unexpected error when renaming file: %v", err)
+			i, err := strconv.Atoi(fileVersion)
+			if err != nil {
+				return fmt.Errorf("error parsing fileVersion: %v", err)
+			}
+			fileVersion = fmt.Sprint(i + 1)
 		}
 	}
+}
+
+// commitFile moves a completely written file into the blob store and saves the resource
+func (s *ResourceService) commitFile(srcPath string, r *Resource, size int64, sha256 string, allowRename bool) (string, error) {
+	s.quotaMu.Lock()
+	defer s.quotaMu.Unlock()
+
+	if err := s.resolveResourceName(r, allowRename); err != nil {
+		return "", err
+	}
+	return s.insertFile(srcPath, r, size, sha256)
+}
 
+// insertFile saves a new file with a resolved name. Callers need to hold quotaMu.
+func (s *ResourceService) insertFile(srcPath string, r *Resource, size int64, sha256 string) (string, error) {
 	fileUUID, err := uuid.NewV7()
 	if err != nil {
 		return "", fmt.Errorf("UUID generation error: %v", err)
 	}
 
-	tmpDir := filepath.Dir(absDst)
-	tmpFile, err := os.CreateTemp(tmpDir, "upload-*")
+	if err := s.checkSpace(r.APIKeyUUID, size); err != nil {
+		return "", err
+	}
+
+	r.UUID = fileUUID.String()
+	r.IsFile = true
+	r.Size = size
+	r.SHA256 = sha256
+	r.BlobSHA256 = &sha256
+	r.Version = 1
+	r.CreatedAt = time.Now().UTC()
+	r.UpdatedAt = nil
+	r.DeletedAt = nil
+
+	err = s.storeBlob(srcPath, sha256, func() error {
+		return s.db.insertFileResource(r)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return fileUUID.String(), nil
+}
+
+// SpaceLimitBytes returns the storage quota of an API key in bytes (0 = no limit)
+func (s *ResourceService) SpaceLimitBytes(keyUUID string) (int64, error) {
+	key, err := s.db.findAPIKeyByUUID(keyUUID)
 	if err != nil {
-		return "", fmt.Errorf("temp file creation error: %v", err)
+		return 0, err
+	}
+	if key == nil {
+		return 0, fmt.Errorf("API key does not exist")
 	}
-	defer os.Remove(tmpFile.Name())
-	defer tmpFile.Close()
 
-	if _, err = io.Copy(tmpFile, file); err != nil {
-		return "", fmt.Errorf("file copy error: %v", err)
+	if key.SpaceLimitInMB != nil {
+		return *key.SpaceLimitInMB << 20, nil
+	}
+	return s.cfg.SpacePerUserBytes(), nil
+}
+
+// GetUsedSpace returns the number of bytes stored by an API key, including versions and the trash
+func (s *ResourceService) GetUsedSpace(keyUUID string) (int64, error) {
+	return s.db.sumStoredFileSizes(keyUUID)
+}
+
+// checkSpace returns ErrInsufficientStorage if storing additional bytes would exceed the quota of the API key
+func (s *ResourceService) checkSpace(keyUUID string, additional int64) error {
+	limit, err := s.SpaceLimitBytes(keyUUID)
+	if err != nil {
+		return err
+	}
+	if limit == 0 {
+		return nil
 	}
 
-	if err := tmpFile.Close(); err != nil {
-		return "", fmt.Errorf("file close error: %v", err)
+	used, err := s.GetUsedSpace(keyUUID)
+	if err != nil {
+		return err
 	}
 
-	if err := os.Rename(tmpFile.Name(), absDst); err != nil {
-		return "", fmt.Errorf("rename error: %v", err)
+	if used+additional > limit {
+		return apperror.ErrInsufficientStorage
 	}
+	return nil
+}
 
-	r.UUID = fileUUID.String()
-	r.IsFile = true
-	r.ParentUUID = nil
+// CreateFolder creates a folder below r.ParentUUID (nil = home dir) and returns its UUID
+func (s *ResourceService) CreateFolder(r *Resource) (string, error) {
+	if err := validateResourceName(r.Name); err != nil {
+		return "", err
+	}
+
+	r.Name = strings.TrimSpace(r.Name)
+	r.Name = filepath.Base(r.Name)
+
+	depth, err := s.prepareParent(r)
+	if err != nil {
+		return "", err
+	}
+
+	if s.cfg.MaxFolderDepth > 0 && depth >= s.cfg.MaxFolderDepth {
+		return "", apperror.ErrMaxFolderDepthReached
+	}
+
+	folderUUID, err := uuid.NewV7()
+	if err != nil {
+		return "", fmt.Errorf("UUID generation error: %v", err)
+	}
+
+	// folders only exist in the db, their files are stored in the blob store
+	s.quotaMu.Lock()
+	defer s.quotaMu.Unlock()
+
+	if err := s.resolveResourceName(r, false); err != nil {
+		return "", err
+	}
+
+	r.UUID = folderUUID.String()
+	r.IsFile = false
+	r.AutoDeleteAt = nil
 	r.CreatedAt = time.Now().UTC()
 	r.DeletedAt = nil
 
@@ -124,7 +444,7 @@ func (s *ResourceService) SaveUploadedFile(file multipart.File, r *Resource, all
 		return "", err
 	}
 
-	return fileUUID.String(), nil
+	return r.UUID, nil
 }
 
 // CreateDirsFromConfig creates all referenced directories from the config. Needs to be called before the resource service is initialized.
@@ -213,6 +533,74 @@ func (s *ResourceService) GetOrCreateHomeDir(hashed_key string) (*Resource, erro
 	return r, nil
 }
 
+// TransferResources moves the home dir of an API key including its content into the home dir of another key.
+// The old home dir becomes a folder named after the UUID of the old key.
+// Since files are stored in the blob store, only the db is changed.
+func (s *ResourceService) TransferResources(fromKeyUUID string, toKeyUUID string) error {
+	fromHome, err := s.db.findActiveResource(fromKeyUUID, fromKeyUUID, nil)
+	if err != nil {
+		return err
+	}
+	if fromHome == nil {
+		// nothing to transfer
+		return nil
+	}
+
+	toHome, err := s.db.findActiveResource(toKeyUUID, toKeyUUID, nil)
+	if err != nil {
+		return err
+	}
+	if toHome == nil {
+		return fmt.Errorf("home dir of API key %s does not exist", toKeyUUID)
+	}
+
+	s.quotaMu.Lock()
+	defer s.quotaMu.Unlock()
+
+	existing, err := s.db.findActiveChild(fromKeyUUID, toKeyUUID, nil)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return apperror.ErrFileAlreadyExists
+	}
+
+	return s.db.transferResources(fromKeyUUID, toKeyUUID, fromHome.UUID)
+}
+
+// DeleteAllResources removes all resources of an API key including its home dir.
+// Blobs are only unlinked if no resource of another key references them.
+func (s *ResourceService) DeleteAllResources(keyUUID string) error {
+	if keyUUID == "" || strings.ContainsAny(keyUUID, "./\\") {
+		return apperror.ErrFileInvalidFilepath
+	}
+
+	resources, err := s.db.findActiveResourcesByAPIKey(keyUUID)
+	if err != nil {
+		return err
+	}
+
+	t := time.Now().UTC()
+	for _, r := range resources {
+		if err := s.deleteResource(r, t); err != nil {
+			return err
+		}
+	}
+
+	trashed, err := s.db.findTrashedResourcesByAPIKey(keyUUID)
+	if err != nil {
+		return err
+	}
+	for _, r := range trashed {
+		if err := s.purgeTrashedResource(r); err != nil {
+			return err
+		}
+	}
+
+	// leftovers like unfinished uploads
+	return os.RemoveAll(filepath.Join(s.cfg.UploadPath, keyUUID))
+}
+
 func (s *ResourceService) GetResourceByUUID(uuid string) (*Resource, error) {
 	r, err := s.db.findResourceByUUID(uuid)
 	if err != nil {
@@ -224,19 +612,83 @@ func (s *ResourceService) GetResourceByUUID(uuid string) (*Resource, error) {
 	return r, nil
 }
 
-func (s *ResourceService) DeleteResourceByUUID(rUUID string, keyUUID string) error {
-	res, err := s.GetResourceByUUID(rUUID)
-	if err != nil {
-		return err
+// ResolveRelativePath finds an undeleted resource of the API key by a slash separated path relative to a folder (nil = home dir).
+// "." and ".." are supported, paths leaving the home dir are not found.
+func (s *ResourceService) ResolveRelativePath(keyUUID string, parentUUID *string, relPath string) (*Resource, error) {
+	var current *Resource
+	if parentUUID != nil {
+		p, err := s.db.findResourceByUUID(*parentUUID)
+		if err != nil {
+			return nil, err
+		}
+		if p == nil || p.APIKeyUUID != keyUUID || p.DeletedAt != nil {
+			return nil, apperror.ErrResourceNotFound
+		}
+		if !isHomeDir(p) {
+			current = p
+		}
 	}
 
-	// needs to be owner
-	if res.APIKeyUUID != keyUUID {
-		return apperror.ErrAuthorization
+	for _, name := range strings.Split(relPath, "/") {
+		switch name {
+		case "", ".":
+			continue
+		case "..":
+			if current == nil {
+				return nil, apperror.ErrResourceNotFound
+			}
+			parent, err := s.parentFolder(current)
+			if err != nil {
+				return nil, err
+			}
+			current = parent
+			continue
+		}
+
+		if current != nil && current.IsFile {
+			return nil, apperror.ErrResourceNotFound
+		}
+		var dir *string
+		if current != nil {
+			dir = &current.UUID
+		}
+		child, err := s.db.findActiveChild(name, keyUUID, dir)
+		if err != nil {
+			return nil, err
+		}
+		if child == nil {
+			return nil, apperror.ErrResourceNotFound
+		}
+		current = child
+	}
+
+	if current == nil {
+		return nil, apperror.ErrResourceNotFound
+	}
+	return current, nil
+}
+
+// parentFolder returns the folder containing a resource, nil for the home dir
+func (s *ResourceService) parentFolder(r *Resource) (*Resource, error) {
+	if r.ParentUUID == nil {
+		return nil, nil
+	}
+	p, err := s.db.findResourceByUUID(*r.ParentUUID)
+	if err != nil {
+		return nil, err
 	}
+	if p == nil || isHomeDir(p) {
+		return nil, nil
+	}
+	return p, nil
+}
 
-	if res == nil {
-		return apperror.ErrResourceNotFound
+// DeleteResourceByUUID moves a resource of the API key into the trash, folders including their content.
+// It can be restored until the trash retention ends.
+func (s *ResourceService) DeleteResourceByUUID(rUUID string, keyUUID string) error {
+	res, err := s.getDeletableResource(rUUID, keyUUID)
+	if err != nil {
+		return err
 	}
 
 	if res.DeletedAt != nil {
@@ -244,28 +696,204 @@ func (s *ResourceService) DeleteResourceByUUID(rUUID string, keyUUID string) err
 		return apperror.ErrFileAlreadyDeleted
 	}
 
+	t := time.Now().UTC()
+
+	if !res.IsFile {
+		// remove folder including its content
+		if err := s.trashChildren(res.UUID, t); err != nil {
+			return err
+		}
+	}
+
+	return s.trashResource(res, t)
+}
+
+// getDeletableResource loads a resource of the API key that is not the home dir
+func (s *ResourceService) getDeletableResource(rUUID string, keyUUID string) (*Resource, error) {
+	res, err := s.GetResourceByUUID(rUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	// needs to be owner
+	if res.APIKeyUUID != keyUUID {
+		return nil, apperror.ErrAuthorization
+	}
+
 	// detect home dir
-	if !res.IsFile && res.ParentUUID == nil {
-		return apperror.ErrDeleteHomeDirNotAllowed
+	if isHomeDir(res) {
+		return nil, apperror.ErrDeleteHomeDirNotAllowed
+	}
+	return res, nil
+}
+
+// deleteResource soft-deletes a resource and releases its blob.
+// The blob is unlinked once the last resource referencing it is gone.
+func (s *ResourceService) deleteResource(r *Resource, t time.Time) error {
+	if r.IsFile && r.BlobSHA256 == nil {
+		// stored by an older version under its name
+		path, err := s.legacyResourcePath(r)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
 	}
 
-	resPath := filepath.Join(s.cfg.UploadPath, res.APIKeyUUID, res.Name)
+	s.blobMu.Lock()
+	defer s.blobMu.Unlock()
 
-	// remove resource
-	if err := os.Remove(resPath); err != nil {
+	unreferenced, err := s.db.markResourceAsDeleted(r.UUID, t)
+	if err != nil {
 		return err
 	}
+	r.DeletedAt = &t
+	s.removeThumbnails(r.UUID)
 
-	t := time.Now().UTC()
-	res.DeletedAt = &t
+	return s.removeBlobs(unreferenced)
+}
 
-	err = s.db.updateResource(res)
+// markChildrenAsDeleted soft-deletes all resources below a folder recursively
+func (s *ResourceService) markChildrenAsDeleted(parentUUID string, t time.Time) error {
+	children, err := s.db.findActiveChildren(parentUUID)
 	if err != nil {
 		return err
 	}
+
+	for _, c := range children {
+		if !c.IsFile {
+			if err := s.markChildrenAsDeleted(c.UUID, t); err != nil {
+				return err
+			}
+		}
+
+		if err := s.deleteResource(c, t); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+)
+
+// ListResources returns one page of the resources owned by an API key
+func (s *ResourceService) ListResources(keyUUID string, opts ListOptions) (*ResourcePage, error) {
+	switch opts.SortBy {
+	case "":
+		opts.SortBy = "created_at"
+	case "created_at", "name", "size":
+	default:
+		return nil, apperror.ErrInvalidListOptions
+	}
+
+	if opts.Limit <= 0 {
+		opts.Limit = defaultListLimit
+	} else if opts.Limit > maxListLimit {
+		opts.Limit = maxListLimit
+	}
+
+	var after *listCursor
+	if opts.Cursor != "" {
+		c, err := decodeListCursor(opts.Cursor)
+		if err != nil || c.SortBy != opts.SortBy {
+			return nil, apperror.ErrInvalidListOptions
+		}
+		after = c
+	}
+
+	// one more to detect the next page
+	limit := opts.Limit
+	opts.Limit++
+
+	resources, err := s.db.findResourcesByAPIKey(keyUUID, opts, after)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &ResourcePage{Resources: resources}
+	if len(resources) > limit {
+		page.Resources = resources[:limit]
+		last := page.Resources[limit-1]
+
+		page.NextCursor, err = encodeListCursor(&listCursor{
+			SortBy:    opts.SortBy,
+			Name:      last.Name,
+			Size:      last.Size,
+			CreatedAt: last.CreatedAt,
+			UUID:      last.UUID,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
+
+func encodeListCursor(c *listCursor) (string, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeListCursor(cursor string) (*listCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	var c listCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// EnsureChecksum returns the SHA-256 of a file. Checksum and size of files uploaded by older versions are calculated and stored.
+func (s *ResourceService) EnsureChecksum(r *Resource) (string, error) {
+	if r.SHA256 != "" || !r.IsFile || r.DeletedAt != nil {
+		return r.SHA256, nil
+	}
+
+	resPath, err := s.BuildResourcePath(r)
+	if err != nil {
+		return "", err
+	}
+
+	sum, size, err := hashFile(resPath)
+	if err != nil {
+		return "", err
+	}
+
+	r.SHA256 = sum
+	r.Size = size
+	if err := s.db.updateResourceFileInfo(r.UUID, r.Size, r.SHA256); err != nil {
+		return "", err
+	}
+	return r.SHA256, nil
+}
+
+// hashFile returns the hex encoded SHA-256 and the size of a file
+func hashFile(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
 func (s *ResourceService) MarkResourceAsBroken(rUUID string) error {
 	res, err := s.GetResourceByUUID(rUUID)
 	if err != nil || res == nil || res.DeletedAt != nil {
@@ -280,6 +908,31 @@ func (s *ResourceService) MarkResourceAsBroken(rUUID string) error {
 	return nil
 }
 
+// CountDownload atomically counts a view or download of a file with a download limit.
+// ErrDownloadLimitReached is returned if the limit was already used up by earlier requests.
+// If this was the last allowed download, last is true and the file has to be removed with
+// ExpireResource once it was sent.
+func (s *ResourceService) CountDownload(r *Resource) (last bool, err error) {
+	if r.MaxDownloads == nil {
+		return false, nil
+	}
+
+	count, ok, err := s.db.incrementDownloadCount(r.UUID)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		return false, apperror.ErrDownloadLimitReached
+	}
+	r.DownloadCount = count
+	return count >= *r.MaxDownloads, nil
+}
+
+// ExpireResource soft-deletes a file and unlinks its content if no other file references it
+func (s *ResourceService) ExpireResource(r *Resource) error {
+	return s.deleteResource(r, time.Now().UTC())
+}
+
 func (s *ResourceService) StartCleanupWorker(interval time.Duration, stopCh <-chan struct{}) {
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
@@ -291,6 +944,12 @@ func (s *ResourceService) StartCleanupWorker(interval time.Duration, stopCh <-ch
 			if err != nil {
 				log.Printf("Error cleaning up files: %v", err)
 			}
+			if err := s.cleanupExpiredUploads(); err != nil {
+				log.Printf("Error cleaning up uploads: %v", err)
+			}
+			if err := s.purgeExpiredTrash(); err != nil {
+				log.Printf("Error purging trash: %v", err)
+			}
 		case <-stopCh:
 			log.Println("Cleanup worker stopped")
 			return
@@ -307,21 +966,8 @@ func (s *ResourceService) cleanupExpiredFiles() error {
 	}
 
 	for _, file := range files {
-		path, err := s.BuildResourcePath(file)
-		if err != nil {
-			log.Printf("Skipping file %s: %v", file.UUID, err)
-			continue
-		}
-
-		if err := os.Remove(path); err != nil {
-			log.Printf("Failed to delete file %s: %v", path, err)
-			continue
-		}
-
-		t := time.Now().UTC()
-		file.DeletedAt = &t
-		if err := s.db.updateResource(file); err != nil {
-			log.Printf("Failed to mark file %s as deleted: %v", file.UUID, err)
+		if err := s.deleteResource(file, time.Now().UTC()); err != nil {
+			log.Printf("Failed to delete file %s: %v", file.UUID, err)
 			continue
 		}
 	}
@@ -4,10 +4,12 @@ import (
 	"bytes"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/twigman/fshare/src/config"
+	"github.com/twigman/fshare/src/internal/apperror"
 	"github.com/twigman/fshare/src/testutil/fake"
 )
 
@@ -67,12 +69,23 @@ func TestFileService_SaveUploadedFile(t *testing.T) {
 	}
 
 	// tested function
-	_, err = rs.SaveUploadedFile(file, res, false)
+	fileUUID, err := rs.SaveUploadedFile(file, res, false)
 	if err != nil {
 		t.Fatalf("Error saving file: %v", err)
 	}
 
-	savedPath := filepath.Join(cfg.UploadPath, key.UUID, testFilename)
+	saved, err := rs.GetResourceByUUID(fileUUID)
+	if err != nil {
+		t.Fatalf("Error loading resource from db: %v", err)
+	}
+	if saved.Name != testFilename {
+		t.Errorf("expected name %s, got %s", testFilename, saved.Name)
+	}
+
+	savedPath, err := rs.BuildResourcePath(saved)
+	if err != nil {
+		t.Fatalf("Error building path: %v", err)
+	}
 	data, err := os.ReadFile(savedPath)
 	if err != nil {
 		t.Fatalf("File was not saved: %v", err)
@@ -206,7 +219,10 @@ func TestFileService_SaveUploadedFileMultipleTimes(t *testing.T) {
 			t.Fatalf("Error loading resource from db: %v", err)
 		}
 
-		savedPath := filepath.Join(cfg.UploadPath, key.UUID, r.Name)
+		savedPath, err := rs.BuildResourcePath(r)
+		if err != nil {
+			t.Fatalf("Error building path: %v", err)
+		}
 		data, err := os.ReadFile(savedPath)
 		if err != nil {
 			t.Fatalf("File was not saved: %v", err)
@@ -318,3 +334,702 @@ func TestCleanupExpiredFiles(t *testing.T) {
 		})
 	}
 }
+
+func TestFileService_CreateFolderAndSaveNestedFile(t *testing.T) {
+	dataDir := t.TempDir()
+	cfg := &config.Config{
+		DataPath:       dataDir,
+		UploadPath:     filepath.Join(dataDir, "upload"),
+		MaxFolderDepth: 2,
+	}
+
+	rs, key, err := initServices(cfg)
+	if err != nil {
+		t.Fatalf("Error initializing test services: %v", err)
+	}
+
+	if err := CreateDirsFromConfig(cfg); err != nil {
+		t.Fatalf("Error creating app dirs: %v", err)
+	}
+
+	home, err := rs.GetOrCreateHomeDir(key.HashedKey)
+	if err != nil {
+		t.Fatalf("Error creating home dir: %v", err)
+	}
+
+	// parent = home dir is normalized to nil
+	projectUUID, err := rs.CreateFolder(&Resource{Name: "project", APIKeyUUID: key.UUID, ParentUUID: &home.UUID})
+	if err != nil {
+		t.Fatalf("Error creating folder: %v", err)
+	}
+
+	project, err := rs.GetResourceByUUID(projectUUID)
+	if err != nil {
+		t.Fatalf("Error loading folder: %v", err)
+	}
+	if project.IsFile || project.ParentUUID != nil {
+		t.Errorf("folder flags invalid: %+v", project)
+	}
+
+	buildUUID, err := rs.CreateFolder(&Resource{Name: "build", APIKeyUUID: key.UUID, ParentUUID: &projectUUID})
+	if err != nil {
+		t.Fatalf("Error creating nested folder: %v", err)
+	}
+
+	// max depth reached
+	_, err = rs.CreateFolder(&Resource{Name: "too-deep", APIKeyUUID: key.UUID, ParentUUID: &buildUUID})
+	if err != apperror.ErrMaxFolderDepthReached {
+		t.Errorf("expected max depth error, got %v", err)
+	}
+
+	// folder already exists
+	_, err = rs.CreateFolder(&Resource{Name: "project", APIKeyUUID: key.UUID})
+	if err != apperror.ErrFileAlreadyExists {
+		t.Errorf("expected already exists error, got %v", err)
+	}
+
+	content := []byte("Hello World")
+	file := &fake.FakeMultipartFile{Reader: bytes.NewReader(content)}
+	nestedUUID, err := rs.SaveUploadedFile(file, &Resource{Name: "app.bin", APIKeyUUID: key.UUID, ParentUUID: &buildUUID}, false)
+	if err != nil {
+		t.Fatalf("Error saving nested file: %v", err)
+	}
+
+	nested, err := rs.GetResourceByUUID(nestedUUID)
+	if err != nil {
+		t.Fatalf("Error loading resource: %v", err)
+	}
+	if nested.ParentUUID == nil || *nested.ParentUUID != buildUUID {
+		t.Errorf("expected parent %s, got %v", buildUUID, nested.ParentUUID)
+	}
+	nestedPath, err := rs.BuildResourcePath(nested)
+	if err != nil {
+		t.Fatalf("Error building path: %v", err)
+	}
+	data, err := os.ReadFile(nestedPath)
+	if err != nil {
+		t.Fatalf("File was not saved in nested folder: %v", err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Errorf("Wrong file content.\nGot:  %q\nWant: %q", data, content)
+	}
+
+	// parent is a file
+	fileUUID, err := rs.SaveUploadedFile(&fake.FakeMultipartFile{Reader: bytes.NewReader(content)}, &Resource{Name: "a.txt", APIKeyUUID: key.UUID}, false)
+	if err != nil {
+		t.Fatalf("Error saving file: %v", err)
+	}
+	_, err = rs.SaveUploadedFile(&fake.FakeMultipartFile{Reader: bytes.NewReader(content)}, &Resource{Name: "b.txt", APIKeyUUID: key.UUID, ParentUUID: &fileUUID}, false)
+	if err != apperror.ErrInvalidParent {
+		t.Errorf("expected invalid parent error, got %v", err)
+	}
+}
+
+func TestFileService_DeleteFolderCascade(t *testing.T) {
+	dataDir := t.TempDir()
+	cfg := &config.Config{
+		DataPath:   dataDir,
+		UploadPath: filepath.Join(dataDir, "upload"),
+	}
+
+	rs, key, err := initServices(cfg)
+	if err != nil {
+		t.Fatalf("Error initializing test services: %v", err)
+	}
+
+	if err := CreateDirsFromConfig(cfg); err != nil {
+		t.Fatalf("Error creating app dirs: %v", err)
+	}
+
+	if _, err := rs.GetOrCreateHomeDir(key.HashedKey); err != nil {
+		t.Fatalf("Error creating home dir: %v", err)
+	}
+
+	folderUUID, err := rs.CreateFolder(&Resource{Name: "project", APIKeyUUID: key.UUID})
+	if err != nil {
+		t.Fatalf("Error creating folder: %v", err)
+	}
+	subUUID, err := rs.CreateFolder(&Resource{Name: "sub", APIKeyUUID: key.UUID, ParentUUID: &folderUUID})
+	if err != nil {
+		t.Fatalf("Error creating folder: %v", err)
+	}
+
+	file := &fake.FakeMultipartFile{Reader: bytes.NewReader([]byte("Hello World"))}
+	fileUUID, err := rs.SaveUploadedFile(file, &Resource{Name: "test.txt", APIKeyUUID: key.UUID, ParentUUID: &subUUID}, false)
+	if err != nil {
+		t.Fatalf("Error saving file: %v", err)
+	}
+
+	saved, err := rs.GetResourceByUUID(fileUUID)
+	if err != nil {
+		t.Fatalf("Error loading resource: %v", err)
+	}
+	filePath, err := rs.BuildResourcePath(saved)
+	if err != nil {
+		t.Fatalf("Error building path: %v", err)
+	}
+
+	if err := rs.DeleteResourceByUUID(folderUUID, key.UUID); err != nil {
+		t.Fatalf("Error deleting folder: %v", err)
+	}
+
+	// the content is kept in the trash
+	if _, err := os.Stat(filePath); err != nil {
+		t.Errorf("expected file of trashed folder to be kept, got %v", err)
+	}
+
+	for _, u := range []string{folderUUID, subUUID, fileUUID} {
+		r, err := rs.GetResourceByUUID(u)
+		if err != nil {
+			t.Fatalf("Error loading resource: %v", err)
+		}
+		if r.DeletedAt == nil || !r.InTrash {
+			t.Errorf("expected resource %s (%s) to be in the trash", r.Name, r.UUID)
+		}
+	}
+
+	if err := rs.PurgeResourceByUUID(folderUUID, key.UUID); err != nil {
+		t.Fatalf("Error purging folder: %v", err)
+	}
+
+	if _, err := os.Stat(filePath); !os.IsNotExist(err) {
+		t.Errorf("expected file of purged folder to be removed from disk, got %v", err)
+	}
+
+	for _, u := range []string{folderUUID, subUUID, fileUUID} {
+		r, err := rs.GetResourceByUUID(u)
+		if err != nil {
+			t.Fatalf("Error loading resource: %v", err)
+		}
+		if r.DeletedAt == nil || r.InTrash {
+			t.Errorf("expected resource %s (%s) to be purged", r.Name, r.UUID)
+		}
+	}
+}
+
+func TestFileService_SpaceLimit(t *testing.T) {
+	dataDir := t.TempDir()
+	cfg := &config.Config{
+		DataPath:         dataDir,
+		UploadPath:       filepath.Join(dataDir, "upload"),
+		SpacePerUserInMB: 1,
+	}
+
+	rs, key, err := initServices(cfg)
+	if err != nil {
+		t.Fatalf("Error initializing test services: %v", err)
+	}
+
+	if err := CreateDirsFromConfig(cfg); err != nil {
+		t.Fatalf("Error creating app dirs: %v", err)
+	}
+
+	if _, err := rs.GetOrCreateHomeDir(key.HashedKey); err != nil {
+		t.Fatalf("Error creating home dir: %v", err)
+	}
+
+	half := bytes.Repeat([]byte("A"), 512<<10)
+
+	firstUUID, err := rs.SaveUploadedFile(&fake.FakeMultipartFile{Reader: bytes.NewReader(half)}, &Resource{Name: "a.bin", APIKeyUUID: key.UUID}, false)
+	if err != nil {
+		t.Fatalf("Error saving file: %v", err)
+	}
+
+	r, err := rs.GetResourceByUUID(firstUUID)
+	if err != nil {
+		t.Fatalf("Error loading resource: %v", err)
+	}
+	if r.Size != int64(len(half)) {
+		t.Errorf("expected size %d, got %d", len(half), r.Size)
+	}
+
+	if _, err := rs.SaveUploadedFile(&fake.FakeMultipartFile{Reader: bytes.NewReader(half)}, &Resource{Name: "b.bin", APIKeyUUID: key.UUID}, false); err != nil {
+		t.Fatalf("Error saving file within quota: %v", err)
+	}
+
+	// quota exceeded
+	_, err = rs.SaveUploadedFile(&fake.FakeMultipartFile{Reader: bytes.NewReader([]byte("A"))}, &Resource{Name: "c.bin", APIKeyUUID: key.UUID}, false)
+	if err != apperror.ErrInsufficientStorage {
+		t.Fatalf("expected insufficient storage error, got %v", err)
+	}
+	entries, err := os.ReadDir(filepath.Join(cfg.UploadPath, key.UUID))
+	if err != nil {
+		t.Fatalf("Error reading home dir: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("rejected file should not exist on disk, found %d entries", len(entries))
+	}
+
+	// trashed files still count, purging frees space
+	if err := rs.DeleteResourceByUUID(firstUUID, key.UUID); err != nil {
+		t.Fatalf("Error deleting file: %v", err)
+	}
+	if _, err := rs.SaveUploadedFile(&fake.FakeMultipartFile{Reader: bytes.NewReader([]byte("A"))}, &Resource{Name: "c.bin", APIKeyUUID: key.UUID}, false); err != apperror.ErrInsufficientStorage {
+		t.Fatalf("expected insufficient storage error while the file is in the trash, got %v", err)
+	}
+	if err := rs.PurgeResourceByUUID(firstUUID, key.UUID); err != nil {
+		t.Fatalf("Error purging file: %v", err)
+	}
+	if _, err := rs.SaveUploadedFile(&fake.FakeMultipartFile{Reader: bytes.NewReader([]byte("A"))}, &Resource{Name: "c.bin", APIKeyUUID: key.UUID}, false); err != nil {
+		t.Fatalf("Error saving file after delete: %v", err)
+	}
+
+	// per key override: no limit
+	noLimit := int64(0)
+	if err := rs.db.updateAPIKeySpaceLimit(key.UUID, &noLimit); err != nil {
+		t.Fatalf("Error setting space limit: %v", err)
+	}
+	if _, err := rs.SaveUploadedFile(&fake.FakeMultipartFile{Reader: bytes.NewReader(half)}, &Resource{Name: "d.bin", APIKeyUUID: key.UUID}, false); err != nil {
+		t.Fatalf("Error saving file without limit: %v", err)
+	}
+
+	used, err := rs.GetUsedSpace(key.UUID)
+	if err != nil {
+		t.Fatalf("Error reading used space: %v", err)
+	}
+	if used != int64(2*len(half)+1) {
+		t.Errorf("expected %d used bytes, got %d", 2*len(half)+1, used)
+	}
+}
+
+func TestFileService_ListResources(t *testing.T) {
+	dataDir := t.TempDir()
+	cfg := &config.Config{
+		DataPath:   dataDir,
+		UploadPath: filepath.Join(dataDir, "upload"),
+	}
+
+	rs, key, err := initServices(cfg)
+	if err != nil {
+		t.Fatalf("Error initializing test services: %v", err)
+	}
+
+	if err := CreateDirsFromConfig(cfg); err != nil {
+		t.Fatalf("Error creating app dirs: %v", err)
+	}
+
+	if _, err := rs.GetOrCreateHomeDir(key.HashedKey); err != nil {
+		t.Fatalf("Error creating home dir: %v", err)
+	}
+
+	names := []string{"build-1.log", "build-2.log", "build-3.log", "report.pdf", "notes.txt"}
+	uuids := make(map[string]string)
+	for i, name := range names {
+		content := bytes.Repeat([]byte("A"), i+1)
+		u, err := rs.SaveUploadedFile(&fake.FakeMultipartFile{Reader: bytes.NewReader(content)}, &Resource{Name: name, APIKeyUUID: key.UUID}, false)
+		if err != nil {
+			t.Fatalf("Error saving file: %v", err)
+		}
+		uuids[name] = u
+	}
+
+	if err := rs.DeleteResourceByUUID(uuids["notes.txt"], key.UUID); err != nil {
+		t.Fatalf("Error deleting file: %v", err)
+	}
+
+	// pagination by name
+	var got []string
+	cursor := ""
+	pages := 0
+	for {
+		page, err := rs.ListResources(key.UUID, ListOptions{Limit: 2, SortBy: "name", Cursor: cursor})
+		if err != nil {
+			t.Fatalf("Error listing resources: %v", err)
+		}
+		pages++
+		for _, r := range page.Resources {
+			got = append(got, r.Name)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	want := []string{"build-1.log", "build-2.log", "build-3.log", "report.pdf"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("unexpected listing: got %v, want %v", got, want)
+	}
+	if pages != 2 {
+		t.Errorf("expected 2 pages, got %d", pages)
+	}
+
+	// pagination by creation time (default)
+	got = nil
+	cursor = ""
+	for {
+		page, err := rs.ListResources(key.UUID, ListOptions{Limit: 1, Cursor: cursor})
+		if err != nil {
+			t.Fatalf("Error listing resources: %v", err)
+		}
+		for _, r := range page.Resources {
+			got = append(got, r.Name)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("unexpected listing by creation time: got %v, want %v", got, want)
+	}
+
+	// prefix + size desc
+	page, err := rs.ListResources(key.UUID, ListOptions{SortBy: "size", Descending: true, NamePrefix: "build-"})
+	if err != nil {
+		t.Fatalf("Error listing resources: %v", err)
+	}
+	if len(page.Resources) != 3 || page.Resources[0].Name != "build-3.log" || page.Resources[2].Name != "build-1.log" {
+		t.Errorf("unexpected prefix listing: %+v", page.Resources)
+	}
+
+	// include deleted
+	page, err = rs.ListResources(key.UUID, ListOptions{IncludeDeleted: true})
+	if err != nil {
+		t.Fatalf("Error listing resources: %v", err)
+	}
+	if len(page.Resources) != 5 {
+		t.Errorf("expected 5 resources including deleted, got %d", len(page.Resources))
+	}
+
+	// cursor of a different sort order
+	nameCursor, err := rs.ListResources(key.UUID, ListOptions{Limit: 1, SortBy: "name"})
+	if err != nil {
+		t.Fatalf("Error listing resources: %v", err)
+	}
+	if _, err := rs.ListResources(key.UUID, ListOptions{SortBy: "size", Cursor: nameCursor.NextCursor}); err != apperror.ErrInvalidListOptions {
+		t.Errorf("expected invalid list options error, got %v", err)
+	}
+
+	if _, err := rs.ListResources(key.UUID, ListOptions{SortBy: "uuid; DROP TABLE resource"}); err != apperror.ErrInvalidListOptions {
+		t.Errorf("expected invalid list options error, got %v", err)
+	}
+}
+
+func TestFileService_EnsureChecksum(t *testing.T) {
+	dataDir := t.TempDir()
+	cfg := &config.Config{
+		DataPath:   dataDir,
+		UploadPath: filepath.Join(dataDir, "upload"),
+	}
+
+	rs, key, err := initServices(cfg)
+	if err != nil {
+		t.Fatalf("Error initializing test services: %v", err)
+	}
+
+	// file uploaded by an older version: no size and checksum
+	homeDir := filepath.Join(cfg.UploadPath, key.UUID)
+	if err := os.MkdirAll(homeDir, 0o700); err != nil {
+		t.Fatalf("Error creating home dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(homeDir, "old.txt"), []byte("Hello World"), 0o600); err != nil {
+		t.Fatalf("Error writing file: %v", err)
+	}
+
+	r := &Resource{UUID: "old", Name: "old.txt", IsFile: true, APIKeyUUID: key.UUID, CreatedAt: time.Now().UTC()}
+	if err := rs.db.insertResource(r); err != nil {
+		t.Fatalf("Error inserting resource: %v", err)
+	}
+
+	checksum, err := rs.EnsureChecksum(r)
+	if err != nil {
+		t.Fatalf("Error calculating checksum: %v", err)
+	}
+
+	const want = "a591a6d40bf420404a011733cfb7b190d62c65bf0bcda32b57b277d9ad9f146e"
+	if checksum != want {
+		t.Errorf("expected checksum %s, got %s", want, checksum)
+	}
+
+	stored, err := rs.GetResourceByUUID("old")
+	if err != nil {
+		t.Fatalf("Error loading resource: %v", err)
+	}
+	if stored.SHA256 != want || stored.Size != int64(len("Hello World")) {
+		t.Errorf("checksum or size not stored: %+v", stored)
+	}
+}
+
+func TestFileService_TransferResources(t *testing.T) {
+	dataDir := t.TempDir()
+	cfg := &config.Config{
+		DataPath:   dataDir,
+		UploadPath: filepath.Join(dataDir, "upload"),
+	}
+
+	db, err := NewDB(cfg.DataPath)
+	if err != nil {
+		t.Fatalf("could not init test db %v", err)
+	}
+	rs := NewResourceService(cfg, db)
+	as := NewAPIKeyService(db)
+
+	if err := CreateDirsFromConfig(cfg); err != nil {
+		t.Fatalf("Error creating app dirs: %v", err)
+	}
+
+	from, err := as.AddAPIKey("from", "from", false, nil)
+	if err != nil {
+		t.Fatalf("could not add API key: %v", err)
+	}
+	to, err := as.AddAPIKey("to", "to", false, nil)
+	if err != nil {
+		t.Fatalf("could not add API key: %v", err)
+	}
+	for _, k := range []*APIKey{from, to} {
+		if _, err := rs.GetOrCreateHomeDir(k.HashedKey); err != nil {
+			t.Fatalf("Error creating home dir: %v", err)
+		}
+	}
+
+	content := []byte("Hello World")
+	fileUUID, err := rs.SaveUploadedFile(&fake.FakeMultipartFile{Reader: bytes.NewReader(content)}, &Resource{Name: "a.txt", APIKeyUUID: from.UUID}, false)
+	if err != nil {
+		t.Fatalf("Error saving file: %v", err)
+	}
+
+	if err := rs.TransferResources(from.UUID, to.UUID); err != nil {
+		t.Fatalf("Error transferring resources: %v", err)
+	}
+
+	r, err := rs.GetResourceByUUID(fileUUID)
+	if err != nil {
+		t.Fatalf("Error loading resource: %v", err)
+	}
+	if r.APIKeyUUID != to.UUID {
+		t.Errorf("expected owner %s, got %s", to.UUID, r.APIKeyUUID)
+	}
+
+	path, err := rs.BuildResourcePath(r)
+	if err != nil {
+		t.Fatalf("Error building path: %v", err)
+	}
+	folders, err := rs.resolveFolderChain(r.ParentUUID, to.UUID)
+	if err != nil {
+		t.Fatalf("Error resolving folders: %v", err)
+	}
+	if len(folders) != 1 || folders[0].Name != from.UUID {
+		t.Errorf("expected file in folder %s, got %+v", from.UUID, folders)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("transferred file not readable: %v", err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Errorf("Wrong file content.\nGot:  %q\nWant: %q", data, content)
+	}
+
+	used, err := rs.GetUsedSpace(to.UUID)
+	if err != nil {
+		t.Fatalf("Error reading used space: %v", err)
+	}
+	if used != int64(len(content)) {
+		t.Errorf("expected %d bytes used, got %d", len(content), used)
+	}
+}
+
+func TestFileService_DeleteAllResources(t *testing.T) {
+	dataDir := t.TempDir()
+	cfg := &config.Config{
+		DataPath:   dataDir,
+		UploadPath: filepath.Join(dataDir, "upload"),
+	}
+
+	rs, key, err := initServices(cfg)
+	if err != nil {
+		t.Fatalf("Error initializing test services: %v", err)
+	}
+	if err := CreateDirsFromConfig(cfg); err != nil {
+		t.Fatalf("Error creating app dirs: %v", err)
+	}
+	if _, err := rs.GetOrCreateHomeDir(key.HashedKey); err != nil {
+		t.Fatalf("Error creating home dir: %v", err)
+	}
+
+	fileUUID, err := rs.SaveUploadedFile(&fake.FakeMultipartFile{Reader: bytes.NewReader([]byte("x"))}, &Resource{Name: "a.txt", APIKeyUUID: key.UUID}, false)
+	if err != nil {
+		t.Fatalf("Error saving file: %v", err)
+	}
+
+	if err := rs.DeleteAllResources(key.UUID); err != nil {
+		t.Fatalf("Error deleting resources: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(cfg.UploadPath, key.UUID)); !os.IsNotExist(err) {
+		t.Errorf("expected home dir to be removed, got %v", err)
+	}
+
+	r, err := rs.GetResourceByUUID(fileUUID)
+	if err != nil {
+		t.Fatalf("Error loading resource: %v", err)
+	}
+	if r.DeletedAt == nil {
+		t.Errorf("expected resource to be marked as deleted")
+	}
+
+	if err := rs.DeleteAllResources("../x"); err == nil {
+		t.Errorf("expected error for invalid key uuid")
+	}
+}
+
+func TestFileService_StageUpload(t *testing.T) {
+	dataDir := t.TempDir()
+	cfg := &config.Config{
+		DataPath:   dataDir,
+		UploadPath: filepath.Join(dataDir, "upload"),
+	}
+
+	rs, key, err := initServices(cfg)
+	if err != nil {
+		t.Fatalf("Error initializing test services: %v", err)
+	}
+	if err := CreateDirsFromConfig(cfg); err != nil {
+		t.Fatalf("Error creating app dirs: %v", err)
+	}
+	if _, err := rs.GetOrCreateHomeDir(key.HashedKey); err != nil {
+		t.Fatalf("Error creating home dir: %v", err)
+	}
+
+	// too large
+	if _, err := rs.StageUpload(key.UUID, strings.NewReader("12345"), 4); err != apperror.ErrFileTooLarge {
+		t.Fatalf("expected ErrFileTooLarge, got %v", err)
+	}
+	entries, err := os.ReadDir(filepath.Join(cfg.UploadPath, key.UUID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("temp file was not removed")
+	}
+
+	staged, err := rs.StageUpload(key.UUID, strings.NewReader("1234"), 4)
+	if err != nil {
+		t.Fatalf("Error staging upload: %v", err)
+	}
+	if staged.Size != 4 || staged.SHA256 != "03ac674216f3e15c761ee1a5e255f067953623c8b388b4459e13f978d7c846f4" {
+		t.Fatalf("unexpected size or checksum: %+v", staged)
+	}
+
+	fileUUID, err := rs.SaveStagedFile(staged, &Resource{Name: "a.txt", APIKeyUUID: key.UUID}, false)
+	if err != nil {
+		t.Fatalf("Error saving staged file: %v", err)
+	}
+	r, err := rs.GetResourceByUUID(fileUUID)
+	if err != nil {
+		t.Fatalf("Error loading resource: %v", err)
+	}
+	if r.Size != 4 || r.SHA256 != staged.SHA256 {
+		t.Errorf("unexpected resource: %+v", r)
+	}
+	if _, err := os.Stat(staged.Path); !os.IsNotExist(err) {
+		t.Errorf("temp file still exists")
+	}
+}
+
+func TestFileService_CountDownload(t *testing.T) {
+	dataDir := t.TempDir()
+	cfg := &config.Config{
+		DataPath:   dataDir,
+		UploadPath: filepath.Join(dataDir, "upload"),
+	}
+
+	rs, key, err := initServices(cfg)
+	if err != nil {
+		t.Fatalf("Error initializing test services: %v", err)
+	}
+	if err := CreateDirsFromConfig(cfg); err != nil {
+		t.Fatalf("Error creating app dirs: %v", err)
+	}
+	if _, err := rs.GetOrCreateHomeDir(key.HashedKey); err != nil {
+		t.Fatalf("Error creating home dir: %v", err)
+	}
+
+	invalid := int64(0)
+	_, err = rs.SaveUploadedFile(bytes.NewReader([]byte("test")), &Resource{Name: "a.txt", APIKeyUUID: key.UUID, MaxDownloads: &invalid}, false)
+	if err != apperror.ErrInvalidMaxDownloads {
+		t.Fatalf("expected ErrInvalidMaxDownloads, got %v", err)
+	}
+
+	maxDownloads := int64(2)
+	fileUUID, err := rs.SaveUploadedFile(bytes.NewReader([]byte("test")), &Resource{Name: "a.txt", APIKeyUUID: key.UUID, MaxDownloads: &maxDownloads}, false)
+	if err != nil {
+		t.Fatalf("Error saving file: %v", err)
+	}
+	r, err := rs.GetResourceByUUID(fileUUID)
+	if err != nil {
+		t.Fatalf("Error loading resource: %v", err)
+	}
+
+	if last, err := rs.CountDownload(r); err != nil || last {
+		t.Fatalf("first download: last=%v, err=%v", last, err)
+	}
+	// stale copy of the resource, counting is done in the db
+	stale, _ := rs.GetResourceByUUID(fileUUID)
+	if last, err := rs.CountDownload(r); err != nil || !last {
+		t.Fatalf("second download: last=%v, err=%v", last, err)
+	}
+	if _, err := rs.CountDownload(stale); err != apperror.ErrDownloadLimitReached {
+		t.Fatalf("expected ErrDownloadLimitReached, got %v", err)
+	}
+
+	// the cleanup worker removes files whose limit is reached, e.g. after a crash before ExpireResource
+	if err := rs.cleanupExpiredFiles(); err != nil {
+		t.Fatalf("cleanup error: %v", err)
+	}
+	r, _ = rs.GetResourceByUUID(fileUUID)
+	if r.DeletedAt == nil || r.DownloadCount != 2 {
+		t.Errorf("expected used up file to be deleted: %+v", r)
+	}
+}
+
+func TestFileService_ResolveRelativePath(t *testing.T) {
+	dataDir := t.TempDir()
+	cfg := &config.Config{DataPath: dataDir, UploadPath: filepath.Join(dataDir, "upload")}
+	rs, key := initTrashTest(t, cfg)
+
+	docsUUID, err := rs.CreateFolder(&Resource{Name: "docs", APIKeyUUID: key.UUID})
+	if err != nil {
+		t.Fatalf("Error creating folder: %v", err)
+	}
+	imgUUID, err := rs.CreateFolder(&Resource{Name: "img", APIKeyUUID: key.UUID})
+	if err != nil {
+		t.Fatalf("Error creating folder: %v", err)
+	}
+	logoUUID := saveTestFile(t, rs, &Resource{Name: "logo.png", ParentUUID: &imgUUID, APIKeyUUID: key.UUID}, "png")
+	rootUUID := saveTestFile(t, rs, &Resource{Name: "root.txt", APIKeyUUID: key.UUID}, "root")
+
+	tests := []struct {
+		name   string
+		parent *string
+		path   string
+		want   string
+	}{
+		{"sibling folder", nil, "img/logo.png", logoUUID},
+		{"dot segments", &docsUUID, "./../img/./logo.png", logoUUID},
+		{"home dir", &docsUUID, "../root.txt", rootUUID},
+		{"leaving home dir", &docsUUID, "../../root.txt", ""},
+		{"below a file", nil, "root.txt/logo.png", ""},
+		{"missing", &imgUUID, "other.png", ""},
+		{"folder itself", nil, "img", imgUUID},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := rs.ResolveRelativePath(key.UUID, tc.parent, tc.path)
+			if tc.want == "" {
+				if err != apperror.ErrResourceNotFound {
+					t.Errorf("expected ErrResourceNotFound, got %v", err)
+				}
+				return
+			}
+			if err != nil || r.UUID != tc.want {
+				t.Errorf("expected %s, got %+v, %v", tc.want, r, err)
+			}
+		})
+	}
+
+	// other keys can not resolve paths from foreign folders
+	if _, err := rs.ResolveRelativePath("other", &imgUUID, "logo.png"); err != apperror.ErrResourceNotFound {
+		t.Errorf("expected ErrResourceNotFound, got %v", err)
+	}
+}
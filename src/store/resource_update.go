@@ -0,0 +1,143 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/twigman/fshare/src/internal/apperror"
+)
+
+// UpdateResource changes name, privacy and TTL of an undeleted resource of the API key and returns the updated resource.
+// A new name must not be taken by another resource in the same folder.
+func (s *ResourceService) UpdateResource(rUUID string, keyUUID string, upd ResourceUpdate) (*Resource, error) {
+	res, err := s.GetResourceByUUID(rUUID)
+	if err != nil {
+		return nil, err
+	}
+	if res.APIKeyUUID != keyUUID {
+		return nil, apperror.ErrAuthorization
+	}
+	if res.DeletedAt != nil {
+		return nil, apperror.ErrResourceNotFound
+	}
+	if isHomeDir(res) {
+		return nil, apperror.ErrUpdateHomeDirNotAllowed
+	}
+
+	if upd.IsPrivate != nil {
+		res.IsPrivate = *upd.IsPrivate
+	}
+
+	if upd.AutoDeleteIn != nil {
+		if !res.IsFile {
+			return nil, apperror.ErrAutoDeleteNotAFile
+		}
+		if *upd.AutoDeleteIn == 0 {
+			res.AutoDeleteAt = nil
+		} else {
+			t := time.Now().UTC().Add(*upd.AutoDeleteIn)
+			res.AutoDeleteAt = &t
+		}
+	}
+
+	if upd.Name == nil || strings.TrimSpace(*upd.Name) == res.Name {
+		if err := s.saveResourceSettings(res); err != nil {
+			return nil, err
+		}
+		return res, nil
+	}
+
+	if err := s.renameResource(res, *upd.Name); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// renameResource saves r under a new name in its folder.
+// Content written by older versions is stored under its name and is moved along.
+func (s *ResourceService) renameResource(r *Resource, name string) error {
+	if err := validateResourceName(name); err != nil {
+		return err
+	}
+	name = strings.TrimSpace(name)
+	if name == "" || (r.ParentUUID == nil && name == r.APIKeyUUID) {
+		// the home dir is named after the API key
+		return apperror.ErrFileInvalidFilename
+	}
+
+	// serializes the check for a free name with uploads into the same folder
+	s.quotaMu.Lock()
+	defer s.quotaMu.Unlock()
+
+	existing, err := s.db.findActiveChild(name, r.APIKeyUUID, r.ParentUUID)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.UUID != r.UUID {
+		return apperror.ErrFileAlreadyExists
+	}
+
+	oldName := r.Name
+	r.Name = name
+
+	var oldPath, newPath string
+	if r.BlobSHA256 == nil {
+		renamed := *r
+		renamed.Name = oldName
+		if oldPath, err = s.BuildResourcePath(&renamed); err != nil {
+			r.Name = oldName
+			return err
+		}
+		if newPath, err = s.BuildResourcePath(r); err != nil {
+			r.Name = oldName
+			return err
+		}
+		if err := moveLegacyPath(oldPath, newPath); err != nil {
+			r.Name = oldName
+			return err
+		}
+	}
+
+	if err := s.saveResourceSettings(r); err != nil {
+		if oldPath != "" {
+			// keep the content where the db expects it
+			_ = moveLegacyPath(newPath, oldPath)
+		}
+		r.Name = oldName
+		return err
+	}
+	return nil
+}
+
+// saveResourceSettings stores name, privacy and TTL of r. A resource deleted in the meantime stays deleted.
+func (s *ResourceService) saveResourceSettings(r *Resource) error {
+	ok, err := s.db.updateResourceSettings(r)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return apperror.ErrResourceNotFound
+	}
+	return nil
+}
+
+// moveLegacyPath renames a file or folder written by an older version. Folders created by newer versions
+// only exist in the db, so a missing source is not an error.
+func moveLegacyPath(oldPath string, newPath string) error {
+	if _, err := os.Stat(oldPath); os.IsNotExist(err) {
+		return nil
+	}
+	if _, err := os.Lstat(newPath); err == nil {
+		return apperror.ErrFileAlreadyExists
+	}
+	if err := os.MkdirAll(filepath.Dir(newPath), 0o700); err != nil {
+		return err
+	}
+	if err := os.Rename(oldPath, newPath); err != nil {
+		return fmt.Errorf("could not rename %s: %v", oldPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/twigman/fshare/src/config"
+	"github.com/twigman/fshare/src/internal/apperror"
+)
+
+func TestFileService_UpdateResource(t *testing.T) {
+	dataDir := t.TempDir()
+	cfg := &config.Config{
+		DataPath:   dataDir,
+		UploadPath: filepath.Join(dataDir, "upload"),
+	}
+
+	rs, key, err := initServices(cfg)
+	if err != nil {
+		t.Fatalf("Error initializing test services: %v", err)
+	}
+	if err := CreateDirsFromConfig(cfg); err != nil {
+		t.Fatalf("Error creating app dirs: %v", err)
+	}
+	home, err := rs.GetOrCreateHomeDir(key.HashedKey)
+	if err != nil {
+		t.Fatalf("Error creating home dir: %v", err)
+	}
+
+	fileUUID, err := rs.SaveUploadedFile(bytes.NewReader([]byte("test")), &Resource{Name: "a.txt", APIKeyUUID: key.UUID}, false)
+	if err != nil {
+		t.Fatalf("Error saving file: %v", err)
+	}
+	if _, err := rs.SaveUploadedFile(bytes.NewReader([]byte("other")), &Resource{Name: "b.txt", APIKeyUUID: key.UUID}, false); err != nil {
+		t.Fatalf("Error saving file: %v", err)
+	}
+	folderUUID, err := rs.CreateFolder(&Resource{Name: "docs", APIKeyUUID: key.UUID})
+	if err != nil {
+		t.Fatalf("Error creating folder: %v", err)
+	}
+
+	name := func(n string) *string { return &n }
+	yes := true
+	week := 7 * 24 * time.Hour
+	noTTL := time.Duration(0)
+
+	// rename, make private and set a TTL at once
+	before := time.Now().UTC()
+	res, err := rs.UpdateResource(fileUUID, key.UUID, ResourceUpdate{Name: name("c.txt"), IsPrivate: &yes, AutoDeleteIn: &week})
+	if err != nil {
+		t.Fatalf("Error updating resource: %v", err)
+	}
+	if res.Name != "c.txt" || !res.IsPrivate || res.AutoDeleteAt == nil || res.AutoDeleteAt.Before(before.Add(week)) {
+		t.Errorf("unexpected resource after update: %+v", res)
+	}
+
+	stored, err := rs.GetResourceByUUID(fileUUID)
+	if err != nil {
+		t.Fatalf("Error loading resource: %v", err)
+	}
+	if stored.Name != "c.txt" || !stored.IsPrivate || stored.AutoDeleteAt == nil {
+		t.Errorf("update not saved: %+v", stored)
+	}
+	obj, err := rs.OpenResource(stored)
+	if err != nil {
+		t.Fatalf("Error opening renamed file: %v", err)
+	}
+	obj.Close()
+
+	// remove the TTL, keep the rest
+	res, err = rs.UpdateResource(fileUUID, key.UUID, ResourceUpdate{AutoDeleteIn: &noTTL})
+	if err != nil {
+		t.Fatalf("Error updating resource: %v", err)
+	}
+	if res.AutoDeleteAt != nil || res.Name != "c.txt" || !res.IsPrivate {
+		t.Errorf("unexpected resource after removing the TTL: %+v", res)
+	}
+
+	tests := []struct {
+		name    string
+		uuid    string
+		keyUUID string
+		upd     ResourceUpdate
+		want    error
+	}{
+		{"name taken", fileUUID, key.UUID, ResourceUpdate{Name: name("b.txt")}, apperror.ErrFileAlreadyExists},
+		{"invalid name", fileUUID, key.UUID, ResourceUpdate{Name: name("../x")}, apperror.ErrFileInvalidFilename},
+		{"empty name", fileUUID, key.UUID, ResourceUpdate{Name: name(" ")}, apperror.ErrFileInvalidFilename},
+		{"reserved name", fileUUID, key.UUID, ResourceUpdate{Name: name(key.UUID)}, apperror.ErrFileInvalidFilename},
+		{"other key", fileUUID, "other", ResourceUpdate{IsPrivate: &yes}, apperror.ErrAuthorization},
+		{"home dir", home.UUID, key.UUID, ResourceUpdate{Name: name("home")}, apperror.ErrUpdateHomeDirNotAllowed},
+		{"folder TTL", folderUUID, key.UUID, ResourceUpdate{AutoDeleteIn: &week}, apperror.ErrAutoDeleteNotAFile},
+		{"missing", "missing", key.UUID, ResourceUpdate{IsPrivate: &yes}, apperror.ErrResourceNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := rs.UpdateResource(tt.uuid, tt.keyUUID, tt.upd); err != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	stored, err = rs.GetResourceByUUID(fileUUID)
+	if err != nil {
+		t.Fatalf("Error loading resource: %v", err)
+	}
+	if stored.Name != "c.txt" {
+		t.Errorf("expected failed renames to keep the name, got %s", stored.Name)
+	}
+
+	// the name of a deleted file is free again
+	if err := rs.DeleteResourceByUUID(fileUUID, key.UUID); err != nil {
+		t.Fatalf("Error deleting file: %v", err)
+	}
+	if _, err := rs.UpdateResource(fileUUID, key.UUID, ResourceUpdate{IsPrivate: &yes}); err != apperror.ErrResourceNotFound {
+		t.Errorf("expected ErrResourceNotFound for deleted file, got %v", err)
+	}
+	if _, err := rs.UpdateResource(folderUUID, key.UUID, ResourceUpdate{Name: name("c.txt")}); err != nil {
+		t.Errorf("expected rename to the name of a deleted file to work, got %v", err)
+	}
+}
+
+func TestFileService_UpdateResource_LegacyFile(t *testing.T) {
+	dataDir := t.TempDir()
+	cfg := &config.Config{
+		DataPath:   dataDir,
+		UploadPath: filepath.Join(dataDir, "upload"),
+	}
+
+	rs, key, err := initServices(cfg)
+	if err != nil {
+		t.Fatalf("Error initializing test services: %v", err)
+	}
+
+	// file uploaded by an older version, stored under its name
+	homeDir := filepath.Join(cfg.UploadPath, key.UUID)
+	if err := os.MkdirAll(homeDir, 0o700); err != nil {
+		t.Fatalf("Error creating home dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(homeDir, "old.txt"), []byte("Hello World"), 0o600); err != nil {
+		t.Fatalf("Error writing file: %v", err)
+	}
+	old := &Resource{UUID: "old", Name: "old.txt", IsFile: true, APIKeyUUID: key.UUID, CreatedAt: time.Now().UTC()}
+	if err := rs.db.insertResource(old); err != nil {
+		t.Fatalf("Error inserting resource: %v", err)
+	}
+
+	newName := "new.txt"
+	res, err := rs.UpdateResource("old", key.UUID, ResourceUpdate{Name: &newName})
+	if err != nil {
+		t.Fatalf("Error renaming legacy file: %v", err)
+	}
+
+	path, err := rs.BuildResourcePath(res)
+	if err != nil {
+		t.Fatalf("Error building path: %v", err)
+	}
+	if path != filepath.Join(homeDir, "new.txt") {
+		t.Errorf("unexpected path %s", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "Hello World" {
+		t.Errorf("renamed file not readable: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(homeDir, "old.txt")); !os.IsNotExist(err) {
+		t.Errorf("expected old file to be moved, got %v", err)
+	}
+}
+
+func TestFileService_UpdateResourceRacingDelete(t *testing.T) {
+	dataDir := t.TempDir()
+	cfg := &config.Config{DataPath: dataDir, UploadPath: filepath.Join(dataDir, "upload")}
+	rs, key := initTrashTest(t, cfg)
+
+	// an update that read the resource before it was deleted
+	fileUUID := saveTestFile(t, rs, &Resource{Name: "a.txt", APIKeyUUID: key.UUID}, "test")
+	stale, err := rs.GetResourceByUUID(fileUUID)
+	if err != nil {
+		t.Fatalf("Error loading resource: %v", err)
+	}
+	if err := rs.DeleteResourceByUUID(fileUUID, key.UUID); err != nil {
+		t.Fatalf("Error deleting resource: %v", err)
+	}
+	stale.IsPrivate = true
+	if err := rs.saveResourceSettings(stale); err != apperror.ErrResourceNotFound {
+		t.Errorf("expected %v, got %v", apperror.ErrResourceNotFound, err)
+	}
+	if r, err := rs.GetResourceByUUID(fileUUID); err != nil || r.DeletedAt == nil || r.IsPrivate {
+		t.Errorf("expected resource to stay deleted and unchanged, got %+v (%v)", r, err)
+	}
+
+	// concurrent requests
+	yes := true
+	for i := 0; i < 20; i++ {
+		fileUUID := saveTestFile(t, rs, &Resource{Name: fmt.Sprintf("race%d.txt", i), APIKeyUUID: key.UUID}, "test")
+		name := fmt.Sprintf("renamed%d.txt", i)
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, _ = rs.UpdateResource(fileUUID, key.UUID, ResourceUpdate{Name: &name, IsPrivate: &yes})
+		}()
+		go func() {
+			defer wg.Done()
+			if err := rs.DeleteResourceByUUID(fileUUID, key.UUID); err != nil {
+				t.Errorf("Error deleting resource: %v", err)
+			}
+		}()
+		wg.Wait()
+
+		r, err := rs.GetResourceByUUID(fileUUID)
+		if err != nil || r.DeletedAt == nil {
+			t.Fatalf("expected resource to stay deleted, got %+v (%v)", r, err)
+		}
+	}
+}
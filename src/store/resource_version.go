@@ -0,0 +1,181 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/twigman/fshare/src/internal/apperror"
+	"github.com/twigman/fshare/src/storage"
+)
+
+// SaveStagedFileAsVersion saves a staged upload like SaveStagedFile, but if a file with the same name exists in the
+// parent, its content is replaced and the previous content is kept as older version. The file keeps its UUID,
+// so existing links serve the new content. Settings of r are only used for new files; r is set to the saved file.
+// The temp file is removed if that fails.
+func (s *ResourceService) SaveStagedFileAsVersion(f *StagedFile, r *Resource) (string, error) {
+	if err := s.prepareFile(r); err != nil {
+		f.Remove()
+		return "", err
+	}
+
+	fileUUID, err := s.commitVersion(f.Path, r, f.Size, f.SHA256)
+	if err != nil {
+		f.Remove()
+		return "", err
+	}
+	return fileUUID, nil
+}
+
+// commitVersion moves a completely written file into the blob store and saves it as new version of the file with
+// the same name, or as new file if there is none
+func (s *ResourceService) commitVersion(srcPath string, r *Resource, size int64, sha256 string) (string, error) {
+	s.quotaMu.Lock()
+	defer s.quotaMu.Unlock()
+
+	existing, err := s.db.findActiveChild(r.Name, r.APIKeyUUID, r.ParentUUID)
+	if err != nil {
+		return "", err
+	}
+	if existing == nil {
+		return s.insertFile(srcPath, r, size, sha256)
+	}
+	if !existing.IsFile {
+		return "", apperror.ErrVersioningNotAFile
+	}
+	if existing.BlobSHA256 == nil {
+		// stored by an older version under its name and could not be migrated into the blob store
+		return "", apperror.ErrFileAlreadyExists
+	}
+
+	// the previous content stays stored as version
+	if err := s.checkSpace(r.APIKeyUUID, size); err != nil {
+		return "", err
+	}
+
+	maxVersions, err := s.maxVersions(r.APIKeyUUID)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	err = s.storeBlob(srcPath, sha256, func() error {
+		unreferenced, err := s.db.addResourceVersion(existing.UUID, existing.Version, sha256, size, now, maxVersions)
+		if err != nil {
+			return err
+		}
+		// the new version is saved, failing to unlink trimmed versions only leaves unused blobs behind
+		if err := s.removeBlobs(unreferenced); err != nil {
+			log.Printf("Could not remove blobs of trimmed versions of %s: %v", existing.UUID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// deleted or replaced meanwhile
+			return "", apperror.ErrResourceNotFound
+		}
+		return "", err
+	}
+
+	updated, err := s.db.findResourceByUUID(existing.UUID)
+	if err != nil {
+		return "", err
+	}
+	if updated == nil {
+		return "", fmt.Errorf("file %s not found after saving a new version", existing.UUID)
+	}
+	*r = *updated
+	return updated.UUID, nil
+}
+
+// maxVersions returns how many older versions are kept per file of an API key (0 = no limit)
+func (s *ResourceService) maxVersions(keyUUID string) (int64, error) {
+	key, err := s.db.findAPIKeyByUUID(keyUUID)
+	if err != nil {
+		return 0, err
+	}
+	if key == nil {
+		return 0, fmt.Errorf("API key does not exist")
+	}
+
+	if key.MaxVersions != nil {
+		return *key.MaxVersions, nil
+	}
+	return s.cfg.MaxVersionsPerFile, nil
+}
+
+// getVersionedFile returns an undeleted file of an API key
+func (s *ResourceService) getVersionedFile(rUUID string, keyUUID string) (*Resource, error) {
+	res, err := s.GetResourceByUUID(rUUID)
+	if err != nil {
+		return nil, err
+	}
+	if res.APIKeyUUID != keyUUID {
+		return nil, apperror.ErrAuthorization
+	}
+	if res.DeletedAt != nil || !res.IsFile {
+		return nil, apperror.ErrResourceNotFound
+	}
+	return res, nil
+}
+
+// ListVersions returns a file of the API key and its older versions, newest first
+func (s *ResourceService) ListVersions(rUUID string, keyUUID string) (*Resource, []*ResourceVersion, error) {
+	res, err := s.getVersionedFile(rUUID, keyUUID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	versions, err := s.db.findResourceVersions(res.UUID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return res, versions, nil
+}
+
+// GetVersion returns a file of the API key and the given version of its content.
+// For the current version, the returned version is built from the file.
+func (s *ResourceService) GetVersion(rUUID string, keyUUID string, version int64) (*Resource, *ResourceVersion, error) {
+	res, err := s.getVersionedFile(rUUID, keyUUID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if version == res.Version {
+		return res, CurrentVersion(res), nil
+	}
+
+	v, err := s.db.findResourceVersion(res.UUID, version)
+	if err != nil {
+		return nil, nil, err
+	}
+	if v == nil {
+		return nil, nil, apperror.ErrVersionNotFound
+	}
+	return res, v, nil
+}
+
+// CurrentVersion describes the current content of a file as version
+func CurrentVersion(r *Resource) *ResourceVersion {
+	v := &ResourceVersion{ResourceUUID: r.UUID, Version: r.Version, SHA256: r.SHA256, Size: r.Size, CreatedAt: r.CreatedAt}
+	if r.UpdatedAt != nil {
+		v.CreatedAt = *r.UpdatedAt
+	}
+	return v
+}
+
+// OpenResourceVersion opens the content of a version for reading
+func (s *ResourceService) OpenResourceVersion(r *Resource, v *ResourceVersion) (*storage.Object, error) {
+	if v.Version == r.Version {
+		return s.OpenResource(r)
+	}
+
+	key, err := blobKey(v.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	return storage.Open(s.storage, key)
+}
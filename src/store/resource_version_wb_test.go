@@ -0,0 +1,229 @@
+package store
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/twigman/fshare/src/config"
+	"github.com/twigman/fshare/src/internal/apperror"
+)
+
+func saveTestVersion(t *testing.T, rs *ResourceService, r *Resource, content string) string {
+	t.Helper()
+	staged, err := rs.StageUpload(r.APIKeyUUID, bytes.NewReader([]byte(content)), 0)
+	if err != nil {
+		t.Fatalf("Error staging file: %v", err)
+	}
+	u, err := rs.SaveStagedFileAsVersion(staged, r)
+	if err != nil {
+		t.Fatalf("Error saving version: %v", err)
+	}
+	return u
+}
+
+func sha256Hex(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func readTestVersion(t *testing.T, rs *ResourceService, rUUID string, keyUUID string, version int64) string {
+	t.Helper()
+	res, v, err := rs.GetVersion(rUUID, keyUUID, version)
+	if err != nil {
+		t.Fatalf("Error loading version %d: %v", version, err)
+	}
+	obj, err := rs.OpenResourceVersion(res, v)
+	if err != nil {
+		t.Fatalf("Error opening version %d: %v", version, err)
+	}
+	defer obj.Close()
+	data, err := io.ReadAll(obj)
+	if err != nil {
+		t.Fatalf("Error reading version %d: %v", version, err)
+	}
+	return string(data)
+}
+
+func TestVersioning_ReuploadKeepsUUID(t *testing.T) {
+	dataDir := t.TempDir()
+	cfg := &config.Config{DataPath: dataDir, UploadPath: filepath.Join(dataDir, "upload")}
+	rs, key := initTrashTest(t, cfg)
+
+	fileUUID := saveTestVersion(t, rs, &Resource{Name: "report.pdf", APIKeyUUID: key.UUID}, "v1")
+
+	// settings of a new version are ignored, the file keeps its own
+	r := &Resource{Name: "report.pdf", APIKeyUUID: key.UUID, IsPrivate: true}
+	if u := saveTestVersion(t, rs, r, "version 2"); u != fileUUID {
+		t.Fatalf("expected the same UUID %s, got %s", fileUUID, u)
+	}
+	if r.UUID != fileUUID || r.Version != 2 || r.Size != 9 || r.IsPrivate || r.UpdatedAt == nil {
+		t.Errorf("unexpected resource after the new version: %+v", r)
+	}
+
+	res, err := rs.GetResourceByUUID(fileUUID)
+	if err != nil {
+		t.Fatalf("Error loading resource: %v", err)
+	}
+	obj, err := rs.OpenResource(res)
+	if err != nil {
+		t.Fatalf("Error opening file: %v", err)
+	}
+	data, _ := io.ReadAll(obj)
+	obj.Close()
+	if string(data) != "version 2" {
+		t.Errorf("expected the latest content, got %q", data)
+	}
+
+	_, versions, err := rs.ListVersions(fileUUID, key.UUID)
+	if err != nil {
+		t.Fatalf("Error listing versions: %v", err)
+	}
+	if len(versions) != 1 || versions[0].Version != 1 || versions[0].Size != 2 {
+		t.Fatalf("unexpected versions: %+v", versions)
+	}
+	if got := readTestVersion(t, rs, fileUUID, key.UUID, 1); got != "v1" {
+		t.Errorf("expected content of version 1, got %q", got)
+	}
+	if got := readTestVersion(t, rs, fileUUID, key.UUID, 2); got != "version 2" {
+		t.Errorf("expected content of version 2, got %q", got)
+	}
+
+	// older versions count towards the quota
+	used, err := rs.GetUsedSpace(key.UUID)
+	if err != nil {
+		t.Fatalf("Error reading used space: %v", err)
+	}
+	if used != 11 {
+		t.Errorf("expected 11 used bytes, got %d", used)
+	}
+
+	if _, _, err := rs.GetVersion(fileUUID, key.UUID, 5); err != apperror.ErrVersionNotFound {
+		t.Errorf("expected ErrVersionNotFound, got %v", err)
+	}
+	if _, _, err := rs.ListVersions(fileUUID, "other"); err != apperror.ErrAuthorization {
+		t.Errorf("expected ErrAuthorization, got %v", err)
+	}
+}
+
+func TestVersioning_RestoreWithVersionsKeepsQuota(t *testing.T) {
+	dataDir := t.TempDir()
+	cfg := &config.Config{DataPath: dataDir, UploadPath: filepath.Join(dataDir, "upload"), SpacePerUserInMB: 1}
+	rs, key := initTrashTest(t, cfg)
+
+	part := strings.Repeat("x", 300<<10)
+	fileUUID := saveTestVersion(t, rs, &Resource{Name: "report.pdf", APIKeyUUID: key.UUID}, part+"1")
+	saveTestVersion(t, rs, &Resource{Name: "report.pdf", APIKeyUUID: key.UUID}, part+"2")
+	if err := rs.DeleteResourceByUUID(fileUUID, key.UUID); err != nil {
+		t.Fatalf("Error deleting file: %v", err)
+	}
+
+	// the versions of the trashed file still count, so their space can not be used by other files
+	want := int64(2 * (len(part) + 1))
+	if used, err := rs.GetUsedSpace(key.UUID); err != nil || used != want {
+		t.Fatalf("expected %d used bytes, got %d (%v)", want, used, err)
+	}
+	if _, err := rs.SaveUploadedFile(bytes.NewReader([]byte(part+part)), &Resource{Name: "other.bin", APIKeyUUID: key.UUID}, false); err != apperror.ErrInsufficientStorage {
+		t.Fatalf("expected ErrInsufficientStorage, got %v", err)
+	}
+
+	// restoring the file with its versions can not exceed the quota
+	if _, err := rs.RestoreResource(fileUUID, key.UUID); err != nil {
+		t.Fatalf("Error restoring file: %v", err)
+	}
+	if used, err := rs.GetUsedSpace(key.UUID); err != nil || used != want {
+		t.Errorf("expected %d used bytes after the restore, got %d (%v)", want, used, err)
+	}
+	if _, versions, err := rs.ListVersions(fileUUID, key.UUID); err != nil || len(versions) != 1 {
+		t.Errorf("expected the version to be restored, got %+v (%v)", versions, err)
+	}
+}
+
+func TestVersioning_MaxVersions(t *testing.T) {
+	dataDir := t.TempDir()
+	cfg := &config.Config{DataPath: dataDir, UploadPath: filepath.Join(dataDir, "upload"), MaxVersionsPerFile: 5}
+	rs, key := initTrashTest(t, cfg)
+
+	// the key overrides the config
+	maxVersions := int64(2)
+	if err := rs.db.updateAPIKeyMaxVersions(key.UUID, &maxVersions); err != nil {
+		t.Fatalf("Error setting max versions: %v", err)
+	}
+
+	var fileUUID string
+	for _, content := range []string{"one", "two", "three", "four"} {
+		fileUUID = saveTestVersion(t, rs, &Resource{Name: "a.txt", APIKeyUUID: key.UUID}, content)
+	}
+
+	_, versions, err := rs.ListVersions(fileUUID, key.UUID)
+	if err != nil {
+		t.Fatalf("Error listing versions: %v", err)
+	}
+	if len(versions) != 2 || versions[0].Version != 3 || versions[1].Version != 2 {
+		t.Fatalf("expected versions 3 and 2, got %+v", versions)
+	}
+
+	// the blob of the trimmed version is gone
+	first, err := rs.db.findBlobRefCount(sha256Hex("one"))
+	if err != nil {
+		t.Fatalf("Error reading ref count: %v", err)
+	}
+	if first != 0 {
+		t.Errorf("expected the blob of version 1 to be released, got ref count %d", first)
+	}
+}
+
+func TestVersioning_FolderConflict(t *testing.T) {
+	dataDir := t.TempDir()
+	cfg := &config.Config{DataPath: dataDir, UploadPath: filepath.Join(dataDir, "upload")}
+	rs, key := initTrashTest(t, cfg)
+
+	if _, err := rs.CreateFolder(&Resource{Name: "docs", APIKeyUUID: key.UUID}); err != nil {
+		t.Fatalf("Error creating folder: %v", err)
+	}
+
+	staged, err := rs.StageUpload(key.UUID, bytes.NewReader([]byte("data")), 0)
+	if err != nil {
+		t.Fatalf("Error staging file: %v", err)
+	}
+	if _, err := rs.SaveStagedFileAsVersion(staged, &Resource{Name: "docs", APIKeyUUID: key.UUID}); err != apperror.ErrVersioningNotAFile {
+		t.Errorf("expected ErrVersioningNotAFile, got %v", err)
+	}
+}
+
+func TestVersioning_PurgeReleasesVersions(t *testing.T) {
+	dataDir := t.TempDir()
+	cfg := &config.Config{DataPath: dataDir, UploadPath: filepath.Join(dataDir, "upload")}
+	rs, key := initTrashTest(t, cfg)
+
+	saveTestVersion(t, rs, &Resource{Name: "a.txt", APIKeyUUID: key.UUID}, "old")
+	fileUUID := saveTestVersion(t, rs, &Resource{Name: "a.txt", APIKeyUUID: key.UUID}, "new")
+
+	// trashed files keep their versions
+	if err := rs.DeleteResourceByUUID(fileUUID, key.UUID); err != nil {
+		t.Fatalf("Error deleting file: %v", err)
+	}
+	if count, _ := rs.db.findBlobRefCount(sha256Hex("old")); count != 1 {
+		t.Errorf("expected the old version to be kept in the trash, got ref count %d", count)
+	}
+
+	if err := rs.PurgeResourceByUUID(fileUUID, key.UUID); err != nil {
+		t.Fatalf("Error purging file: %v", err)
+	}
+	for _, content := range []string{"old", "new"} {
+		if count, _ := rs.db.findBlobRefCount(sha256Hex(content)); count != 0 {
+			t.Errorf("expected blob of %q to be released, got ref count %d", content, count)
+		}
+	}
+	versions, err := rs.db.findResourceVersions(fileUUID)
+	if err != nil {
+		t.Fatalf("Error listing versions: %v", err)
+	}
+	if len(versions) != 0 {
+		t.Errorf("expected no versions after the purge, got %+v", versions)
+	}
+}
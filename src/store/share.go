@@ -0,0 +1,137 @@
+package store
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/twigman/fshare/src/internal/apperror"
+)
+
+// shareTokenBytes is the amount of randomness in a share token
+const shareTokenBytes = 24
+
+func newShareToken() (string, error) {
+	b := make([]byte, shareTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// getOwnedFile returns an undeleted file of an API key
+func (s *ResourceService) getOwnedFile(rUUID string, keyUUID string) (*Resource, error) {
+	res, err := s.GetResourceByUUID(rUUID)
+	if err != nil {
+		return nil, err
+	}
+	if res.APIKeyUUID != keyUUID {
+		return nil, apperror.ErrAuthorization
+	}
+	if res.DeletedAt != nil {
+		return nil, apperror.ErrResourceNotFound
+	}
+	if !res.IsFile {
+		return nil, apperror.ErrShareNotAFile
+	}
+	return res, nil
+}
+
+// CreateShare adds a share link to a file of the API key. Token and creation time are set on sh.
+func (s *ResourceService) CreateShare(sh *Share, keyUUID string) error {
+	res, err := s.getOwnedFile(sh.ResourceUUID, keyUUID)
+	if err != nil {
+		return err
+	}
+	// downloads through a share are not counted for the file, a burn after read file would stay readable
+	if res.MaxDownloads != nil {
+		return apperror.ErrShareLimitedFile
+	}
+	if sh.MaxDownloads != nil && *sh.MaxDownloads <= 0 {
+		return apperror.ErrInvalidMaxDownloads
+	}
+
+	now := time.Now().UTC()
+	if sh.ExpiresAt != nil {
+		if !sh.ExpiresAt.After(now) {
+			return apperror.ErrInvalidShareExpiry
+		}
+		t := sh.ExpiresAt.UTC()
+		sh.ExpiresAt = &t
+	}
+
+	token, err := newShareToken()
+	if err != nil {
+		return fmt.Errorf("token generation error: %v", err)
+	}
+	sh.Token = token
+	sh.DownloadCount = 0
+	sh.CreatedAt = now
+	sh.RevokedAt = nil
+
+	return s.db.insertShare(sh)
+}
+
+// ListShares returns all shares of a file of the API key including revoked ones
+func (s *ResourceService) ListShares(rUUID string, keyUUID string) ([]*Share, error) {
+	if _, err := s.getOwnedFile(rUUID, keyUUID); err != nil {
+		return nil, err
+	}
+	return s.db.findSharesByResource(rUUID)
+}
+
+// RevokeShare disables a share of a file of the API key
+func (s *ResourceService) RevokeShare(rUUID string, token string, keyUUID string) error {
+	res, err := s.GetResourceByUUID(rUUID)
+	if err != nil {
+		return err
+	}
+	if res.APIKeyUUID != keyUUID {
+		return apperror.ErrAuthorization
+	}
+
+	sh, err := s.db.findShareByToken(token)
+	if err != nil {
+		return err
+	}
+	if sh == nil || sh.ResourceUUID != rUUID {
+		return apperror.ErrShareNotFound
+	}
+	return s.db.updateShareRevokedAt(token, time.Now().UTC())
+}
+
+// GetActiveShare returns an active share and its file. ErrShareNotFound is returned if the share
+// does not exist, is not active anymore or its file is gone.
+func (s *ResourceService) GetActiveShare(token string) (*Share, *Resource, error) {
+	sh, err := s.db.findShareByToken(token)
+	if err != nil {
+		return nil, nil, err
+	}
+	if sh == nil || !sh.IsActive(time.Now()) {
+		return nil, nil, apperror.ErrShareNotFound
+	}
+
+	res, err := s.db.findResourceByUUID(sh.ResourceUUID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if res == nil || res.DeletedAt != nil || res.IsBroken || res.MaxDownloads != nil {
+		return nil, nil, apperror.ErrShareNotFound
+	}
+	return sh, res, nil
+}
+
+// CountShareDownload atomically counts a view or download through a share.
+// ErrDownloadLimitReached is returned if the share was used up or revoked in the meantime.
+func (s *ResourceService) CountShareDownload(sh *Share) error {
+	ok, err := s.db.incrementShareDownloadCount(sh.Token)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return apperror.ErrDownloadLimitReached
+	}
+	sh.DownloadCount++
+	return nil
+}
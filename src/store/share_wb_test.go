@@ -0,0 +1,111 @@
+package store
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/twigman/fshare/src/config"
+	"github.com/twigman/fshare/src/internal/apperror"
+)
+
+func TestShares(t *testing.T) {
+	dataDir := t.TempDir()
+	cfg := &config.Config{
+		DataPath:   dataDir,
+		UploadPath: filepath.Join(dataDir, "upload"),
+	}
+
+	rs, key, err := initServices(cfg)
+	if err != nil {
+		t.Fatalf("Error initializing test services: %v", err)
+	}
+	if err := CreateDirsFromConfig(cfg); err != nil {
+		t.Fatalf("Error creating app dirs: %v", err)
+	}
+	home, err := rs.GetOrCreateHomeDir(key.HashedKey)
+	if err != nil {
+		t.Fatalf("Error creating home dir: %v", err)
+	}
+
+	fileUUID, err := rs.SaveUploadedFile(bytes.NewReader([]byte("test")), &Resource{Name: "a.txt", APIKeyUUID: key.UUID, IsPrivate: true}, false)
+	if err != nil {
+		t.Fatalf("Error saving file: %v", err)
+	}
+
+	// invalid shares
+	if err := rs.CreateShare(&Share{ResourceUUID: fileUUID}, "other"); err != apperror.ErrAuthorization {
+		t.Errorf("expected ErrAuthorization, got %v", err)
+	}
+	if err := rs.CreateShare(&Share{ResourceUUID: home.UUID}, key.UUID); err != apperror.ErrShareNotAFile {
+		t.Errorf("expected ErrShareNotAFile, got %v", err)
+	}
+	past := time.Now().Add(-time.Minute)
+	if err := rs.CreateShare(&Share{ResourceUUID: fileUUID, ExpiresAt: &past}, key.UUID); err != apperror.ErrInvalidShareExpiry {
+		t.Errorf("expected ErrInvalidShareExpiry, got %v", err)
+	}
+
+	one := int64(1)
+	limited := &Share{ResourceUUID: fileUUID, Label: "alice", MaxDownloads: &one}
+	if err := rs.CreateShare(limited, key.UUID); err != nil {
+		t.Fatalf("Error creating share: %v", err)
+	}
+	unlimited := &Share{ResourceUUID: fileUUID, Label: "bob"}
+	if err := rs.CreateShare(unlimited, key.UUID); err != nil {
+		t.Fatalf("Error creating share: %v", err)
+	}
+	if limited.Token == "" || limited.Token == unlimited.Token {
+		t.Fatalf("expected distinct tokens, got %q and %q", limited.Token, unlimited.Token)
+	}
+
+	sh, res, err := rs.GetActiveShare(limited.Token)
+	if err != nil || res.UUID != fileUUID || sh.Label != "alice" {
+		t.Fatalf("unexpected share %+v, %+v, %v", sh, res, err)
+	}
+
+	// used up
+	if err := rs.CountShareDownload(sh); err != nil {
+		t.Fatalf("Error counting download: %v", err)
+	}
+	if err := rs.CountShareDownload(sh); err != apperror.ErrDownloadLimitReached {
+		t.Errorf("expected ErrDownloadLimitReached, got %v", err)
+	}
+	if _, _, err := rs.GetActiveShare(limited.Token); err != apperror.ErrShareNotFound {
+		t.Errorf("expected used up share to be inactive, got %v", err)
+	}
+
+	// revoked
+	if err := rs.RevokeShare(fileUUID, unlimited.Token, "other"); err != apperror.ErrAuthorization {
+		t.Errorf("expected ErrAuthorization, got %v", err)
+	}
+	if err := rs.RevokeShare(fileUUID, "unknown", key.UUID); err != apperror.ErrShareNotFound {
+		t.Errorf("expected ErrShareNotFound, got %v", err)
+	}
+	if err := rs.RevokeShare(fileUUID, unlimited.Token, key.UUID); err != nil {
+		t.Fatalf("Error revoking share: %v", err)
+	}
+	if _, _, err := rs.GetActiveShare(unlimited.Token); err != apperror.ErrShareNotFound {
+		t.Errorf("expected revoked share to be inactive, got %v", err)
+	}
+
+	shares, err := rs.ListShares(fileUUID, key.UUID)
+	if err != nil {
+		t.Fatalf("Error listing shares: %v", err)
+	}
+	if len(shares) != 2 || shares[0].DownloadCount != 1 || shares[1].RevokedAt == nil {
+		t.Errorf("unexpected shares: %+v, %+v", shares[0], shares[1])
+	}
+
+	// shares end with their file
+	third := &Share{ResourceUUID: fileUUID}
+	if err := rs.CreateShare(third, key.UUID); err != nil {
+		t.Fatalf("Error creating share: %v", err)
+	}
+	if err := rs.DeleteResourceByUUID(fileUUID, key.UUID); err != nil {
+		t.Fatalf("Error deleting file: %v", err)
+	}
+	if _, _, err := rs.GetActiveShare(third.Token); err != apperror.ErrShareNotFound {
+		t.Errorf("expected share of deleted file to be inactive, got %v", err)
+	}
+}
@@ -44,6 +44,10 @@ func (s *SQLite) init() error {
 		is_highly_trusted BOOLEAN,
 		created_at DATETIME,
 		created_by TEXT,
+		space_limit_in_mb INTEGER,
+		expires_at DATETIME,
+		revoked_at DATETIME,
+		max_versions INTEGER,
 		FOREIGN KEY (created_by) REFERENCES api_key(uuid) ON DELETE SET NULL
 	);
 
@@ -58,54 +62,775 @@ func (s *SQLite) init() error {
 		created_at DATETIME,
 		deleted_at DATETIME,
 		is_broken BOOLEAN,
+		size INTEGER NOT NULL DEFAULT 0,
+		sha256 TEXT NOT NULL DEFAULT '',
+		blob_sha256 TEXT,
+		password_hash TEXT,
+		max_downloads INTEGER,
+		download_count INTEGER NOT NULL DEFAULT 0,
+		in_trash BOOLEAN NOT NULL DEFAULT 0,
+		version INTEGER NOT NULL DEFAULT 1,
+		updated_at DATETIME,
 		FOREIGN KEY (api_key_uuid) REFERENCES api_key(uuid) ON DELETE CASCADE,
 		FOREIGN KEY (parent_uuid) REFERENCES resource(uuid) ON DELETE SET NULL
 	);
+
+	CREATE TABLE IF NOT EXISTS blob (
+		sha256 TEXT PRIMARY KEY,
+		size INTEGER NOT NULL,
+		ref_count INTEGER NOT NULL,
+		created_at DATETIME
+	);
+
+	CREATE TABLE IF NOT EXISTS upload_session (
+		id TEXT PRIMARY KEY,
+		api_key_uuid TEXT,
+		name TEXT,
+		is_private BOOLEAN,
+		parent_uuid TEXT,
+		autodelete_in_sec INTEGER,
+		upload_length INTEGER NOT NULL,
+		upload_offset INTEGER NOT NULL DEFAULT 0,
+		metadata TEXT NOT NULL DEFAULT '',
+		resource_uuid TEXT,
+		created_at DATETIME,
+		expires_at DATETIME,
+		max_downloads INTEGER,
+		versioning BOOLEAN NOT NULL DEFAULT 0,
+		FOREIGN KEY (api_key_uuid) REFERENCES api_key(uuid) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS resource_version (
+		resource_uuid TEXT NOT NULL,
+		version INTEGER NOT NULL,
+		sha256 TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		created_at DATETIME,
+		PRIMARY KEY (resource_uuid, version),
+		FOREIGN KEY (resource_uuid) REFERENCES resource(uuid) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS share (
+		token TEXT PRIMARY KEY,
+		resource_uuid TEXT NOT NULL,
+		label TEXT NOT NULL DEFAULT '',
+		password_hash TEXT,
+		max_downloads INTEGER,
+		download_count INTEGER NOT NULL DEFAULT 0,
+		expires_at DATETIME,
+		created_at DATETIME,
+		revoked_at DATETIME,
+		FOREIGN KEY (resource_uuid) REFERENCES resource(uuid) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_share_resource ON share(resource_uuid);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// columns added after the initial release
+	if err := s.addColumnIfNotExists("resource", "size", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfNotExists("api_key", "space_limit_in_mb", "INTEGER"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfNotExists("resource", "sha256", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfNotExists("api_key", "expires_at", "DATETIME"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfNotExists("api_key", "revoked_at", "DATETIME"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfNotExists("resource", "blob_sha256", "TEXT"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfNotExists("resource", "password_hash", "TEXT"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfNotExists("resource", "max_downloads", "INTEGER"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfNotExists("resource", "download_count", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfNotExists("upload_session", "max_downloads", "INTEGER"); err != nil {
+		return err
+	}
+	// resources deleted by older versions are already purged
+	if err := s.addColumnIfNotExists("resource", "in_trash", "BOOLEAN NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfNotExists("resource", "version", "INTEGER NOT NULL DEFAULT 1"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfNotExists("resource", "updated_at", "DATETIME"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfNotExists("api_key", "max_versions", "INTEGER"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfNotExists("upload_session", "versioning", "BOOLEAN NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_unique_active_resource
+		ON resource(name, parent_uuid, api_key_uuid)
+		WHERE deleted_at IS NULL;
 	`)
+	return err
+}
+
+// addColumnIfNotExists adds a column to an existing table (migration for databases created by older versions)
+func (s *SQLite) addColumnIfNotExists(table string, column string, definition string) error {
+	rows, err := s.db.Query(fmt.Sprintf(`PRAGMA table_info(%s)`, table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   bool
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, definition))
+	return err
+}
+
+// resourceColumns lists all columns of table resource in the order expected by scanResource
+const resourceColumns = `uuid, name, is_private, is_file, parent_uuid, api_key_uuid, autodelete_at, created_at, deleted_at, is_broken, size, sha256, blob_sha256, password_hash, max_downloads, download_count, in_trash, version, updated_at`
+
+// resourcePlaceholders has one placeholder per column in resourceColumns
+const resourcePlaceholders = `?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?`
+
+// apiKeyColumns lists all columns of table api_key in the order expected by scanAPIKey
+const apiKeyColumns = `uuid, hashed_key, comment, is_highly_trusted, created_at, created_by, space_limit_in_mb, expires_at, revoked_at, max_versions`
+
+// shareColumns lists all columns of table share in the order expected by scanShare
+const shareColumns = `token, resource_uuid, label, password_hash, max_downloads, download_count, expires_at, created_at, revoked_at`
+
+// uploadSessionColumns lists all columns of table upload_session in the order expected by scanUploadSession
+const uploadSessionColumns = `id, api_key_uuid, name, is_private, parent_uuid, autodelete_in_sec, upload_length, upload_offset, metadata, resource_uuid, created_at, expires_at, max_downloads, versioning`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanResource(row rowScanner) (*Resource, error) {
+	var r Resource
+	if err := row.Scan(&r.UUID, &r.Name, &r.IsPrivate, &r.IsFile, &r.ParentUUID, &r.APIKeyUUID,
+		&r.AutoDeleteAt, &r.CreatedAt, &r.DeletedAt, &r.IsBroken, &r.Size, &r.SHA256, &r.BlobSHA256,
+		&r.PasswordHash, &r.MaxDownloads, &r.DownloadCount, &r.InTrash, &r.Version, &r.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func scanAPIKey(row rowScanner) (*APIKey, error) {
+	var k APIKey
+	if err := row.Scan(&k.UUID, &k.HashedKey, &k.Comment, &k.IsHighlyTrusted, &k.CreatedAt, &k.CreatedBy, &k.SpaceLimitInMB,
+		&k.ExpiresAt, &k.RevokedAt, &k.MaxVersions); err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+func scanShare(row rowScanner) (*Share, error) {
+	var sh Share
+	if err := row.Scan(&sh.Token, &sh.ResourceUUID, &sh.Label, &sh.PasswordHash, &sh.MaxDownloads, &sh.DownloadCount,
+		&sh.ExpiresAt, &sh.CreatedAt, &sh.RevokedAt); err != nil {
+		return nil, err
+	}
+	return &sh, nil
+}
+
+func scanUploadSession(row rowScanner) (*UploadSession, error) {
+	var u UploadSession
+	if err := row.Scan(&u.ID, &u.APIKeyUUID, &u.Name, &u.IsPrivate, &u.ParentUUID, &u.AutoDeleteInSec, &u.Length, &u.Offset,
+		&u.Metadata, &u.ResourceUUID, &u.CreatedAt, &u.ExpiresAt, &u.MaxDownloads, &u.Versioning); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// scanResources reads all resources of a query result
+func scanResources(rows *sql.Rows) ([]*Resource, error) {
+	defer rows.Close()
+
+	var resources []*Resource
+	for rows.Next() {
+		r, err := scanResource(rows)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return resources, nil
+}
+
+// resourceValues returns the values of a resource in the order of resourceColumns
+func resourceValues(r *Resource) []any {
+	return []any{r.UUID, r.Name, r.IsPrivate, r.IsFile, r.ParentUUID, r.APIKeyUUID, r.AutoDeleteAt, r.CreatedAt, r.DeletedAt,
+		r.IsBroken, r.Size, r.SHA256, r.BlobSHA256, r.PasswordHash, r.MaxDownloads, r.DownloadCount, r.InTrash, r.Version, r.UpdatedAt}
+}
+
+// insertResource saves a resource
+func (s *SQLite) insertResource(r *Resource) error {
+	_, err := s.db.Exec(`
+		INSERT INTO resource (`+resourceColumns+`) VALUES (`+resourcePlaceholders+`)
+	`, resourceValues(r)...)
+
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// insertFileResource saves a file and adds a reference to its blob in one transaction
+func (s *SQLite) insertFileResource(r *Resource) error {
+	if r.BlobSHA256 == nil {
+		return fmt.Errorf("file %s does not reference a blob", r.UUID)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := addBlobReference(tx, *r.BlobSHA256, r.Size); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO resource (`+resourceColumns+`) VALUES (`+resourcePlaceholders+`)
+	`, resourceValues(r)...)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// addBlobReference creates a blob entry or increments its reference count
+func addBlobReference(tx *sql.Tx, sha256 string, size int64) error {
+	_, err := tx.Exec(`
+		INSERT INTO blob (sha256, size, ref_count, created_at) VALUES (?, ?, 1, ?)
+		ON CONFLICT(sha256) DO UPDATE SET ref_count = ref_count + 1
+	`, sha256, size, time.Now().UTC())
+	return err
+}
+
+// markResourceAsDeleted soft-deletes a resource and releases the blob references of its content and older versions.
+// Blobs that are not referenced anymore are removed from table blob and their hashes returned, so the content can be deleted.
+func (s *SQLite) markResourceAsDeleted(uuid string, deletedAt time.Time) ([]string, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var blobSHA256 sql.NullString
+	err = tx.QueryRow(`SELECT blob_sha256 FROM resource WHERE uuid = ? AND deleted_at IS NULL`, uuid).Scan(&blobSHA256)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// already deleted
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`UPDATE resource SET deleted_at = ? WHERE uuid = ?`, deletedAt, uuid); err != nil {
+		return nil, err
+	}
+
+	unreferenced, err := releaseResourceBlobs(tx, uuid, blobSHA256)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return unreferenced, nil
+}
+
+// releaseResourceBlobs releases the blob of the current content and removes all older versions of a resource.
+// It returns the hashes of blobs that are not referenced anymore.
+func releaseResourceBlobs(tx *sql.Tx, uuid string, blobSHA256 sql.NullString) ([]string, error) {
+	var sums []string
+	if blobSHA256.Valid {
+		sums = append(sums, blobSHA256.String)
+	}
+
+	versionSums, err := deleteResourceVersions(tx, `DELETE FROM resource_version WHERE resource_uuid = ? RETURNING sha256`, uuid)
+	if err != nil {
+		return nil, err
+	}
+	return releaseBlobReferences(tx, append(sums, versionSums...))
+}
+
+// releaseBlobReferences releases one reference per hash and returns the hashes of blobs that are not referenced anymore
+func releaseBlobReferences(tx *sql.Tx, sums []string) ([]string, error) {
+	var unreferenced []string
+	for _, sum := range sums {
+		u, err := releaseBlobReference(tx, sum)
+		if err != nil {
+			return nil, err
+		}
+		if u != "" {
+			unreferenced = append(unreferenced, u)
+		}
+	}
+	return unreferenced, nil
+}
+
+// deleteResourceVersions runs a DELETE on table resource_version returning sha256 and collects the blob hashes of the removed versions
+func deleteResourceVersions(tx *sql.Tx, query string, args ...any) ([]string, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sums []string
+	for rows.Next() {
+		var sum string
+		if err := rows.Scan(&sum); err != nil {
+			return nil, err
+		}
+		sums = append(sums, sum)
+	}
+	return sums, rows.Err()
+}
+
+// releaseBlobReference decrements the reference count of a blob. If the blob is not referenced anymore,
+// its entry is removed and its hash returned.
+func releaseBlobReference(tx *sql.Tx, sha256 string) (string, error) {
+	if _, err := tx.Exec(`UPDATE blob SET ref_count = ref_count - 1 WHERE sha256 = ?`, sha256); err != nil {
+		return "", err
+	}
+
+	res, err := tx.Exec(`DELETE FROM blob WHERE sha256 = ? AND ref_count <= 0`, sha256)
+	if err != nil {
+		return "", err
+	}
+	if n, err := res.RowsAffected(); err == nil && n > 0 {
+		return sha256, nil
+	}
+	return "", nil
+}
+
+// moveResourceToTrash soft-deletes a resource but keeps its blob reference, so it can be restored
+func (s *SQLite) moveResourceToTrash(uuid string, deletedAt time.Time) error {
+	_, err := s.db.Exec(`UPDATE resource SET deleted_at = ?, in_trash = 1 WHERE uuid = ? AND deleted_at IS NULL`, deletedAt, uuid)
+	return err
+}
+
+// purgeTrashedResource removes a resource from the trash and releases the blob references of its content and older versions.
+// It returns the hashes of blobs that are not referenced anymore.
+func (s *SQLite) purgeTrashedResource(uuid string) ([]string, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var blobSHA256 sql.NullString
+	err = tx.QueryRow(`SELECT blob_sha256 FROM resource WHERE uuid = ? AND in_trash = 1`, uuid).Scan(&blobSHA256)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// already purged or restored
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`UPDATE resource SET in_trash = 0 WHERE uuid = ?`, uuid); err != nil {
+		return nil, err
+	}
+
+	unreferenced, err := releaseResourceBlobs(tx, uuid, blobSHA256)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return unreferenced, nil
+}
+
+// restoreResources moves resources out of the trash in one transaction, saving their new name and parent.
+// Fails with sql.ErrNoRows if one of them is not in the trash anymore.
+func (s *SQLite) restoreResources(resources []*Resource) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, r := range resources {
+		res, err := tx.Exec(`
+			UPDATE resource
+			SET name = ?, parent_uuid = ?, deleted_at = NULL, in_trash = 0
+			WHERE uuid = ? AND in_trash = 1
+		`, r.Name, r.ParentUUID, r.UUID)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n != 1 {
+			// purged in the meantime
+			return sql.ErrNoRows
+		}
+	}
+
+	return tx.Commit()
+}
+
+// findTrashedChildren finds all resources in the trash directly below the given parent
+func (s *SQLite) findTrashedChildren(parentUUID string) ([]*Resource, error) {
+	rows, err := s.db.Query(`
+		SELECT `+resourceColumns+`
+		FROM resource
+		WHERE parent_uuid = ? AND in_trash = 1
+	`, parentUUID)
+	if err != nil {
+		return nil, err
+	}
+	return scanResources(rows)
+}
+
+// findTrashedResourcesByAPIKey finds all resources of an API key in the trash
+func (s *SQLite) findTrashedResourcesByAPIKey(apiKeyUUID string) ([]*Resource, error) {
+	rows, err := s.db.Query(`
+		SELECT `+resourceColumns+`
+		FROM resource
+		WHERE api_key_uuid = ? AND in_trash = 1
+	`, apiKeyUUID)
+	if err != nil {
+		return nil, err
+	}
+	return scanResources(rows)
+}
+
+// findResourcesForPurge finds all resources in the trash that were deleted before the given time
+// or whose TTL ended in the meantime
+func (s *SQLite) findResourcesForPurge(deletedBefore time.Time, now time.Time) ([]*Resource, error) {
+	rows, err := s.db.Query(`
+		SELECT `+resourceColumns+`
+		FROM resource
+		WHERE in_trash = 1 AND (deleted_at <= ? OR autodelete_at <= ?)
+	`, deletedBefore, now)
+	if err != nil {
+		return nil, err
+	}
+	return scanResources(rows)
+}
+
+// setResourceBlob links a file stored before the blob store existed to its blob
+func (s *SQLite) setResourceBlob(uuid string, sha256 string, size int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := addBlobReference(tx, sha256, size); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE resource SET blob_sha256 = ?, sha256 = ?, size = ? WHERE uuid = ? AND blob_sha256 IS NULL`, sha256, sha256, size, uuid)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// addResourceVersion replaces the content of a file with a new blob. The previous content is kept as older version
+// and the oldest versions beyond maxVersions (0 = no limit) are removed. expectedVersion guards against concurrent updates,
+// sql.ErrNoRows is returned if the file was deleted or changed meanwhile.
+// It returns the hashes of blobs that are not referenced anymore.
+func (s *SQLite) addResourceVersion(uuid string, expectedVersion int64, sha256 string, size int64, t time.Time, maxVersions int64) ([]string, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var (
+		blobSHA256 sql.NullString
+		oldSize    int64
+		createdAt  time.Time
+		updatedAt  *time.Time
+	)
+	err = tx.QueryRow(`
+		SELECT blob_sha256, size, created_at, updated_at
+		FROM resource
+		WHERE uuid = ? AND is_file = 1 AND deleted_at IS NULL AND version = ?
+	`, uuid, expectedVersion).Scan(&blobSHA256, &oldSize, &createdAt, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+	savedAt := createdAt
+	if updatedAt != nil {
+		savedAt = *updatedAt
+	}
+	if !blobSHA256.Valid {
+		return nil, fmt.Errorf("file %s does not reference a blob", uuid)
+	}
+
+	if err := addBlobReference(tx, sha256, size); err != nil {
+		return nil, err
+	}
+
+	// the reference of the previous content moves to the version
+	_, err = tx.Exec(`
+		INSERT INTO resource_version (resource_uuid, version, sha256, size, created_at) VALUES (?, ?, ?, ?, ?)
+	`, uuid, expectedVersion, blobSHA256.String, oldSize, savedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE resource
+		SET blob_sha256 = ?, sha256 = ?, size = ?, version = version + 1, updated_at = ?, is_broken = 0
+		WHERE uuid = ?
+	`, sha256, sha256, size, t, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	var unreferenced []string
+	if maxVersions > 0 {
+		trimmed, err := deleteResourceVersions(tx, `
+			DELETE FROM resource_version
+			WHERE resource_uuid = ? AND version NOT IN (
+				SELECT version FROM resource_version WHERE resource_uuid = ? ORDER BY version DESC LIMIT ?
+			)
+			RETURNING sha256
+		`, uuid, uuid, maxVersions)
+		if err != nil {
+			return nil, err
+		}
+		if unreferenced, err = releaseBlobReferences(tx, trimmed); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return unreferenced, nil
+}
+
+// findResourceVersions returns the older versions of a file, newest first
+func (s *SQLite) findResourceVersions(uuid string) ([]*ResourceVersion, error) {
+	rows, err := s.db.Query(`
+		SELECT resource_uuid, version, sha256, size, created_at
+		FROM resource_version
+		WHERE resource_uuid = ?
+		ORDER BY version DESC
+	`, uuid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []*ResourceVersion{}
+	for rows.Next() {
+		v := &ResourceVersion{}
+		if err := rows.Scan(&v.ResourceUUID, &v.Version, &v.SHA256, &v.Size, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// findResourceVersion returns an older version of a file or nil if it does not exist
+func (s *SQLite) findResourceVersion(uuid string, version int64) (*ResourceVersion, error) {
+	v := &ResourceVersion{}
+	err := s.db.QueryRow(`
+		SELECT resource_uuid, version, sha256, size, created_at
+		FROM resource_version
+		WHERE resource_uuid = ? AND version = ?
+	`, uuid, version).Scan(&v.ResourceUUID, &v.Version, &v.SHA256, &v.Size, &v.CreatedAt)
 	if err != nil {
-		return err
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
 	}
+	return v, nil
+}
 
-	_, err = s.db.Exec(`
-		CREATE UNIQUE INDEX IF NOT EXISTS idx_unique_active_resource
-		ON resource(name, parent_uuid, api_key_uuid)
-		WHERE deleted_at IS NULL;
-	`)
-	return err
+// findBlobs returns hash and size of all referenced blobs ordered by hash
+func (s *SQLite) findBlobs() ([]*Blob, error) {
+	rows, err := s.db.Query(`SELECT sha256, size FROM blob WHERE ref_count > 0 ORDER BY sha256`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	blobs := []*Blob{}
+	for rows.Next() {
+		b := &Blob{}
+		if err := rows.Scan(&b.SHA256, &b.Size); err != nil {
+			return nil, err
+		}
+		blobs = append(blobs, b)
+	}
+	return blobs, rows.Err()
 }
 
-// insertResource saves a resource
-func (s *SQLite) insertResource(r *Resource) error {
-	_, err := s.db.Exec(`
-		INSERT INTO resource (
-			uuid, name, is_private, is_file, parent_uuid, api_key_uuid, autodelete_at, created_at, deleted_at, is_broken
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, r.UUID, r.Name, r.IsPrivate, r.IsFile, r.ParentUUID, r.APIKeyUUID, r.AutoDeleteAt, r.CreatedAt, r.DeletedAt, r.IsBroken)
+// markBlobFilesAsBroken marks all undeleted files whose current content is stored in the blob as broken.
+// It returns the UUIDs of files that were not marked before.
+func (s *SQLite) markBlobFilesAsBroken(sha256 string) ([]string, error) {
+	rows, err := s.db.Query(`
+		UPDATE resource
+		SET is_broken = 1
+		WHERE blob_sha256 = ? AND deleted_at IS NULL AND is_broken = 0
+		RETURNING uuid
+	`, sha256)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var uuids []string
+	for rows.Next() {
+		var uuid string
+		if err := rows.Scan(&uuid); err != nil {
+			return nil, err
+		}
+		uuids = append(uuids, uuid)
+	}
+	return uuids, rows.Err()
+}
 
+// findActiveFilesByBlob finds all undeleted files whose current content is stored in the blob
+func (s *SQLite) findActiveFilesByBlob(sha256 string) ([]*Resource, error) {
+	rows, err := s.db.Query(`
+		SELECT `+resourceColumns+`
+		FROM resource
+		WHERE blob_sha256 = ? AND deleted_at IS NULL
+	`, sha256)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	return scanResources(rows)
+}
+
+// findBlobRefCount returns the reference count of a blob (0 if it does not exist)
+func (s *SQLite) findBlobRefCount(sha256 string) (int64, error) {
+	var count int64
+	err := s.db.QueryRow(`SELECT ref_count FROM blob WHERE sha256 = ?`, sha256).Scan(&count)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return count, nil
+}
+
+// findActiveChild finds an undeleted resource by name directly below a parent (nil = home dir)
+func (s *SQLite) findActiveChild(name string, apiKeyUUID string, parentUUID *string) (*Resource, error) {
+	var row *sql.Row
+	if parentUUID == nil {
+		row = s.db.QueryRow(`
+			SELECT `+resourceColumns+`
+			FROM resource
+			WHERE name = ? AND api_key_uuid = ? AND parent_uuid IS NULL AND deleted_at IS NULL
+		`, name, apiKeyUUID)
+	} else {
+		row = s.db.QueryRow(`
+			SELECT `+resourceColumns+`
+			FROM resource
+			WHERE name = ? AND api_key_uuid = ? AND parent_uuid = ? AND deleted_at IS NULL
+		`, name, apiKeyUUID, *parentUUID)
+	}
+
+	r, err := scanResource(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return r, nil
+}
+
+// findLegacyFiles finds all undeleted files that are not stored in the blob store yet
+func (s *SQLite) findLegacyFiles() ([]*Resource, error) {
+	rows, err := s.db.Query(`
+		SELECT ` + resourceColumns + `
+		FROM resource
+		WHERE is_file = 1 AND deleted_at IS NULL AND blob_sha256 IS NULL
+	`)
+	if err != nil {
+		return nil, err
+	}
+	return scanResources(rows)
+}
+
+// findActiveResourcesByAPIKey finds all undeleted resources of an API key including its home dir
+func (s *SQLite) findActiveResourcesByAPIKey(apiKeyUUID string) ([]*Resource, error) {
+	rows, err := s.db.Query(`
+		SELECT `+resourceColumns+`
+		FROM resource
+		WHERE api_key_uuid = ? AND deleted_at IS NULL
+	`, apiKeyUUID)
+	if err != nil {
+		return nil, err
+	}
+	return scanResources(rows)
 }
 
 func (s *SQLite) findResourceByUUID(uuid string) (*Resource, error) {
-	row := s.db.QueryRow(`SELECT uuid, name, is_private, is_file, parent_uuid, api_key_uuid, autodelete_at, created_at, deleted_at, is_broken FROM resource WHERE uuid = ?`, uuid)
-	var r Resource
-	if err := row.Scan(&r.UUID, &r.Name, &r.IsPrivate, &r.IsFile, &r.ParentUUID, &r.APIKeyUUID, &r.AutoDeleteAt, &r.CreatedAt, &r.DeletedAt, &r.IsBroken); err != nil {
+	row := s.db.QueryRow(`SELECT `+resourceColumns+` FROM resource WHERE uuid = ?`, uuid)
+	r, err := scanResource(row)
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
 		return nil, err
 	}
-	return &r, nil
+	return r, nil
 }
 
 func (s *SQLite) findActiveResource(name string, apiKeyUUID string, parentDir *string) (*Resource, error) {
 	var row *sql.Row
 	if parentDir == nil {
 		row = s.db.QueryRow(`
-			SELECT uuid, name, is_private, is_file, parent_uuid, api_key_uuid,
-			       autodelete_at, created_at, deleted_at, is_broken
+			SELECT `+resourceColumns+`
 			FROM resource
 			WHERE name = ?
 			  AND api_key_uuid = ?
@@ -115,8 +840,7 @@ func (s *SQLite) findActiveResource(name string, apiKeyUUID string, parentDir *s
 		`, name, apiKeyUUID)
 	} else {
 		row = s.db.QueryRow(`
-			SELECT uuid, name, is_private, is_file, parent_uuid, api_key_uuid,
-			       autodelete_at, created_at, deleted_at, is_broken
+			SELECT `+resourceColumns+`
 			FROM resource
 			WHERE name = ?
 			  AND api_key_uuid = ?
@@ -132,15 +856,27 @@ func (s *SQLite) findActiveResource(name string, apiKeyUUID string, parentDir *s
 		`, name, apiKeyUUID, *parentDir, apiKeyUUID)
 	}
 
-	var r Resource
-	if err := row.Scan(&r.UUID, &r.Name, &r.IsPrivate, &r.IsFile, &r.ParentUUID,
-		&r.APIKeyUUID, &r.AutoDeleteAt, &r.CreatedAt, &r.DeletedAt, &r.IsBroken); err != nil {
+	r, err := scanResource(row)
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
 		return nil, err
 	}
-	return &r, nil
+	return r, nil
+}
+
+// findActiveChildren finds and returns all undeleted resources directly below the given parent
+func (s *SQLite) findActiveChildren(parentUUID string) ([]*Resource, error) {
+	rows, err := s.db.Query(`
+		SELECT `+resourceColumns+`
+		FROM resource
+		WHERE parent_uuid = ? AND deleted_at IS NULL
+	`, parentUUID)
+	if err != nil {
+		return nil, err
+	}
+	return scanResources(rows)
 }
 
 func (s *SQLite) updateResource(r *Resource) error {
@@ -154,46 +890,161 @@ func (s *SQLite) updateResource(r *Resource) error {
 		    autodelete_at = ?,
 		    created_at = ?,
 		    deleted_at = ?,
-			is_broken = ?
+			is_broken = ?,
+			size = ?,
+			sha256 = ?,
+			password_hash = ?,
+			max_downloads = ?
 		WHERE uuid = ?
-	`, r.Name, r.IsPrivate, r.IsFile, r.ParentUUID, r.APIKeyUUID, r.AutoDeleteAt, r.CreatedAt, r.DeletedAt, r.IsBroken, r.UUID)
+	`, r.Name, r.IsPrivate, r.IsFile, r.ParentUUID, r.APIKeyUUID, r.AutoDeleteAt, r.CreatedAt, r.DeletedAt, r.IsBroken, r.Size, r.SHA256, r.PasswordHash,
+		r.MaxDownloads, r.UUID)
+	return err
+}
+
+// updateResourceSettings writes name, privacy and TTL of an undeleted resource. Other columns are left alone, since
+// they may have changed since r was read, e.g. by a delete or a new version. It returns false if the resource is deleted.
+func (s *SQLite) updateResourceSettings(r *Resource) (bool, error) {
+	res, err := s.db.Exec(`
+		UPDATE resource
+		SET name = ?, is_private = ?, autodelete_at = ?
+		WHERE uuid = ? AND deleted_at IS NULL
+	`, r.Name, r.IsPrivate, r.AutoDeleteAt, r.UUID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// incrementDownloadCount counts a download of an undeleted file as long as its download limit is not reached.
+// It returns the new count, or ok = false if the limit was already reached.
+func (s *SQLite) incrementDownloadCount(uuid string) (count int64, ok bool, err error) {
+	row := s.db.QueryRow(`
+		UPDATE resource
+		SET download_count = download_count + 1
+		WHERE uuid = ? AND deleted_at IS NULL AND (max_downloads IS NULL OR download_count < max_downloads)
+		RETURNING download_count
+	`, uuid)
+	if err := row.Scan(&count); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	return count, true, nil
+}
+
+// updateResourceFileInfo updates size and checksum of a file
+func (s *SQLite) updateResourceFileInfo(uuid string, size int64, sha256 string) error {
+	_, err := s.db.Exec(`UPDATE resource SET size = ?, sha256 = ? WHERE uuid = ?`, size, sha256, uuid)
 	return err
 }
 
 // findFilesForDeletion finds and returns all undeleted resources that should be deleted according to autodelete_at
+// or because their download limit is reached
 func (s *SQLite) findFilesForDeletion(deleteTime time.Time) ([]*Resource, error) {
 	rows, err := s.db.Query(`
-		SELECT uuid, name, is_private, is_file, parent_uuid, api_key_uuid, autodelete_at, created_at, deleted_at, is_broken 
+		SELECT `+resourceColumns+`
 		FROM resource
-		WHERE autodelete_at <= ? AND deleted_at IS NULL
+		WHERE (autodelete_at <= ? OR download_count >= max_downloads) AND deleted_at IS NULL
 	`, deleteTime)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	return scanResources(rows)
+}
 
-	var resources []*Resource
-	for rows.Next() {
-		var r Resource
-		if err := rows.Scan(&r.UUID, &r.Name, &r.IsPrivate, &r.IsFile, &r.ParentUUID, &r.APIKeyUUID, &r.AutoDeleteAt, &r.CreatedAt, &r.DeletedAt, &r.IsBroken); err != nil {
-			return nil, err
+// sumStoredFileSizes returns the number of bytes stored by an API key, including older versions of its files
+// and files in the trash, whose content is kept until they are purged
+func (s *SQLite) sumStoredFileSizes(apiKeyUUID string) (int64, error) {
+	row := s.db.QueryRow(`
+		SELECT
+			(SELECT COALESCE(SUM(size), 0)
+			 FROM resource
+			 WHERE api_key_uuid = ? AND is_file = 1 AND (deleted_at IS NULL OR in_trash = 1))
+			+
+			(SELECT COALESCE(SUM(v.size), 0)
+			 FROM resource_version v JOIN resource r ON r.uuid = v.resource_uuid
+			 WHERE r.api_key_uuid = ? AND (r.deleted_at IS NULL OR r.in_trash = 1))
+	`, apiKeyUUID, apiKeyUUID)
+	var size int64
+	if err := row.Scan(&size); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// listCursor marks the last resource of a page for keyset pagination
+type listCursor struct {
+	SortBy    string    `json:"s"`
+	Name      string    `json:"n,omitempty"`
+	Size      int64     `json:"z,omitempty"`
+	CreatedAt time.Time `json:"c,omitempty"`
+	UUID      string    `json:"u"`
+}
+
+// findResourcesByAPIKey finds all resources of an API key (excluding the home dir) according to the list options.
+// opts.SortBy needs to be validated beforehand.
+func (s *SQLite) findResourcesByAPIKey(apiKeyUUID string, opts ListOptions, after *listCursor) ([]*Resource, error) {
+	query := `SELECT ` + resourceColumns + `
+		FROM resource
+		WHERE api_key_uuid = ?
+		  AND NOT (is_file = 0 AND parent_uuid IS NULL AND name = api_key_uuid)`
+	args := []any{apiKeyUUID}
+
+	if opts.InTrash {
+		query += ` AND in_trash = 1`
+	} else if !opts.IncludeDeleted {
+		query += ` AND deleted_at IS NULL`
+	}
+
+	if opts.NamePrefix != "" {
+		// case sensitive, no wildcards
+		query += ` AND substr(name, 1, length(?)) = ?`
+		args = append(args, opts.NamePrefix, opts.NamePrefix)
+	}
+
+	cmp := ">"
+	order := "ASC"
+	if opts.Descending {
+		cmp = "<"
+		order = "DESC"
+	}
+
+	if after != nil {
+		var v any
+		switch opts.SortBy {
+		case "name":
+			v = after.Name
+		case "size":
+			v = after.Size
+		default:
+			v = after.CreatedAt
 		}
-		resources = append(resources, &r)
+		query += fmt.Sprintf(` AND (%s %s ? OR (%s = ? AND uuid %s ?))`, opts.SortBy, cmp, opts.SortBy, cmp)
+		args = append(args, v, v, after.UUID)
 	}
 
-	if err := rows.Err(); err != nil {
+	query += fmt.Sprintf(` ORDER BY %s %s, uuid %s LIMIT ?`, opts.SortBy, order, order)
+	args = append(args, opts.Limit)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
 		return nil, err
 	}
-
-	return resources, nil
+	return scanResources(rows)
 }
 
 // insertAPIKey saves a hashed API key, a comment and the timestamp
 func (s *SQLite) insertAPIKey(key *APIKey) error {
 	_, err := s.db.Exec(`
-		INSERT INTO api_key (uuid, hashed_key, comment, is_highly_trusted, created_at, created_by)
-		VALUES (?, ?, ?, ?, ?, ?)
-	`, key.UUID, key.HashedKey, key.Comment, key.IsHighlyTrusted, key.CreatedAt, key.CreatedBy)
+		INSERT INTO api_key (`+apiKeyColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, key.UUID, key.HashedKey, key.Comment, key.IsHighlyTrusted, key.CreatedAt, key.CreatedBy, key.SpaceLimitInMB,
+		key.ExpiresAt, key.RevokedAt, key.MaxVersions)
 
 	if err != nil {
 		return fmt.Errorf("error adding API key: %v", err)
@@ -202,6 +1053,86 @@ func (s *SQLite) insertAPIKey(key *APIKey) error {
 	return nil
 }
 
+// updateAPIKeySpaceLimit sets the storage quota override of an API key (nil = config default)
+func (s *SQLite) updateAPIKeySpaceLimit(uuid string, spaceLimitInMB *int64) error {
+	_, err := s.db.Exec(`UPDATE api_key SET space_limit_in_mb = ? WHERE uuid = ?`, spaceLimitInMB, uuid)
+	return err
+}
+
+// updateAPIKeyMaxVersions sets how many older versions are kept per file (nil = config default, 0 = no limit)
+func (s *SQLite) updateAPIKeyMaxVersions(uuid string, maxVersions *int64) error {
+	_, err := s.db.Exec(`UPDATE api_key SET max_versions = ? WHERE uuid = ?`, maxVersions, uuid)
+	return err
+}
+
+// updateAPIKeyExpiresAt sets the expiry of an API key (nil = never)
+func (s *SQLite) updateAPIKeyExpiresAt(uuid string, expiresAt *time.Time) error {
+	_, err := s.db.Exec(`UPDATE api_key SET expires_at = ? WHERE uuid = ?`, expiresAt, uuid)
+	return err
+}
+
+// updateAPIKeyHash replaces the hashed secret of an API key
+func (s *SQLite) updateAPIKeyHash(uuid string, hashedKey string) error {
+	_, err := s.db.Exec(`UPDATE api_key SET hashed_key = ? WHERE uuid = ?`, hashedKey, uuid)
+	return err
+}
+
+// updateAPIKeyRevokedAt marks an API key as revoked
+func (s *SQLite) updateAPIKeyRevokedAt(uuid string, revokedAt time.Time) error {
+	_, err := s.db.Exec(`UPDATE api_key SET revoked_at = ? WHERE uuid = ?`, revokedAt, uuid)
+	return err
+}
+
+// findAPIKeysCreatedBy finds and returns all api_key entries created by the given key
+func (s *SQLite) findAPIKeysCreatedBy(creatorUUID string) ([]*APIKey, error) {
+	rows, err := s.db.Query(`SELECT `+apiKeyColumns+` FROM api_key WHERE created_by = ? ORDER BY created_at`, creatorUUID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*APIKey
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// transferResources moves all resources of an API key to another key.
+// Resources directly in the old home dir are attached to the old home dir, which becomes a folder of the new key.
+func (s *SQLite) transferResources(fromKeyUUID string, toKeyUUID string, fromHomeUUID string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE resource
+		SET parent_uuid = ?
+		WHERE api_key_uuid = ? AND parent_uuid IS NULL AND uuid != ?
+	`, fromHomeUUID, fromKeyUUID, fromHomeUUID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE resource SET api_key_uuid = ? WHERE api_key_uuid = ?`, toKeyUUID, fromKeyUUID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
 // countApiKeyEntries counts the entries in table api_key
 func (s *SQLite) countApiKeyEntries() (int, error) {
 	row := s.db.QueryRow(`SELECT COUNT(*) FROM api_key`)
@@ -214,26 +1145,155 @@ func (s *SQLite) countApiKeyEntries() (int, error) {
 
 // findAPIKeyByHash finds and returns the api_key entry containing the hashed key
 func (s *SQLite) findAPIKeyByHash(hash string) (*APIKey, error) {
-	row := s.db.QueryRow(`SELECT uuid, hashed_key, comment, is_highly_trusted, created_at, created_by FROM api_key WHERE hashed_key = ?`, hash)
-	var k APIKey
-	if err := row.Scan(&k.UUID, &k.HashedKey, &k.Comment, &k.IsHighlyTrusted, &k.CreatedAt, &k.CreatedBy); err != nil {
+	row := s.db.QueryRow(`SELECT `+apiKeyColumns+` FROM api_key WHERE hashed_key = ?`, hash)
+	k, err := scanAPIKey(row)
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
 		return nil, err
 	}
-	return &k, nil
+	return k, nil
 }
 
 // findAPIKeyByUUID finds and returns the api_key entry by its uuid
 func (s *SQLite) findAPIKeyByUUID(uuid string) (*APIKey, error) {
-	row := s.db.QueryRow(`SELECT uuid, hashed_key, comment, is_highly_trusted, created_at, created_by FROM api_key WHERE uuid = ?`, uuid)
-	var k APIKey
-	if err := row.Scan(&k.UUID, &k.HashedKey, &k.Comment, &k.IsHighlyTrusted, &k.CreatedAt, &k.CreatedBy); err != nil {
+	row := s.db.QueryRow(`SELECT `+apiKeyColumns+` FROM api_key WHERE uuid = ?`, uuid)
+	k, err := scanAPIKey(row)
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
 		return nil, err
 	}
-	return &k, nil
+	return k, nil
+}
+
+// insertUploadSession saves a resumable upload
+func (s *SQLite) insertUploadSession(u *UploadSession) error {
+	_, err := s.db.Exec(`
+		INSERT INTO upload_session (`+uploadSessionColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, u.ID, u.APIKeyUUID, u.Name, u.IsPrivate, u.ParentUUID, u.AutoDeleteInSec, u.Length, u.Offset, u.Metadata, u.ResourceUUID, u.CreatedAt, u.ExpiresAt,
+		u.MaxDownloads, u.Versioning)
+	return err
+}
+
+func (s *SQLite) findUploadSession(id string) (*UploadSession, error) {
+	row := s.db.QueryRow(`SELECT `+uploadSessionColumns+` FROM upload_session WHERE id = ?`, id)
+	u, err := scanUploadSession(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return u, nil
+}
+
+// updateUploadSessionProgress stores the current offset and expiry of a resumable upload
+func (s *SQLite) updateUploadSessionProgress(id string, offset int64, expiresAt time.Time) error {
+	_, err := s.db.Exec(`UPDATE upload_session SET upload_offset = ?, expires_at = ? WHERE id = ?`, offset, expiresAt, id)
+	return err
+}
+
+// updateUploadSessionResource links a finalized upload to its resource
+func (s *SQLite) updateUploadSessionResource(id string, resourceUUID string) error {
+	_, err := s.db.Exec(`UPDATE upload_session SET resource_uuid = ? WHERE id = ?`, resourceUUID, id)
+	return err
+}
+
+func (s *SQLite) deleteUploadSession(id string) error {
+	_, err := s.db.Exec(`DELETE FROM upload_session WHERE id = ?`, id)
+	return err
+}
+
+// findExpiredUploadSessions finds and returns all resumable uploads that expired before the given time
+func (s *SQLite) findExpiredUploadSessions(t time.Time) ([]*UploadSession, error) {
+	rows, err := s.db.Query(`
+		SELECT `+uploadSessionColumns+`
+		FROM upload_session
+		WHERE expires_at <= ?
+	`, t)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*UploadSession
+	for rows.Next() {
+		u, err := scanUploadSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, u)
+	}
+	return sessions, rows.Err()
+}
+
+// insertShare saves a share link
+func (s *SQLite) insertShare(sh *Share) error {
+	_, err := s.db.Exec(`
+		INSERT INTO share (`+shareColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, sh.Token, sh.ResourceUUID, sh.Label, sh.PasswordHash, sh.MaxDownloads, sh.DownloadCount, sh.ExpiresAt, sh.CreatedAt, sh.RevokedAt)
+	return err
+}
+
+func (s *SQLite) findShareByToken(token string) (*Share, error) {
+	row := s.db.QueryRow(`SELECT `+shareColumns+` FROM share WHERE token = ?`, token)
+	sh, err := scanShare(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return sh, nil
+}
+
+// findSharesByResource returns all shares of a resource, oldest first
+func (s *SQLite) findSharesByResource(resourceUUID string) ([]*Share, error) {
+	rows, err := s.db.Query(`
+		SELECT `+shareColumns+`
+		FROM share
+		WHERE resource_uuid = ?
+		ORDER BY created_at, token
+	`, resourceUUID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shares := []*Share{}
+	for rows.Next() {
+		sh, err := scanShare(rows)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, sh)
+	}
+	return shares, rows.Err()
+}
+
+// updateShareRevokedAt revokes a share; revoking twice keeps the first time
+func (s *SQLite) updateShareRevokedAt(token string, revokedAt time.Time) error {
+	_, err := s.db.Exec(`UPDATE share SET revoked_at = ? WHERE token = ? AND revoked_at IS NULL`, revokedAt, token)
+	return err
+}
+
+// incrementShareDownloadCount counts a download through an unrevoked share as long as its download limit is not reached.
+// It returns false if the limit was already reached.
+func (s *SQLite) incrementShareDownloadCount(token string) (bool, error) {
+	res, err := s.db.Exec(`
+		UPDATE share
+		SET download_count = download_count + 1
+		WHERE token = ? AND revoked_at IS NULL AND (max_downloads IS NULL OR download_count < max_downloads)
+	`, token)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
 }
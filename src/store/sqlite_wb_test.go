@@ -1,6 +1,8 @@
 package store
 
 import (
+	"database/sql"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -82,3 +84,62 @@ func TestFindFilesForDeletion(t *testing.T) {
 		}
 	}
 }
+
+func TestInitMigratesOldSchema(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// database created by a version without size and space_limit_in_mb
+	raw, err := sql.Open("sqlite3", filepath.Join(tmpDir, "fshare.sqlite"))
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	_, err = raw.Exec(`
+	CREATE TABLE api_key (
+		uuid TEXT PRIMARY KEY,
+		hashed_key TEXT UNIQUE,
+		comment TEXT,
+		is_highly_trusted BOOLEAN,
+		created_at DATETIME,
+		created_by TEXT
+	);
+	CREATE TABLE resource (
+		uuid TEXT PRIMARY KEY,
+		name TEXT,
+		is_private BOOLEAN,
+		is_file BOOLEAN,
+		parent_uuid TEXT,
+		api_key_uuid TEXT,
+		autodelete_at DATETIME,
+		created_at DATETIME,
+		deleted_at DATETIME,
+		is_broken BOOLEAN
+	);
+	INSERT INTO api_key VALUES ('k1', 'hash', 'old key', 0, '2025-01-01 00:00:00', NULL);
+	INSERT INTO resource VALUES ('r1', 'old.txt', 0, 1, NULL, 'k1', NULL, '2025-01-01 00:00:00', NULL, 0);
+	`)
+	if err != nil {
+		t.Fatalf("failed to create old schema: %v", err)
+	}
+	raw.Close()
+
+	db, err := NewDB(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to migrate db: %v", err)
+	}
+
+	r, err := db.findResourceByUUID("r1")
+	if err != nil || r == nil {
+		t.Fatalf("failed to load migrated resource: %v", err)
+	}
+	if r.Size != 0 {
+		t.Errorf("expected size 0 for migrated resource, got %d", r.Size)
+	}
+
+	k, err := db.findAPIKeyByUUID("k1")
+	if err != nil || k == nil {
+		t.Fatalf("failed to load migrated API key: %v", err)
+	}
+	if k.SpaceLimitInMB != nil {
+		t.Errorf("expected no space limit for migrated API key")
+	}
+}
@@ -0,0 +1,350 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/twigman/fshare/src/internal/apperror"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+// thumbnailDir is the dir inside the data folder caching thumbnails, one sub dir per resource.
+// Thumbnails are generated on first request and can be removed at any time.
+const thumbnailDir = "thumbs"
+
+// ThumbnailSizes are the supported sizes of thumbnails in pixels of the longer edge
+var ThumbnailSizes = []int{128, 256, 512, 1024}
+
+// DefaultThumbnailSize is used if no size is requested
+const DefaultThumbnailSize = 256
+
+// maxThumbnailSourcePixels protects against images that would need too much memory to decode,
+// a decoded RGBA image of this size takes 64 MB
+const maxThumbnailSourcePixels = 16_000_000
+
+// maxConcurrentThumbnails bounds the number of images decoded at the same time, so anonymous requests for
+// thumbnails of public images can not exhaust the memory
+const maxConcurrentThumbnails = 2
+
+// thumbnailFailedPrefix marks content no thumbnail can be generated for, so it is not decoded again on every request
+const thumbnailFailedPrefix = "failed-"
+
+// exifHeaderSize is the amount of data searched for the EXIF orientation of JPEG images
+const exifHeaderSize = 128 << 10
+
+var thumbnailDecoders = map[string]func(io.Reader) (image.Image, error){
+	".jpg":  jpeg.Decode,
+	".jpeg": jpeg.Decode,
+	".png":  png.Decode,
+	".gif":  gif.Decode, // first frame
+	".webp": webp.Decode,
+}
+
+var thumbnailConfigDecoders = map[string]func(io.Reader) (image.Config, error){
+	".jpg":  jpeg.DecodeConfig,
+	".jpeg": jpeg.DecodeConfig,
+	".png":  png.DecodeConfig,
+	".gif":  gif.DecodeConfig,
+	".webp": webp.DecodeConfig,
+}
+
+// IsThumbnailSupported reports whether thumbnails can be generated for a file name
+func IsThumbnailSupported(name string) bool {
+	_, ok := thumbnailDecoders[strings.ToLower(filepath.Ext(name))]
+	return ok
+}
+
+// OpenThumbnail opens the cached thumbnail of an image file with the given size and returns it with its MIME type.
+// The thumbnail is generated if it does not exist for the current content yet. Images without transparency are
+// stored as JPEG, others as PNG.
+func (s *ResourceService) OpenThumbnail(r *Resource, size int) (*os.File, string, error) {
+	if !slices.Contains(ThumbnailSizes, size) {
+		return nil, "", apperror.ErrInvalidThumbnailSize
+	}
+	if !r.IsFile || r.DeletedAt != nil || !IsThumbnailSupported(r.Name) {
+		return nil, "", apperror.ErrThumbnailNotSupported
+	}
+
+	sum, err := s.EnsureChecksum(r)
+	if err != nil {
+		return nil, "", err
+	}
+	dir := s.thumbnailPath(r.UUID)
+	base := fmt.Sprintf("%d-%s", size, sum)
+	failedPath := filepath.Join(dir, thumbnailFailedPrefix+sum)
+
+	if f, mimeType, err := openCachedThumbnail(dir, base, failedPath); f != nil || err != nil {
+		return f, mimeType, err
+	}
+
+	s.thumbnailSlots <- struct{}{}
+	defer func() { <-s.thumbnailSlots }()
+
+	// generated by another request in the meantime
+	if f, mimeType, err := openCachedThumbnail(dir, base, failedPath); f != nil || err != nil {
+		return f, mimeType, err
+	}
+
+	path, mimeType, err := s.generateThumbnail(r, size, dir, base)
+	if err == apperror.ErrThumbnailNotSupported {
+		if err := os.MkdirAll(dir, 0o700); err == nil {
+			_ = os.WriteFile(failedPath, nil, 0o600)
+		}
+		return nil, "", err
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	return f, mimeType, nil
+}
+
+// openCachedThumbnail opens an existing thumbnail. It returns ErrThumbnailNotSupported if generating one failed before
+// and neither a file nor an error if the thumbnail has to be generated.
+func openCachedThumbnail(dir string, base string, failedPath string) (*os.File, string, error) {
+	for ext, mimeType := range map[string]string{".jpg": "image/jpeg", ".png": "image/png"} {
+		f, err := os.Open(filepath.Join(dir, base+ext))
+		if err == nil {
+			return f, mimeType, nil
+		}
+	}
+	if _, err := os.Stat(failedPath); err == nil {
+		return nil, "", apperror.ErrThumbnailNotSupported
+	}
+	return nil, "", nil
+}
+
+// generateThumbnail scales the image down and writes the thumbnail to dir. Thumbnails of the same size
+// made from older content are removed.
+func (s *ResourceService) generateThumbnail(r *Resource, size int, dir string, base string) (string, string, error) {
+	obj, err := s.OpenResource(r)
+	if err != nil {
+		return "", "", err
+	}
+	defer obj.Close()
+
+	ext := strings.ToLower(filepath.Ext(r.Name))
+	cfg, err := thumbnailConfigDecoders[ext](obj)
+	if err != nil || cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > maxThumbnailSourcePixels {
+		return "", "", apperror.ErrThumbnailNotSupported
+	}
+
+	orientation := 1
+	if _, err := obj.Seek(0, io.SeekStart); err != nil {
+		return "", "", err
+	}
+	if ext == ".jpg" || ext == ".jpeg" {
+		header := make([]byte, exifHeaderSize)
+		n, err := io.ReadFull(obj, header)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return "", "", err
+		}
+		orientation = jpegOrientation(header[:n])
+		if _, err := obj.Seek(0, io.SeekStart); err != nil {
+			return "", "", err
+		}
+	}
+
+	src, err := thumbnailDecoders[ext](obj)
+	if err != nil {
+		return "", "", apperror.ErrThumbnailNotSupported
+	}
+	thumb := orient(scaleImage(src, size), orientation)
+
+	var buf bytes.Buffer
+	outExt, mimeType := ".jpg", "image/jpeg"
+	if o, ok := src.(interface{ Opaque() bool }); ok && o.Opaque() {
+		err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 85})
+	} else {
+		outExt, mimeType = ".png", "image/png"
+		err = png.Encode(&buf, thumb)
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", "", err
+	}
+	tmp, err := os.CreateTemp(dir, ".thumb-*")
+	if err != nil {
+		return "", "", err
+	}
+	_, err = tmp.Write(buf.Bytes())
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	path := filepath.Join(dir, base+outExt)
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", "", err
+	}
+
+	// thumbnails and failures of previous versions
+	old, _ := filepath.Glob(filepath.Join(dir, fmt.Sprintf("%d-*", size)))
+	failed, _ := filepath.Glob(filepath.Join(dir, thumbnailFailedPrefix+"*"))
+	old = append(old, failed...)
+	for _, p := range old {
+		if p != path {
+			os.Remove(p)
+		}
+	}
+	return path, mimeType, nil
+}
+
+// thumbnailPath returns the dir holding the thumbnails of a resource
+func (s *ResourceService) thumbnailPath(rUUID string) string {
+	return filepath.Join(s.cfg.DataPath, thumbnailDir, rUUID)
+}
+
+// removeThumbnails deletes the cached thumbnails of a resource. Errors are only logged, since the resource itself is gone.
+func (s *ResourceService) removeThumbnails(rUUID string) {
+	if rUUID == "" || strings.ContainsAny(rUUID, "./\\") {
+		return
+	}
+	if err := os.RemoveAll(s.thumbnailPath(rUUID)); err != nil {
+		log.Printf("Could not remove thumbnails of %s: %v", rUUID, err)
+	}
+}
+
+// scaleImage scales an image down to fit into a square of size pixels. Smaller images keep their size.
+func scaleImage(src image.Image, size int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > size || h > size {
+		if w >= h {
+			h = max(1, h*size/w)
+			w = size
+		} else {
+			w = max(1, w*size/h)
+			h = size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Src, nil)
+	return dst
+}
+
+// orient rotates and flips an image according to an EXIF orientation (1-8), so it is shown like the original in browsers
+func orient(src image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	// orientations 5-8 swap width and height
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored
+				dx, dy = w-1-x, y
+			case 3: // rotated 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // mirrored and rotated 270° clockwise
+				dx, dy = y, x
+			case 6: // rotated 90° clockwise
+				dx, dy = h-1-y, x
+			case 7: // mirrored and rotated 90° clockwise
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 270° clockwise
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, src.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// jpegOrientation returns the EXIF orientation of a JPEG image from its first bytes, 1 if there is none
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	// walk the segments up to the image data
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return 1
+		}
+		marker := data[pos+1]
+		if marker == 0xDA || marker == 0xD9 {
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			return 1
+		}
+		segment := data[pos+4 : pos+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		pos += 2 + length
+	}
+	return 1
+}
+
+// exifOrientation reads the orientation tag from the first IFD of TIFF formatted EXIF data
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			o := int(order.Uint16(tiff[entry+8:]))
+			if o < 1 || o > 8 {
+				return 1
+			}
+			return o
+		}
+	}
+	return 1
+}
@@ -0,0 +1,242 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/twigman/fshare/src/config"
+	"github.com/twigman/fshare/src/internal/apperror"
+)
+
+func encodeTestImage(t *testing.T, w int, h int, opaque bool) string {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			a := uint8(255)
+			if !opaque && x < w/2 {
+				a = 0
+			}
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 100, A: a})
+		}
+	}
+
+	var buf bytes.Buffer
+	var err error
+	if opaque {
+		err = jpeg.Encode(&buf, img, nil)
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		t.Fatalf("Error encoding image: %v", err)
+	}
+	return buf.String()
+}
+
+func openTestThumbnail(t *testing.T, rs *ResourceService, rUUID string, size int) (image.Config, string, string) {
+	t.Helper()
+	r, err := rs.GetResourceByUUID(rUUID)
+	if err != nil {
+		t.Fatalf("Error loading resource: %v", err)
+	}
+	f, mimeType, err := rs.OpenThumbnail(r, size)
+	if err != nil {
+		t.Fatalf("Error opening thumbnail: %v", err)
+	}
+	defer f.Close()
+
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		t.Fatalf("Error decoding thumbnail: %v", err)
+	}
+	return cfg, mimeType, f.Name()
+}
+
+func TestThumbnail_Generate(t *testing.T) {
+	dataDir := t.TempDir()
+	cfg := &config.Config{DataPath: dataDir, UploadPath: filepath.Join(dataDir, "upload")}
+	rs, key := initTrashTest(t, cfg)
+
+	photoUUID := saveTestFile(t, rs, &Resource{Name: "photo.JPG", APIKeyUUID: key.UUID}, encodeTestImage(t, 600, 300, true))
+	iconUUID := saveTestFile(t, rs, &Resource{Name: "icon.png", APIKeyUUID: key.UUID}, encodeTestImage(t, 40, 80, false))
+
+	imgCfg, mimeType, path := openTestThumbnail(t, rs, photoUUID, 256)
+	if mimeType != "image/jpeg" || imgCfg.Width != 256 || imgCfg.Height != 128 {
+		t.Errorf("expected 256x128 JPEG, got %dx%d %s", imgCfg.Width, imgCfg.Height, mimeType)
+	}
+	if filepath.Dir(path) != filepath.Join(dataDir, thumbnailDir, photoUUID) {
+		t.Errorf("unexpected thumbnail path %s", path)
+	}
+
+	// served from the cache
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Error reading thumbnail: %v", err)
+	}
+	_, _, cached := openTestThumbnail(t, rs, photoUUID, 256)
+	if cachedInfo, err := os.Stat(cached); err != nil || cached != path || !os.SameFile(info, cachedInfo) {
+		t.Errorf("expected cached thumbnail %s, got %s", path, cached)
+	}
+
+	// transparency is kept, small images are not scaled up
+	imgCfg, mimeType, _ = openTestThumbnail(t, rs, iconUUID, 128)
+	if mimeType != "image/png" || imgCfg.Width != 40 || imgCfg.Height != 80 {
+		t.Errorf("expected 40x80 PNG, got %dx%d %s", imgCfg.Width, imgCfg.Height, mimeType)
+	}
+
+	photo, err := rs.GetResourceByUUID(photoUUID)
+	if err != nil {
+		t.Fatalf("Error loading resource: %v", err)
+	}
+	if _, _, err := rs.OpenThumbnail(photo, 300); err != apperror.ErrInvalidThumbnailSize {
+		t.Errorf("expected ErrInvalidThumbnailSize, got %v", err)
+	}
+
+	textUUID := saveTestFile(t, rs, &Resource{Name: "notes.txt", APIKeyUUID: key.UUID}, "no image")
+	text, err := rs.GetResourceByUUID(textUUID)
+	if err != nil {
+		t.Fatalf("Error loading resource: %v", err)
+	}
+	if _, _, err := rs.OpenThumbnail(text, 256); err != apperror.ErrThumbnailNotSupported {
+		t.Errorf("expected ErrThumbnailNotSupported, got %v", err)
+	}
+
+	brokenUUID := saveTestFile(t, rs, &Resource{Name: "broken.png", APIKeyUUID: key.UUID}, "not a png")
+	broken, err := rs.GetResourceByUUID(brokenUUID)
+	if err != nil {
+		t.Fatalf("Error loading resource: %v", err)
+	}
+	if _, _, err := rs.OpenThumbnail(broken, 256); err != apperror.ErrThumbnailNotSupported {
+		t.Errorf("expected ErrThumbnailNotSupported, got %v", err)
+	}
+
+	// thumbnails are removed with the file
+	if err := rs.DeleteResourceByUUID(photoUUID, key.UUID); err != nil {
+		t.Fatalf("Error deleting resource: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, thumbnailDir, photoUUID)); !os.IsNotExist(err) {
+		t.Errorf("expected thumbnails to be removed, got %v", err)
+	}
+}
+
+// pngHeader returns the start of a PNG image with the given dimensions, enough to read its config
+func pngHeader(w uint32, h uint32) string {
+	ihdr := make([]byte, 17)
+	copy(ihdr, "IHDR")
+	binary.BigEndian.PutUint32(ihdr[4:], w)
+	binary.BigEndian.PutUint32(ihdr[8:], h)
+	ihdr[12] = 8 // bit depth
+	ihdr[13] = 6 // RGBA
+
+	var buf bytes.Buffer
+	buf.WriteString("\x89PNG\r\n\x1a\n")
+	_ = binary.Write(&buf, binary.BigEndian, uint32(13))
+	buf.Write(ihdr)
+	_ = binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(ihdr))
+	return buf.String()
+}
+
+func TestThumbnail_LimitsAndFailures(t *testing.T) {
+	dataDir := t.TempDir()
+	cfg := &config.Config{DataPath: dataDir, UploadPath: filepath.Join(dataDir, "upload")}
+	rs, key := initTrashTest(t, cfg)
+
+	hugeUUID := saveTestFile(t, rs, &Resource{Name: "huge.png", APIKeyUUID: key.UUID}, pngHeader(5000, 4000))
+	huge, err := rs.GetResourceByUUID(hugeUUID)
+	if err != nil {
+		t.Fatalf("Error loading resource: %v", err)
+	}
+	if _, _, err := rs.OpenThumbnail(huge, 256); err != apperror.ErrThumbnailNotSupported {
+		t.Errorf("expected ErrThumbnailNotSupported for a huge image, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, thumbnailDir, hugeUUID, thumbnailFailedPrefix+huge.SHA256)); err != nil {
+		t.Errorf("expected the failure to be cached: %v", err)
+	}
+
+	photoUUID := saveTestFile(t, rs, &Resource{Name: "photo.jpg", APIKeyUUID: key.UUID}, encodeTestImage(t, 300, 200, true))
+	photo, err := rs.GetResourceByUUID(photoUUID)
+	if err != nil {
+		t.Fatalf("Error loading resource: %v", err)
+	}
+
+	// all slots are busy: cached failures are answered at once, new thumbnails wait
+	for i := 0; i < maxConcurrentThumbnails; i++ {
+		rs.thumbnailSlots <- struct{}{}
+	}
+	if _, _, err := rs.OpenThumbnail(huge, 512); err != apperror.ErrThumbnailNotSupported {
+		t.Errorf("expected cached ErrThumbnailNotSupported, got %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		f, _, err := rs.OpenThumbnail(photo, 256)
+		if err == nil {
+			f.Close()
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("expected generation to wait for a free slot, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	<-rs.thumbnailSlots
+	if err := <-done; err != nil {
+		t.Errorf("Error generating thumbnail: %v", err)
+	}
+}
+
+func TestThumbnail_Orientation(t *testing.T) {
+	// 2x1 image: red, blue
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	red := color.RGBA{R: 255, A: 255}
+	blue := color.RGBA{B: 255, A: 255}
+	src.Set(0, 0, red)
+	src.Set(1, 0, blue)
+
+	rotated := orient(src, 6)
+	if b := rotated.Bounds(); b.Dx() != 1 || b.Dy() != 2 {
+		t.Fatalf("expected 1x2 image, got %v", b)
+	}
+	if rotated.At(0, 0) != red || rotated.At(0, 1) != blue {
+		t.Errorf("unexpected pixels after rotating 90°")
+	}
+
+	mirrored := orient(src, 2)
+	if mirrored.At(0, 0) != blue || mirrored.At(1, 0) != red {
+		t.Errorf("unexpected pixels after mirroring")
+	}
+
+	// APP1 segment with a TIFF header and one IFD entry for the orientation
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01")
+	entry := make([]byte, 12)
+	binary.BigEndian.PutUint16(entry[0:], 0x0112)
+	binary.BigEndian.PutUint16(entry[2:], 3)
+	binary.BigEndian.PutUint32(entry[4:], 1)
+	binary.BigEndian.PutUint16(entry[8:], 6)
+	tiff = append(tiff, entry...)
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+
+	jpg := []byte{0xFF, 0xD8, 0xFF, 0xE1}
+	jpg = binary.BigEndian.AppendUint16(jpg, uint16(len(payload)+2))
+	jpg = append(jpg, payload...)
+	jpg = append(jpg, 0xFF, 0xDA)
+
+	if o := jpegOrientation(jpg); o != 6 {
+		t.Errorf("expected orientation 6, got %d", o)
+	}
+	if o := jpegOrientation([]byte{0xFF, 0xD8, 0xFF, 0xDA}); o != 1 {
+		t.Errorf("expected orientation 1 without EXIF, got %d", o)
+	}
+}
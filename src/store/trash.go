@@ -0,0 +1,201 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/twigman/fshare/src/internal/apperror"
+)
+
+// trashResource moves a resource into the trash. Its blob stays referenced until the trash is purged.
+func (s *ResourceService) trashResource(r *Resource, t time.Time) error {
+	if r.IsFile && r.BlobSHA256 == nil {
+		// stored by an older version under its name, which may be taken by another file until it is restored
+		return s.deleteResource(r, t)
+	}
+
+	if err := s.db.moveResourceToTrash(r.UUID, t); err != nil {
+		return err
+	}
+	r.DeletedAt = &t
+	r.InTrash = true
+
+	// regenerated on request after a restore
+	s.removeThumbnails(r.UUID)
+	return nil
+}
+
+// trashChildren moves all resources below a folder into the trash recursively.
+// They share the deletion time of the folder, so they are restored together with it.
+func (s *ResourceService) trashChildren(parentUUID string, t time.Time) error {
+	children, err := s.db.findActiveChildren(parentUUID)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range children {
+		if !c.IsFile {
+			if err := s.trashChildren(c.UUID, t); err != nil {
+				return err
+			}
+		}
+
+		if err := s.trashResource(c, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PurgeResourceByUUID deletes a resource of the API key permanently, no matter if it is in the trash or not
+func (s *ResourceService) PurgeResourceByUUID(rUUID string, keyUUID string) error {
+	res, err := s.getDeletableResource(rUUID, keyUUID)
+	if err != nil {
+		return err
+	}
+
+	if res.DeletedAt == nil {
+		t := time.Now().UTC()
+		if !res.IsFile {
+			if err := s.markChildrenAsDeleted(res.UUID, t); err != nil {
+				return err
+			}
+		}
+		return s.deleteResource(res, t)
+	}
+
+	if !res.InTrash {
+		return apperror.ErrFileAlreadyDeleted
+	}
+	return s.purgeTrashedTree(res)
+}
+
+// purgeTrashedTree purges a resource in the trash together with its content in the trash
+func (s *ResourceService) purgeTrashedTree(r *Resource) error {
+	if !r.IsFile {
+		children, err := s.db.findTrashedChildren(r.UUID)
+		if err != nil {
+			return err
+		}
+		for _, c := range children {
+			if err := s.purgeTrashedTree(c); err != nil {
+				return err
+			}
+		}
+	}
+	return s.purgeTrashedResource(r)
+}
+
+// purgeTrashedResource removes a resource from the trash and unlinks its blob if no other resource references it
+func (s *ResourceService) purgeTrashedResource(r *Resource) error {
+	s.blobMu.Lock()
+	defer s.blobMu.Unlock()
+
+	unreferenced, err := s.db.purgeTrashedResource(r.UUID)
+	if err != nil {
+		return err
+	}
+	r.InTrash = false
+	s.removeThumbnails(r.UUID)
+
+	return s.removeBlobs(unreferenced)
+}
+
+// RestoreResource moves a resource of the API key out of the trash and returns it. A folder is restored
+// with the content that was deleted together with it. If its folder is gone, the resource is restored into the home dir.
+// Name conflicts are resolved by prefixing a number, like uploads with rename.
+func (s *ResourceService) RestoreResource(rUUID string, keyUUID string) (*Resource, error) {
+	res, err := s.GetResourceByUUID(rUUID)
+	if err != nil {
+		return nil, err
+	}
+	if res.APIKeyUUID != keyUUID {
+		return nil, apperror.ErrAuthorization
+	}
+	if res.DeletedAt == nil {
+		return nil, apperror.ErrResourceNotInTrash
+	}
+	if !res.InTrash {
+		// purged
+		return nil, apperror.ErrResourceNotFound
+	}
+
+	resources := []*Resource{res}
+	if !res.IsFile {
+		if resources, err = s.collectTrashedContent(res.UUID, *res.DeletedAt, resources); err != nil {
+			return nil, err
+		}
+	}
+
+	if res.ParentUUID != nil {
+		p, err := s.db.findResourceByUUID(*res.ParentUUID)
+		if err != nil {
+			return nil, err
+		}
+		if p == nil || p.DeletedAt != nil || p.IsBroken {
+			res.ParentUUID = nil
+		}
+	}
+
+	s.quotaMu.Lock()
+	defer s.quotaMu.Unlock()
+
+	// also renames a resource restored into the home dir that is named like the home dir
+	if err := s.resolveResourceName(res, true); err != nil {
+		return nil, err
+	}
+	// no quota check, trashed files and their versions count towards the quota until they are purged
+
+	if err := s.db.restoreResources(resources); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, apperror.ErrResourceNotFound
+		}
+		return nil, err
+	}
+
+	res.DeletedAt = nil
+	res.InTrash = false
+	return res, nil
+}
+
+// collectTrashedContent appends all resources below a folder that were deleted together with it
+func (s *ResourceService) collectTrashedContent(parentUUID string, deletedAt time.Time, resources []*Resource) ([]*Resource, error) {
+	children, err := s.db.findTrashedChildren(parentUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range children {
+		if c.DeletedAt == nil || !c.DeletedAt.Equal(deletedAt) {
+			// deleted on its own before the folder
+			continue
+		}
+		resources = append(resources, c)
+		if !c.IsFile {
+			if resources, err = s.collectTrashedContent(c.UUID, deletedAt, resources); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return resources, nil
+}
+
+// purgeExpiredTrash permanently deletes resources whose trash retention or TTL ended
+func (s *ResourceService) purgeExpiredTrash() error {
+	now := time.Now().UTC()
+
+	resources, err := s.db.findResourcesForPurge(now.Add(-s.cfg.TrashRetention()), now)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range resources {
+		if err := s.purgeTrashedResource(r); err != nil {
+			log.Printf("Failed to purge %s: %v", r.UUID, err)
+			continue
+		}
+	}
+	return nil
+}
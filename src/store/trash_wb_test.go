@@ -0,0 +1,285 @@
+package store
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/twigman/fshare/src/config"
+	"github.com/twigman/fshare/src/internal/apperror"
+)
+
+func initTrashTest(t *testing.T, cfg *config.Config) (*ResourceService, *APIKey) {
+	t.Helper()
+	rs, key, err := initServices(cfg)
+	if err != nil {
+		t.Fatalf("Error initializing test services: %v", err)
+	}
+	if err := CreateDirsFromConfig(cfg); err != nil {
+		t.Fatalf("Error creating app dirs: %v", err)
+	}
+	if _, err := rs.GetOrCreateHomeDir(key.HashedKey); err != nil {
+		t.Fatalf("Error creating home dir: %v", err)
+	}
+	return rs, key
+}
+
+func saveTestFile(t *testing.T, rs *ResourceService, r *Resource, content string) string {
+	t.Helper()
+	u, err := rs.SaveUploadedFile(bytes.NewReader([]byte(content)), r, false)
+	if err != nil {
+		t.Fatalf("Error saving file: %v", err)
+	}
+	return u
+}
+
+func TestTrash_RestoreFile(t *testing.T) {
+	dataDir := t.TempDir()
+	cfg := &config.Config{DataPath: dataDir, UploadPath: filepath.Join(dataDir, "upload")}
+	rs, key := initTrashTest(t, cfg)
+
+	fileUUID := saveTestFile(t, rs, &Resource{Name: "a.txt", APIKeyUUID: key.UUID}, "first")
+
+	if _, err := rs.RestoreResource(fileUUID, key.UUID); err != apperror.ErrResourceNotInTrash {
+		t.Errorf("expected ErrResourceNotInTrash, got %v", err)
+	}
+	if err := rs.DeleteResourceByUUID(fileUUID, key.UUID); err != nil {
+		t.Fatalf("Error deleting file: %v", err)
+	}
+	if _, err := rs.RestoreResource(fileUUID, "other"); err != apperror.ErrAuthorization {
+		t.Errorf("expected ErrAuthorization, got %v", err)
+	}
+
+	// the name is free while the file is in the trash
+	otherUUID := saveTestFile(t, rs, &Resource{Name: "a.txt", APIKeyUUID: key.UUID}, "second")
+
+	res, err := rs.RestoreResource(fileUUID, key.UUID)
+	if err != nil {
+		t.Fatalf("Error restoring file: %v", err)
+	}
+	if res.Name != "0a.txt" || res.DeletedAt != nil || res.InTrash {
+		t.Errorf("unexpected restored resource: %+v", res)
+	}
+
+	stored, err := rs.GetResourceByUUID(fileUUID)
+	if err != nil {
+		t.Fatalf("Error loading resource: %v", err)
+	}
+	if stored.Name != "0a.txt" || stored.DeletedAt != nil || stored.InTrash {
+		t.Errorf("restore not saved: %+v", stored)
+	}
+	obj, err := rs.OpenResource(stored)
+	if err != nil {
+		t.Fatalf("Error opening restored file: %v", err)
+	}
+	obj.Close()
+
+	// purged files are gone for good
+	if err := rs.DeleteResourceByUUID(otherUUID, key.UUID); err != nil {
+		t.Fatalf("Error deleting file: %v", err)
+	}
+	if err := rs.PurgeResourceByUUID(otherUUID, key.UUID); err != nil {
+		t.Fatalf("Error purging file: %v", err)
+	}
+	if _, err := rs.RestoreResource(otherUUID, key.UUID); err != apperror.ErrResourceNotFound {
+		t.Errorf("expected ErrResourceNotFound, got %v", err)
+	}
+}
+
+func TestTrash_RestoreFolder(t *testing.T) {
+	dataDir := t.TempDir()
+	cfg := &config.Config{DataPath: dataDir, UploadPath: filepath.Join(dataDir, "upload")}
+	rs, key := initTrashTest(t, cfg)
+
+	folderUUID, err := rs.CreateFolder(&Resource{Name: "project", APIKeyUUID: key.UUID})
+	if err != nil {
+		t.Fatalf("Error creating folder: %v", err)
+	}
+	subUUID, err := rs.CreateFolder(&Resource{Name: "sub", APIKeyUUID: key.UUID, ParentUUID: &folderUUID})
+	if err != nil {
+		t.Fatalf("Error creating folder: %v", err)
+	}
+	fileUUID := saveTestFile(t, rs, &Resource{Name: "a.txt", APIKeyUUID: key.UUID, ParentUUID: &subUUID}, "a")
+	earlierUUID := saveTestFile(t, rs, &Resource{Name: "b.txt", APIKeyUUID: key.UUID, ParentUUID: &folderUUID}, "b")
+
+	// deleted on its own before the folder
+	if err := rs.DeleteResourceByUUID(earlierUUID, key.UUID); err != nil {
+		t.Fatalf("Error deleting file: %v", err)
+	}
+	time.Sleep(time.Millisecond)
+	if err := rs.DeleteResourceByUUID(folderUUID, key.UUID); err != nil {
+		t.Fatalf("Error deleting folder: %v", err)
+	}
+
+	page, err := rs.ListResources(key.UUID, ListOptions{InTrash: true})
+	if err != nil {
+		t.Fatalf("Error listing trash: %v", err)
+	}
+	if len(page.Resources) != 4 {
+		t.Errorf("expected 4 resources in the trash, got %d", len(page.Resources))
+	}
+
+	if _, err := rs.RestoreResource(folderUUID, key.UUID); err != nil {
+		t.Fatalf("Error restoring folder: %v", err)
+	}
+	for _, u := range []string{folderUUID, subUUID, fileUUID} {
+		r, err := rs.GetResourceByUUID(u)
+		if err != nil {
+			t.Fatalf("Error loading resource: %v", err)
+		}
+		if r.DeletedAt != nil || r.InTrash {
+			t.Errorf("expected %s to be restored", r.Name)
+		}
+	}
+	earlier, err := rs.GetResourceByUUID(earlierUUID)
+	if err != nil {
+		t.Fatalf("Error loading resource: %v", err)
+	}
+	if !earlier.InTrash {
+		t.Errorf("expected file deleted before the folder to stay in the trash")
+	}
+
+	// restored into its folder, which exists again
+	res, err := rs.RestoreResource(earlierUUID, key.UUID)
+	if err != nil {
+		t.Fatalf("Error restoring file: %v", err)
+	}
+	if res.ParentUUID == nil || *res.ParentUUID != folderUUID {
+		t.Errorf("expected file to be restored into its folder, got %v", res.ParentUUID)
+	}
+
+	// a file whose folder is still in the trash goes into the home dir
+	if err := rs.DeleteResourceByUUID(subUUID, key.UUID); err != nil {
+		t.Fatalf("Error deleting folder: %v", err)
+	}
+	res, err = rs.RestoreResource(fileUUID, key.UUID)
+	if err != nil {
+		t.Fatalf("Error restoring file: %v", err)
+	}
+	if res.ParentUUID != nil {
+		t.Errorf("expected file to be restored into the home dir, got %v", *res.ParentUUID)
+	}
+}
+
+func TestTrash_SpaceLimit(t *testing.T) {
+	dataDir := t.TempDir()
+	cfg := &config.Config{DataPath: dataDir, UploadPath: filepath.Join(dataDir, "upload"), SpacePerUserInMB: 1}
+	rs, key := initTrashTest(t, cfg)
+
+	big := string(bytes.Repeat([]byte("x"), 700<<10))
+	fileUUID := saveTestFile(t, rs, &Resource{Name: "a.bin", APIKeyUUID: key.UUID}, big)
+	if err := rs.DeleteResourceByUUID(fileUUID, key.UUID); err != nil {
+		t.Fatalf("Error deleting file: %v", err)
+	}
+
+	// trashed files keep their content and count until they are purged
+	if used, err := rs.GetUsedSpace(key.UUID); err != nil || used != int64(len(big)) {
+		t.Errorf("expected %d bytes used, got %d (%v)", len(big), used, err)
+	}
+	if _, err := rs.SaveUploadedFile(bytes.NewReader([]byte(big+"y")), &Resource{Name: "b.bin", APIKeyUUID: key.UUID}, false); err != apperror.ErrInsufficientStorage {
+		t.Errorf("expected ErrInsufficientStorage, got %v", err)
+	}
+
+	// restoring does not change the used space
+	if _, err := rs.RestoreResource(fileUUID, key.UUID); err != nil {
+		t.Fatalf("Error restoring file: %v", err)
+	}
+	if err := rs.DeleteResourceByUUID(fileUUID, key.UUID); err != nil {
+		t.Fatalf("Error deleting file: %v", err)
+	}
+
+	if err := rs.PurgeResourceByUUID(fileUUID, key.UUID); err != nil {
+		t.Fatalf("Error purging file: %v", err)
+	}
+	if used, err := rs.GetUsedSpace(key.UUID); err != nil || used != 0 {
+		t.Errorf("expected no used space after the purge, got %d (%v)", used, err)
+	}
+	saveTestFile(t, rs, &Resource{Name: "b.bin", APIKeyUUID: key.UUID}, big+"y")
+}
+
+func TestTrash_PurgeExpired(t *testing.T) {
+	dataDir := t.TempDir()
+	cfg := &config.Config{DataPath: dataDir, UploadPath: filepath.Join(dataDir, "upload"), TrashRetentionInHours: 1}
+	rs, key := initTrashTest(t, cfg)
+
+	oldUUID := saveTestFile(t, rs, &Resource{Name: "old.txt", APIKeyUUID: key.UUID}, "old")
+	recentUUID := saveTestFile(t, rs, &Resource{Name: "recent.txt", APIKeyUUID: key.UUID}, "recent")
+	ttlUUID := saveTestFile(t, rs, &Resource{Name: "ttl.txt", APIKeyUUID: key.UUID}, "ttl")
+	for _, u := range []string{oldUUID, recentUUID, ttlUUID} {
+		if err := rs.DeleteResourceByUUID(u, key.UUID); err != nil {
+			t.Fatalf("Error deleting file: %v", err)
+		}
+	}
+
+	old, err := rs.GetResourceByUUID(oldUUID)
+	if err != nil {
+		t.Fatalf("Error loading resource: %v", err)
+	}
+	path, err := rs.BuildResourcePath(old)
+	if err != nil {
+		t.Fatalf("Error building path: %v", err)
+	}
+	deletedAt := time.Now().UTC().Add(-2 * time.Hour)
+	old.DeletedAt = &deletedAt
+	if err := rs.db.updateResource(old); err != nil {
+		t.Fatalf("Error updating resource: %v", err)
+	}
+	ttl, err := rs.GetResourceByUUID(ttlUUID)
+	if err != nil {
+		t.Fatalf("Error loading resource: %v", err)
+	}
+	past := time.Now().UTC().Add(-time.Minute)
+	ttl.AutoDeleteAt = &past
+	if err := rs.db.updateResource(ttl); err != nil {
+		t.Fatalf("Error updating resource: %v", err)
+	}
+
+	if err := rs.purgeExpiredTrash(); err != nil {
+		t.Fatalf("Error purging trash: %v", err)
+	}
+
+	for u, wantInTrash := range map[string]bool{oldUUID: false, recentUUID: true, ttlUUID: false} {
+		r, err := rs.GetResourceByUUID(u)
+		if err != nil {
+			t.Fatalf("Error loading resource: %v", err)
+		}
+		if r.InTrash != wantInTrash {
+			t.Errorf("%s: expected in trash = %v, got %v", r.Name, wantInTrash, r.InTrash)
+		}
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected content of purged file to be removed, got %v", err)
+	}
+}
+
+func TestTrash_DeleteAllResourcesPurgesTrash(t *testing.T) {
+	dataDir := t.TempDir()
+	cfg := &config.Config{DataPath: dataDir, UploadPath: filepath.Join(dataDir, "upload")}
+	rs, key := initTrashTest(t, cfg)
+
+	fileUUID := saveTestFile(t, rs, &Resource{Name: "a.txt", APIKeyUUID: key.UUID}, "trashed")
+	if err := rs.DeleteResourceByUUID(fileUUID, key.UUID); err != nil {
+		t.Fatalf("Error deleting file: %v", err)
+	}
+	r, err := rs.GetResourceByUUID(fileUUID)
+	if err != nil {
+		t.Fatalf("Error loading resource: %v", err)
+	}
+
+	if err := rs.DeleteAllResources(key.UUID); err != nil {
+		t.Fatalf("Error deleting resources: %v", err)
+	}
+
+	if count, _ := rs.db.findBlobRefCount(*r.BlobSHA256); count != 0 {
+		t.Errorf("expected no references, got %d", count)
+	}
+	r, err = rs.GetResourceByUUID(fileUUID)
+	if err != nil {
+		t.Fatalf("Error loading resource: %v", err)
+	}
+	if r.InTrash {
+		t.Errorf("expected trash to be purged")
+	}
+}
@@ -3,16 +3,70 @@ package store
 import "time"
 
 type Resource struct {
-	UUID         string
-	Name         string
-	IsPrivate    bool
-	IsFile       bool
-	ParentUUID   *string
-	APIKeyUUID   string
-	AutoDeleteAt *time.Time
+	UUID          string
+	Name          string
+	IsPrivate     bool
+	IsFile        bool
+	ParentUUID    *string
+	APIKeyUUID    string
+	AutoDeleteAt  *time.Time
+	CreatedAt     time.Time
+	DeletedAt     *time.Time
+	IsBroken      bool
+	Size          int64
+	SHA256        string  // hex encoded, empty if unknown
+	BlobSHA256    *string // blob holding the content, nil for folders and files stored before the blob store
+	PasswordHash  *string // share password of a public file, see utils.HashPassword
+	MaxDownloads  *int64  // nil = unlimited, the file is removed once DownloadCount reaches it
+	DownloadCount int64
+	InTrash       bool // deleted but restorable, the blob is kept until the trash is purged
+	Version       int64
+	UpdatedAt     *time.Time // when the current version was saved, nil = CreatedAt
+}
+
+// Blob is stored content, shared by all files and versions with the same SHA-256
+type Blob struct {
+	SHA256 string
+	Size   int64
+}
+
+// ResourceVersion is an older content of a file that was replaced by a re-upload with versioning
+type ResourceVersion struct {
+	ResourceUUID string
+	Version      int64
+	SHA256       string // blob holding the content
+	Size         int64
 	CreatedAt    time.Time
-	DeletedAt    *time.Time
-	IsBroken     bool
+}
+
+// DownloadLimitReached reports whether a file may not be viewed or downloaded anymore
+func (r *Resource) DownloadLimitReached() bool {
+	return r.MaxDownloads != nil && r.DownloadCount >= *r.MaxDownloads
+}
+
+// Share is an additional link to a file with its own label, expiry, password and download limit.
+// It can be revoked without touching the file or other shares.
+type Share struct {
+	Token         string
+	ResourceUUID  string
+	Label         string
+	PasswordHash  *string // see utils.HashPassword
+	MaxDownloads  *int64  // nil = unlimited
+	DownloadCount int64
+	ExpiresAt     *time.Time
+	CreatedAt     time.Time
+	RevokedAt     *time.Time
+}
+
+// IsActive reports whether the share is neither revoked, expired nor used up
+func (sh *Share) IsActive(now time.Time) bool {
+	if sh.RevokedAt != nil {
+		return false
+	}
+	if sh.ExpiresAt != nil && !now.Before(*sh.ExpiresAt) {
+		return false
+	}
+	return sh.MaxDownloads == nil || sh.DownloadCount < *sh.MaxDownloads
 }
 
 type APIKey struct {
@@ -22,4 +76,71 @@ type APIKey struct {
 	IsHighlyTrusted bool
 	CreatedAt       time.Time
 	CreatedBy       *string
+	SpaceLimitInMB  *int64 // nil = config default, 0 = no limit
+	ExpiresAt       *time.Time
+	RevokedAt       *time.Time
+	MaxVersions     *int64 // nil = config default, 0 = no limit
+}
+
+// IsActive reports whether the key is neither revoked nor expired
+func (k *APIKey) IsActive(now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
+
+// ListOptions controls filtering, sorting and pagination of resource listings
+type ListOptions struct {
+	Limit          int
+	Cursor         string
+	SortBy         string // "created_at" (default), "name" or "size"
+	Descending     bool
+	NamePrefix     string
+	IncludeDeleted bool
+	InTrash        bool // only deleted resources that can still be restored
+}
+
+// RevokePolicy defines what happens to the resources of a revoked API key
+type RevokePolicy string
+
+const (
+	RevokePolicyKeep     RevokePolicy = "keep"
+	RevokePolicyTransfer RevokePolicy = "transfer"
+	RevokePolicyDelete   RevokePolicy = "delete"
+)
+
+// ResourceUpdate holds the settings to change on an existing resource; nil fields are kept
+type ResourceUpdate struct {
+	Name         *string
+	IsPrivate    *bool
+	AutoDeleteIn *time.Duration // new TTL counted from now, 0 removes the TTL
+}
+
+type ResourcePage struct {
+	Resources  []*Resource
+	NextCursor string
+}
+
+// UploadSession is a resumable upload that is staged in the home dir of its API key until all bytes arrived
+type UploadSession struct {
+	ID              string
+	APIKeyUUID      string
+	Name            string
+	IsPrivate       bool
+	ParentUUID      *string
+	AutoDeleteInSec *int64 // TTL of the resource, starts when the upload is finalized
+	Length          int64
+	Offset          int64
+	Metadata        string  // Upload-Metadata as sent by the client
+	ResourceUUID    *string // set once the upload is finalized
+	MaxDownloads    *int64
+	Versioning      bool // replace the content of an existing file with the same name, see SaveStagedFileAsVersion
+	CreatedAt       time.Time
+	ExpiresAt       time.Time
+}
+
+// IsCompleted reports whether the upload was finalized into a resource
+func (u *UploadSession) IsCompleted() bool {
+	return u.ResourceUUID != nil
 }
@@ -0,0 +1,292 @@
+package store
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/twigman/fshare/src/internal/apperror"
+)
+
+// uploadStagingDir is the dir inside a home dir holding unfinished resumable uploads.
+// Resource names must not start with a dot, so it never collides with a resource.
+const uploadStagingDir = ".uploads"
+
+// uploadStagingPath returns the path of the staged data of a resumable upload
+func (s *ResourceService) uploadStagingPath(u *UploadSession) (string, error) {
+	if u.ID == "" || strings.ContainsAny(u.ID, "./\\") || u.APIKeyUUID == "" || strings.ContainsAny(u.APIKeyUUID, "./\\") {
+		return "", apperror.ErrFileInvalidFilepath
+	}
+	return filepath.Join(s.cfg.UploadPath, u.APIKeyUUID, uploadStagingDir, u.ID), nil
+}
+
+// CreateUploadSession validates the target of a resumable upload and creates its empty staging file
+func (s *ResourceService) CreateUploadSession(u *UploadSession) error {
+	if u.Length < 0 {
+		return apperror.ErrFileTooLarge
+	}
+	if s.cfg.IsUploadLimited() && u.Length > s.cfg.MaxFileSizeBytes() {
+		return apperror.ErrFileTooLarge
+	}
+
+	// same checks as for the final resource
+	r := &Resource{Name: u.Name, ParentUUID: u.ParentUUID, APIKeyUUID: u.APIKeyUUID, IsFile: true}
+	if err := validateResourceName(r.Name); err != nil {
+		return err
+	}
+	if u.MaxDownloads != nil && *u.MaxDownloads <= 0 {
+		return apperror.ErrInvalidMaxDownloads
+	}
+	r.Name = filepath.Base(strings.TrimSpace(r.Name))
+	if _, err := s.prepareParent(r); err != nil {
+		return err
+	}
+	if err := s.checkSpace(u.APIKeyUUID, u.Length); err != nil {
+		return err
+	}
+	u.Name = r.Name
+	u.ParentUUID = r.ParentUUID
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return fmt.Errorf("UUID generation error: %v", err)
+	}
+	u.ID = id.String()
+	u.Offset = 0
+	u.ResourceUUID = nil
+	u.CreatedAt = time.Now().UTC()
+	u.ExpiresAt = u.CreatedAt.Add(s.cfg.UploadExpiry())
+
+	path, err := s.uploadStagingPath(u)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := s.db.insertUploadSession(u); err != nil {
+		os.Remove(path)
+		return err
+	}
+	return nil
+}
+
+// GetUploadSession returns the resumable upload with the given ID if it belongs to the API key
+func (s *ResourceService) GetUploadSession(id string, keyUUID string) (*UploadSession, error) {
+	u, err := s.db.findUploadSession(id)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil || u.APIKeyUUID != keyUUID {
+		return nil, apperror.ErrUploadNotFound
+	}
+	if !time.Now().UTC().Before(u.ExpiresAt) {
+		return nil, apperror.ErrUploadExpired
+	}
+	return u, nil
+}
+
+// lockUpload acquires the lock of a resumable upload of the API key without waiting and returns the session
+// reloaded with the lock held. Unknown, foreign and expired uploads are rejected before a lock is created.
+func (s *ResourceService) lockUpload(id string, keyUUID string) (*UploadSession, func(), error) {
+	if _, err := s.GetUploadSession(id, keyUUID); err != nil {
+		return nil, nil, err
+	}
+	unlock, err := s.acquireUploadLock(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	u, err := s.GetUploadSession(id, keyUUID)
+	if err != nil {
+		unlock()
+		return nil, nil, err
+	}
+	return u, unlock, nil
+}
+
+// acquireUploadLock locks an upload ID without waiting. The entry of the lock only exists while it is held,
+// so the map does not grow with uploads that are finished, rejected or never existed.
+func (s *ResourceService) acquireUploadLock(id string) (func(), error) {
+	for {
+		m, _ := s.uploadLocks.LoadOrStore(id, &sync.Mutex{})
+		mu := m.(*sync.Mutex)
+		if !mu.TryLock() {
+			return nil, apperror.ErrUploadLocked
+		}
+		// the previous holder may have released and removed this lock in the meantime
+		if cur, ok := s.uploadLocks.Load(id); !ok || cur != m {
+			mu.Unlock()
+			continue
+		}
+		return func() {
+			s.uploadLocks.Delete(id)
+			mu.Unlock()
+		}, nil
+	}
+}
+
+// AppendToUpload writes data at the given offset of a resumable upload.
+// Bytes received before an error are kept, so the client can resume from the new offset.
+// Once all bytes arrived, the upload is finalized into a resource.
+func (s *ResourceService) AppendToUpload(id string, keyUUID string, offset int64, data io.Reader) (*UploadSession, error) {
+	u, unlock, err := s.lockUpload(id, keyUUID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if u.IsCompleted() {
+		return nil, apperror.ErrUploadCompleted
+	}
+	if offset != u.Offset {
+		return nil, apperror.ErrUploadOffsetMismatch
+	}
+
+	path, err := s.uploadStagingPath(u)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// drop bytes of an earlier request that were written but never recorded
+	if err := f.Truncate(u.Offset); err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(u.Offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	n, copyErr := io.Copy(f, io.LimitReader(data, u.Length-u.Offset))
+	if copyErr == nil {
+		// more data than announced
+		var b [1]byte
+		if m, _ := data.Read(b[:]); m > 0 {
+			copyErr = apperror.ErrFileTooLarge
+		}
+	}
+	if err := f.Close(); err != nil && copyErr == nil {
+		copyErr = err
+	}
+
+	u.Offset += n
+	u.ExpiresAt = time.Now().UTC().Add(s.cfg.UploadExpiry())
+	if err := s.db.updateUploadSessionProgress(u.ID, u.Offset, u.ExpiresAt); err != nil {
+		return nil, err
+	}
+	if copyErr != nil {
+		return u, copyErr
+	}
+
+	if u.Offset == u.Length {
+		if err := s.finalizeUpload(u, path); err != nil {
+			return u, err
+		}
+	}
+	return u, nil
+}
+
+// finalizeUpload moves the staged data of a completed upload into the blob store and creates the resource.
+// If that fails, the upload is removed, since the client can not resume it anyway.
+func (s *ResourceService) finalizeUpload(u *UploadSession, path string) error {
+	fail := func(err error) error {
+		if err2 := s.removeUpload(u); err2 != nil {
+			log.Printf("Could not remove failed upload %s: %v", u.ID, err2)
+		}
+		return err
+	}
+
+	r := &Resource{
+		Name:         u.Name,
+		IsPrivate:    u.IsPrivate,
+		ParentUUID:   u.ParentUUID,
+		APIKeyUUID:   u.APIKeyUUID,
+		MaxDownloads: u.MaxDownloads,
+	}
+	if u.AutoDeleteInSec != nil {
+		t := time.Now().Add(time.Duration(*u.AutoDeleteInSec) * time.Second).UTC()
+		r.AutoDeleteAt = &t
+	}
+
+	if err := s.prepareFile(r); err != nil {
+		return fail(err)
+	}
+
+	sum, size, err := hashFile(path)
+	if err != nil {
+		return fail(err)
+	}
+
+	var resourceUUID string
+	if u.Versioning {
+		resourceUUID, err = s.commitVersion(path, r, size, sum)
+	} else {
+		resourceUUID, err = s.commitFile(path, r, size, sum, true)
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	u.ResourceUUID = &resourceUUID
+	return s.db.updateUploadSessionResource(u.ID, resourceUUID)
+}
+
+// TerminateUpload cancels a resumable upload and removes its staged data
+func (s *ResourceService) TerminateUpload(id string, keyUUID string) error {
+	u, unlock, err := s.lockUpload(id, keyUUID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return s.removeUpload(u)
+}
+
+// removeUpload deletes staged data and DB entry of a resumable upload
+func (s *ResourceService) removeUpload(u *UploadSession) error {
+	path, err := s.uploadStagingPath(u)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return s.db.deleteUploadSession(u.ID)
+}
+
+func (s *ResourceService) cleanupExpiredUploads() error {
+	uploads, err := s.db.findExpiredUploadSessions(time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	for _, u := range uploads {
+		unlock, err := s.acquireUploadLock(u.ID)
+		if err != nil {
+			// in use, try again next time
+			continue
+		}
+		if err := s.removeUpload(u); err != nil {
+			log.Printf("Failed to remove expired upload %s: %v", u.ID, err)
+		}
+		unlock()
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/twigman/fshare/src/config"
+	"github.com/twigman/fshare/src/internal/apperror"
+)
+
+func TestCleanupExpiredUploads(t *testing.T) {
+	dataDir := t.TempDir()
+	cfg := &config.Config{
+		DataPath:   dataDir,
+		UploadPath: filepath.Join(dataDir, "upload"),
+	}
+
+	rs, key, err := initServices(cfg)
+	if err != nil {
+		t.Fatalf("Error initializing test services: %v", err)
+	}
+	if err := CreateDirsFromConfig(cfg); err != nil {
+		t.Fatalf("Error creating app dirs: %v", err)
+	}
+	if _, err := rs.GetOrCreateHomeDir(key.HashedKey); err != nil {
+		t.Fatalf("Error creating home dir: %v", err)
+	}
+
+	u := &UploadSession{APIKeyUUID: key.UUID, Name: "a.bin", Length: 4}
+	if err := rs.CreateUploadSession(u); err != nil {
+		t.Fatalf("Error creating upload: %v", err)
+	}
+	if _, err := rs.AppendToUpload(u.ID, key.UUID, 0, strings.NewReader("ab")); err != nil {
+		t.Fatalf("Error appending to upload: %v", err)
+	}
+
+	stagingPath := filepath.Join(cfg.UploadPath, key.UUID, uploadStagingDir, u.ID)
+	if _, err := os.Stat(stagingPath); err != nil {
+		t.Fatalf("Staged data missing: %v", err)
+	}
+
+	// not expired yet
+	if err := rs.cleanupExpiredUploads(); err != nil {
+		t.Fatalf("Error cleaning up uploads: %v", err)
+	}
+	if _, err := rs.GetUploadSession(u.ID, key.UUID); err != nil {
+		t.Fatalf("Upload removed before expiry: %v", err)
+	}
+
+	if err := rs.db.updateUploadSessionProgress(u.ID, 2, time.Now().UTC().Add(-time.Minute)); err != nil {
+		t.Fatalf("Error updating upload: %v", err)
+	}
+	if _, err := rs.GetUploadSession(u.ID, key.UUID); err != apperror.ErrUploadExpired {
+		t.Fatalf("Expected ErrUploadExpired, got %v", err)
+	}
+
+	if err := rs.cleanupExpiredUploads(); err != nil {
+		t.Fatalf("Error cleaning up uploads: %v", err)
+	}
+	if _, err := os.Stat(stagingPath); !os.IsNotExist(err) {
+		t.Errorf("Expected staged data to be removed, got %v", err)
+	}
+	if _, err := rs.GetUploadSession(u.ID, key.UUID); err != apperror.ErrUploadNotFound {
+		t.Errorf("Expected ErrUploadNotFound, got %v", err)
+	}
+}
+
+func TestAppendToUpload_QuotaExceededOnFinalize(t *testing.T) {
+	dataDir := t.TempDir()
+	cfg := &config.Config{
+		DataPath:         dataDir,
+		UploadPath:       filepath.Join(dataDir, "upload"),
+		SpacePerUserInMB: 1,
+	}
+
+	rs, key, err := initServices(cfg)
+	if err != nil {
+		t.Fatalf("Error initializing test services: %v", err)
+	}
+	if err := CreateDirsFromConfig(cfg); err != nil {
+		t.Fatalf("Error creating app dirs: %v", err)
+	}
+	if _, err := rs.GetOrCreateHomeDir(key.HashedKey); err != nil {
+		t.Fatalf("Error creating home dir: %v", err)
+	}
+
+	if err := rs.CreateUploadSession(&UploadSession{APIKeyUUID: key.UUID, Name: "big.bin", Length: 2 << 20}); err != apperror.ErrInsufficientStorage {
+		t.Fatalf("Expected ErrInsufficientStorage on creation, got %v", err)
+	}
+
+	u := &UploadSession{APIKeyUUID: key.UUID, Name: "a.bin", Length: 3}
+	if err := rs.CreateUploadSession(u); err != nil {
+		t.Fatalf("Error creating upload: %v", err)
+	}
+
+	// fill the quota in the meantime
+	if err := rs.db.insertResource(&Resource{UUID: "filler", Name: "filler", IsFile: true, APIKeyUUID: key.UUID, Size: 1 << 20}); err != nil {
+		t.Fatalf("Error inserting resource: %v", err)
+	}
+
+	if _, err := rs.AppendToUpload(u.ID, key.UUID, 0, strings.NewReader("abc")); err != apperror.ErrInsufficientStorage {
+		t.Fatalf("Expected ErrInsufficientStorage on finalize, got %v", err)
+	}
+	if _, err := rs.GetUploadSession(u.ID, key.UUID); err != apperror.ErrUploadNotFound {
+		t.Errorf("Expected failed upload to be removed, got %v", err)
+	}
+}
+
+func TestUploadLocks_Released(t *testing.T) {
+	dataDir := t.TempDir()
+	cfg := &config.Config{DataPath: dataDir, UploadPath: filepath.Join(dataDir, "upload")}
+	rs, key := initTrashTest(t, cfg)
+
+	countLocks := func() int {
+		n := 0
+		rs.uploadLocks.Range(func(_, _ any) bool {
+			n++
+			return true
+		})
+		return n
+	}
+
+	u := &UploadSession{APIKeyUUID: key.UUID, Name: "a.bin", Length: 4}
+	if err := rs.CreateUploadSession(u); err != nil {
+		t.Fatalf("Error creating upload: %v", err)
+	}
+
+	// unknown and foreign IDs never create a lock
+	for i := range 100 {
+		if _, err := rs.AppendToUpload(fmt.Sprintf("unknown-%d", i), key.UUID, 0, strings.NewReader("x")); err != apperror.ErrUploadNotFound {
+			t.Fatalf("Expected ErrUploadNotFound, got %v", err)
+		}
+	}
+	if _, err := rs.AppendToUpload(u.ID, "other-key", 0, strings.NewReader("x")); err != apperror.ErrUploadNotFound {
+		t.Fatalf("Expected ErrUploadNotFound, got %v", err)
+	}
+	if n := countLocks(); n != 0 {
+		t.Fatalf("Expected no locks, got %d", n)
+	}
+
+	// a held lock rejects concurrent writes
+	unlock, err := rs.acquireUploadLock(u.ID)
+	if err != nil {
+		t.Fatalf("Error locking upload: %v", err)
+	}
+	if _, err := rs.AppendToUpload(u.ID, key.UUID, 0, strings.NewReader("ab")); err != apperror.ErrUploadLocked {
+		t.Fatalf("Expected ErrUploadLocked, got %v", err)
+	}
+	unlock()
+
+	if _, err := rs.AppendToUpload(u.ID, key.UUID, 0, strings.NewReader("ab")); err != nil {
+		t.Fatalf("Error appending to upload: %v", err)
+	}
+	if _, err := rs.AppendToUpload(u.ID, key.UUID, 1, strings.NewReader("b")); err != apperror.ErrUploadOffsetMismatch {
+		t.Fatalf("Expected ErrUploadOffsetMismatch, got %v", err)
+	}
+	finished, err := rs.AppendToUpload(u.ID, key.UUID, 2, strings.NewReader("cd"))
+	if err != nil || !finished.IsCompleted() {
+		t.Fatalf("Expected finalized upload, got %+v, %v", finished, err)
+	}
+	if _, err := rs.AppendToUpload(u.ID, key.UUID, 4, strings.NewReader("e")); err != apperror.ErrUploadCompleted {
+		t.Fatalf("Expected ErrUploadCompleted, got %v", err)
+	}
+	if n := countLocks(); n != 0 {
+		t.Errorf("Expected locks to be released, got %d", n)
+	}
+}
@@ -0,0 +1,176 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/twigman/fshare/src/storage"
+)
+
+// errValidationStopped aborts a validation pass on shutdown
+var errValidationStopped = errors.New("validation stopped")
+
+// ValidationReport is the result of a validation pass over all blobs
+type ValidationReport struct {
+	StartedAt       time.Time
+	FinishedAt      time.Time
+	CheckedBlobs    int
+	CheckedBytes    int64
+	MissingBlobs    []string // hashes of blobs that do not exist in the storage backend
+	CorruptBlobs    []string // hashes of blobs whose content does not match their hash
+	BrokenResources []string // UUIDs of files marked as broken in this pass
+}
+
+// StartValidationWorker re-hashes all stored files in a loop and marks files with missing or changed content as broken.
+// bytesPerSec limits the read rate, so the validation does not slow down downloads.
+func (s *ResourceService) StartValidationWorker(interval time.Duration, bytesPerSec int64, stopCh <-chan struct{}) {
+	for {
+		report, err := s.ValidateBlobs(bytesPerSec, stopCh)
+		if err == errValidationStopped {
+			log.Println("Validation worker stopped")
+			return
+		}
+		if err != nil {
+			log.Printf("Error validating files: %v", err)
+		} else {
+			log.Printf("File validation checked %d blobs (%d bytes) in %s: %d missing, %d corrupt, %d files marked as broken",
+				report.CheckedBlobs, report.CheckedBytes, report.FinishedAt.Sub(report.StartedAt).Round(time.Second),
+				len(report.MissingBlobs), len(report.CorruptBlobs), len(report.BrokenResources))
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-stopCh:
+			log.Println("Validation worker stopped")
+			return
+		}
+	}
+}
+
+// ValidateBlobs re-hashes all referenced blobs once. Files whose blob is missing or does not match its hash
+// are marked as broken. bytesPerSec limits the read rate (0 = no limit), stopCh aborts the pass.
+func (s *ResourceService) ValidateBlobs(bytesPerSec int64, stopCh <-chan struct{}) (*ValidationReport, error) {
+	report := &ValidationReport{StartedAt: time.Now().UTC()}
+
+	blobs, err := s.db.findBlobs()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, b := range blobs {
+		size, ok, err := s.validateBlob(b.SHA256, bytesPerSec, stopCh)
+		if err == errValidationStopped {
+			return nil, err
+		}
+		if err == storage.ErrNotExist {
+			// the last file referencing it may have been deleted meanwhile
+			count, err := s.db.findBlobRefCount(b.SHA256)
+			if err != nil {
+				return nil, err
+			}
+			if count == 0 {
+				continue
+			}
+		}
+		report.CheckedBlobs++
+		report.CheckedBytes += size
+
+		switch {
+		case err == storage.ErrNotExist:
+			log.Printf("File validation: blob %s is missing", b.SHA256)
+			report.MissingBlobs = append(report.MissingBlobs, b.SHA256)
+		case err != nil:
+			// e.g. a remote storage that is not reachable, try again in the next pass
+			log.Printf("File validation: could not read blob %s: %v", b.SHA256, err)
+			continue
+		case !ok:
+			log.Printf("File validation: content of blob %s does not match its hash", b.SHA256)
+			report.CorruptBlobs = append(report.CorruptBlobs, b.SHA256)
+		default:
+			continue
+		}
+
+		broken, err := s.markBlobFilesAsBroken(b.SHA256)
+		if err != nil {
+			return nil, err
+		}
+		report.BrokenResources = append(report.BrokenResources, broken...)
+	}
+
+	report.FinishedAt = time.Now().UTC()
+	return report, nil
+}
+
+// validateBlob hashes the content of a blob and reports whether it matches the hash
+func (s *ResourceService) validateBlob(sum string, bytesPerSec int64, stopCh <-chan struct{}) (int64, bool, error) {
+	key, err := blobKey(sum)
+	if err != nil {
+		return 0, false, err
+	}
+	obj, err := storage.Open(s.storage, key)
+	if err != nil {
+		return 0, false, err
+	}
+	defer obj.Close()
+
+	hash := sha256.New()
+	size, err := copyThrottled(hash, obj, bytesPerSec, stopCh)
+	if err != nil {
+		return size, false, err
+	}
+	return size, hex.EncodeToString(hash.Sum(nil)) == sum, nil
+}
+
+// validationChunkSize is the amount of data read between two checks of the read rate
+const validationChunkSize = 256 << 10
+
+// copyThrottled copies src to dst with at most bytesPerSec (0 = no limit) and stops early if stopCh is closed
+func copyThrottled(dst io.Writer, src io.Reader, bytesPerSec int64, stopCh <-chan struct{}) (int64, error) {
+	start := time.Now()
+	var total int64
+	for {
+		n, err := io.CopyN(dst, src, validationChunkSize)
+		total += n
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+
+		var wait time.Duration
+		if bytesPerSec > 0 {
+			wait = time.Duration(float64(total)/float64(bytesPerSec)*float64(time.Second)) - time.Since(start)
+		}
+		if wait <= 0 {
+			select {
+			case <-stopCh:
+				return total, errValidationStopped
+			default:
+				continue
+			}
+		}
+		select {
+		case <-time.After(wait):
+		case <-stopCh:
+			return total, errValidationStopped
+		}
+	}
+}
+
+// markBlobFilesAsBroken marks all undeleted files with the content of the blob as broken and returns their UUIDs
+func (s *ResourceService) markBlobFilesAsBroken(sum string) ([]string, error) {
+	broken, err := s.db.markBlobFilesAsBroken(sum)
+	if err != nil {
+		return nil, fmt.Errorf("could not mark files of blob %s as broken: %v", sum, err)
+	}
+	for _, u := range broken {
+		log.Printf("File validation: marked file %s as broken", u)
+	}
+	return broken, nil
+}
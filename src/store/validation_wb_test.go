@@ -0,0 +1,83 @@
+package store
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/twigman/fshare/src/config"
+)
+
+func TestValidateBlobs(t *testing.T) {
+	dataDir := t.TempDir()
+	cfg := &config.Config{DataPath: dataDir, UploadPath: filepath.Join(dataDir, "upload")}
+	rs, key := initTrashTest(t, cfg)
+
+	okUUID := saveTestFile(t, rs, &Resource{Name: "ok.txt", APIKeyUUID: key.UUID}, "intact")
+	corruptUUID := saveTestFile(t, rs, &Resource{Name: "corrupt.txt", APIKeyUUID: key.UUID}, "will change")
+	missingUUID := saveTestFile(t, rs, &Resource{Name: "missing.txt", APIKeyUUID: key.UUID}, "will vanish")
+
+	blobPath := func(rUUID string) string {
+		t.Helper()
+		r, err := rs.GetResourceByUUID(rUUID)
+		if err != nil {
+			t.Fatalf("Error loading resource: %v", err)
+		}
+		p, err := rs.BuildResourcePath(r)
+		if err != nil {
+			t.Fatalf("Error building path: %v", err)
+		}
+		return p
+	}
+	if err := os.WriteFile(blobPath(corruptUUID), []byte("changed"), 0o600); err != nil {
+		t.Fatalf("Error changing blob: %v", err)
+	}
+	if err := os.Remove(blobPath(missingUUID)); err != nil {
+		t.Fatalf("Error removing blob: %v", err)
+	}
+
+	report, err := rs.ValidateBlobs(0, nil)
+	if err != nil {
+		t.Fatalf("Error validating blobs: %v", err)
+	}
+	if report.CheckedBlobs != 3 || len(report.CorruptBlobs) != 1 || len(report.MissingBlobs) != 1 || len(report.BrokenResources) != 2 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	for rUUID, broken := range map[string]bool{okUUID: false, corruptUUID: true, missingUUID: true} {
+		r, err := rs.GetResourceByUUID(rUUID)
+		if err != nil {
+			t.Fatalf("Error loading resource: %v", err)
+		}
+		if r.IsBroken != broken {
+			t.Errorf("expected is_broken %v for %s, got %v", broken, r.Name, r.IsBroken)
+		}
+	}
+
+	// files are only reported once
+	report, err = rs.ValidateBlobs(0, nil)
+	if err != nil {
+		t.Fatalf("Error validating blobs: %v", err)
+	}
+	if len(report.BrokenResources) != 0 {
+		t.Errorf("expected no newly broken files, got %v", report.BrokenResources)
+	}
+}
+
+func TestCopyThrottled(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 3*validationChunkSize)
+
+	var dst bytes.Buffer
+	n, err := copyThrottled(&dst, bytes.NewReader(data), 0, nil)
+	if err != nil || n != int64(len(data)) || !bytes.Equal(dst.Bytes(), data) {
+		t.Fatalf("unexpected copy: %d bytes, %v", n, err)
+	}
+
+	// a closed stop channel aborts a throttled copy
+	stopCh := make(chan struct{})
+	close(stopCh)
+	if _, err := copyThrottled(&dst, bytes.NewReader(data), 1, stopCh); err != errValidationStopped {
+		t.Errorf("expected errValidationStopped, got %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package fake
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// S3Server is an in-memory S3-compatible object storage supporting PUT (also with If-None-Match: *),
+// GET (with ranges), HEAD and DELETE of objects with path-style addressing
+type S3Server struct {
+	AccessKey string
+
+	mu       sync.Mutex
+	objects  map[string][]byte
+	requests map[string]int
+}
+
+func NewS3Server(accessKey string) *S3Server {
+	return &S3Server{AccessKey: accessKey, objects: make(map[string][]byte), requests: make(map[string]int)}
+}
+
+// Object returns the stored content of /<bucket>/<key>
+func (f *S3Server) Object(path string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.objects[path]
+	return data, ok
+}
+
+// ObjectCount returns the number of stored objects
+func (f *S3Server) ObjectCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.objects)
+}
+
+// RequestCount returns the number of handled requests with the given method
+func (f *S3Server) RequestCount(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[method]
+}
+
+func (f *S3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential="+f.AccessKey+"/") ||
+		r.Header.Get("x-amz-date") == "" || r.Header.Get("x-amz-content-sha256") == "" {
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests[r.Method]++
+
+	path := r.URL.Path
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.ContentLength != int64(len(data)) {
+			http.Error(w, "IncompleteBody", http.StatusBadRequest)
+			return
+		}
+		if _, ok := f.objects[path]; ok && r.Header.Get("If-None-Match") == "*" {
+			http.Error(w, "PreconditionFailed", http.StatusPreconditionFailed)
+			return
+		}
+		f.objects[path] = data
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet, http.MethodHead:
+		data, ok := f.objects[path]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+
+		if rng := r.Header.Get("Range"); rng != "" && r.Method == http.MethodGet {
+			var start, end int
+			if _, err := fmt.Sscanf(rng, "bytes=%d-%d", &start, &end); err != nil || start > end || start >= len(data) {
+				http.Error(w, "InvalidRange", http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			if end >= len(data) {
+				end = len(data) - 1
+			}
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+			w.Header().Set("Content-Length", strconv.Itoa(end-start+1))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(data[start : end+1])
+			return
+		}
+
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	case http.MethodDelete:
+		delete(f.objects, path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+	}
+}
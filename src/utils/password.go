@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// password hashes are stored as "argon2id$v=19$m=<memory in KiB>,t=<iterations>,p=<threads>$<salt>$<hash>"
+// with base64 encoded salt and hash. The parameters follow the OWASP recommendation for argon2id.
+const (
+	passwordHashScheme  = "argon2id"
+	passwordMemory      = 19 * 1024
+	passwordIterations  = 2
+	passwordThreads     = 1
+	passwordSaltLength  = 16
+	passwordKeyLength   = 32
+	maxArgon2MemoryKiB  = 256 * 1024
+	maxArgon2Iterations = 16
+)
+
+// HashPassword derives a salted hash of a password with argon2id
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, passwordSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, passwordIterations, passwordMemory, passwordThreads, passwordKeyLength)
+
+	return fmt.Sprintf("%s$v=%d$m=%d,t=%d,p=%d$%s$%s", passwordHashScheme, argon2.Version,
+		passwordMemory, passwordIterations, passwordThreads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// VerifyPassword checks a password against a hash created by HashPassword
+func VerifyPassword(hash string, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 5 || parts[0] != passwordHashScheme || parts[1] != fmt.Sprintf("v=%d", argon2.Version) {
+		return false
+	}
+
+	var memory, iterations uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[2], "m=%d,t=%d,p=%d", &memory, &iterations, &threads); err != nil {
+		return false
+	}
+	// a manipulated hash must not make the check arbitrarily expensive
+	if memory == 0 || memory > maxArgon2MemoryKiB || iterations == 0 || iterations > maxArgon2Iterations || threads == 0 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	expected, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil || len(expected) == 0 {
+		return false
+	}
+
+	key := argon2.IDKey([]byte(password), salt, iterations, memory, threads, uint32(len(expected)))
+	return subtle.ConstantTimeCompare(key, expected) == 1
+}